@@ -0,0 +1,31 @@
+package main
+
+import "strings"
+
+// alertRule returns a Prometheus alerting rule, as YAML to paste into
+// the rules of a group, that fires when the query text has results. The
+// name, duration, labels and annotations are placeholders to fill in.
+// Macros are expanded, since the server would not understand them.
+func alertRule(text string) string {
+	expr, err := expand(text)
+	if err != nil {
+		expr = text
+	}
+	var b strings.Builder
+	b.WriteString("- alert: <AlertName>\n")
+	b.WriteString("  expr: |\n")
+	for _, line := range strings.Split(strings.TrimSpace(expr), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line != "" {
+			b.WriteString("    " + line)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("  for: <duration>\n")
+	b.WriteString("  labels:\n")
+	b.WriteString("    severity: <severity>\n")
+	b.WriteString("  annotations:\n")
+	b.WriteString("    summary: <summary>\n")
+	b.WriteString("    description: <description>\n")
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// traceURLPlaceholder is replaced by the trace id in a trace URL template.
+const traceURLPlaceholder = "{trace_id}"
+
+// checkTraceURL reports whether tmpl is a usable trace URL template.
+func checkTraceURL(tmpl string) error {
+	if !strings.Contains(tmpl, traceURLPlaceholder) {
+		return fmt.Errorf("trace URL %q does not contain %s", tmpl, traceURLPlaceholder)
+	}
+	u, err := url.Parse(expandTraceURL(tmpl, "id"))
+	if err != nil {
+		return fmt.Errorf("bad trace URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("trace URL %q is not an http(s) URL", tmpl)
+	}
+	return nil
+}
+
+// expandTraceURL substitutes id into the trace URL template tmpl.
+func expandTraceURL(tmpl, id string) string {
+	return strings.ReplaceAll(tmpl, traceURLPlaceholder, url.PathEscape(id))
+}
+
+// openBrowser opens u in the user's default browser.
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not open browser: %w", err)
+	}
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/common/model"
+)
+
+// cachedResult is the last successful result of a pane, saved so that it
+// can be shown straight away in the next session.
+type cachedResult struct {
+	// Text is the query as written in the editor, before expansion.
+	Text string `json:"text"`
+	recordedResponse
+}
+
+// resultCachePath is the location of the cached result of the pane with
+// the given index within the user's cache directory.
+func resultCachePath(index int) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "binnacle", fmt.Sprintf("result-%d.json", index)), nil
+}
+
+// newCachedResult encodes the successful result for saving.
+func newCachedResult(result queryResult) (cachedResult, error) {
+	data, err := json.Marshal(result.data)
+	if err != nil {
+		return cachedResult{}, fmt.Errorf("could not encode result: %w", err)
+	}
+	return cachedResult{
+		Text: result.text,
+		recordedResponse: recordedResponse{
+			Query:    result.query,
+			Time:     result.at,
+			Type:     result.data.Type(),
+			Result:   data,
+			Warnings: result.warnings,
+		},
+	}, nil
+}
+
+// saveResult caches result in the file at path.
+func saveResult(path string, result queryResult) error {
+	c, err := newCachedResult(result)
+	if err != nil {
+		return err
+	}
+	cached, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("could not encode result: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not cache result: %w", err)
+	}
+	if err := ioutil.WriteFile(path, cached, 0644); err != nil {
+		return fmt.Errorf("could not cache result: %w", err)
+	}
+	return nil
+}
+
+// loadResult reads the result cached in the file at path. If there is
+// none, ok is false.
+func loadResult(path string) (cached cachedResult, value model.Value, ok bool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cached, nil, false, nil
+	} else if err != nil {
+		return cached, nil, false, fmt.Errorf("could not read cached result: %w", err)
+	}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return cached, nil, false, fmt.Errorf("could not parse cached result %s: %w", path, err)
+	}
+	value, err = decodeValue(cached.Type, cached.Result)
+	if err != nil {
+		return cached, nil, false, fmt.Errorf("invalid cached result %s: %w", path, err)
+	}
+	return cached, value, true, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget/material"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// cardinalityWindow is how far back series are counted, so that only
+// those still being scraped contribute to the estimate.
+const cardinalityWindow = 5 * time.Minute
+
+// cardinalityColors color the series count of a query by its magnitude.
+var cardinalityColors, _ = ParseThresholds("green<1000, yellow<10000, orange<100000, red")
+
+// querySelectors returns the series selectors of a parsed query,
+// without their modifiers.
+func querySelectors(expr promql.Expr) []string {
+	if expr == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var selectors []string
+	promql.Inspect(expr, func(n promql.Node) bool {
+		if vs, ok := n.(*promql.VectorSelector); ok {
+			sel := *vs
+			sel.Offset, sel.At = 0, nil
+			if s := sel.String(); !seen[s] {
+				seen[s] = true
+				selectors = append(selectors, s)
+			}
+		}
+		return true
+	})
+	sort.Strings(selectors)
+	return selectors
+}
+
+type cardinalityResponse struct {
+	key    string
+	series int
+	err    error
+}
+
+// cardinality estimates in the background how many series the selectors
+// of a query match.
+type cardinality struct {
+	counter latest.Worker
+	// key identifies the selectors most recently counted, which are
+	// pending until their count arrives.
+	key     string
+	pending bool
+	// counted is set once a count for the current selectors, or ones
+	// before them, has arrived.
+	counted bool
+	series  int
+	err     error
+}
+
+func newCardinality(b *Backend) *cardinality {
+	c := &cardinality{}
+	c.counter = latest.NewWorker(func(in interface{}) interface{} {
+		selectors := in.([]string)
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		defer cancel()
+		end := time.Now()
+		series, _, err := b.Source.Series(ctx, selectors, end.Add(-cardinalityWindow), end)
+		return cardinalityResponse{
+			key:    strings.Join(selectors, "\n"),
+			series: len(series),
+			err:    err,
+		}
+	})
+	return c
+}
+
+// Update counts the series matched by the selectors of a parsed query,
+// if they differ from those last counted.
+func (c *cardinality) Update(expr promql.Expr) {
+	selectors := querySelectors(expr)
+	key := strings.Join(selectors, "\n")
+	if key == c.key {
+		return
+	}
+	c.key = key
+	c.pending = len(selectors) > 0
+	if c.pending {
+		c.counter.Push(selectors)
+	} else {
+		c.counted = false
+	}
+}
+
+func (c *cardinality) receive() {
+	select {
+	case r := <-c.counter.Raw():
+		resp := r.(cardinalityResponse)
+		if resp.key == c.key {
+			c.pending, c.counted = false, true
+			c.series, c.err = resp.series, resp.err
+		}
+	default:
+	}
+}
+
+// Layout shows the estimated series count, colored by magnitude. While
+// a new count is pending, the previous one is shown.
+func (c *cardinality) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	c.receive()
+	if c.pending {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	if !c.counted || c.err != nil {
+		return D{}
+	}
+	label := material.Caption(th, fmt.Sprintf("~%d series", c.series))
+	label.Color, _ = cardinalityColors.Color(float64(c.series))
+	return inset.Layout(gtx, label.Layout)
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// seriesColor is the color of the line of the series with metric m,
+// which stays the same however the series are ordered.
+func seriesColor(m model.Metric) color.Color {
+	colors := plotutil.DefaultColors
+	return colors[int(m.Fingerprint()%model.Fingerprint(len(colors)))]
+}
+
+// chartOptions control how a matrix is charted.
+type chartOptions struct {
+	// Hidden are the series left out of the chart.
+	Hidden map[model.Fingerprint]bool
+	// LogY scales the Y axis logarithmically. It does not apply to
+	// stacked charts, whose areas reach down to zero.
+	LogY bool
+	// Stacked stacks the series as areas, so that they add up.
+	Stacked bool
+	// Normalize scales each series to span 0 to 1 between its least and
+	// greatest values, so that the shapes of series of very different
+	// magnitudes can be compared. Only the chart is scaled.
+	Normalize bool
+	// Histogram charts the buckets of a classic histogram as a heatmap
+	// over time. It takes the place of LogY and Stacked.
+	Histogram bool
+	// CarryForward fills in the samples missing from a stacked series
+	// with its previous value, rather than zero.
+	CarryForward bool
+	// MinX and MaxX, if MaxX is greater, zoom the X axis into this
+	// range of times, in seconds.
+	MinX, MaxX float64
+}
+
+// matrixPlot charts each series of a matrix as a line over time, except
+// those hidden. Samples that are not finite, or not positive on a log
+// scale, are left out, breaking the line.
+func matrixPlot(data model.Matrix, opts chartOptions) (*plot.Plot, error) {
+	if opts.Histogram && isHistogram(data) {
+		return histogramPlot(data, opts)
+	}
+	if opts.Normalize {
+		data = normalizeSeries(data)
+	}
+	p := plot.New()
+	if opts.Normalize {
+		p.Y.Label.Text = "normalized per series (0 to 1)"
+	}
+	p.X.Tick.Marker = plot.TimeTicks{Format: "15:04:05", Time: plot.UnixTimeIn(time.Local)}
+	defer zoom(p, opts)
+	if opts.Stacked {
+		return p, stackAreas(p, data, opts)
+	}
+	lines := 0
+	for _, s := range data {
+		if opts.Hidden[s.Metric.Fingerprint()] {
+			continue
+		}
+		var runs []plotter.XYs
+		var run plotter.XYs
+		for _, v := range s.Values {
+			y := float64(v.Value)
+			if math.IsNaN(y) || math.IsInf(y, 0) || opts.LogY && y <= 0 {
+				if len(run) > 0 {
+					runs, run = append(runs, run), nil
+				}
+				continue
+			}
+			run = append(run, plotter.XY{X: float64(v.Timestamp) / 1000, Y: y})
+		}
+		if len(run) > 0 {
+			runs = append(runs, run)
+		}
+		for _, run := range runs {
+			line, err := plotter.NewLine(run)
+			if err != nil {
+				return nil, err
+			}
+			line.Color = seriesColor(s.Metric)
+			line.Width = vg.Points(1.5)
+			p.Add(line)
+			lines++
+		}
+	}
+	// An empty log axis would have no positive range to scale.
+	if opts.LogY && lines > 0 {
+		p.Y.Scale = plot.LogScale{}
+		p.Y.Tick.Marker = plot.LogTicks{}
+	}
+	return p, nil
+}
+
+// normalizeSeries scales the values of each series of data to span 0 to
+// 1 between its least and greatest finite values. A series whose values
+// are all the same is drawn at 0.5.
+func normalizeSeries(data model.Matrix) model.Matrix {
+	scaled := make(model.Matrix, len(data))
+	for i, s := range data {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, v := range s.Values {
+			y := float64(v.Value)
+			if math.IsNaN(y) || math.IsInf(y, 0) {
+				continue
+			}
+			lo, hi = math.Min(lo, y), math.Max(hi, y)
+		}
+		values := make([]model.SamplePair, len(s.Values))
+		for j, v := range s.Values {
+			y := float64(v.Value)
+			switch {
+			case math.IsNaN(y) || math.IsInf(y, 0):
+			case hi > lo:
+				y = (y - lo) / (hi - lo)
+			default:
+				y = .5
+			}
+			values[j] = model.SamplePair{Timestamp: v.Timestamp, Value: model.SampleValue(y)}
+		}
+		scaled[i] = &model.SampleStream{Metric: s.Metric, Values: values}
+	}
+	return scaled
+}
+
+// zoom narrows the X axis of p to the range of opts, if any, once the
+// data has been added.
+func zoom(p *plot.Plot, opts chartOptions) {
+	if opts.MaxX > opts.MinX {
+		p.X.Min, p.X.Max = opts.MinX, opts.MaxX
+	}
+}
+
+// stackAreas adds the series of data not hidden to p as areas stacked
+// in order of their labels. Samples that are missing, or not finite, are
+// taken as zero or as the previous value of the series.
+func stackAreas(p *plot.Plot, data model.Matrix, opts chartOptions) error {
+	var shown model.Matrix
+	seen := map[model.Time]bool{}
+	var times []model.Time
+	for _, s := range data {
+		if opts.Hidden[s.Metric.Fingerprint()] {
+			continue
+		}
+		shown = append(shown, s)
+		for _, v := range s.Values {
+			if !seen[v.Timestamp] {
+				seen[v.Timestamp] = true
+				times = append(times, v.Timestamp)
+			}
+		}
+	}
+	if len(times) == 0 {
+		return nil
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	sort.Slice(shown, func(i, j int) bool { return shown[i].Metric.Before(shown[j].Metric) })
+	base := make([]float64, len(times))
+	for _, s := range shown {
+		top := make([]float64, len(times))
+		var last float64
+		j := 0
+		for i, t := range times {
+			for j < len(s.Values) && s.Values[j].Timestamp < t {
+				j++
+			}
+			v := 0.0
+			if opts.CarryForward {
+				v = last
+			}
+			if j < len(s.Values) && s.Values[j].Timestamp == t {
+				if y := float64(s.Values[j].Value); !math.IsNaN(y) && !math.IsInf(y, 0) {
+					v, last = y, y
+				}
+			}
+			top[i] = base[i] + v
+		}
+		// The area runs along the top, and back along the base.
+		ring := make(plotter.XYs, 0, 2*len(times))
+		for i, t := range times {
+			ring = append(ring, plotter.XY{X: float64(t) / 1000, Y: top[i]})
+		}
+		for i := len(times) - 1; i >= 0; i-- {
+			ring = append(ring, plotter.XY{X: float64(times[i]) / 1000, Y: base[i]})
+		}
+		area, err := plotter.NewPolygon(ring)
+		if err != nil {
+			return err
+		}
+		area.Color = seriesColor(s.Metric)
+		area.LineStyle.Width = 0
+		p.Add(area)
+		base = top
+	}
+	return nil
+}
+
+// RenderMatrix charts the series of data with the given options.
+func RenderMatrix(gtx C, data model.Matrix, opts chartOptions) vizResult {
+	if len(data) < 1 {
+		return vizResult{}
+	}
+	p, err := matrixPlot(data, opts)
+	if err != nil {
+		slog.Error("failed creating line chart", "err", err)
+		return vizResult{}
+	}
+	return drawPlot(gtx, p)
+}
+
+// chartArea is where the data of a chart is drawn, in pixels from its
+// top left, and the range of the X axis drawn across it.
+type chartArea struct {
+	rect       image.Rectangle
+	minX, maxX float64
+}
+
+func newChartArea(p *plot.Plot, c draw.Canvas, dpi float64) chartArea {
+	data := p.DataCanvas(c)
+	height := c.Max.Y.Dots(dpi)
+	return chartArea{
+		rect: image.Rect(
+			int(data.Min.X.Dots(dpi)), int(height-data.Max.Y.Dots(dpi)),
+			int(data.Max.X.Dots(dpi)), int(height-data.Min.Y.Dots(dpi)),
+		),
+		minX: p.X.Min,
+		maxX: p.X.Max,
+	}
+}
+
+// time returns the time shown at the horizontal pixel x.
+func (a chartArea) time(x float32) model.Time {
+	f := (float64(x) - float64(a.rect.Min.X)) / float64(a.rect.Dx())
+	return model.Time((a.minX + f*(a.maxX-a.minX)) * 1000)
+}
+
+// pixel returns the horizontal pixel at which time t is shown.
+func (a chartArea) pixel(t model.Time) float32 {
+	f := (float64(t)/1000 - a.minX) / (a.maxX - a.minX)
+	return float32(float64(a.rect.Min.X) + f*float64(a.rect.Dx()))
+}
+
+// nearestSample returns the index of the sample of s nearest to t, or -1
+// if it has none.
+func nearestSample(s *model.SampleStream, t model.Time) int {
+	i := sort.Search(len(s.Values), func(i int) bool {
+		return s.Values[i].Timestamp >= t
+	})
+	switch {
+	case len(s.Values) == 0:
+		return -1
+	case i == len(s.Values):
+		return i - 1
+	case i > 0 && t-s.Values[i-1].Timestamp < s.Values[i].Timestamp-t:
+		return i - 1
+	}
+	return i
+}
+
+// maxReadout is the most series whose values the crosshair reads out.
+const maxReadout = 10
+
+// minBrush is the narrowest drag across a chart, in pixels, that zooms
+// into it, so that a click does not.
+const minBrush = 4
+
+// chartCursor draws a crosshair over a chart of a matrix where the
+// pointer is, snapped to the nearest sample, and reads out the value of
+// each series shown at that time. Dragging across the chart selects a
+// range of times to zoom into.
+type chartCursor struct {
+	hovered bool
+	x       float32
+	// dragging is set while a range is being selected from x0 to x.
+	dragging bool
+	x0       float32
+	// zoomed is set when a range has been selected, until taken by Zoom.
+	zoomed           bool
+	zoomMin, zoomMax float64
+}
+
+// Zoom returns the range of times last selected, in seconds, if one has
+// been since the last call.
+func (c *chartCursor) Zoom() (min, max float64, ok bool) {
+	ok, c.zoomed = c.zoomed, false
+	return c.zoomMin, c.zoomMax, ok
+}
+
+func (c *chartCursor) Layout(gtx C, th *material.Theme, area chartArea, data model.Matrix, hidden map[model.Fingerprint]bool, f NumberFormat, chart layout.Widget) D {
+	for _, e := range gtx.Events(c) {
+		e, ok := e.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch e.Type {
+		case pointer.Enter, pointer.Move:
+			c.hovered, c.x = true, e.Position.X
+		case pointer.Leave:
+			c.hovered = false
+		case pointer.Cancel:
+			c.hovered, c.dragging = false, false
+		case pointer.Press:
+			if e.Buttons.Contain(pointer.ButtonLeft) {
+				c.dragging, c.x0, c.x = true, e.Position.X, e.Position.X
+			}
+		case pointer.Drag:
+			c.x = e.Position.X
+		case pointer.Release:
+			if c.dragging && abs32(c.x-c.x0) >= minBrush && area.maxX > area.minX {
+				from, to := area.time(c.x0), area.time(c.x)
+				if to < from {
+					from, to = to, from
+				}
+				c.zoomed = true
+				c.zoomMin, c.zoomMax = float64(from)/1000, float64(to)/1000
+			}
+			c.dragging = false
+		}
+	}
+	dims := chart(gtx)
+	stack := op.Save(gtx.Ops)
+	pointer.Rect(area.rect).Add(gtx.Ops)
+	pointer.InputOp{Tag: c, Types: pointer.Enter | pointer.Leave | pointer.Move | pointer.Press | pointer.Drag | pointer.Release}.Add(gtx.Ops)
+	stack.Load()
+	if area.rect.Empty() || area.maxX <= area.minX {
+		return dims
+	}
+	if c.dragging {
+		from, to := int(c.x0), int(c.x)
+		if to < from {
+			from, to = to, from
+		}
+		from, to = clampInt(from, area.rect.Min.X, area.rect.Max.X), clampInt(to, area.rect.Min.X, area.rect.Max.X)
+		brush := color.NRGBA{R: th.ContrastBg.R, G: th.ContrastBg.G, B: th.ContrastBg.B, A: 0x40}
+		paint.FillShape(gtx.Ops, brush, clip.Rect{Min: image.Pt(from, area.rect.Min.Y), Max: image.Pt(to, area.rect.Max.Y)}.Op())
+		return dims
+	}
+	if !c.hovered {
+		return dims
+	}
+	var shown []*model.SampleStream
+	for _, s := range data {
+		if !hidden[s.Metric.Fingerprint()] {
+			shown = append(shown, s)
+		}
+	}
+	// Snap to the sample nearest the pointer.
+	t := area.time(c.x)
+	snapped, found := t, false
+	for _, s := range shown {
+		if i := nearestSample(s, t); i >= 0 {
+			ts := s.Values[i].Timestamp
+			if d, best := ts.Sub(t), snapped.Sub(t); !found || abs(d) < abs(best) {
+				snapped, found = ts, true
+			}
+		}
+	}
+	if !found {
+		return dims
+	}
+	sort.Slice(shown, func(i, j int) bool {
+		return shown[i].Metric.Before(shown[j].Metric)
+	})
+	lines := []string{snapped.Time().Format("2006-01-02 15:04:05.000")}
+	for n, s := range shown {
+		if n == maxReadout {
+			lines = append(lines, fmt.Sprintf("and %d more", len(shown)-n))
+			break
+		}
+		i := nearestSample(s, snapped)
+		if i < 0 || s.Values[i].Timestamp != snapped {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", s.Metric, f.Format(float64(s.Values[i].Value))))
+	}
+	x := int(area.pixel(snapped))
+	line := color.NRGBA{R: th.Fg.R, G: th.Fg.G, B: th.Fg.B, A: 0x80}
+	paint.FillShape(gtx.Ops, line, clip.Rect{Min: image.Pt(x, area.rect.Min.Y), Max: image.Pt(x+1, area.rect.Max.Y)}.Op())
+	macro := op.Record(gtx.Ops)
+	offset := gtx.Px(unit.Dp(8))
+	op.Offset(f32.Pt(float32(x+offset), float32(area.rect.Min.Y))).Add(gtx.Ops)
+	gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Px(unit.Dp(600)), gtx.Px(unit.Dp(400)))}
+	layoutTooltip(gtx, th, strings.Join(lines, "\n"))
+	op.Defer(gtx.Ops, macro.Stop())
+	return dims
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func abs32(f float32) float32 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// chartLegend lists the series of a chart, each of which can be clicked
+// to hide or show it. Hidden series are remembered by fingerprint, so
+// they stay hidden when the query is re-run.
+type chartLegend struct {
+	hidden map[model.Fingerprint]bool
+	clicks map[model.Fingerprint]*widget.Clickable
+	list   layout.List
+}
+
+func newChartLegend() *chartLegend {
+	l := &chartLegend{
+		hidden: map[model.Fingerprint]bool{},
+		clicks: map[model.Fingerprint]*widget.Clickable{},
+	}
+	l.list.Axis = layout.Vertical
+	return l
+}
+
+// Hidden returns a copy of the set of hidden series, for use by the
+// chart while the legend may change.
+func (l *chartLegend) Hidden() map[model.Fingerprint]bool {
+	hidden := make(map[model.Fingerprint]bool, len(l.hidden))
+	for fp := range l.hidden {
+		hidden[fp] = true
+	}
+	return hidden
+}
+
+// Changed toggles the series clicked, reporting whether there were any.
+func (l *chartLegend) Changed() bool {
+	changed := false
+	for fp, click := range l.clicks {
+		for click.Clicked() {
+			if l.hidden[fp] {
+				delete(l.hidden, fp)
+			} else {
+				l.hidden[fp] = true
+			}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Layout lists the series of data in order of their labels, with those
+// hidden greyed out.
+func (l *chartLegend) Layout(gtx C, th *material.Theme, data model.Matrix) D {
+	metrics := make([]model.Metric, len(data))
+	for i, s := range data {
+		metrics[i] = s.Metric
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Before(metrics[j])
+	})
+	return l.list.Layout(gtx, len(metrics), func(gtx C, index int) D {
+		m := metrics[index]
+		fp := m.Fingerprint()
+		click := l.clicks[fp]
+		if click == nil {
+			click = new(widget.Clickable)
+			l.clicks[fp] = click
+		}
+		swatch := color.NRGBAModel.Convert(seriesColor(m)).(color.NRGBA)
+		text := th.Fg
+		if l.hidden[fp] {
+			swatch.A, text.A = 0x40, 0x80
+		}
+		return material.Clickable(gtx, click, func(gtx C) D {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					size := gtx.Px(unit.Dp(12))
+					paint.FillShape(gtx.Ops, swatch, clip.Rect{Max: image.Pt(size, size)}.Op())
+					return D{Size: image.Pt(size, size)}
+				}),
+				layout.Rigid(func(gtx C) D {
+					return layout.Inset{Left: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+						label := material.Body2(th, m.String())
+						label.Font.Variant = "Mono"
+						label.Color = text
+						label.MaxLines = 1
+						return label.Layout(gtx)
+					})
+				}),
+			)
+		})
+	})
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"image"
+	"strings"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// completionTTL is how long the names fetched for completion are used
+// before they are fetched again.
+const completionTTL = 5 * time.Minute
+
+// completionLimit is the most names offered at once.
+const completionLimit = 8
+
+type completionResponse struct {
+	labels bool
+	names  []string
+	err    error
+}
+
+// fetchedNames are names fetched for completion, and when.
+type fetchedNames struct {
+	names []string
+	at    time.Time
+}
+
+// queryCompletion offers the names completing the identifier typed at
+// the caret of a query: the metric names known to the server, or the
+// label names inside the braces of a selector. The names are fetched in
+// the background and kept for completionTTL, and filtered as typing
+// goes on, metric names fuzzily as in the selector builder.
+type queryCompletion struct {
+	fetcher latest.Worker
+	fetched map[bool]fetchedNames
+	// requested is whether the names pending are label names.
+	requested, pending bool
+
+	// text and caret are the query and caret offset that suggestions
+	// were found for.
+	text        string
+	caret       int
+	suggestions []string
+	clicks      []widget.Clickable
+	// dismissed is the query text that the suggestions were dismissed
+	// for, until it is edited.
+	dismissed string
+	// chosen is the suggestion chosen with a key, inserted once the
+	// editor has handled that key, which may type a newline or a tab.
+	chosen string
+}
+
+func newQueryCompletion(b *Backend) *queryCompletion {
+	c := &queryCompletion{fetched: map[bool]fetchedNames{}, caret: -1}
+	c.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		labels := in.(bool)
+		names, err := b.Names(labels)
+		return completionResponse{labels: labels, names: names, err: err}
+	})
+	return c
+}
+
+// isIdentByte reports whether b may be part of a metric or label name.
+func isIdentByte(b byte) bool {
+	return b == '_' || b == ':' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+// completionToken finds the identifier in text around the offset caret,
+// from start to end, if it is one that names complete. If it is inside
+// the braces of a selector, naming a label, brace is the offset of the
+// opening brace, and otherwise -1.
+func completionToken(text string, caret int) (start, end, brace int, ok bool) {
+	start, end = caret, caret
+	for start > 0 && isIdentByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentByte(text[end]) {
+		end++
+	}
+	if start == caret || text[start] >= '0' && text[start] <= '9' {
+		return 0, 0, -1, false
+	}
+	// Identifiers in quoted strings, comments and durations are not
+	// names.
+	var quote byte
+	brackets := 0
+	var braces []int
+	for i := 0; i < start; i++ {
+		if quote != 0 {
+			switch text[i] {
+			case '\\':
+				if quote != '`' {
+					i++
+				}
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+		switch text[i] {
+		case '"', '\'', '`':
+			quote = text[i]
+		case '#':
+			for i < start && text[i] != '\n' {
+				i++
+			}
+			if i == start {
+				return 0, 0, -1, false
+			}
+		case '{':
+			braces = append(braces, i)
+		case '}':
+			if len(braces) > 0 {
+				braces = braces[:len(braces)-1]
+			}
+		case '[':
+			brackets++
+		case ']':
+			brackets--
+		}
+	}
+	if quote != 0 || brackets > 0 {
+		return 0, 0, -1, false
+	}
+	brace = -1
+	if len(braces) > 0 {
+		brace = braces[len(braces)-1]
+	}
+	return start, end, brace, true
+}
+
+// matchedLabels returns the names of the labels already matched by the
+// selector whose opening brace is at the offset brace of text, as last
+// parsed. There are none if the parse does not reach that far into text
+// unchanged, its offsets no longer standing for those of text.
+func matchedLabels(parsed *parsedQuery, text string, brace int) map[string]bool {
+	if parsed == nil || parsed.expr == nil || parsed.text != parsed.query ||
+		len(parsed.text) <= brace || parsed.text[:brace+1] != text[:brace+1] {
+		return nil
+	}
+	var matched map[string]bool
+	promql.Inspect(parsed.expr, func(n promql.Node) bool {
+		vs, ok := n.(*promql.VectorSelector)
+		if !ok || brace < vs.Start || brace >= vs.End {
+			return true
+		}
+		matched = map[string]bool{}
+		for _, m := range vs.Matchers {
+			matched[m.Name] = true
+		}
+		return false
+	})
+	return matched
+}
+
+// Clear forgets the names fetched, as after switching to another
+// endpoint.
+func (c *queryCompletion) Clear() {
+	c.fetched = map[bool]fetchedNames{}
+	c.caret = -1
+}
+
+// fetch requests the metric names, or the label names if labels is set,
+// unless they were fetched recently or are on their way.
+func (c *queryCompletion) fetch(labels bool, now time.Time) {
+	if f, ok := c.fetched[labels]; ok && now.Sub(f.at) < completionTTL {
+		return
+	}
+	if c.pending && c.requested == labels {
+		return
+	}
+	c.requested, c.pending = labels, true
+	c.fetcher.Push(labels)
+}
+
+func (c *queryCompletion) receive(now time.Time) {
+	select {
+	case r := <-c.fetcher.Raw():
+		resp := r.(completionResponse)
+		if resp.labels == c.requested {
+			c.pending = false
+		}
+		// Failed lookups are kept as empty, like names that have
+		// expired, so that they are not retried on every frame.
+		if resp.err != nil {
+			resp.names = []string{}
+		}
+		c.fetched[resp.labels] = fetchedNames{names: resp.names, at: now}
+		// Find the suggestions again with the names fetched.
+		c.caret = -1
+	default:
+	}
+}
+
+// Update finds the names completing the identifier at the caret of ed,
+// inserting one if it was clicked. Label names are not offered for the
+// labels that the selector, as last parsed, already matches.
+func (c *queryCompletion) Update(gtx C, ed *widget.Editor, parsed *parsedQuery) {
+	c.receive(gtx.Now)
+	for i := range c.suggestions {
+		if i < len(c.clicks) && c.clicks[i].Clicked() {
+			c.insert(ed, c.suggestions[i])
+			ed.Focus()
+			op.InvalidateOp{}.Add(gtx.Ops)
+			break
+		}
+	}
+	if c.pending {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	text := ed.Text()
+	caret, end := ed.Selection()
+	if !ed.Focused() || caret != end || text == c.dismissed {
+		c.suggestions, c.caret = nil, -1
+		return
+	}
+	c.dismissed = ""
+	if text == c.text && caret == c.caret {
+		return
+	}
+	c.text, c.caret, c.suggestions = text, caret, nil
+	start, end, brace, ok := completionToken(text, caret)
+	if !ok {
+		return
+	}
+	labels := brace >= 0
+	c.fetch(labels, gtx.Now)
+	typed := text[start:caret]
+	var candidates []string
+	if labels {
+		matched := matchedLabels(parsed, text, brace)
+		for _, name := range c.fetched[labels].names {
+			if strings.HasPrefix(name, typed) && !matched[name] {
+				candidates = append(candidates, name)
+			}
+		}
+	} else {
+		candidates = fuzzyRank(typed, c.fetched[labels].names)
+	}
+	for _, name := range candidates {
+		if len(c.suggestions) == completionLimit {
+			break
+		}
+		if name != text[start:end] {
+			c.suggestions = append(c.suggestions, name)
+		}
+	}
+	if len(c.clicks) < len(c.suggestions) {
+		c.clicks = make([]widget.Clickable, len(c.suggestions))
+	}
+}
+
+// Choose chooses the first suggestion, if there are any, for Apply to
+// insert, reporting whether there was one.
+func (c *queryCompletion) Choose() bool {
+	if len(c.suggestions) == 0 {
+		return false
+	}
+	c.chosen = c.suggestions[0]
+	return true
+}
+
+// Dismiss hides the suggestions until the query is edited, reporting
+// whether there were any.
+func (c *queryCompletion) Dismiss() bool {
+	if len(c.suggestions) == 0 {
+		return false
+	}
+	c.dismissed, c.suggestions = c.text, nil
+	return true
+}
+
+// Apply inserts the suggestion chosen, if any, in place of the
+// identifier at the caret of ed, reporting whether it did. The newline
+// or tab typed by the key choosing it is taken out again.
+func (c *queryCompletion) Apply(ed *widget.Editor) bool {
+	if c.chosen == "" {
+		return false
+	}
+	chosen := c.chosen
+	c.chosen = ""
+	text := ed.Text()
+	caret, _ := ed.Selection()
+	if caret > 0 && (text[caret-1] == '\n' || text[caret-1] == '\t') {
+		text = text[:caret-1] + text[caret:]
+		caret--
+		ed.SetText(text)
+		ed.SetCaret(caret, caret)
+	}
+	c.insert(ed, chosen)
+	return true
+}
+
+// insert replaces the identifier at the caret of ed with name.
+func (c *queryCompletion) insert(ed *widget.Editor, name string) {
+	text := ed.Text()
+	caret, _ := ed.Selection()
+	start, end, _, ok := completionToken(text, caret)
+	if !ok {
+		start, end = caret, caret
+	}
+	text = text[:start] + name + text[end:]
+	ed.SetText(text)
+	n := start + len(name)
+	ed.SetCaret(n, n)
+	// Until it is edited again, the name is left as it is rather than
+	// further completed by the next Tab or Enter.
+	c.dismissed = text
+}
+
+// Layout shows the suggestions in a list below the caret of ed, over
+// whatever is laid out there.
+func (c *queryCompletion) Layout(gtx C, th *material.Theme, ed *widget.Editor) {
+	if len(c.suggestions) == 0 {
+		return
+	}
+	macro := op.Record(gtx.Ops)
+	pos := ed.CaretCoords()
+	op.Offset(f32.Pt(pos.X, pos.Y+float32(gtx.Px(unit.Dp(4))))).Add(gtx.Ops)
+	gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Px(unit.Dp(400)), gtx.Px(unit.Dp(600)))}
+	layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx C) D {
+			paint.FillShape(gtx.Ops, th.Bg, clip.Rect{Max: gtx.Constraints.Min}.Op())
+			return D{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx C) D {
+			return widget.Border{Width: unit.Dp(1), Color: th.Fg}.Layout(gtx, func(gtx C) D {
+				children := make([]layout.FlexChild, len(c.suggestions))
+				for i := range c.suggestions {
+					i := i
+					children[i] = layout.Rigid(func(gtx C) D {
+						return material.Clickable(gtx, &c.clicks[i], func(gtx C) D {
+							gtx.Constraints.Min.X = gtx.Constraints.Max.X
+							label := material.Body2(th, c.suggestions[i])
+							label.Font.Variant = "Mono"
+							if i == 0 {
+								// The one that Tab and Enter insert.
+								label.Color = th.ContrastBg
+							}
+							return layout.UniformInset(unit.Dp(4)).Layout(gtx, label.Layout)
+						})
+					})
+				}
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+			})
+		}),
+	)
+	op.Defer(gtx.Ops, macro.Stop())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// gzipTransport asks for responses to be gzip-compressed and decompresses
+// them, which the transports built from client configs are set not to
+// do. A request that already asks for an encoding is left alone.
+type gzipTransport struct {
+	http.RoundTripper
+}
+
+func (t gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" {
+		return t.RoundTripper.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it is given.
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") || resp.Body == http.NoBody {
+		return resp, err
+	}
+	compressed := &countingReader{r: resp.Body}
+	zr, err := gzip.NewReader(compressed)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("could not decompress response: %w", err)
+	}
+	resp.Body = &gzipBody{
+		decompressed: countingReader{r: zr},
+		compressed:   compressed,
+		body:         resp.Body,
+		path:         req.URL.Path,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// gzipBody is the decompressed body of a response, which logs how much it
+// was compressed once it is closed.
+type gzipBody struct {
+	decompressed countingReader
+	compressed   *countingReader
+	body         io.Closer
+	path         string
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	return b.decompressed.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	slog.Debug("decompressed response", "path", b.path, "compressed", b.compressed.n, "decompressed", b.decompressed.n)
+	return b.body.Close()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultTimeout bounds queries to endpoints that do not set a timeout.
+const defaultTimeout = 10 * time.Second
+
+// Config is the contents of a configuration file.
+type Config struct {
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
+
+// Endpoint describes how to reach a Prometheus server. Each endpoint has
+// its own TLS, authentication and timeout settings.
+type Endpoint struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+	// Timeout bounds each query, including any retries. Zero means
+	// defaultTimeout.
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+	// ConnectTimeout bounds connecting to the server, so that one that
+	// cannot be reached fails sooner than a slow query. Zero leaves
+	// connecting bounded by Timeout alone.
+	ConnectTimeout model.Duration `yaml:"connect_timeout,omitempty"`
+	// MaxResponseBytes, if positive, is the most bytes of a response
+	// body read, after decompression, before the response fails.
+	MaxResponseBytes int64 `yaml:"max_response_bytes,omitempty"`
+	// ForwardAuthOnRedirect sends the endpoint's credentials along when
+	// it redirects to another host, which by default gets none.
+	ForwardAuthOnRedirect bool `yaml:"forward_auth_on_redirect,omitempty"`
+	// Backend is the kind of server, backendPrometheus if empty.
+	Backend string        `yaml:"backend,omitempty"`
+	Thanos  ThanosOptions `yaml:"thanos,omitempty"`
+
+	HTTPClientConfig config.HTTPClientConfig `yaml:",inline"`
+}
+
+func (ep *Endpoint) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*ep = Endpoint{HTTPClientConfig: config.DefaultHTTPClientConfig}
+	type plain Endpoint
+	return unmarshal((*plain)(ep))
+}
+
+// LoadConfig reads and validates the configuration file at path.
+// Relative file paths within it are resolved against its directory.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config: %w", err)
+	}
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("could not parse config %s: %w", path, err)
+	}
+	if len(c.Endpoints) == 0 {
+		return nil, fmt.Errorf("config %s has no endpoints", path)
+	}
+	names := map[string]bool{}
+	for i := range c.Endpoints {
+		ep := &c.Endpoints[i]
+		ep.HTTPClientConfig.SetDirectory(filepath.Dir(path))
+		if err := ep.validate(); err != nil {
+			return nil, fmt.Errorf("invalid endpoint %d (%q) in %s: %w", i+1, ep.Name, path, err)
+		}
+		if names[ep.Name] {
+			return nil, fmt.Errorf("duplicate endpoint name %q in %s", ep.Name, path)
+		}
+		names[ep.Name] = true
+	}
+	return &c, nil
+}
+
+func (ep *Endpoint) validate() error {
+	if ep.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	u, err := url.Parse(ep.Address)
+	if err != nil {
+		return fmt.Errorf("bad address: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("address %q is not an http(s) URL", ep.Address)
+	}
+	if ep.Timeout < 0 {
+		return fmt.Errorf("negative timeout")
+	}
+	if ep.ConnectTimeout < 0 {
+		return fmt.Errorf("negative connect timeout")
+	}
+	if ep.MaxResponseBytes < 0 {
+		return fmt.Errorf("negative max response bytes")
+	}
+	switch ep.Backend {
+	case "", backendPrometheus:
+		if ep.Thanos != (ThanosOptions{}) {
+			return fmt.Errorf("thanos options need backend %q", backendThanos)
+		}
+	case backendThanos:
+		if err := ep.Thanos.validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown backend %q", ep.Backend)
+	}
+	if err := ep.HTTPClientConfig.Validate(); err != nil {
+		return err
+	}
+	// Building the client checks that any certificates can be loaded.
+	_, err = ep.Connect()
+	return err
+}
+
+// QueryTimeout is the time allowed for each query to the endpoint.
+func (ep *Endpoint) QueryTimeout() time.Duration {
+	if ep.Timeout == 0 {
+		return defaultTimeout
+	}
+	return time.Duration(ep.Timeout)
+}
+
+// CheckAuth fetches an OAuth2 token if the endpoint uses OAuth2, so that
+// a failing token endpoint is reported up front rather than by every
+// query.
+func (ep *Endpoint) CheckAuth(ctx context.Context) error {
+	o := ep.HTTPClientConfig.OAuth2
+	if o == nil {
+		return nil
+	}
+	secret := string(o.ClientSecret)
+	if o.ClientSecretFile != "" {
+		data, err := ioutil.ReadFile(o.ClientSecretFile)
+		if err != nil {
+			return fmt.Errorf("could not read oauth2 client secret: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	params := url.Values{}
+	for k, v := range o.EndpointParams {
+		params.Set(k, v)
+	}
+	cc := clientcredentials.Config{
+		ClientID:       o.ClientID,
+		ClientSecret:   secret,
+		TokenURL:       o.TokenURL,
+		Scopes:         o.Scopes,
+		EndpointParams: params,
+	}
+	// The token endpoint is trusted the same as the server, through the
+	// endpoint's TLS settings.
+	tlsConfig, err := config.NewTLSConfig(&ep.HTTPClientConfig.TLSConfig)
+	if err != nil {
+		return fmt.Errorf("could not configure TLS for oauth2 token of %s: %w", ep.Name, err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(ep.HTTPClientConfig.ProxyURL.URL),
+		TLSClientConfig: tlsConfig,
+	}}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	if _, err := cc.Token(ctx); err != nil {
+		return fmt.Errorf("could not get oauth2 token for %s from %s: %w", ep.Name, o.TokenURL, err)
+	}
+	return nil
+}
+
+// defaultConnectTimeouts sets the connect timeout of the endpoints that do
+// not set their own to d.
+func defaultConnectTimeouts(endpoints []Endpoint, d time.Duration) {
+	for i := range endpoints {
+		if endpoints[i].ConnectTimeout == 0 {
+			endpoints[i].ConnectTimeout = model.Duration(d)
+		}
+	}
+}
+
+// defaultMaxResponseBytes sets the response size limit of the endpoints
+// that do not set their own to n.
+func defaultMaxResponseBytes(endpoints []Endpoint, n int64) {
+	for i := range endpoints {
+		if endpoints[i].MaxResponseBytes == 0 {
+			endpoints[i].MaxResponseBytes = n
+		}
+	}
+}
+
+// forwardAuthOnRedirects makes all the endpoints send their credentials
+// along on redirects to other hosts, if forward is set.
+func forwardAuthOnRedirects(endpoints []Endpoint, forward bool) {
+	for i := range endpoints {
+		endpoints[i].ForwardAuthOnRedirect = endpoints[i].ForwardAuthOnRedirect || forward
+	}
+}
+
+// dialer connects within the endpoint's connect timeout, reporting a
+// timeout as a failure to connect rather than a slow query.
+func (ep *Endpoint) dialer() config.DialContextFunc {
+	timeout := time.Duration(ep.ConnectTimeout)
+	d := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			return nil, fmt.Errorf("could not connect to %s within %v: %w", addr, timeout, err)
+		}
+		return conn, err
+	}
+}
+
+// Connect builds a client for the endpoint.
+func (ep *Endpoint) Connect() (Source, error) {
+	var opts []config.HTTPClientOption
+	if ep.ConnectTimeout > 0 {
+		opts = append(opts, config.WithDialContextFunc(ep.dialer()))
+	}
+	rt, err := config.NewRoundTripperFromConfig(ep.HTTPClientConfig, "binnacle", opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure client for %s: %w", ep.Name, err)
+	}
+	rt, err = newRedirectTransport(rt, ep, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure client for %s: %w", ep.Name, err)
+	}
+	var transport http.RoundTripper = replicaTransport{gzipTransport{rt}}
+	if ep.MaxResponseBytes > 0 {
+		transport = limitTransport{transport, ep.MaxResponseBytes}
+	}
+	client, err := api.NewClient(api.Config{
+		Address:      ep.Address,
+		RoundTripper: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not configure client for %s: %w", ep.Name, err)
+	}
+	src := &apiSource{API: v1.NewAPI(client), client: client, endpoint: *ep, transport: transport}
+	if ep.Backend == backendThanos {
+		src.params = ep.Thanos.params()
+		// Unless partial responses are disabled, the querier's warnings
+		// are of stores that did not answer.
+		src.partial = ep.Thanos.PartialResponse == nil || *ep.Thanos.PartialResponse
+	}
+	return src, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/config"
+)
+
+func TestCheckAuthUsesEndpointTLS(t *testing.T) {
+	tokens := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "token", "token_type": "bearer", "expires_in": 3600}`))
+	}))
+	// The handshakes failing for want of the CA are expected.
+	tokens.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	tokens.StartTLS()
+	defer tokens.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tokens.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ep := Endpoint{Name: "test", HTTPClientConfig: config.DefaultHTTPClientConfig}
+	ep.HTTPClientConfig.OAuth2 = &config.OAuth2{
+		ClientID:     "binnacle",
+		ClientSecret: "secret",
+		TokenURL:     tokens.URL + "/token",
+	}
+	if err := ep.CheckAuth(context.Background()); err == nil {
+		t.Error("CheckAuth() trusted the token endpoint without its CA")
+	}
+	ep.HTTPClientConfig.TLSConfig.CAFile = caFile
+	if err := ep.CheckAuth(context.Background()); err != nil {
+		t.Errorf("CheckAuth() with the token endpoint's CA: %v", err)
+	}
+}
+
+func TestConnectWithoutCredentialsSendsNoAuthorization(t *testing.T) {
+	var auth []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "success", "data": {"resultType": "vector", "result": []}}`))
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name  string
+		token config.Secret
+		want  string
+	}{
+		{"no credentials", "", ""},
+		{"bearer token", "secret", "Bearer secret"},
+	} {
+		auth = nil
+		ep := Endpoint{Name: "test", Address: server.URL, HTTPClientConfig: config.DefaultHTTPClientConfig}
+		ep.HTTPClientConfig.BearerToken = tt.token
+		src, err := ep.Connect()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, _, err := src.Query(context.Background(), "up", time.Now()); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(auth) == 0 {
+			t.Fatalf("%s: the query did not reach the server", tt.name)
+		}
+		for _, got := range auth {
+			if got != tt.want {
+				t.Errorf("%s: sent Authorization %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/config"
+)
+
+// connectionForm is a form for connecting to a server by its address,
+// with a bearer token if one is given, without restarting with other
+// flags. err describes why the form could not be applied.
+type connectionForm struct {
+	Visible bool
+	toggle  widget.Clickable
+	address widget.Editor
+	token   widget.Editor
+	apply   widget.Clickable
+	err     string
+}
+
+func newConnectionForm() *connectionForm {
+	f := &connectionForm{}
+	f.address.SingleLine = true
+	f.token.SingleLine = true
+	f.token.Mask = '•'
+	return f
+}
+
+// Toggle shows or hides the form, filling in the address of the endpoint
+// in use, if any, as it is shown.
+func (f *connectionForm) Toggle(current *Endpoint) {
+	f.Visible = !f.Visible
+	if !f.Visible {
+		return
+	}
+	f.err = ""
+	if current != nil {
+		f.address.SetText(current.Address)
+	}
+	f.address.Focus()
+}
+
+// Applied returns the endpoint described by the form once it has been
+// applied, named by its address as with the -addr flag.
+func (f *connectionForm) Applied() (Endpoint, bool) {
+	if !f.Visible || !f.apply.Clicked() {
+		return Endpoint{}, false
+	}
+	address := strings.TrimSpace(f.address.Text())
+	ep := Endpoint{
+		Name:             address,
+		Address:          address,
+		HTTPClientConfig: config.DefaultHTTPClientConfig,
+	}
+	if token := strings.TrimSpace(f.token.Text()); token != "" {
+		ep.HTTPClientConfig.BearerToken = config.Secret(token)
+	}
+	return ep, true
+}
+
+// Layout shows the form, if it is visible.
+func (f *connectionForm) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	if !f.Visible {
+		return D{}
+	}
+	field := func(ed *widget.Editor, hint string) layout.Widget {
+		return func(gtx C) D {
+			return widget.Border{Width: unit.Dp(1), Color: th.Fg}.Layout(gtx, func(gtx C) D {
+				return inset.Layout(gtx, func(gtx C) D {
+					gtx.Constraints.Min.X = gtx.Constraints.Max.X
+					e := material.Editor(th, ed, hint)
+					e.Font.Variant = "Mono"
+					return e.Layout(gtx)
+				})
+			})
+		}
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Flexed(.6, func(gtx C) D {
+			return inset.Layout(gtx, field(&f.address, "address, like http://localhost:9090"))
+		}),
+		layout.Flexed(.4, func(gtx C) D {
+			return inset.Layout(gtx, field(&f.token, "bearer token (optional)"))
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &f.apply, "apply").Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if f.err == "" {
+				return D{}
+			}
+			label := material.Caption(th, f.err)
+			label.Color = errorColor(th)
+			label.MaxLines = 1
+			return inset.Layout(gtx, label.Layout)
+		}),
+	)
+}
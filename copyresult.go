@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strings"
+
+	"gioui.org/io/clipboard"
+	"gioui.org/widget/material"
+)
+
+// rowSelection is the result rows selected by clicking them, by index,
+// for copying only those.
+type rowSelection struct {
+	rows map[int]bool
+}
+
+// Toggle selects the row at index, or deselects it if it was selected.
+func (s *rowSelection) Toggle(index int) {
+	if s.rows == nil {
+		s.rows = map[int]bool{}
+	}
+	if s.rows[index] {
+		delete(s.rows, index)
+	} else {
+		s.rows[index] = true
+	}
+}
+
+// Clear deselects every row, as once the rows are of another result.
+func (s *rowSelection) Clear() {
+	s.rows = nil
+}
+
+func (s *rowSelection) Selected(index int) bool {
+	return s.rows[index]
+}
+
+// selectionColor is the background of a selected row, a tint of the
+// color that values are shown in.
+func selectionColor(th *material.Theme) color.NRGBA {
+	c := th.ContrastBg
+	c.A = 0x40
+	return c
+}
+
+// clipboardText is the text of rows, or of only those selected if any
+// are, one to a line and headed by warnings, as copied to the clipboard.
+// n is the number of rows copied.
+func clipboardText(rows []textRow, selected *rowSelection, warnings []string) (text string, n int) {
+	var b strings.Builder
+	for _, w := range warnings {
+		fmt.Fprintf(&b, "warning: %s\n", w)
+	}
+	if len(warnings) > 0 {
+		b.WriteString("\n")
+	}
+	indices := make([]int, 0, len(selected.rows))
+	for i := range selected.rows {
+		if i < len(rows) {
+			indices = append(indices, i)
+		}
+	}
+	sort.Ints(indices)
+	if len(indices) == 0 {
+		for i := range rows {
+			indices = append(indices, i)
+		}
+	}
+	for _, i := range indices {
+		b.WriteString(rows[i].String())
+		b.WriteString("\n")
+	}
+	return b.String(), len(indices)
+}
+
+// shownRows are the rows of the result as the pane lists them.
+func (p *pane) shownRows() []textRow {
+	rows, grouped := p.grouping.Rows(p.opts.Numbers, p.opts.MaxLabelValue)
+	if p.labelsOnly.Value {
+		rows = p.labelSets
+	} else if !grouped {
+		rows = p.renderer.RenderText()
+	}
+	return rows
+}
+
+// CopyResult asks for the result on display to be copied to the
+// clipboard: the rows selected, if any, or else all of them, or the
+// error of the last query if it failed. It is copied once the pane is
+// next laid out.
+func (p *pane) CopyResult() {
+	p.copyPending = true
+}
+
+// copyResult copies the result to the clipboard if it was asked for,
+// noting what was copied for the status bar.
+func (p *pane) copyResult(gtx C) {
+	if !p.copyPending {
+		return
+	}
+	p.copyPending = false
+	if p.errorText != "" {
+		clipboard.WriteOp{Text: p.errorText}.Add(gtx.Ops)
+		p.Note("copied the error", gtx.Now)
+		return
+	}
+	rows := append([]textRow(nil), p.shownRows()...)
+	for i := range rows {
+		rows[i] = p.sampleTime(rows[i])
+	}
+	text, n := clipboardText(rows, &p.selected, p.warnings)
+	if n == 0 && len(p.warnings) == 0 {
+		p.Note("there is no result to copy", gtx.Now)
+		return
+	}
+	clipboard.WriteOp{Text: text}.Add(gtx.Ops)
+	note := fmt.Sprintf("copied %d rows", n)
+	if n == 1 {
+		note = "copied 1 row"
+	}
+	p.Note(note, gtx.Now)
+}
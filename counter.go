@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// rateFunctions are the functions that make sense of a counter's running
+// total, a query using any of which is taken to know it has one.
+var rateFunctions = map[string]bool{
+	"rate": true, "irate": true, "increase": true, "resets": true,
+	"delta": true, "idelta": true, "deriv": true,
+}
+
+// counterCandidates returns the metrics whose samples a parsed query
+// returns as they are, not passed to any function, if it uses none of
+// rateFunctions. If any is a counter, the query gives only its running
+// total.
+func counterCandidates(expr promql.Expr) []string {
+	if expr == nil || expr.Type() != promql.ValueTypeVector {
+		return nil
+	}
+	rated := false
+	promql.Inspect(expr, func(n promql.Node) bool {
+		if call, ok := n.(*promql.Call); ok && rateFunctions[call.Func.Name] {
+			rated = true
+		}
+		return !rated
+	})
+	if rated {
+		return nil
+	}
+	seen := map[string]bool{}
+	var metrics []string
+	var visit func(n promql.Node)
+	visit = func(n promql.Node) {
+		switch n := n.(type) {
+		case *promql.Call, *promql.SubqueryExpr:
+			return
+		case *promql.VectorSelector:
+			if n.Name != "" && !seen[n.Name] {
+				seen[n.Name] = true
+				metrics = append(metrics, n.Name)
+			}
+		}
+		for _, child := range promql.Children(n) {
+			visit(child)
+		}
+	}
+	visit(expr)
+	sort.Strings(metrics)
+	return metrics
+}
+
+// counterResponse says which of the metrics asked about are counters.
+type counterResponse struct {
+	counters map[string]bool
+}
+
+// counterHint explains, when a query returns a counter's samples as they
+// are, that they are a running total, and suggests rate or increase. The
+// metadata of the metrics is fetched in the background, and the hint for
+// each metric can be dismissed.
+type counterHint struct {
+	fetcher latest.Worker
+	// counters records which metrics are counters, for those whose
+	// metadata has arrived, and key identifies the metrics last asked
+	// about.
+	counters map[string]bool
+	key      string
+	// metrics are the candidates of the current query.
+	metrics   []string
+	dismissed map[string]bool
+	dismiss   widget.Clickable
+	// Rate wraps the query in rate, offered when it is just the
+	// selector of a counter.
+	Rate  widget.Clickable
+	plain bool
+}
+
+func newCounterHint(b *Backend) *counterHint {
+	h := &counterHint{counters: map[string]bool{}, dismissed: map[string]bool{}}
+	h.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		metrics := in.([]string)
+		resp := counterResponse{counters: map[string]bool{}}
+		src, ok := b.Source.(MetadataSource)
+		for _, m := range metrics {
+			resp.counters[m] = ok && isCounter(src, b, m)
+		}
+		return resp
+	})
+	return h
+}
+
+// isCounter reports whether the metadata of metric says it is a counter.
+func isCounter(src MetadataSource, b *Backend, metric string) bool {
+	t, _ := metricType(src, b, metric)
+	return t == v1.MetricTypeCounter
+}
+
+// metricType returns the type that the metadata of metric gives it, if
+// any, looking also under its name without _total, as OpenMetrics names
+// counters.
+func metricType(src MetadataSource, b *Backend, metric string) (v1.MetricType, bool) {
+	names := []string{metric}
+	if base := strings.TrimSuffix(metric, "_total"); base != metric {
+		names = append(names, base)
+	}
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		md, err := src.Metadata(ctx, name, "")
+		cancel()
+		if err != nil {
+			return "", false
+		}
+		if len(md[name]) > 0 {
+			return md[name][0].Type, true
+		}
+	}
+	return "", false
+}
+
+// Update finds the metrics that a parsed query may return the running
+// totals of, and asks about those not yet known.
+func (h *counterHint) Update(expr promql.Expr) {
+	h.metrics = counterCandidates(expr)
+	_, h.plain = expr.(*promql.VectorSelector)
+	var unknown []string
+	for _, m := range h.metrics {
+		if _, ok := h.counters[m]; !ok {
+			unknown = append(unknown, m)
+		}
+	}
+	key := strings.Join(unknown, "\n")
+	if key == h.key {
+		return
+	}
+	h.key = key
+	if len(unknown) > 0 {
+		h.fetcher.Push(unknown)
+	}
+}
+
+func (h *counterHint) receive() {
+	select {
+	case r := <-h.fetcher.Raw():
+		for m, counter := range r.(counterResponse).counters {
+			h.counters[m] = counter
+		}
+	default:
+	}
+}
+
+// counter returns the first metric of the query that is a counter and
+// whose hint has not been dismissed, if any.
+func (h *counterHint) counter() (string, bool) {
+	for _, m := range h.metrics {
+		if h.counters[m] && !h.dismissed[m] {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+func (h *counterHint) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	h.receive()
+	metric, ok := h.counter()
+	if ok && h.dismiss.Clicked() {
+		h.dismissed[metric] = true
+		metric, ok = h.counter()
+	}
+	if !ok {
+		return D{}
+	}
+	text := fmt.Sprintf("%s is a counter: its value is a running total since the target started, which means little on its own; rate(%[1]s[5m]) gives its rate per second, and increase(%[1]s[1h]) how much it grew", metric)
+	children := []layout.FlexChild{
+		layout.Flexed(1, func(gtx C) D {
+			return inset.Layout(gtx, material.Body2(th, text).Layout)
+		}),
+	}
+	if h.plain {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &h.Rate, "use rate").Layout)
+		}))
+	}
+	children = append(children, layout.Rigid(func(gtx C) D {
+		return inset.Layout(gtx, material.Button(th, &h.dismiss, "dismiss").Layout)
+	}))
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/config"
+)
+
+// CurlSource is a Source that can write a curl command sending the same
+// request as a query.
+type CurlSource interface {
+	// Curl returns the command for the query. Credentials are replaced
+	// by redactedSecret unless secrets is set.
+	Curl(query string, opts queryOptions, secrets bool) (string, error)
+}
+
+// errNoCurl is returned by Curl when the Source in use cannot be
+// queried with curl.
+var errNoCurl = errors.New("copying as curl is not supported by this source")
+
+// redactedSecret stands in for credentials left out of curl commands.
+const redactedSecret = "<redacted>"
+
+// Curl writes the query as a curl command, including the endpoint's
+// credentials and TLS settings. The query is evaluated when the command
+// is run, rather than when it is written.
+func (s *apiSource) Curl(query string, opts queryOptions, secrets bool) (string, error) {
+	args := []string{"curl", "-sS"}
+	args = append(args, curlAuth(s.endpoint.HTTPClientConfig, secrets)...)
+	tls := s.endpoint.HTTPClientConfig.TLSConfig
+	if tls.InsecureSkipVerify {
+		args = append(args, "-k")
+	}
+	for _, tlsArg := range []struct{ flag, file string }{
+		{"--cacert", tls.CAFile},
+		{"--cert", tls.CertFile},
+		{"--key", tls.KeyFile},
+	} {
+		if tlsArg.file != "" {
+			args = append(args, tlsArg.flag, tlsArg.file)
+		}
+	}
+	form := s.queryForm(query, time.Time{}, opts)
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range form[k] {
+			args = append(args, "--data-urlencode", k+"="+v)
+		}
+	}
+	args = append(args, s.client.URL("/api/v1/query", nil).String())
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// curlAuth returns the curl arguments that authenticate as cfg does. A
+// token fetched with OAuth2 is never known in advance, so it is always
+// left as a placeholder.
+func curlAuth(cfg config.HTTPClientConfig, secrets bool) []string {
+	secret := func(value config.Secret, file string) string {
+		if !secrets {
+			return redactedSecret
+		}
+		if file != "" {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return redactedSecret
+			}
+			return strings.TrimSpace(string(data))
+		}
+		return string(value)
+	}
+	header := func(kind, credentials string) []string {
+		return []string{"-H", "Authorization: " + kind + " " + credentials}
+	}
+	switch {
+	case cfg.OAuth2 != nil:
+		return header("Bearer", "<oauth2 token>")
+	case cfg.Authorization != nil && (cfg.Authorization.Credentials != "" || cfg.Authorization.CredentialsFile != ""):
+		kind := cfg.Authorization.Type
+		if kind == "" {
+			kind = "Bearer"
+		}
+		return header(kind, secret(cfg.Authorization.Credentials, cfg.Authorization.CredentialsFile))
+	case cfg.BearerToken != "" || cfg.BearerTokenFile != "":
+		return header("Bearer", secret(cfg.BearerToken, cfg.BearerTokenFile))
+	case cfg.BasicAuth != nil:
+		password := secret(cfg.BasicAuth.Password, cfg.BasicAuth.PasswordFile)
+		return []string{"-u", cfg.BasicAuth.Username + ":" + password}
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell, unless it needs no quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"gioui.org/app"
+	"gioui.org/font/gofont"
+	"gioui.org/io/key"
+	"gioui.org/io/system"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/latest"
+	"gopkg.in/yaml.v2"
+)
+
+// The ways a dashboard panel shows its result.
+const (
+	// panelValue shows the value of a scalar or of the first sample of
+	// a vector in large type.
+	panelValue = "value"
+	// panelList lists each series with its value.
+	panelList = "list"
+)
+
+// maxPanelRows is the most series a list panel shows.
+const maxPanelRows = 10
+
+// kioskTextSize is the size of the body text of a dashboard in kiosk
+// mode, which the other text sizes scale with, to be read from across a
+// room.
+var kioskTextSize = unit.Sp(32)
+
+// dashboardPanel is a query shown on a dashboard.
+type dashboardPanel struct {
+	Title string `yaml:"title"`
+	Query string `yaml:"query"`
+	// Type is how the result is shown, panelValue or panelList. If it is
+	// empty, a single value is shown as panelValue and anything else as
+	// panelList.
+	Type string `yaml:"type,omitempty"`
+}
+
+// LoadDashboard reads and validates the panels listed in the YAML file at
+// path.
+func LoadDashboard(path string) ([]dashboardPanel, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read dashboard: %w", err)
+	}
+	var panels []dashboardPanel
+	if err := yaml.UnmarshalStrict(data, &panels); err != nil {
+		return nil, fmt.Errorf("could not parse dashboard %s: %w", path, err)
+	}
+	if len(panels) == 0 {
+		return nil, fmt.Errorf("dashboard %s has no panels", path)
+	}
+	for i, p := range panels {
+		if p.Query == "" {
+			return nil, fmt.Errorf("panel %d of dashboard %s has no query", i+1, path)
+		}
+		switch p.Type {
+		case "", panelValue, panelList:
+		default:
+			return nil, fmt.Errorf("panel %q of dashboard %s has unknown type %q", p.Title, path, p.Type)
+		}
+	}
+	return panels, nil
+}
+
+// dashboard shows the results of a fixed set of queries in a grid,
+// fetching them all again at every refresh. It cannot be edited.
+type dashboard struct {
+	panels []dashboardPanel
+	// thresholds color each panel's values, from its query's own
+	// thresholds if it sets any.
+	thresholds []Thresholds
+	fetcher    latest.Worker
+	results    []queryResult
+	// kiosk fills the window with the panels, in large type, for a wall
+	// display. Esc closes it.
+	kiosk bool
+}
+
+func newDashboard(b *Backend, panels []dashboardPanel, opts paneOptions) *dashboard {
+	d := &dashboard{panels: panels, thresholds: make([]Thresholds, len(panels))}
+	for i, p := range panels {
+		d.thresholds[i] = opts.Thresholds
+		if spec, ok := queryThresholds(p.Query); ok {
+			if t, err := ParseThresholds(spec); err == nil {
+				d.thresholds[i] = t
+			}
+		}
+	}
+	d.fetcher = latest.NewWorker(func(interface{}) interface{} {
+		results := make([]queryResult, len(panels))
+		for i, p := range panels {
+			results[i] = b.Query(queryRequest{Text: p.Query, Limit: opts.MaxSeries})
+		}
+		return results
+	})
+	return d
+}
+
+// Fetch queries every panel again.
+func (d *dashboard) Fetch() {
+	d.fetcher.Push(nil)
+}
+
+// panelType is how the panel at index i shows result.
+func (d *dashboard) panelType(i int, result model.Value) string {
+	if t := d.panels[i].Type; t != "" {
+		return t
+	}
+	switch v := result.(type) {
+	case *model.Scalar:
+		return panelValue
+	case model.Vector:
+		if len(v) == 1 {
+			return panelValue
+		}
+	}
+	return panelList
+}
+
+func (d *dashboard) layoutPanel(gtx C, th *material.Theme, i, width int, f NumberFormat) D {
+	gtx.Constraints.Min.X = width
+	gtx.Constraints.Max.X = gtx.Constraints.Min.X
+	inset := layout.UniformInset(unit.Dp(6))
+	title := d.panels[i].Title
+	if title == "" {
+		title = d.panels[i].Query
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			label := material.H6(th, title)
+			label.MaxLines = 1
+			return inset.Layout(gtx, label.Layout)
+		}),
+	}
+	var result queryResult
+	if i < len(d.results) {
+		result = d.results[i]
+	}
+	valueLabel := func(text string, v float64) layout.FlexChild {
+		return layout.Rigid(func(gtx C) D {
+			label := material.H4(th, text)
+			if c, ok := d.thresholds[i].Color(v); ok {
+				label.Color = c
+			}
+			return inset.Layout(gtx, label.Layout)
+		})
+	}
+	switch v := result.data.(type) {
+	case nil:
+		text := "…"
+		if result.error != nil {
+			text = result.Error()
+		} else if !result.at.IsZero() {
+			text = "no data"
+		}
+		children = append(children, layout.Rigid(func(gtx C) D {
+			label := material.Body2(th, text)
+			if result.error != nil {
+				label.Color = palette["red"]
+			}
+			return inset.Layout(gtx, label.Layout)
+		}))
+	case *model.Scalar:
+		children = append(children, valueLabel(f.Format(float64(v.Value)), float64(v.Value)))
+	case model.Vector:
+		if len(v) == 0 {
+			children = append(children, layout.Rigid(func(gtx C) D {
+				return inset.Layout(gtx, material.Body2(th, "no data").Layout)
+			}))
+			break
+		}
+		if d.panelType(i, v) == panelValue {
+			children = append(children, valueLabel(f.Format(float64(v[0].Value)), float64(v[0].Value)))
+			break
+		}
+		for j, s := range v {
+			if j == maxPanelRows {
+				more := fmt.Sprintf("and %d more", len(v)-maxPanelRows)
+				children = append(children, layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Caption(th, more).Layout)
+				}))
+				break
+			}
+			s := s
+			children = append(children, layout.Rigid(func(gtx C) D {
+				label := material.Body2(th, s.Metric.String()+" => "+f.Format(float64(s.Value)))
+				label.Font.Variant = "Mono"
+				label.MaxLines = 1
+				if c, ok := d.thresholds[i].Color(float64(s.Value)); ok {
+					label.Color = c
+				}
+				return inset.Layout(gtx, label.Layout)
+			}))
+		}
+	default:
+		text := fmt.Sprintf("a dashboard cannot show a %s", result.data.Type())
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Body2(th, text).Layout)
+		}))
+	}
+	return widget.Border{Color: th.Fg, Width: unit.Dp(1)}.Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+	})
+}
+
+func (d *dashboard) Layout(gtx C, th *material.Theme, f NumberFormat) D {
+	return layout.UniformInset(unit.Dp(6)).Layout(gtx, func(gtx C) D {
+		space := gtx.Px(unit.Dp(6))
+		width := gtx.Px(unit.Dp(280))
+		if d.kiosk {
+			// As many columns as rows, sharing the width of the window.
+			cols := int(math.Ceil(math.Sqrt(float64(len(d.panels)))))
+			width = (gtx.Constraints.Max.X - space*(cols-1)) / cols
+		}
+		return layoutWrap(gtx, space, len(d.panels), func(gtx C, i int) D {
+			return d.layoutPanel(gtx, th, i, width, f)
+		})
+	})
+}
+
+// dashboardLoop shows the dashboard in w, refreshing it every
+// opts.Refresh, until the window is closed.
+func dashboardLoop(w *app.Window, d *dashboard, opts paneOptions) error {
+	th := material.NewTheme(gofont.Collection())
+	if d.kiosk {
+		th.TextSize = kioskTextSize
+	}
+	var ops op.Ops
+	d.Fetch()
+	refresh := time.NewTimer(jitter(opts.Refresh, opts.RefreshJitter))
+	defer refresh.Stop()
+	for {
+		select {
+		case e := <-w.Events():
+			switch e := e.(type) {
+			case system.DestroyEvent:
+				return e.Err
+			case key.Event:
+				if d.kiosk && e.State == key.Press && e.Name == key.NameEscape {
+					w.Close()
+				}
+			case system.FrameEvent:
+				gtx := layout.NewContext(&ops, e)
+				d.Layout(gtx, th, opts.Numbers)
+				e.Frame(gtx.Ops)
+			}
+		case <-refresh.C:
+			refresh.Reset(jitter(opts.Refresh, opts.RefreshJitter))
+			d.Fetch()
+		case r := <-d.fetcher.Raw():
+			d.results = r.([]queryResult)
+			w.Invalidate()
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/common/config"
+	"gopkg.in/yaml.v2"
+)
+
+// Diagnostics is the effective configuration of a session, gathered from
+// the flags and the config file into one place, together with the outcome
+// of probing each endpoint, for attaching to bug reports. Only settings
+// that are not secret are copied into it, and URLs have their passwords
+// redacted, so that it can be shared as it is.
+type Diagnostics struct {
+	Version string `yaml:"version"`
+	// Config is where the endpoints were configured: a config file, or
+	// the -addr flag.
+	Config        string                `yaml:"config"`
+	ServerTimeout time.Duration         `yaml:"server_timeout,omitempty"`
+	Retries       int                   `yaml:"retries"`
+	RetryBackoff  time.Duration         `yaml:"retry_backoff"`
+	CacheSize     int                   `yaml:"cache_size"`
+	CacheTTL      time.Duration         `yaml:"cache_ttl"`
+	Endpoints     []EndpointDiagnostics `yaml:"endpoints"`
+}
+
+// EndpointDiagnostics is the effective configuration of an endpoint, with
+// its credentials described but not included.
+type EndpointDiagnostics struct {
+	Name                  string         `yaml:"name"`
+	Address               string         `yaml:"address"`
+	Backend               string         `yaml:"backend"`
+	Auth                  string         `yaml:"auth"`
+	Timeout               time.Duration  `yaml:"timeout"`
+	ConnectTimeout        time.Duration  `yaml:"connect_timeout,omitempty"`
+	MaxResponseBytes      int64          `yaml:"max_response_bytes,omitempty"`
+	ForwardAuthOnRedirect bool           `yaml:"forward_auth_on_redirect"`
+	FollowRedirects       bool           `yaml:"follow_redirects"`
+	Proxy                 string         `yaml:"proxy"`
+	TLS                   TLSDiagnostics `yaml:"tls"`
+	// Probes are the outcomes of connecting to the endpoint, by step.
+	Probes []string `yaml:"probes"`
+}
+
+// TLSDiagnostics are the TLS settings of an endpoint. Files are named but
+// not read.
+type TLSDiagnostics struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// newDiagnostics describes the configuration of a session querying the
+// endpoints with opts, configured by configPath if it is not empty, and
+// probes each endpoint.
+func newDiagnostics(endpoints []Endpoint, configPath string, opts paneOptions) Diagnostics {
+	d := Diagnostics{
+		Version:       versionString(),
+		Config:        "-addr",
+		ServerTimeout: opts.ServerTimeout,
+		Retries:       opts.Retry.Retries,
+		RetryBackoff:  opts.Retry.Backoff,
+		CacheSize:     opts.CacheSize,
+		CacheTTL:      opts.CacheTTL,
+	}
+	if configPath != "" {
+		d.Config = configPath
+	}
+	for i := range endpoints {
+		ed := endpointDiagnostics(&endpoints[i])
+		ed.Probes = probeEndpoint(&endpoints[i])
+		d.Endpoints = append(d.Endpoints, ed)
+	}
+	return d
+}
+
+func endpointDiagnostics(ep *Endpoint) EndpointDiagnostics {
+	c := ep.HTTPClientConfig
+	ed := EndpointDiagnostics{
+		Name:                  ep.Name,
+		Address:               redactURL(ep.Address),
+		Backend:               ep.Backend,
+		Auth:                  authMode(c),
+		Timeout:               ep.QueryTimeout(),
+		ConnectTimeout:        time.Duration(ep.ConnectTimeout),
+		MaxResponseBytes:      ep.MaxResponseBytes,
+		ForwardAuthOnRedirect: ep.ForwardAuthOnRedirect,
+		FollowRedirects:       c.FollowRedirects,
+		Proxy:                 "none",
+		TLS: TLSDiagnostics{
+			CAFile:             c.TLSConfig.CAFile,
+			CertFile:           c.TLSConfig.CertFile,
+			KeyFile:            c.TLSConfig.KeyFile,
+			ServerName:         c.TLSConfig.ServerName,
+			InsecureSkipVerify: c.TLSConfig.InsecureSkipVerify,
+		},
+	}
+	if ep.Name == ep.Address {
+		// As when given by -addr, which may hold a password.
+		ed.Name = ed.Address
+	}
+	if ed.Backend == "" {
+		ed.Backend = backendPrometheus
+	}
+	if c.ProxyURL.URL != nil {
+		ed.Proxy = c.ProxyURL.URL.Redacted()
+	}
+	return ed
+}
+
+// authMode describes how an endpoint authenticates, naming any files the
+// credentials are read from but never the credentials themselves.
+func authMode(c config.HTTPClientConfig) string {
+	switch {
+	case c.OAuth2 != nil:
+		return fmt.Sprintf("oauth2 client %q from %s", c.OAuth2.ClientID, redactURL(c.OAuth2.TokenURL))
+	case c.BasicAuth != nil && c.BasicAuth.PasswordFile != "":
+		return fmt.Sprintf("basic auth as %q, password from %s", c.BasicAuth.Username, c.BasicAuth.PasswordFile)
+	case c.BasicAuth != nil:
+		return fmt.Sprintf("basic auth as %q", c.BasicAuth.Username)
+	case c.Authorization != nil && c.Authorization.CredentialsFile != "":
+		return fmt.Sprintf("%s authorization from %s", c.Authorization.Type, c.Authorization.CredentialsFile)
+	case c.Authorization != nil:
+		return fmt.Sprintf("%s authorization", c.Authorization.Type)
+	case c.BearerTokenFile != "":
+		return "bearer token from " + c.BearerTokenFile
+	case c.BearerToken != "":
+		return "bearer token"
+	}
+	return "none"
+}
+
+// redactURL is the URL s with any password replaced, or a placeholder if
+// s cannot be parsed, since it might then hold one where it cannot be
+// found.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "<unparseable URL>"
+	}
+	return u.Redacted()
+}
+
+// probeEndpoint connects to the endpoint, authenticates and runs a trivial
+// query, describing the outcome of each step until one fails.
+func probeEndpoint(ep *Endpoint) []string {
+	src, err := ep.Connect()
+	if err != nil {
+		return []string{"configure client: " + err.Error()}
+	}
+	probes := []string{"configure client: ok"}
+	ctx, cancel := context.WithTimeout(context.Background(), ep.QueryTimeout())
+	defer cancel()
+	if err := ep.CheckAuth(ctx); err != nil {
+		return append(probes, "authenticate: "+err.Error())
+	}
+	if ep.HTTPClientConfig.OAuth2 != nil {
+		probes = append(probes, "authenticate: ok")
+	}
+	start := time.Now()
+	if _, _, err := src.Query(ctx, "vector(1)", start); err != nil {
+		return append(probes, "query: "+err.Error())
+	}
+	return append(probes, fmt.Sprintf("query: ok in %v", time.Since(start).Round(time.Millisecond)))
+}
+
+// String writes the diagnostics as YAML.
+func (d Diagnostics) String() string {
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		return fmt.Sprintf("could not encode diagnostics: %v", err)
+	}
+	return string(data)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// maxCrumbBase is the most characters of the base query shown in the
+// trail.
+const maxCrumbBase = 40
+
+// drillStep is a matcher added while drilling down, to the selector with
+// the given index among those of the query.
+type drillStep struct {
+	selector int
+	name     model.LabelName
+	value    model.LabelValue
+	remove   widget.Clickable
+}
+
+// drillTrail remembers the matchers added to a query from its results, in
+// order, so that any of them can be taken back. The query is generated
+// afresh from the base query it started from with the matchers that
+// remain. Editing the query by hand starts a new trail.
+type drillTrail struct {
+	base  string
+	steps []*drillStep
+	// query is the query last generated, used to tell whether it has
+	// since been edited.
+	query string
+	back  widget.Clickable
+}
+
+// sameQuery reports whether a and b differ at most in whitespace, as
+// auto-formatting leaves them.
+func sameQuery(a, b string) bool {
+	return strings.Join(strings.Fields(a), "") == strings.Join(strings.Fields(b), "")
+}
+
+// Add adds the matcher name="value" to the selector around caret in
+// text, returning the query with it.
+func (t *drillTrail) Add(text string, caret int, name model.LabelName, value model.LabelValue) string {
+	if len(t.steps) == 0 || !sameQuery(text, t.query) {
+		t.base, t.steps = text, nil
+	}
+	sels := selectors(text)
+	if len(sels) == 0 {
+		return text
+	}
+	i := selectorAt(sels, caret)
+	for _, s := range t.steps {
+		if s.selector == i && s.name == name {
+			s.value = value
+			return t.generate()
+		}
+	}
+	t.steps = append(t.steps, &drillStep{selector: i, name: name, value: value})
+	return t.generate()
+}
+
+// Edited forgets the trail if text is no longer the query it generated.
+func (t *drillTrail) Edited(text string) {
+	if len(t.steps) > 0 && !sameQuery(text, t.query) {
+		t.steps = nil
+	}
+}
+
+func (t *drillTrail) generate() string {
+	text := t.base
+	for _, s := range t.steps {
+		if sels := selectors(text); s.selector < len(sels) {
+			text, _, _ = insertMatcher(text, sels[s.selector], string(s.name), string(s.value))
+		}
+	}
+	t.query = text
+	return text
+}
+
+// Stepped returns the query after a matcher is taken back, or after
+// going back to the base query, if either has been clicked.
+func (t *drillTrail) Stepped() (string, bool) {
+	if t.back.Clicked() {
+		t.steps = nil
+		return t.base, true
+	}
+	for i, s := range t.steps {
+		if s.remove.Clicked() {
+			t.steps = append(t.steps[:i], t.steps[i+1:]...)
+			return t.generate(), true
+		}
+	}
+	return "", false
+}
+
+// Layout draws the trail as a row of buttons: the base query, followed by
+// each matcher added to it.
+func (t *drillTrail) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	if len(t.steps) == 0 {
+		return D{}
+	}
+	base := strings.Join(strings.Fields(t.base), " ")
+	if r := []rune(base); len(r) > maxCrumbBase {
+		base = string(r[:maxCrumbBase]) + "…"
+	}
+	crumbs := []layout.Widget{
+		material.Caption(th, "drill-down").Layout,
+		material.Button(th, &t.back, base).Layout,
+	}
+	for _, s := range t.steps {
+		matcher := model.LabelSet{s.name: s.value}.String()
+		crumbs = append(crumbs,
+			material.Body2(th, "›").Layout,
+			material.Button(th, &s.remove, matcher[1:len(matcher)-1]+" ×").Layout,
+		)
+	}
+	return layoutWrap(gtx, 0, len(crumbs), func(gtx C, i int) D {
+		return inset.Layout(gtx, crumbs[i])
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// durationField is an editor for a Prometheus duration such as 5m or
+// 1h30m, which is outlined in red while what is typed is not one.
+type durationField struct {
+	widget.Editor
+	// Name describes the duration in errors.
+	Name string
+
+	value time.Duration
+	err   string
+}
+
+func newDurationField(name string) *durationField {
+	f := &durationField{Name: name}
+	f.SingleLine = true
+	return f
+}
+
+// Changed parses the text if it has been edited, reporting whether it
+// has.
+func (f *durationField) Changed() bool {
+	changed := false
+	for _, e := range f.Events() {
+		if _, ok := e.(widget.ChangeEvent); ok {
+			changed = true
+		}
+	}
+	if changed {
+		f.parse()
+	}
+	return changed
+}
+
+func (f *durationField) parse() {
+	f.value, f.err = 0, ""
+	text := strings.TrimSpace(f.Text())
+	if text == "" {
+		return
+	}
+	d, err := promql.ParseDuration(text)
+	if err != nil {
+		f.err = fmt.Sprintf("invalid %s: %v", f.Name, err)
+		return
+	}
+	f.value = d
+}
+
+// Duration is the duration typed, or zero if none is or it is invalid.
+func (f *durationField) Duration() time.Duration {
+	return f.value
+}
+
+// Err describes what is wrong with the duration typed, if anything.
+func (f *durationField) Err() string {
+	return f.err
+}
+
+// Layout draws the field, width wide, with hint shown while it is empty.
+func (f *durationField) Layout(gtx C, th *material.Theme, width unit.Value, hint string) D {
+	gtx.Constraints.Max.X = gtx.Px(width)
+	gtx.Constraints.Min.X = gtx.Constraints.Max.X
+	ed := material.Editor(th, &f.Editor, hint)
+	ed.Font.Variant = "Mono"
+	if f.err == "" {
+		return ed.Layout(gtx)
+	}
+	border := widget.Border{Width: unit.Dp(1), Color: errorColor(th)}
+	return border.Layout(gtx, func(gtx C) D {
+		return layout.UniformInset(unit.Dp(1)).Layout(gtx, ed.Layout)
+	})
+}
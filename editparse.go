@@ -0,0 +1,103 @@
+package main
+
+import (
+	"time"
+
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// parseDelay is how long the query must go unedited before it is parsed
+// again for the features that analyze it, so that they change once
+// typing pauses rather than with every key.
+const parseDelay = 250 * time.Millisecond
+
+// parsedQuery is a query as edited, with the query it expands to from
+// its templates and the parse of that.
+type parsedQuery struct {
+	text, query string
+	// expr is nil if the query is empty, there being nothing to analyze.
+	expr promql.Expr
+}
+
+// editParse is the parse of the query being edited, shared by the
+// features that analyze it as it is typed. While it is mid-edit and
+// cannot be parsed, they are given the last query that could be, rather
+// than flickering off and on.
+type editParse struct {
+	// good is the last query that parsed, and err why the query as it
+	// is could not be, if it could not.
+	good *parsedQuery
+	err  error
+	// missing are the selectors of the query as it is that need a range,
+	// found even though the missing range keeps it from parsing.
+	missing []*promql.VectorSelector
+	// pending is the text edited since the last parse, to be parsed at
+	// due.
+	pending string
+	due     time.Time
+	edited  bool
+}
+
+// Edited records that the query is now text, to be parsed once it has
+// gone unedited for parseDelay.
+func (p *editParse) Edited(text string, now time.Time) {
+	p.pending, p.due, p.edited = text, now.Add(parseDelay), true
+}
+
+// Parse parses the query edited, if it is due, reporting whether it did.
+// When it did, Good may have changed.
+func (p *editParse) Parse(now time.Time) bool {
+	if !p.edited || now.Before(p.due) {
+		return false
+	}
+	p.edited = false
+	parsed, err := parseEdited(p.pending)
+	p.err, p.missing = err, nil
+	if err == nil {
+		p.good = parsed
+	} else if query, err := expand(p.pending); err == nil {
+		// A query that parses needs no range, so only one that does
+		// not is looked over again for selectors missing one.
+		p.missing = missingRanges(query)
+	}
+	return true
+}
+
+// Waiting reports whether an edit is yet to be parsed, and when.
+func (p *editParse) Waiting() (time.Time, bool) {
+	return p.due, p.edited
+}
+
+// Good is the last query that parsed, nil if none has.
+func (p *editParse) Good() *parsedQuery {
+	return p.good
+}
+
+// Missing are the selectors of the query as last parsed that need the
+// range their function takes, as in rate(foo), in order.
+func (p *editParse) Missing() []*promql.VectorSelector {
+	return p.missing
+}
+
+// Err is why the query as last parsed could not be, or nil.
+func (p *editParse) Err() error {
+	return p.err
+}
+
+// parseEdited expands and parses the query text, or reports why it
+// cannot be. Empty text parses to no expression.
+func parseEdited(text string) (*parsedQuery, error) {
+	query, err := expand(text)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &parsedQuery{text: text, query: query}
+	if emptyQuery(query) {
+		return parsed, nil
+	}
+	parsed.expr, err = promql.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
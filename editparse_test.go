@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditParseKeepsLastGoodParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial string
+	}{
+		{"unfinished selector", `up{job="api"`},
+		{"unfinished matcher", `up{job=`},
+		{"unterminated string", `up{job="api}`},
+		{"unfinished grouping", `sum by (job`},
+		{"grouping without expression", `sum by (job) (`},
+		{"unfinished range", `rate(up[5`},
+		{"range of a string", `rate(up["5m"])`},
+		{"unclosed call", `rate(up[5m]`},
+		{"dangling operator", `up +`},
+		{"unfinished template", `up{job="{{.Job"}`},
+		{"template without end", `{{if true}}up`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p editParse
+			now := time.Unix(0, 0)
+			p.Edited(`sum by (job) (rate(up[5m]))`, now)
+			now = now.Add(parseDelay)
+			if !p.Parse(now) || p.Err() != nil {
+				t.Fatalf("valid query not parsed: %v", p.Err())
+			}
+			p.Edited(tt.partial, now)
+			now = now.Add(parseDelay)
+			if !p.Parse(now) {
+				t.Fatal("edit not parsed once due")
+			}
+			if p.Err() == nil {
+				t.Errorf("%q parsed without error", tt.partial)
+			}
+			good := p.Good()
+			if want := `sum by (job) (rate(up[5m]))`; good == nil || good.text != want {
+				t.Fatalf("Good() = %+v, want the last good parse of %q", good, want)
+			}
+			if good.expr == nil || good.expr.String() != `sum by (job) (rate(up[5m]))` {
+				t.Errorf("Good().expr = %v, want the parse of the last good query", good.expr)
+			}
+		})
+	}
+}
+
+func TestEditParseWaitsForPause(t *testing.T) {
+	var p editParse
+	now := time.Unix(0, 0)
+	p.Edited("up", now)
+	if p.Parse(now.Add(parseDelay / 2)) {
+		t.Error("parsed before the edit was due")
+	}
+	p.Edited("up{", now.Add(parseDelay/2))
+	if p.Parse(now.Add(parseDelay)) {
+		t.Error("parsed before the later edit was due")
+	}
+	if !p.Parse(now.Add(parseDelay * 2)) {
+		t.Error("not parsed once due")
+	}
+	if p.Good() != nil {
+		t.Errorf("Good() = %+v, want none before any query parses", p.Good())
+	}
+	if p.Parse(now.Add(parseDelay * 3)) {
+		t.Error("parsed again without an edit")
+	}
+}
+
+// Every prefix of a query is a state it passes through as it is typed,
+// none of which may bring anything down.
+func TestParseEditedPrefixesDoNotPanic(t *testing.T) {
+	queries := []string{
+		`sum by (job, instance) (rate(http_requests_total{job=~"api|web", code!="200"}[5m] offset 1h))`,
+		`histogram_quantile(0.9, sum without (pod) (rate(latency_bucket[1m:10s] @ 1600000000)))`,
+		`{"my.metric", "ü"="x\"y"} / on (job) group_left (env) up == bool 1`,
+		`# comment
+up{job="{{"api"}}"}`,
+	}
+	for _, q := range queries {
+		for i := range q {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Errorf("parsing %q panicked: %v", q[:i], r)
+					}
+				}()
+				parseEdited(q[:i])
+			}()
+		}
+		if _, err := parseEdited(q); err != nil {
+			t.Errorf("parseEdited(%q) = %v, want nil", q, err)
+		}
+	}
+}
+
+func TestEditParseExpandsTemplates(t *testing.T) {
+	var p editParse
+	now := time.Unix(0, 0)
+	p.Edited(`up{job="{{"api"}}"}`, now)
+	if !p.Parse(now.Add(parseDelay)) || p.Err() != nil {
+		t.Fatalf("templated query not parsed: %v", p.Err())
+	}
+	good := p.Good()
+	if got, want := good.query, `up{job="api"}`; got != want {
+		t.Errorf("Good().query = %q, want %q", got, want)
+	}
+	if got, want := good.expr.String(), `up{job="api"}`; got != want {
+		t.Errorf("Good().expr = %s, want the parse of the expanded query %s", got, want)
+	}
+}
+
+func TestEditParseFindsMissingRanges(t *testing.T) {
+	var p editParse
+	now := time.Unix(0, 0)
+	p.Edited(`rate(up) + rate(down)`, now)
+	if !p.Parse(now.Add(parseDelay)) {
+		t.Fatal("edit not parsed once due")
+	}
+	if p.Err() == nil {
+		t.Fatal("query missing ranges parsed without error")
+	}
+	var got []string
+	for _, vs := range p.Missing() {
+		got = append(got, vs.String())
+	}
+	if want := []string{"up", "down"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Missing() = %q, want %q", got, want)
+	}
+}
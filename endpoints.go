@@ -0,0 +1,369 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/whereswaldon/binnacle/latest"
+)
+
+// allEndpoints is the choice of querying every endpoint at once. The NUL
+// keeps it from clashing with any sensible endpoint name.
+const allEndpoints = "\x00all"
+
+// endpointPicker lets the user switch among the configured endpoints,
+// rebuilding the client with each endpoint's settings as it is chosen.
+// With more than one endpoint, all of them can be queried together.
+type endpointPicker struct {
+	endpoints []Endpoint
+	sw        *Switch
+	choice    widget.Enum
+	// current is the endpoint in use, or nil if all are, in which case
+	// fed queries them.
+	current *Endpoint
+	fed     *Federation
+	dedupe  widget.Bool
+	// health is that of each endpoint as of probed, updated in the
+	// background by prober while probing.
+	health  []int
+	prober  latest.Worker
+	probing bool
+	probed  time.Time
+	// configPath is the file the endpoints were loaded from, if any, which
+	// is loaded again when reload is clicked or hup is signalled, with
+	// defaults applied to the endpoints it lists, as given by the flags.
+	// reloadErr describes why the last reload failed.
+	configPath string
+	defaults   func([]Endpoint)
+	reload     widget.Clickable
+	hup        chan os.Signal
+	reloadErr  string
+	// Connection connects to an endpoint typed in, which is given the
+	// defaults too.
+	Connection *connectionForm
+}
+
+// newEndpointPicker directs sw to the first of endpoints, which must
+// already be connected. Endpoints loaded or typed in later are given
+// defaults, the settings of the flags that they do not override.
+func newEndpointPicker(endpoints []Endpoint, sw *Switch, defaults func([]Endpoint)) *endpointPicker {
+	p := &endpointPicker{endpoints: endpoints, sw: sw, defaults: defaults, Connection: newConnectionForm()}
+	if len(endpoints) > 0 {
+		p.current = &endpoints[0]
+		p.choice.Value = p.current.Name
+	}
+	p.health = make([]int, len(endpoints))
+	if len(endpoints) > 1 {
+		p.prober = newHealthProber(endpoints)
+	}
+	return p
+}
+
+// WatchConfig records that the endpoints were loaded from the config file
+// at path, which is then reloaded on SIGHUP as well as on request.
+func (p *endpointPicker) WatchConfig(path string) {
+	p.configPath = path
+	p.hup = make(chan os.Signal, 1)
+	signal.Notify(p.hup, syscall.SIGHUP)
+}
+
+// Hangups receives a value for each SIGHUP once the config is watched.
+func (p *endpointPicker) Hangups() <-chan os.Signal {
+	return p.hup
+}
+
+// Reload loads the config file again and reconnects to the endpoint of
+// the same name as the one in use, or else the first, reporting whether
+// it did. If the config is invalid, its error is shown and the endpoints
+// in use remain so. Queries in flight finish with the old clients.
+func (p *endpointPicker) Reload() bool {
+	cfg, err := LoadConfig(p.configPath)
+	if err != nil {
+		slog.Error("could not reload config", "err", err)
+		p.reloadErr = err.Error()
+		return false
+	}
+	p.reloadErr = ""
+	slog.Info("reloaded config", "path", p.configPath, "endpoints", len(cfg.Endpoints))
+	p.defaults(cfg.Endpoints)
+	p.setEndpoints(cfg.Endpoints)
+	name := p.endpoints[0].Name
+	if p.current == nil && len(p.endpoints) > 1 {
+		name = allEndpoints
+	}
+	for i := range p.endpoints {
+		if p.current != nil && p.endpoints[i].Name == p.current.Name {
+			name = p.current.Name
+		}
+	}
+	p.choice.Value = name
+	if name == allEndpoints {
+		return p.connectAll()
+	}
+	return p.connect(name)
+}
+
+// setEndpoints replaces the endpoints to choose from, probing their health
+// afresh.
+func (p *endpointPicker) setEndpoints(endpoints []Endpoint) {
+	if len(p.endpoints) > 1 {
+		p.prober.Close()
+	}
+	p.endpoints = endpoints
+	p.health = make([]int, len(p.endpoints))
+	p.probing, p.probed = false, time.Time{}
+	if len(p.endpoints) > 1 {
+		p.prober = newHealthProber(p.endpoints)
+	}
+}
+
+// use connects to ep, typed into the connection form, in place of the
+// endpoint of the same name or else as another endpoint, reporting
+// whether it did. If ep is invalid, the form says why and the endpoints
+// in use remain so.
+func (p *endpointPicker) use(ep Endpoint) bool {
+	eps := []Endpoint{ep}
+	p.defaults(eps)
+	if err := eps[0].validate(); err != nil {
+		p.Connection.err = "could not connect: " + err.Error()
+		return false
+	}
+	p.Connection.err = ""
+	endpoints := append([]Endpoint(nil), p.endpoints...)
+	replaced := false
+	for i := range endpoints {
+		if endpoints[i].Name == ep.Name {
+			endpoints[i], replaced = eps[0], true
+		}
+	}
+	if !replaced {
+		endpoints = append(endpoints, eps[0])
+	}
+	p.setEndpoints(endpoints)
+	if !p.connect(ep.Name) {
+		p.Connection.err = "could not connect to " + eps[0].Address
+		return false
+	}
+	p.choice.Value = ep.Name
+	return true
+}
+
+// Timeout is the query timeout of the endpoint in use, or the longest
+// among the endpoints if all are in use.
+func (p *endpointPicker) Timeout() time.Duration {
+	if p.current != nil {
+		return p.current.QueryTimeout()
+	}
+	var timeout time.Duration
+	for i := range p.endpoints {
+		if t := p.endpoints[i].QueryTimeout(); t > timeout {
+			timeout = t
+		}
+	}
+	return timeout
+}
+
+// Switched connects to a newly chosen endpoint, reporting whether the
+// endpoint changed, or whether deduplication was toggled while all are
+// in use. If the client cannot be built, the previous endpoint remains
+// in use.
+func (p *endpointPicker) Switched() bool {
+	if p.reload.Clicked() {
+		return p.Reload()
+	}
+	if p.Connection.toggle.Clicked() {
+		p.Connection.Toggle(p.current)
+	}
+	if ep, ok := p.Connection.Applied(); ok && len(p.endpoints) > 0 {
+		return p.use(ep)
+	}
+	if p.dedupe.Changed() && p.current == nil {
+		p.fed.SetDedupe(p.dedupe.Value)
+		return true
+	}
+	if !p.choice.Changed() {
+		return false
+	}
+	if p.choice.Value == allEndpoints {
+		if p.connectAll() {
+			return true
+		}
+	} else {
+		if p.connect(p.choice.Value) {
+			return true
+		}
+	}
+	if p.current == nil {
+		p.choice.Value = allEndpoints
+	} else {
+		p.choice.Value = p.current.Name
+	}
+	return false
+}
+
+// connect directs sw to the endpoint called name.
+func (p *endpointPicker) connect(name string) bool {
+	for i := range p.endpoints {
+		ep := &p.endpoints[i]
+		if ep.Name != name {
+			continue
+		}
+		src, err := ep.Connect()
+		if err != nil {
+			slog.Error("could not switch endpoint", "endpoint", ep.Name, "err", err)
+			return false
+		}
+		slog.Info("switched endpoint", "endpoint", ep.Name, "addr", ep.Address)
+		p.sw.Set(src)
+		p.current = ep
+		return true
+	}
+	return false
+}
+
+// connectAll directs sw to a Federation of every endpoint.
+func (p *endpointPicker) connectAll() bool {
+	fed := &Federation{}
+	for i := range p.endpoints {
+		ep := &p.endpoints[i]
+		src, err := ep.Connect()
+		if err != nil {
+			slog.Error("could not switch endpoint", "endpoint", ep.Name, "err", err)
+			return false
+		}
+		fed.Names = append(fed.Names, ep.Name)
+		fed.Sources = append(fed.Sources, src)
+	}
+	slog.Info("switched to all endpoints", "endpoints", fed.Names)
+	fed.SetDedupe(p.dedupe.Value)
+	p.sw.Set(fed)
+	p.current, p.fed = nil, fed
+	return true
+}
+
+// maxShownHost is the longest endpoint host shown in full beside the
+// endpoints.
+const maxShownHost = 40
+
+// endpointHost is the host of ep, shortened by shortHost, or empty if its
+// address cannot be parsed.
+func endpointHost(ep *Endpoint) string {
+	u, err := url.Parse(ep.Address)
+	if err != nil {
+		return ""
+	}
+	return shortHost(u.Host)
+}
+
+// shortHost drops domain labels from the end of host until it is short
+// enough to show, keeping at least the first. A port is kept.
+func shortHost(host string) string {
+	if len(host) <= maxShownHost {
+		return host
+	}
+	name, port := host, ""
+	if i := strings.LastIndexByte(host, ':'); i > 0 && !strings.Contains(host[i:], "]") {
+		name, port = host[:i], host[i:]
+	}
+	labels := strings.Split(name, ".")
+	for n := len(labels) - 1; n > 0; n-- {
+		if short := strings.Join(labels[:n], ".") + ".…" + port; len(short) <= maxShownHost {
+			return short
+		}
+	}
+	if len(labels[0]) > maxShownHost {
+		return labels[0][:maxShownHost-len("…")] + "…" + port
+	}
+	return labels[0] + ".…" + port
+}
+
+// probe receives the health of the endpoints, and probes them again
+// every healthInterval.
+func (p *endpointPicker) probe(gtx C) {
+	select {
+	case h := <-p.prober.Raw():
+		p.health = h.([]int)
+		p.probing, p.probed = false, gtx.Now
+	default:
+	}
+	if !p.probing && gtx.Now.Sub(p.probed) >= healthInterval {
+		p.probing = true
+		p.prober.Push(struct{}{})
+	}
+	if p.probing {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	} else {
+		op.InvalidateOp{At: p.probed.Add(healthInterval)}.Add(gtx.Ops)
+	}
+}
+
+// Layout shows a choice of endpoints if there is more than one, each with
+// a dot showing whether it is reachable, a button to reload them if they
+// came from a config file, and one showing the connection form beneath.
+func (p *endpointPicker) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	var children []layout.FlexChild
+	if p.current != nil {
+		// This version of Gio cannot retitle a window once it is open,
+		// so the endpoint in use is shown here, following switches.
+		if host := endpointHost(p.current); host != "" {
+			children = append(children, layout.Rigid(func(gtx C) D {
+				label := material.Caption(th, "querying "+host)
+				label.MaxLines = 1
+				return inset.Layout(gtx, label.Layout)
+			}))
+		}
+	}
+	if len(p.endpoints) > 1 {
+		p.probe(gtx)
+		for i := range p.endpoints {
+			name, health := p.endpoints[i].Name, p.health[i]
+			children = append(children, layout.Rigid(func(gtx C) D {
+				return inset.Layout(gtx, func(gtx C) D {
+					return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx C) D {
+							return layoutHealthDot(gtx, health)
+						}),
+						layout.Rigid(material.RadioButton(th, &p.choice, name, name).Layout),
+					)
+				})
+			}))
+		}
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.RadioButton(th, &p.choice, allEndpoints, "all").Layout)
+		}))
+		if p.current == nil {
+			children = append(children, layout.Rigid(func(gtx C) D {
+				return inset.Layout(gtx, material.CheckBox(th, &p.dedupe, "dedupe").Layout)
+			}))
+		}
+	}
+	if p.configPath != "" {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &p.reload, "reload config").Layout)
+		}))
+	}
+	if len(p.endpoints) > 0 {
+		// Replayed sessions have no endpoints to connect to instead.
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &p.Connection.toggle, "connection").Layout)
+		}))
+	}
+	if p.reloadErr != "" {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			label := material.Caption(th, p.reloadErr)
+			label.Color = errorColor(th)
+			label.MaxLines = 1
+			return inset.Layout(gtx, label.Layout)
+		}))
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"gioui.org/io/clipboard"
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// traceLabels are the names of the labels commonly used to attach a
+// trace id to an exemplar.
+var traceLabels = []model.LabelName{"trace_id", "traceID", "traceId"}
+
+// traceID returns the trace id carried by ex, if any.
+func traceID(ex v1.Exemplar) string {
+	for _, name := range traceLabels {
+		if id, ok := ex.Labels[name]; ok {
+			return string(id)
+		}
+	}
+	return ""
+}
+
+// exemplarRow is a line of the exemplar list: either the labels of a
+// series or one of its exemplars.
+type exemplarRow struct {
+	text string
+	// traceID is the trace of an exemplar, if it has one.
+	traceID string
+}
+
+// exemplarList displays exemplars grouped by series. Clicking an
+// exemplar that has a trace id opens the trace in the browser if a trace
+// URL template is configured, or otherwise copies the id to the
+// clipboard.
+type exemplarList struct {
+	// TraceURL is a URL template containing traceURLPlaceholder.
+	TraceURL string
+
+	rows   []exemplarRow
+	clicks []widget.Clickable
+	list   layout.List
+}
+
+// Set replaces the exemplars displayed.
+func (l *exemplarList) Set(results []v1.ExemplarQueryResult, f NumberFormat) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].SeriesLabels.String() < results[j].SeriesLabels.String()
+	})
+	l.rows = l.rows[:0]
+	for _, r := range results {
+		l.rows = append(l.rows, exemplarRow{text: r.SeriesLabels.String() + " =>"})
+		for _, ex := range r.Exemplars {
+			l.rows = append(l.rows, exemplarRow{
+				text:    fmt.Sprintf("%s %s @[%s]", ex.Labels, f.Format(float64(ex.Value)), ex.Timestamp),
+				traceID: traceID(ex),
+			})
+		}
+	}
+	if len(l.clicks) < len(l.rows) {
+		l.clicks = make([]widget.Clickable, len(l.rows))
+	}
+}
+
+func (l *exemplarList) Layout(gtx C, th *material.Theme) D {
+	l.list.Axis = layout.Vertical
+	if len(l.rows) == 0 {
+		return material.Body2(th, "no exemplars").Layout(gtx)
+	}
+	return l.list.Layout(gtx, len(l.rows), func(gtx C, index int) D {
+		row := l.rows[index]
+		label := material.Body2(th, row.text)
+		label.Font.Variant = "Mono"
+		if row.traceID == "" {
+			return label.Layout(gtx)
+		}
+		click := &l.clicks[index]
+		if click.Clicked() {
+			l.open(gtx, row.traceID)
+		}
+		label.Color = th.ContrastBg
+		return material.Clickable(gtx, click, label.Layout)
+	})
+}
+
+// open shows the trace with the given id, falling back to copying the id
+// if there is no trace URL or the browser cannot be opened.
+func (l *exemplarList) open(gtx C, id string) {
+	if l.TraceURL != "" {
+		u := expandTraceURL(l.TraceURL, id)
+		err := openBrowser(u)
+		if err == nil {
+			slog.Debug("opened trace", "url", u)
+			return
+		}
+		slog.Error("could not open trace", "url", u, "err", err)
+	}
+	slog.Debug("copying trace id", "trace_id", id)
+	clipboard.WriteOp{Text: id}.Add(gtx.Ops)
+}
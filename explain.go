@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// explain renders the syntax tree of a parsed query as indented lines,
+// one per node. An empty query has none.
+func explain(expr promql.Expr) []string {
+	if expr == nil {
+		return nil
+	}
+	var lines []string
+	var walk func(n promql.Node, depth int)
+	walk = func(n promql.Node, depth int) {
+		lines = append(lines, strings.Repeat("  ", depth)+describe(n))
+		for _, child := range promql.Children(n) {
+			walk(child, depth+1)
+		}
+	}
+	walk(expr, 0)
+	return lines
+}
+
+// describe summarizes a single node without its children.
+func describe(n promql.Node) string {
+	var desc string
+	switch n := n.(type) {
+	case *promql.NumberLiteral:
+		desc = "number " + n.String()
+	case *promql.StringLiteral:
+		desc = "string " + n.String()
+	case *promql.Matcher:
+		return "matcher " + n.String()
+	case *promql.VectorSelector:
+		desc = "selector"
+		if n.Name != "" {
+			desc += " " + n.Name
+		}
+		desc += modifiers(n.Offset, n.At)
+	case *promql.MatrixSelector:
+		desc = "range [" + promql.FormatDuration(n.Range) + "]"
+	case *promql.SubqueryExpr:
+		desc = "subquery [" + promql.FormatDuration(n.Range) + ":"
+		if n.Step != 0 {
+			desc += promql.FormatDuration(n.Step)
+		}
+		desc += "]" + modifiers(n.Offset, n.At)
+	case *promql.Call:
+		desc = "call " + n.Func.Name
+	case *promql.AggregateExpr:
+		desc = "aggregate " + n.Op
+		if n.Grouped {
+			clause := "by"
+			if n.Without {
+				clause = "without"
+			}
+			desc += fmt.Sprintf(" %s (%s)", clause, strings.Join(n.Grouping, ", "))
+		}
+	case *promql.BinaryExpr:
+		desc = "binary " + strconv.Quote(n.Op)
+		if n.ReturnBool {
+			desc += " bool"
+		}
+		if n.Matching != nil {
+			desc += " " + n.Matching.String()
+		}
+	case *promql.ParenExpr:
+		desc = "parentheses"
+	case *promql.UnaryExpr:
+		desc = "unary " + strconv.Quote(n.Op)
+	}
+	if expr, ok := n.(promql.Expr); ok {
+		desc += " → " + string(expr.Type())
+	}
+	return desc
+}
+
+func modifiers(offset time.Duration, at *promql.AtModifier) string {
+	var desc string
+	if at != nil {
+		desc += " " + at.String()
+	}
+	if offset > 0 {
+		desc += " offset " + promql.FormatDuration(offset)
+	} else if offset < 0 {
+		desc += " offset -" + promql.FormatDuration(-offset)
+	}
+	return desc
+}
+
+// constantHints evaluates the constant subexpressions of a parsed query,
+// such as 3600 * 24, returning each as it is written with its value.
+// Literals on their own are left out.
+func constantHints(parsed *parsedQuery, f NumberFormat) []string {
+	if parsed == nil || parsed.expr == nil {
+		return nil
+	}
+	var hints []string
+	promql.Inspect(parsed.expr, func(n promql.Node) bool {
+		e, ok := n.(promql.Expr)
+		if !ok {
+			return true
+		}
+		v, ok := promql.Fold(e)
+		if !ok {
+			return true
+		}
+		if isLiteral(e) {
+			return false
+		}
+		r := e.PositionRange()
+		hints = append(hints, parsed.query[r.Start:r.End]+" = "+f.Format(v))
+		return false
+	})
+	return hints
+}
+
+// isLiteral reports whether e is a number, possibly signed or in
+// parentheses.
+func isLiteral(e promql.Expr) bool {
+	switch e := e.(type) {
+	case *promql.NumberLiteral:
+		return true
+	case *promql.ParenExpr:
+		return isLiteral(e.Expr)
+	case *promql.UnaryExpr:
+		return isLiteral(e.Expr)
+	}
+	return false
+}
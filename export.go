@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// defaultChartPath is where a chart is saved if no path is given.
+const defaultChartPath = "chart.png"
+
+// saveChartPNG saves the chart of v at path as a PNG image of the given
+// size in pixels, captioned with the query. A matrix is charted with the
+// options in use on screen.
+func saveChartPNG(path string, v model.Value, opts chartOptions, query string, size image.Point) error {
+	if !charted(v) {
+		return errors.New("there is no chart to save")
+	}
+	var (
+		p   *plot.Plot
+		err error
+	)
+	switch v := v.(type) {
+	case model.Vector:
+		p, err = vectorPlot(v)
+	case model.Matrix:
+		p, err = matrixPlot(v, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("could not chart result: %w", err)
+	}
+	p.Title.Text = query
+	// Pixels are drawn at the resolution that vggio assumes on screen.
+	c := vgimg.NewWith(
+		vgimg.UseWH(vg.Points(float64(size.X*3/4)), vg.Points(float64(size.Y*3/4))),
+		vgimg.UseDPI(96),
+	)
+	p.Draw(draw.New(c))
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not save chart: %w", err)
+	}
+	if _, err := (vgimg.PngCanvas{Canvas: c}).WriteTo(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not save chart: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not save chart: %w", err)
+	}
+	return nil
+}
+
+// charted reports whether v is a result that is shown as a chart.
+func charted(v model.Value) bool {
+	switch v := v.(type) {
+	case model.Vector:
+		return len(v) > 0
+	case model.Matrix:
+		return len(v) > 0
+	}
+	return false
+}
+
+// chartExport is a form for saving the chart of a pane as a PNG file.
+type chartExport struct {
+	path   widget.Editor
+	save   widget.Clickable
+	status string
+}
+
+func newChartExport() *chartExport {
+	e := &chartExport{}
+	e.path.SingleLine = true
+	e.path.Submit = true
+	return e
+}
+
+// Saving reports whether the chart should be saved, as when the button
+// is clicked or Enter is pressed in the path, and where.
+func (e *chartExport) Saving() (string, bool) {
+	submitted := false
+	for _, ev := range e.path.Events() {
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			submitted = true
+		}
+	}
+	if !e.save.Clicked() && !submitted {
+		return "", false
+	}
+	path := strings.TrimSpace(e.path.Text())
+	if path == "" {
+		path = defaultChartPath
+	}
+	return path, true
+}
+
+// Saved reports the outcome of saving the chart at path.
+func (e *chartExport) Saved(path string, err error) {
+	if err != nil {
+		e.status = err.Error()
+	} else {
+		e.status = "saved " + path
+	}
+}
+
+// Focused reports whether the path is being edited.
+func (e *chartExport) Focused() bool {
+	return e.path.Focused()
+}
+
+func (e *chartExport) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Max.X = gtx.Px(unit.Dp(160))
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				ed := material.Editor(th, &e.path, defaultChartPath)
+				ed.Font.Variant = "Mono"
+				return ed.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &e.save, "save PNG").Layout)
+		}),
+		layout.Flexed(1, func(gtx C) D {
+			return inset.Layout(gtx, material.Caption(th, e.status).Layout)
+		}),
+	)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// sourceLabel is added to each series of a federated result to name the
+// endpoint it came from.
+const sourceLabel model.LabelName = "source"
+
+// Federation is a Source that sends each query to several Sources at
+// once, merging their results. Each series is labelled with the name of
+// the Source it came from. A Source that fails is reported in the
+// warnings, unless every Source fails.
+type Federation struct {
+	Names   []string
+	Sources []Source
+
+	mu     sync.Mutex
+	dedupe bool
+}
+
+// SetDedupe chooses whether series that differ only in their source are
+// merged into one, as for a pair of Prometheus servers scraping the same
+// targets.
+func (fed *Federation) SetDedupe(dedupe bool) {
+	fed.mu.Lock()
+	defer fed.mu.Unlock()
+	fed.dedupe = dedupe
+}
+
+func (fed *Federation) deduping() bool {
+	fed.mu.Lock()
+	defer fed.mu.Unlock()
+	return fed.dedupe
+}
+
+// each calls f concurrently for the index of every source, returning the
+// errors of those for which it failed, prefixed with their names.
+func (fed *Federation) each(f func(i int) error) []error {
+	errs := make([]error, len(fed.Sources))
+	var wg sync.WaitGroup
+	for i := range fed.Sources {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := f(i); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", fed.Names[i], err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// combine turns the failures of some sources into warnings, and those
+// of all sources into an error.
+func (fed *Federation) combine(failed []error, warnings v1.Warnings) (v1.Warnings, error) {
+	if len(failed) == len(fed.Sources) && len(failed) > 0 {
+		msgs := make([]string, len(failed))
+		for i, err := range failed {
+			msgs[i] = err.Error()
+		}
+		return warnings, fmt.Errorf("all endpoints failed: %s", strings.Join(msgs, "; "))
+	}
+	// The results of the other sources are all there is.
+	for _, err := range failed {
+		warnings = append(warnings, partialResponsePrefix+err.Error())
+	}
+	return warnings, nil
+}
+
+func withSource(m model.Metric, name string) model.Metric {
+	m = m.Clone()
+	m[sourceLabel] = model.LabelValue(name)
+	return m
+}
+
+func (fed *Federation) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	values := make([]model.Value, len(fed.Sources))
+	warnings := make([]v1.Warnings, len(fed.Sources))
+	failed := fed.each(func(i int) error {
+		var err error
+		values[i], warnings[i], err = fed.Sources[i].Query(ctx, query, ts)
+		return err
+	})
+	var (
+		merged    model.Value
+		allWarned v1.Warnings
+	)
+	for i, v := range values {
+		for _, w := range warnings[i] {
+			allWarned = append(allWarned, fed.Names[i]+": "+w)
+		}
+		name := fed.Names[i]
+		switch v := v.(type) {
+		case nil:
+		case model.Vector:
+			vector, _ := merged.(model.Vector)
+			for _, s := range v {
+				s := *s
+				s.Metric = withSource(s.Metric, name)
+				vector = append(vector, &s)
+			}
+			merged = vector
+		case model.Matrix:
+			matrix, _ := merged.(model.Matrix)
+			for _, s := range v {
+				s := *s
+				s.Metric = withSource(s.Metric, name)
+				matrix = append(matrix, &s)
+			}
+			merged = matrix
+		case *model.Scalar:
+			// Scalars cannot be told apart, so they are shown as a
+			// vector with a sample per source.
+			vector, _ := merged.(model.Vector)
+			merged = append(vector, &model.Sample{
+				Metric:    model.Metric{sourceLabel: model.LabelValue(name)},
+				Value:     v.Value,
+				Timestamp: v.Timestamp,
+			})
+		default:
+			if merged == nil {
+				merged = v
+			} else {
+				allWarned = append(allWarned, fmt.Sprintf("%s: %s result not shown", name, v.Type()))
+			}
+		}
+	}
+	allWarned, err := fed.combine(failed, allWarned)
+	if err != nil {
+		return nil, allWarned, err
+	}
+	if fed.deduping() {
+		merged = dedupe(merged)
+	}
+	return merged, allWarned, nil
+}
+
+// withoutSource fingerprints m ignoring its source label.
+func withoutSource(m model.Metric) model.Fingerprint {
+	m = m.Clone()
+	delete(m, sourceLabel)
+	return m.Fingerprint()
+}
+
+// dedupe keeps one of each set of series in v that differ only in their
+// source: the latest sample of a vector, or the series of a matrix whose
+// last sample is latest, breaking ties by the greater value.
+func dedupe(v model.Value) model.Value {
+	switch v := v.(type) {
+	case model.Vector:
+		kept := map[model.Fingerprint]int{}
+		var out model.Vector
+		for _, s := range v {
+			fp := withoutSource(s.Metric)
+			i, ok := kept[fp]
+			if !ok {
+				kept[fp] = len(out)
+				out = append(out, s)
+				continue
+			}
+			if later(s.Timestamp, s.Value, out[i].Timestamp, out[i].Value) {
+				out[i] = s
+			}
+		}
+		return out
+	case model.Matrix:
+		kept := map[model.Fingerprint]int{}
+		var out model.Matrix
+		for _, s := range v {
+			if len(s.Values) == 0 {
+				continue
+			}
+			fp := withoutSource(s.Metric)
+			i, ok := kept[fp]
+			if !ok {
+				kept[fp] = len(out)
+				out = append(out, s)
+				continue
+			}
+			last, prev := s.Values[len(s.Values)-1], out[i].Values[len(out[i].Values)-1]
+			if later(last.Timestamp, last.Value, prev.Timestamp, prev.Value) {
+				out[i] = s
+			}
+		}
+		return out
+	}
+	return v
+}
+
+// later reports whether a sample at t with value v is preferred to one
+// at prevT with value prevV.
+func later(t model.Time, v model.SampleValue, prevT model.Time, prevV model.SampleValue) bool {
+	if t != prevT {
+		return t.After(prevT)
+	}
+	return v > prevV
+}
+
+func (fed *Federation) QueryExemplars(ctx context.Context, query string, startTime time.Time, endTime time.Time) ([]v1.ExemplarQueryResult, error) {
+	results := make([][]v1.ExemplarQueryResult, len(fed.Sources))
+	failed := fed.each(func(i int) error {
+		var err error
+		results[i], err = fed.Sources[i].QueryExemplars(ctx, query, startTime, endTime)
+		return err
+	})
+	if _, err := fed.combine(failed, nil); err != nil {
+		return nil, err
+	}
+	var merged []v1.ExemplarQueryResult
+	for i, rs := range results {
+		for _, r := range rs {
+			r.SeriesLabels = r.SeriesLabels.Clone()
+			r.SeriesLabels[sourceLabel] = model.LabelValue(fed.Names[i])
+			merged = append(merged, r)
+		}
+	}
+	return merged, nil
+}
+
+func (fed *Federation) LabelNames(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]string, v1.Warnings, error) {
+	results := make([][]string, len(fed.Sources))
+	failed := fed.each(func(i int) error {
+		var err error
+		results[i], _, err = fed.Sources[i].LabelNames(ctx, matches, startTime, endTime)
+		return err
+	})
+	warnings, err := fed.combine(failed, nil)
+	if err != nil {
+		return nil, warnings, err
+	}
+	seen := map[string]bool{string(sourceLabel): true}
+	names := []string{string(sourceLabel)}
+	for _, r := range results {
+		for _, name := range r {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, warnings, nil
+}
+
+func (fed *Federation) LabelValues(ctx context.Context, label string, matches []string, startTime time.Time, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	if model.LabelName(label) == sourceLabel {
+		values := make(model.LabelValues, len(fed.Names))
+		for i, name := range fed.Names {
+			values[i] = model.LabelValue(name)
+		}
+		sort.Sort(values)
+		return values, nil, nil
+	}
+	results := make([]model.LabelValues, len(fed.Sources))
+	failed := fed.each(func(i int) error {
+		var err error
+		results[i], _, err = fed.Sources[i].LabelValues(ctx, label, matches, startTime, endTime)
+		return err
+	})
+	warnings, err := fed.combine(failed, nil)
+	if err != nil {
+		return nil, warnings, err
+	}
+	seen := map[model.LabelValue]bool{}
+	var values model.LabelValues
+	for _, r := range results {
+		for _, v := range r {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	sort.Sort(values)
+	return values, warnings, nil
+}
+
+func (fed *Federation) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	results := make([][]model.LabelSet, len(fed.Sources))
+	failed := fed.each(func(i int) error {
+		var err error
+		results[i], _, err = fed.Sources[i].Series(ctx, matches, startTime, endTime)
+		return err
+	})
+	warnings, err := fed.combine(failed, nil)
+	if err != nil {
+		return nil, warnings, err
+	}
+	var series []model.LabelSet
+	for i, r := range results {
+		for _, ls := range r {
+			ls = ls.Clone()
+			ls[sourceLabel] = model.LabelValue(fed.Names[i])
+			series = append(series, ls)
+		}
+	}
+	return series, warnings, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// findAll returns the byte offsets of the non-overlapping occurrences of
+// term in text.
+func findAll(text, term string) []int {
+	if term == "" {
+		return nil
+	}
+	var matches []int
+	for i := 0; ; {
+		j := strings.Index(text[i:], term)
+		if j < 0 {
+			return matches
+		}
+		matches = append(matches, i+j)
+		i += j + len(term)
+	}
+}
+
+// queryFind searches the text of a query editor, selecting each match in
+// turn as the search term is typed or Enter is pressed.
+type queryFind struct {
+	Visible bool
+	field   widget.Editor
+	// matches are the offsets of the term in text, and current is the
+	// index of the one selected.
+	text, term string
+	matches    []int
+	current    int
+}
+
+func newQueryFind() *queryFind {
+	f := &queryFind{}
+	f.field.SingleLine = true
+	f.field.Submit = true
+	return f
+}
+
+// Focused reports whether the search term is being edited.
+func (f *queryFind) Focused() bool {
+	return f.Visible && f.field.Focused()
+}
+
+// Open shows the search bar and focuses it, searching for the selection
+// in ed if there is one on a single line.
+func (f *queryFind) Open(ed *widget.Editor) {
+	f.Visible = true
+	if sel := ed.SelectedText(); sel != "" && !strings.Contains(sel, "\n") {
+		f.field.SetText(sel)
+		n := len(sel)
+		f.field.SetCaret(n, n)
+	}
+	f.field.Focus()
+}
+
+// Close hides the search bar, returning the focus to ed.
+func (f *queryFind) Close(ed *widget.Editor) {
+	f.Visible = false
+	ed.Focus()
+}
+
+// Next selects the match after the selection in ed, or before it if
+// dir is negative, wrapping around at either end.
+func (f *queryFind) Next(ed *widget.Editor, dir int) {
+	// A fresh search already starts from the caret.
+	if !f.search(ed) && len(f.matches) > 0 {
+		f.current = (f.current + dir + len(f.matches)) % len(f.matches)
+	}
+	if len(f.matches) > 0 {
+		f.selectCurrent(ed)
+	}
+}
+
+// search finds the term in ed, if either has changed since last time,
+// making current the first match at or after the caret. It reports
+// whether it searched anew.
+func (f *queryFind) search(ed *widget.Editor) bool {
+	text, term := ed.Text(), f.field.Text()
+	if text == f.text && term == f.term {
+		return false
+	}
+	f.text, f.term = text, term
+	f.matches = findAll(text, term)
+	start, end := ed.Selection()
+	if end < start {
+		start = end
+	}
+	f.current = 0
+	for i, m := range f.matches {
+		if m >= start {
+			f.current = i
+			break
+		}
+	}
+	return true
+}
+
+func (f *queryFind) selectCurrent(ed *widget.Editor) {
+	m := f.matches[f.current]
+	ed.SetCaret(m+len(f.term), m)
+}
+
+// Layout handles edits of the search term, selecting the nearest match
+// in ed as it is typed, and draws the search bar if it is visible.
+func (f *queryFind) Layout(gtx C, th *material.Theme, inset layout.Inset, ed *widget.Editor) D {
+	for _, e := range f.field.Events() {
+		switch e.(type) {
+		case widget.ChangeEvent:
+			f.search(ed)
+			if len(f.matches) > 0 {
+				f.selectCurrent(ed)
+			}
+		case widget.SubmitEvent:
+			f.Next(ed, 1)
+		}
+	}
+	if !f.Visible {
+		return D{}
+	}
+	f.search(ed)
+	status := "no matches"
+	if len(f.matches) > 0 {
+		status = fmt.Sprintf("%d of %d", f.current+1, len(f.matches))
+	}
+	if f.term == "" {
+		status = ""
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Max.X = gtx.Px(unit.Dp(200))
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return widget.Border{Width: unit.Dp(1), Color: th.Fg}.Layout(gtx, func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						field := material.Editor(th, &f.field, "find in query")
+						field.Font.Variant = "Mono"
+						return field.Layout(gtx)
+					})
+				})
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Caption(th, status).Layout)
+		}),
+	)
+}
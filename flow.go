@@ -0,0 +1,61 @@
+package main
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+)
+
+// flowItem is a widget of a flow, laid out and waiting to be placed.
+type flowItem struct {
+	call op.CallOp
+	dims D
+}
+
+// layoutFlow lays out the widgets one after another like a Flex, but
+// wraps those that do not fit onto further rows rather than letting them
+// run off the edge, so that all of them stay within reach however narrow
+// the window. Each row is centered vertically, and widgets laid out as
+// nothing take no room.
+func layoutFlow(gtx C, widgets ...layout.Widget) D {
+	cgtx := gtx
+	cgtx.Constraints.Min = image.Point{}
+	var row []flowItem
+	var size image.Point
+	x, rowHeight := 0, 0
+	place := func() {
+		offset := 0
+		for _, item := range row {
+			stack := op.Save(gtx.Ops)
+			op.Offset(f32.Pt(float32(offset), float32(size.Y+(rowHeight-item.dims.Size.Y)/2))).Add(gtx.Ops)
+			item.call.Add(gtx.Ops)
+			stack.Load()
+			offset += item.dims.Size.X
+		}
+		if x > size.X {
+			size.X = x
+		}
+		size.Y += rowHeight
+		row, x, rowHeight = row[:0], 0, 0
+	}
+	for _, w := range widgets {
+		macro := op.Record(gtx.Ops)
+		dims := w(cgtx)
+		call := macro.Stop()
+		if dims.Size == (image.Point{}) {
+			continue
+		}
+		if len(row) > 0 && x+dims.Size.X > gtx.Constraints.Max.X {
+			place()
+		}
+		row = append(row, flowItem{call: call, dims: dims})
+		x += dims.Size.X
+		if dims.Size.Y > rowHeight {
+			rowHeight = dims.Size.Y
+		}
+	}
+	place()
+	return D{Size: gtx.Constraints.Constrain(size)}
+}
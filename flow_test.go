@@ -0,0 +1,41 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+)
+
+func TestLayoutFlowWraps(t *testing.T) {
+	box := func(w, h int) layout.Widget {
+		return func(gtx C) D {
+			return D{Size: image.Pt(w, h)}
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		width   int
+		widgets []layout.Widget
+		want    image.Point
+	}{
+		{"one row", 800, []layout.Widget{box(300, 20), box(300, 30)}, image.Pt(600, 30)},
+		{"wraps", 800, []layout.Widget{box(300, 20), box(300, 20), box(300, 20)}, image.Pt(600, 40)},
+		{"fits exactly", 800, []layout.Widget{box(400, 20), box(400, 20), box(400, 20)}, image.Pt(800, 40)},
+		{"tallest sets the row", 800, []layout.Widget{box(500, 20), box(500, 40), box(200, 10)}, image.Pt(700, 60)},
+		{"empty take no room", 800, []layout.Widget{box(600, 20), box(0, 0), box(200, 20)}, image.Pt(800, 20)},
+		{"wider than the width", 100, []layout.Widget{box(150, 20), box(50, 20)}, image.Pt(100, 40)},
+		{"nothing", 800, nil, image.Pt(0, 0)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx := layout.Context{
+				Ops:         new(op.Ops),
+				Constraints: layout.Constraints{Max: image.Pt(tt.width, 1000)},
+			}
+			if got := layoutFlow(gtx, tt.widgets...).Size; got != tt.want {
+				t.Errorf("layoutFlow size = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
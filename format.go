@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"gioui.org/widget"
+)
+
+// format indents the query in ed by its nesting of parentheses,
+// preserving the selection.
+func format(ed *widget.Editor) {
+	start, end := ed.Selection()
+	text := ed.Text()
+	finalText, endStart, endEnd := formatText(text, start, end)
+	if finalText != text {
+		ed.SetText(finalText)
+		ed.SetCaret(endStart, endEnd)
+	}
+}
+
+// formatText indents each line of text by the number of parentheses
+// left open before it, less those it begins by closing, returning the
+// result along with the byte offsets start and end mapped to their
+// positions in it. Lines are indented whole, so that a selection ending
+// partway along a line makes no difference to it.
+func formatText(text string, start, end int) (string, int, int) {
+	forward := true
+	if end < start {
+		forward = false
+		start, end = end, start
+	}
+	var result strings.Builder
+	newStart, newEnd := start, end
+	depth := 0
+	lineStart := 0
+	for i, line := range strings.Split(text, "\n") {
+		lineEnd := lineStart + len(line)
+		hasCaret := func(c int) bool { return lineStart <= c && c <= lineEnd }
+		lead := len(line) - len(strings.TrimLeft(line, " \t"))
+		// Trailing blanks are trimmed, but not those before the caret,
+		// where they may have just been typed.
+		keep := len(strings.TrimRight(line, " \t"))
+		for _, c := range []int{start, end} {
+			if hasCaret(c) && c-lineStart > keep {
+				keep = c - lineStart
+			}
+		}
+		body := ""
+		if lead < keep {
+			body = line[lead:keep]
+		}
+		// Unbalanced closing parentheses would otherwise leave a
+		// negative indent.
+		indent := depth - leadingCloseParens(body)
+		if indent < 0 {
+			indent = 0
+		}
+		prefix := strings.Repeat("  ", indent)
+		if body == "" && !hasCaret(start) && !hasCaret(end) {
+			prefix = ""
+		}
+		if i > 0 {
+			result.WriteString("\n")
+		}
+		mapOffset := func(c int, to *int) {
+			if hasCaret(c) {
+				col := c - lineStart - lead
+				if col < 0 {
+					col = 0
+				}
+				*to = result.Len() + len(prefix) + col
+			}
+		}
+		mapOffset(start, &newStart)
+		mapOffset(end, &newEnd)
+		result.WriteString(prefix)
+		result.WriteString(body)
+		depth = scanParens(line, depth, nil)
+		if depth < 0 {
+			depth = 0
+		}
+		lineStart = lineEnd + 1
+	}
+
+	if !forward {
+		newStart, newEnd = newEnd, newStart
+	}
+	return result.String(), newStart, newEnd
+}
+
+// leadingCloseParens counts the closing parentheses that line begins
+// with, blanks between them aside.
+func leadingCloseParens(line string) int {
+	n := 0
+	for _, r := range line {
+		switch r {
+		case ')':
+			n++
+		case ' ', '\t':
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// scanParens adds the nesting of parentheses in s to depth, calling f,
+// if not nil, with the offset and the new depth at each parenthesis.
+// Parentheses in comments and quoted strings, such as UTF-8 names like
+// {"requests.(total)"}, are not counted.
+func scanParens(s string, depth int, f func(i, depth int)) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		if quote != 0 {
+			switch s[i] {
+			case '\\':
+				if quote != '`' {
+					i++
+				}
+			case quote:
+				quote = 0
+			}
+			continue
+		}
+		switch s[i] {
+		case '"', '\'', '`':
+			quote = s[i]
+			continue
+		case '#':
+			// Comments, which may be prose with apostrophes, run to
+			// the end of the line.
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+		default:
+			continue
+		}
+		if f != nil {
+			f(i, depth)
+		}
+	}
+	return depth
+}
+
+// checkParens describes the first unmatched closing parenthesis in text,
+// or else the last unclosed opening one, if any.
+func checkParens(text string) string {
+	var (
+		open       []int
+		unmatched  = -1
+		isUnclosed bool
+	)
+	scanParens(text, 0, func(i, depth int) {
+		switch {
+		case unmatched >= 0:
+		case depth < 0:
+			unmatched = i
+		case text[i] == '(':
+			open = append(open, i)
+		default:
+			open = open[:len(open)-1]
+		}
+	})
+	if unmatched < 0 && len(open) > 0 {
+		unmatched, isUnclosed = open[len(open)-1], true
+	}
+	if unmatched < 0 {
+		return ""
+	}
+	line := strings.Count(text[:unmatched], "\n") + 1
+	col := unmatched - strings.LastIndex(text[:unmatched], "\n")
+	if isUnclosed {
+		return fmt.Sprintf("unclosed ( at line %d, column %d", line, col)
+	}
+	return fmt.Sprintf("unmatched ) at line %d, column %d", line, col)
+}
+
+// formatStream formats the query read from r, writing it to w.
+func formatStream(w io.Writer, r io.Reader) error {
+	text, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not read query: %w", err)
+	}
+	formatted, _, _ := formatText(string(text), 0, 0)
+	if _, err := io.WriteString(w, formatted); err != nil {
+		return fmt.Errorf("could not write query: %w", err)
+	}
+	return nil
+}
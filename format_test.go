@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatStreamGolden(t *testing.T) {
+	ins, err := filepath.Glob(filepath.Join("testdata", "*.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ins) == 0 {
+		t.Fatal("no testdata/*.in files")
+	}
+	for _, in := range ins {
+		name := strings.TrimSuffix(filepath.Base(in), ".in")
+		t.Run(name, func(t *testing.T) {
+			query, err := os.Open(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer query.Close()
+			want, err := ioutil.ReadFile(strings.TrimSuffix(in, ".in") + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := formatStream(&got, query); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("formatted %s:\n%s\nwant:\n%s", in, got.String(), want)
+			}
+		})
+	}
+}
+
+// trailingBlanks returns the lines of text, other than any holding the
+// offsets start or end, that end in a blank.
+func trailingBlanks(text string, start, end int) []string {
+	var bad []string
+	lineStart := 0
+	for _, line := range strings.Split(text, "\n") {
+		lineEnd := lineStart + len(line)
+		onCaret := lineStart <= start && start <= lineEnd || lineStart <= end && end <= lineEnd
+		if !onCaret && strings.TrimRight(line, " \t") != line {
+			bad = append(bad, line)
+		}
+		lineStart = lineEnd + 1
+	}
+	return bad
+}
+
+func TestFormatTrimsTrailingBlanks(t *testing.T) {
+	for _, tt := range []struct {
+		text       string
+		start, end int
+		want       string
+	}{
+		{"up   \n\t\n", 0, 0, "up\n\n"},
+		{"sum(\nup \t\n)  \n", 0, 0, "sum(\n  up\n)\n"},
+		// Blanks before the caret may have just been typed, and are kept
+		// for the next word.
+		{"sum(\nup   ", 10, 10, "sum(\n  up   "},
+		{"sum(up   \n)\t", 6, 6, "sum(up\n)"},
+		{"up   \nfoo  ", 5, 11, "up   \nfoo  "},
+	} {
+		got, start, end := formatText(tt.text, tt.start, tt.end)
+		if got != tt.want {
+			t.Errorf("formatText(%q, %d, %d) = %q, want %q", tt.text, tt.start, tt.end, got, tt.want)
+		}
+		if bad := trailingBlanks(got, start, end); len(bad) > 0 {
+			t.Errorf("formatText(%q, %d, %d) left trailing blanks on %q", tt.text, tt.start, tt.end, bad)
+		}
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	for _, tt := range []struct {
+		name               string
+		text               string
+		start, end         int
+		want               string
+		wantStart, wantEnd int
+	}{
+		{
+			name: "multi-line sum(rate)",
+			text: "sum by (job) (\nrate(http_requests_total{job=\"api\"}[5m])\n)",
+			want: "sum by (job) (\n  rate(http_requests_total{job=\"api\"}[5m])\n)",
+		},
+		{
+			name:  "caret follows its line",
+			text:  "sum(\nrate(up[5m])\n)",
+			start: 10, end: 10,
+			want:      "sum(\n  rate(up[5m])\n)",
+			wantStart: 12, wantEnd: 12,
+		},
+		{
+			name:  "partial-line selection",
+			text:  "sum(\nrate(up[5m])\n)",
+			start: 7, end: 11,
+			want:      "sum(\n  rate(up[5m])\n)",
+			wantStart: 9, wantEnd: 13,
+		},
+		{
+			name:  "backward selection",
+			text:  "sum(\nrate(up[5m])\n)",
+			start: 11, end: 7,
+			want:      "sum(\n  rate(up[5m])\n)",
+			wantStart: 13, wantEnd: 9,
+		},
+		{
+			name:  "caret in indent",
+			text:  "sum(\n    rate(up[5m])\n)",
+			start: 7, end: 7,
+			want:      "sum(\n  rate(up[5m])\n)",
+			wantStart: 7, wantEnd: 7,
+		},
+		{
+			name:  "caret on blank line is indented",
+			text:  "sum(\n\nup\n)",
+			start: 5, end: 5,
+			want:      "sum(\n  \n  up\n)",
+			wantStart: 7, wantEnd: 7,
+		},
+		{
+			name: "all blank lines",
+			text: "  \n\t\n ",
+			want: "\n\n",
+		},
+		{
+			name:  "all blank lines with caret",
+			text:  "  \n\t\n ",
+			start: 3, end: 3,
+			want:      "\n\n",
+			wantStart: 1, wantEnd: 1,
+		},
+		{
+			name: "unbalanced closing parentheses",
+			text: "up)\n)\n    foo",
+			want: "up)\n)\nfoo",
+		},
+		{
+			name: "closing parentheses dedent",
+			text: "sum(rate(\nup[5m]\n))",
+			want: "sum(rate(\n    up[5m]\n))",
+		},
+	} {
+		got, start, end := formatText(tt.text, tt.start, tt.end)
+		if got != tt.want || start != tt.wantStart || end != tt.wantEnd {
+			t.Errorf("%s: formatText(%q, %d, %d) = %q, %d, %d, want %q, %d, %d",
+				tt.name, tt.text, tt.start, tt.end, got, start, end, tt.want, tt.wantStart, tt.wantEnd)
+		}
+		if bad := trailingBlanks(got, start, end); len(bad) > 0 {
+			t.Errorf("%s: left trailing blanks on %q", tt.name, bad)
+		}
+	}
+}
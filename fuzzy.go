@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Bonuses and penalties of fuzzyScore.
+const (
+	fuzzyMatch       = 1
+	fuzzyConsecutive = 5
+	fuzzyWordStart   = 8
+	fuzzyPrefix      = 10
+	fuzzyGap         = -1
+)
+
+// fuzzyScore reports whether the letters of pattern appear in order in
+// candidate, ignoring case, and how well they match if so. Runs of
+// consecutive letters and letters starting a word of the name score best,
+// so that "cpusec" ranks node_cpu_seconds_total above node_cpu_guest_seconds.
+func fuzzyScore(pattern, candidate string) (int, bool) {
+	pattern, lower := strings.ToLower(pattern), strings.ToLower(candidate)
+	score, next, last := 0, 0, -1
+	for i := 0; i < len(lower) && next < len(pattern); i++ {
+		if lower[i] != pattern[next] {
+			continue
+		}
+		score += fuzzyMatch
+		switch {
+		case i == 0:
+			score += fuzzyPrefix
+		case last == i-1:
+			score += fuzzyConsecutive
+		case lower[i-1] == '_' || lower[i-1] == ':' || candidate[i-1] >= 'a' && candidate[i-1] <= 'z' && candidate[i] >= 'A' && candidate[i] <= 'Z':
+			score += fuzzyWordStart
+		}
+		if last >= 0 {
+			score += fuzzyGap * (i - last - 1)
+		}
+		last = i
+		next++
+	}
+	return score, next == len(pattern)
+}
+
+// fuzzyRank returns the candidates that pattern fuzzily matches, best
+// first, keeping the order of those that match equally well.
+func fuzzyRank(pattern string, candidates []string) []string {
+	type ranked struct {
+		name  string
+		score int
+	}
+	var matches []ranked
+	for _, c := range candidates {
+		if score, ok := fuzzyScore(pattern, c); ok {
+			matches = append(matches, ranked{c, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.name
+	}
+	return names
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, candidate string
+		score              int
+		ok                 bool
+	}{
+		{"", "up", 0, true},
+		{"up", "up", 17, true},
+		{"UP", "up", 17, true},
+		{"up", "UP", 17, true},
+		// A word start after _, and the letters running on from it.
+		{"cpu", "node_cpu", 21, true},
+		// Each letter skipped between matches costs a point.
+		{"ns", "node_seconds", 16, true},
+		{"ns", "nodes", 9, true},
+		// A capital after a small letter starts a word too.
+		{"rc", "requestCount", 14, true},
+		{"rc", "requestcount", 6, true},
+		{"job", "job:rate5m", 23, true},
+		// So does a letter after :.
+		{"r5", "job:rate5m", 7, true},
+		{"xyz", "up", 0, false},
+		{"pu", "up", 1, false},
+		{"upp", "up", 17, false},
+	} {
+		score, ok := fuzzyScore(tt.pattern, tt.candidate)
+		if score != tt.score || ok != tt.ok {
+			t.Errorf("fuzzyScore(%q, %q) = %d, %v, want %d, %v", tt.pattern, tt.candidate, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyRank(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		pattern    string
+		candidates []string
+		want       []string
+	}{
+		{"word starts", "cpusec", []string{"node_cpu_guest_seconds", "node_cpu_seconds_total"},
+			[]string{"node_cpu_seconds_total", "node_cpu_guest_seconds"}},
+		{"prefix first", "up", []string{"backup_size", "up"}, []string{"up", "backup_size"}},
+		{"ties keep their order", "up", []string{"up_b", "up_a", "up_c"}, []string{"up_b", "up_a", "up_c"}},
+		{"ties keep their order reversed", "up", []string{"up_c", "up_a", "up_b"}, []string{"up_c", "up_a", "up_b"}},
+		{"ties among others", "up", []string{"backup", "up_b", "upgrade", "up_a"}, []string{"up_b", "upgrade", "up_a", "backup"}},
+		{"empty pattern keeps all", "", []string{"b", "a"}, []string{"b", "a"}},
+		{"non-matches left out", "zz", []string{"up", "node_load1"}, []string{}},
+		{"no candidates", "up", nil, []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fuzzyRank(tt.pattern, tt.candidates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fuzzyRank(%q, %q) = %q, want %q", tt.pattern, tt.candidates, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// grafanaPanel is the part of a Grafana panel, or of a dashboard or row
+// holding panels, that carries its queries.
+type grafanaPanel struct {
+	Targets []struct {
+		Expr string `json:"expr"`
+		Hide bool   `json:"hide"`
+	} `json:"targets"`
+	Panels []grafanaPanel `json:"panels"`
+}
+
+// grafanaExprs returns the PromQL expressions of the visible targets of
+// text, if it is the JSON of a Grafana panel or dashboard.
+func grafanaExprs(text string) []string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") {
+		return nil
+	}
+	var panel grafanaPanel
+	if err := json.Unmarshal([]byte(text), &panel); err != nil {
+		return nil
+	}
+	var exprs []string
+	var walk func(p grafanaPanel)
+	walk = func(p grafanaPanel) {
+		for _, t := range p.Targets {
+			if t.Expr != "" && !t.Hide {
+				exprs = append(exprs, t.Expr)
+			}
+		}
+		for _, child := range p.Panels {
+			walk(child)
+		}
+	}
+	walk(panel)
+	return exprs
+}
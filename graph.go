@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// instantWindow chooses, instead of one of rangeWindows, to evaluate a
+// pane's query at an instant.
+const instantWindow = "instant"
+
+// rangeWindows are the ranges that a pane's query can be evaluated over,
+// up to now, as a range query charting its history.
+var rangeWindows = []string{"15m", "1h", "6h"}
+
+// graphPoints is about how many samples each series has when a query is
+// graphed over its history, which sets the step of the subquery.
+const graphPoints = 240
+
+// graphStep is the step at which a query graphed over rng is evaluated,
+// in whole seconds.
+func graphStep(rng time.Duration) time.Duration {
+	step := (rng / graphPoints).Round(time.Second)
+	if step < time.Second {
+		step = time.Second
+	}
+	return step
+}
+
+// graphable reports whether a parsed query is an instant vector, whose
+// history can be graphed by evaluating it as a subquery.
+func graphable(expr promql.Expr) bool {
+	return expr != nil && expr.Type() == promql.ValueTypeVector
+}
+
+// rangeable reports whether query, already expanded, can be evaluated as
+// a range query, which only instant vectors and scalars can.
+func rangeable(query string) bool {
+	e, err := promql.Parse(query)
+	return err == nil && (e.Type() == promql.ValueTypeVector || e.Type() == promql.ValueTypeScalar)
+}
+
+// graphQuery is text evaluated as a subquery over rng, so that its
+// result is the history of each of its series, ready to chart.
+func graphQuery(text string, rng time.Duration) string {
+	sub := "[" + promql.FormatDuration(rng) + ":" + promql.FormatDuration(graphStep(rng)) + "]"
+	text = strings.TrimSpace(text)
+	if strings.Contains(text, "#") {
+		// A comment on the last line would swallow the subquery.
+		return "(\n" + text + "\n)" + sub
+	}
+	query, err := expand(text)
+	if err != nil {
+		return "(" + text + ")" + sub
+	}
+	switch e, _ := promql.Parse(query); e := e.(type) {
+	case *promql.VectorSelector:
+		if e.Offset == 0 && e.At == nil {
+			return text + sub
+		}
+	case *promql.Call, *promql.AggregateExpr, *promql.ParenExpr:
+		return text + sub
+	}
+	return "(" + text + ")" + sub
+}
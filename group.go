@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/text"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// resultGrouping arranges the rows of a vector result into groups of
+// series sharing a value of a chosen label. Each group has a header,
+// which can be clicked to collapse or expand it.
+type resultGrouping struct {
+	// Label is the name of the label to group by.
+	Label widget.Editor
+
+	collapsed map[string]bool
+	headers   map[string]*widget.Clickable
+
+	dirty bool
+	value model.Value
+	rows  []textRow
+}
+
+func newResultGrouping() *resultGrouping {
+	g := &resultGrouping{
+		collapsed: map[string]bool{},
+		headers:   map[string]*widget.Clickable{},
+	}
+	g.Label.SingleLine = true
+	return g
+}
+
+// SetData replaces the result to be grouped.
+func (g *resultGrouping) SetData(v model.Value) {
+	g.value = v
+	g.dirty = true
+}
+
+// Rows returns the grouped rows, or ok=false if the result is not
+// grouped because no label is chosen or it is not a vector.
+func (g *resultGrouping) Rows(f NumberFormat, maxValue int) (rows []textRow, ok bool) {
+	for _, e := range g.Label.Events() {
+		if _, ok := e.(widget.ChangeEvent); ok {
+			g.dirty = true
+		}
+	}
+	for group, click := range g.headers {
+		if click.Clicked() {
+			g.collapsed[group] = !g.collapsed[group]
+			g.dirty = true
+		}
+	}
+	label := model.LabelName(strings.TrimSpace(g.Label.Text()))
+	vector, isVector := g.value.(model.Vector)
+	if label == "" || !isVector {
+		return nil, false
+	}
+	if g.dirty {
+		g.dirty = false
+		g.rows = g.group(vector, label, f, maxValue)
+	}
+	return g.rows, true
+}
+
+func (g *resultGrouping) group(v model.Vector, label model.LabelName, f NumberFormat, maxValue int) []textRow {
+	groups := map[string]model.Vector{}
+	for _, s := range v {
+		value := string(s.Metric[label])
+		groups[value] = append(groups[value], s)
+	}
+	values := make([]string, 0, len(groups))
+	for value := range groups {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	var rows []textRow
+	for _, value := range values {
+		series := groups[value]
+		header := fmt.Sprintf("%s=%q", label, value)
+		if value == "" {
+			header = fmt.Sprintf("no %s", label)
+		}
+		marker := "▾ "
+		if g.collapsed[value] {
+			marker = "▸ "
+		}
+		rows = append(rows, textRow{
+			Label:  fmt.Sprintf("%s%s (%d series)", marker, header, len(series)),
+			Header: true,
+			Group:  value,
+		})
+		if g.headers[value] == nil {
+			g.headers[value] = new(widget.Clickable)
+		}
+		if !g.collapsed[value] {
+			rows = append(rows, formatRows(series, f, maxValue)...)
+		}
+	}
+	return rows
+}
+
+// layoutHeader draws the header of a group, which toggles whether the
+// group is collapsed when clicked.
+func (g *resultGrouping) layoutHeader(gtx C, th *material.Theme, row textRow) D {
+	label := material.Body1(th, row.Label)
+	label.Font.Variant = "Mono"
+	label.Font.Weight = text.Bold
+	return material.Clickable(gtx, g.headers[row.Group], func(gtx C) D {
+		return layout.W.Layout(gtx, label.Layout)
+	})
+}
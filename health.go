@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	"sync"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"github.com/whereswaldon/binnacle/latest"
+)
+
+// HealthSource is a Source that can check whether its server is ready to
+// answer queries.
+type HealthSource interface {
+	Ready(ctx context.Context) error
+}
+
+// Ready checks the server's readiness endpoint, which is cheap for it to
+// answer.
+func (s *apiSource) Ready(ctx context.Context) error {
+	u := s.client.URL("/-/ready", nil)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("could not build readiness check: %w", err)
+	}
+	resp, _, err := s.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
+
+// The health of an endpoint, as last probed.
+const (
+	healthUnknown = iota
+	healthy
+	unreachable
+)
+
+const (
+	// healthInterval is how often the endpoints are probed.
+	healthInterval = 30 * time.Second
+	// healthTimeout bounds each probe, so that one endpoint that does not
+	// answer cannot hold up the next round.
+	healthTimeout = 5 * time.Second
+)
+
+// healthColors are the colors of the dots showing each health.
+var healthColors = map[int]color.NRGBA{
+	healthUnknown: palette["gray"],
+	healthy:       palette["green"],
+	unreachable:   palette["red"],
+}
+
+// newHealthProber returns a worker that, for each push, probes all of
+// the endpoints at once, yielding their health in order. Clients are
+// built once, on the first probe.
+func newHealthProber(endpoints []Endpoint) latest.Worker {
+	var sources []Source
+	return latest.NewWorker(func(interface{}) interface{} {
+		if sources == nil {
+			sources = make([]Source, len(endpoints))
+			for i := range endpoints {
+				// An endpoint that cannot be connected to stays
+				// unknown, having been reported when it was loaded.
+				sources[i], _ = endpoints[i].Connect()
+			}
+		}
+		health := make([]int, len(endpoints))
+		var wg sync.WaitGroup
+		for i, src := range sources {
+			src, ok := src.(HealthSource)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+				defer cancel()
+				if err := src.Ready(ctx); err != nil {
+					health[i] = unreachable
+				} else {
+					health[i] = healthy
+				}
+			}(i)
+		}
+		wg.Wait()
+		return health
+	})
+}
+
+// layoutHealthDot draws a dot in the color of the health h.
+func layoutHealthDot(gtx C, h int) D {
+	size := gtx.Px(unit.Dp(8))
+	r := float32(size) / 2
+	dot := clip.UniformRRect(f32.Rectangle{Max: f32.Pt(float32(size), float32(size))}, r)
+	paint.FillShape(gtx.Ops, healthColors[h], dot.Op(gtx.Ops))
+	return D{Size: image.Pt(size, size)}
+}
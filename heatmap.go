@@ -0,0 +1,64 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/prometheus/common/model"
+)
+
+// heatAlpha is the opacity of heatmap backgrounds, light enough for the
+// text over them to stay readable.
+const heatAlpha = 0x48
+
+// heatScale colors values by where they fall between the least and
+// greatest values of a result, from blue to red.
+type heatScale struct {
+	min, max float64
+	ok       bool
+}
+
+// newHeatScale spans the finite values of v, other than stale markers.
+func newHeatScale(v model.Value) heatScale {
+	var h heatScale
+	add := func(s model.SampleValue) {
+		x := float64(s)
+		if math.IsNaN(x) || math.IsInf(x, 0) || isStaleMarker(s) {
+			return
+		}
+		if !h.ok || x < h.min {
+			h.min = x
+		}
+		if !h.ok || x > h.max {
+			h.max = x
+		}
+		h.ok = true
+	}
+	switch v := v.(type) {
+	case model.Vector:
+		for _, s := range v {
+			add(s.Value)
+		}
+	case model.Matrix:
+		for _, ss := range v {
+			for _, p := range ss.Values {
+				add(p.Value)
+			}
+		}
+	}
+	return h
+}
+
+// Color is the background of a row with value x, reporting false if x
+// has none, as when it is not finite or the result has no range.
+func (h heatScale) Color(x float64) (color.NRGBA, bool) {
+	if !h.ok || h.max == h.min || math.IsNaN(x) || math.IsInf(x, 0) {
+		return color.NRGBA{}, false
+	}
+	f := (x - h.min) / (h.max - h.min)
+	lo, hi := palette["blue"], palette["red"]
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + f*(float64(b)-float64(a)) + .5)
+	}
+	return color.NRGBA{R: mix(lo.R, hi.R), G: mix(lo.G, hi.G), B: mix(lo.B, hi.B), A: heatAlpha}, true
+}
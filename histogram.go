@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/palette/moreland"
+	"gonum.org/v1/plot/plotter"
+)
+
+// bucketLabel is the label holding the upper bound of each bucket of a
+// classic histogram.
+const bucketLabel model.LabelName = "le"
+
+// isHistogram reports whether every series of v is a bucket of a classic
+// histogram, as from rate(foo_bucket[5m]), so that it can be charted as
+// a heatmap. Native histograms are not recognized, since the client
+// library in use does not decode them.
+func isHistogram(v model.Value) bool {
+	m, ok := v.(model.Matrix)
+	if !ok || len(m) == 0 {
+		return false
+	}
+	for _, s := range m {
+		if _, err := parseBucketBound(s.Metric[bucketLabel]); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func parseBucketBound(le model.LabelValue) (float64, error) {
+	return strconv.ParseFloat(string(le), 64)
+}
+
+// bucketGrid is the count of each bucket of a histogram at each time,
+// summed over the series of each bucket and no longer cumulative, for
+// charting as a heatmap.
+type bucketGrid struct {
+	times  []model.Time
+	bounds []model.LabelValue
+	// counts holds the count of each bucket at each time, by time and
+	// then bucket, NaN where it is missing.
+	counts   [][]float64
+	min, max float64
+}
+
+// newBucketGrid sums the series of data not hidden by the bucket they
+// count, in order of their bounds, and subtracts from each bucket the
+// one below it.
+func newBucketGrid(data model.Matrix, hidden map[model.Fingerprint]bool) *bucketGrid {
+	sums := map[model.LabelValue]map[model.Time]float64{}
+	seen := map[model.Time]bool{}
+	g := &bucketGrid{}
+	for _, s := range data {
+		if hidden[s.Metric.Fingerprint()] {
+			continue
+		}
+		le := s.Metric[bucketLabel]
+		if sums[le] == nil {
+			sums[le] = map[model.Time]float64{}
+			g.bounds = append(g.bounds, le)
+		}
+		for _, p := range s.Values {
+			if !seen[p.Timestamp] {
+				seen[p.Timestamp] = true
+				g.times = append(g.times, p.Timestamp)
+			}
+			sums[le][p.Timestamp] += float64(p.Value)
+		}
+	}
+	sort.Slice(g.times, func(i, j int) bool { return g.times[i] < g.times[j] })
+	sort.Slice(g.bounds, func(i, j int) bool {
+		a, _ := parseBucketBound(g.bounds[i])
+		b, _ := parseBucketBound(g.bounds[j])
+		return a < b
+	})
+	g.min, g.max = math.Inf(1), math.Inf(-1)
+	g.counts = make([][]float64, len(g.times))
+	for i, t := range g.times {
+		g.counts[i] = make([]float64, len(g.bounds))
+		below := 0.0
+		for j, le := range g.bounds {
+			total, ok := sums[le][t]
+			if !ok {
+				g.counts[i][j] = math.NaN()
+				continue
+			}
+			c := math.Max(total-below, 0)
+			below = total
+			g.counts[i][j] = c
+			if !math.IsNaN(c) && !math.IsInf(c, 0) {
+				g.min, g.max = math.Min(g.min, c), math.Max(g.max, c)
+			}
+		}
+	}
+	return g
+}
+
+func (g *bucketGrid) Dims() (c, r int)   { return len(g.times), len(g.bounds) }
+func (g *bucketGrid) Z(c, r int) float64 { return g.counts[c][r] }
+func (g *bucketGrid) X(c int) float64    { return float64(g.times[c]) / 1000 }
+func (g *bucketGrid) Y(r int) float64    { return float64(r) }
+func (g *bucketGrid) Min() float64       { return g.min }
+func (g *bucketGrid) Max() float64       { return g.max }
+
+// histogramPlot charts the buckets of the histogram in data as a heatmap
+// over time, one row per bucket from the lowest bound up, shaded by the
+// count of the bucket alone.
+func histogramPlot(data model.Matrix, opts chartOptions) (*plot.Plot, error) {
+	p := plot.New()
+	p.X.Tick.Marker = plot.TimeTicks{Format: "15:04:05", Time: plot.UnixTimeIn(time.Local)}
+	defer zoom(p, opts)
+	g := newBucketGrid(data, opts.Hidden)
+	if len(g.times) == 0 || g.min > g.max {
+		return p, nil
+	}
+	h := plotter.NewHeatMap(g, moreland.SmoothBlueRed().Palette(255))
+	if h.Min == h.Max {
+		// A single count would map to no color of the palette.
+		h.Max = h.Min + 1
+	}
+	p.Add(h)
+	labels := make([]string, len(g.bounds))
+	for i, le := range g.bounds {
+		labels[i] = "le=" + string(le)
+	}
+	p.NominalY(labels...)
+	return p, nil
+}
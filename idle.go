@@ -0,0 +1,50 @@
+package main
+
+import "net/http"
+
+// IdleCloser is a Source that can close the connections it keeps open
+// between queries. Later queries connect again.
+type IdleCloser interface {
+	CloseIdleConnections()
+}
+
+// closeIdle closes the idle connections of rt, if it keeps any.
+func closeIdle(rt http.RoundTripper) {
+	if c, ok := rt.(IdleCloser); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (t gzipTransport) CloseIdleConnections() {
+	closeIdle(t.RoundTripper)
+}
+
+func (s *apiSource) CloseIdleConnections() {
+	closeIdle(s.transport)
+}
+
+// CloseIdleConnections forwards to the wrapped Source, if it keeps
+// connections open.
+func (r *Recorder) CloseIdleConnections() {
+	if c, ok := r.Source.(IdleCloser); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections forwards to the current Source, if it keeps
+// connections open.
+func (s *Switch) CloseIdleConnections() {
+	if c, ok := s.current().(IdleCloser); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections forwards to each Source that keeps connections
+// open.
+func (fed *Federation) CloseIdleConnections() {
+	for _, src := range fed.Sources {
+		if c, ok := src.(IdleCloser); ok {
+			c.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gioui.org/gesture"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// A chord is a key pressed together with a set of modifiers.
+type chord struct {
+	Name      string
+	Modifiers key.Modifiers
+}
+
+// matches reports whether e presses the chord. Gio names keys by what
+// they type in the keyboard layout in use, not by where they are, so a
+// chord like Ctrl+Z follows the key labelled Z on any layout. Symbols
+// such as / and ? match regardless of Shift, since whether they need it
+// depends on the layout.
+func (c chord) matches(e key.Event) bool {
+	if e.State != key.Press || e.Name != c.Name {
+		return false
+	}
+	if e.Modifiers == c.Modifiers {
+		return true
+	}
+	return !c.Modifiers.Contain(key.ModShift) && e.Modifiers == c.Modifiers|key.ModShift && isSymbol(c.Name)
+}
+
+func isSymbol(name string) bool {
+	r := []rune(name)
+	return len(r) == 1 && !unicode.IsLetter(r[0]) && !unicode.IsDigit(r[0]) && unicode.IsPrint(r[0])
+}
+
+// modifierNames lists modifiers in the order they are written in chords.
+var modifierNames = []struct {
+	mod  key.Modifiers
+	name string
+}{
+	{key.ModCtrl, "Ctrl"},
+	{key.ModCommand, "Cmd"},
+	{key.ModAlt, "Alt"},
+	{key.ModSuper, "Super"},
+	{key.ModShift, "Shift"},
+}
+
+// keyNames spells out the special keys that Gio names with symbols.
+var keyNames = map[string]string{
+	key.NameEscape:         "Esc",
+	key.NameReturn:         "Enter",
+	key.NameEnter:          "Enter",
+	key.NameTab:            "Tab",
+	key.NameUpArrow:        "Up",
+	key.NameDownArrow:      "Down",
+	key.NameLeftArrow:      "Left",
+	key.NameRightArrow:     "Right",
+	key.NameDeleteBackward: "Backspace",
+	key.NameDeleteForward:  "Delete",
+	key.NamePageUp:         "PageUp",
+	key.NamePageDown:       "PageDown",
+	key.NameHome:           "Home",
+	key.NameEnd:            "End",
+}
+
+func (c chord) String() string {
+	var parts []string
+	for _, m := range modifierNames {
+		if c.Modifiers.Contain(m.mod) {
+			parts = append(parts, m.name)
+		}
+	}
+	name := c.Name
+	if n, ok := keyNames[name]; ok {
+		name = n
+	}
+	return strings.Join(append(parts, name), "+")
+}
+
+// An action is something the user can do from the keyboard.
+type action string
+
+const (
+	actionUndo         action = "undo"
+	actionRedo         action = "redo"
+	actionJobSelector  action = "insert-job-selector"
+	actionWrapRate     action = "wrap-rate"
+	actionWrapSum      action = "wrap-sum"
+	actionToggleMatch  action = "toggle-matcher"
+	actionDuplicate    action = "duplicate-query"
+	actionFind         action = "find-in-query"
+	actionFindNext     action = "find-next"
+	actionFindPrev     action = "find-previous"
+	actionFocusEditor  action = "focus-editor"
+	actionShowKeys     action = "show-shortcuts"
+	actionDismiss      action = "dismiss"
+	actionReloadConfig action = "reload-config"
+	actionCycleView    action = "cycle-view"
+	actionRerun        action = "rerun-query"
+	actionRun          action = "run-query"
+	actionFreeze       action = "freeze-results"
+	actionRecallPrev   action = "recall-previous-query"
+	actionComplete     action = "complete-name"
+	actionConnection   action = "connection-settings"
+	actionRecallNext   action = "recall-next-query"
+	actionCopyResult   action = "copy-result"
+	actionToggleTheme  action = "toggle-theme"
+)
+
+// binding describes an action and the chords that trigger it.
+type binding struct {
+	Action      action
+	Description string
+	Chords      []chord
+}
+
+// keymap lists every keyboard shortcut, in the order that the shortcut
+// reference shows them.
+var keymap = []binding{
+	{actionUndo, "undo the last edit", []chord{{"Z", key.ModShortcut}}},
+	{actionRedo, "redo the last undone edit", []chord{{"Y", key.ModShortcut}, {"Z", key.ModShortcut | key.ModShift}}},
+	{actionJobSelector, "insert a job selector", []chord{{"J", key.ModAlt}}},
+	{actionWrapRate, "wrap the selection in rate", []chord{{"R", key.ModAlt}}},
+	{actionWrapSum, "wrap the selection, or the whole query, in sum by", []chord{{"S", key.ModAlt}}},
+	{actionToggleMatch, "switch the matcher at the caret between exact and regex matching", []chord{{"M", key.ModAlt}}},
+	{actionDuplicate, "copy the query into the other pane without running it, pressed twice if that pane has another query", []chord{{"D", key.ModShortcut}}},
+	{actionFind, "find in the query", []chord{{"F", key.ModShortcut}}},
+	{actionFindNext, "select the next match in the query", []chord{{"F3", 0}}},
+	{actionFindPrev, "select the previous match in the query", []chord{{"F3", key.ModShift}}},
+	{actionFocusEditor, "jump to the query editor", []chord{{"/", 0}}},
+	{actionCycleView, "show the result as text and chart, text or chart in turn", []chord{{"M", key.ModShortcut}}},
+	{actionRerun, "run the query again now, asking the server even for a cached result", []chord{{"R", key.ModShortcut}}},
+	{actionRun, "run the query, as when running manually", []chord{{key.NameReturn, key.ModShortcut}, {key.NameEnter, key.ModShortcut}}},
+	{actionFreeze, "freeze or unfreeze the result on display", []chord{{"F", key.ModShortcut | key.ModShift}}},
+	{actionRecallPrev, "recall the query submitted before, with the caret on the first line", []chord{{key.NameUpArrow, 0}}},
+	{actionRecallNext, "recall the query submitted after, or the draft, with the caret on the last line", []chord{{key.NameDownArrow, 0}}},
+	{actionComplete, "complete the name at the caret with the first name offered", []chord{{key.NameTab, 0}, {key.NameReturn, 0}, {key.NameEnter, 0}}},
+	{actionCopyResult, "copy the result, or the rows of it selected by clicking them, while no text box has focus", []chord{{"C", key.ModShortcut}}},
+	{actionToggleTheme, "switch between the light and dark themes", []chord{{"T", key.ModShortcut}}},
+	{actionReloadConfig, "reload the config file", []chord{{"R", key.ModShortcut | key.ModShift}}},
+	{actionConnection, "show or hide the form connecting to another server", []chord{{",", key.ModShortcut}}},
+	{actionShowKeys, "show this list of shortcuts", []chord{{"?", 0}, {"F1", 0}}},
+	{actionDismiss, "close this list, or the names offered to complete the query", []chord{{key.NameEscape, 0}}},
+}
+
+// parseChord parses a chord written like "Ctrl+Shift+Z". The modifier
+// Shortcut stands for the platform's usual shortcut modifier.
+func parseChord(s string) (chord, error) {
+	var c chord
+	parts := strings.Split(s, "+")
+	if strings.HasSuffix(s, "++") {
+		// The plus key itself.
+		parts = append(parts[:len(parts)-2], "+")
+	}
+	for _, p := range parts[:len(parts)-1] {
+		switch p = strings.TrimSpace(p); {
+		case strings.EqualFold(p, "Shortcut"):
+			c.Modifiers |= key.ModShortcut
+		default:
+			found := false
+			for _, m := range modifierNames {
+				if strings.EqualFold(p, m.name) {
+					c.Modifiers |= m.mod
+					found = true
+				}
+			}
+			if !found {
+				return chord{}, fmt.Errorf("unknown modifier %q in %q", p, s)
+			}
+		}
+	}
+	name := strings.TrimSpace(parts[len(parts)-1])
+	if name == "" {
+		return chord{}, fmt.Errorf("missing key in %q", s)
+	}
+	for k, n := range keyNames {
+		// Both Return and keypad Enter are spelled Enter; prefer Return.
+		if strings.EqualFold(name, n) && k != key.NameEnter {
+			name = k
+		}
+	}
+	if r := []rune(name); len(r) == 1 {
+		name = strings.ToUpper(name)
+	}
+	c.Name = name
+	return c, nil
+}
+
+// rebind replaces the chords of the actions named in keys, which maps
+// action names to chords as written by parseChord. If any entry is
+// invalid, the keymap is left as it was and the error of the first
+// invalid action in name order is returned.
+func rebind(keys map[string][]string) error {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bound := append([]binding(nil), keymap...)
+	for _, name := range names {
+		i := -1
+		for j, b := range bound {
+			if string(b.Action) == name {
+				i = j
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("unknown action %q", name)
+		}
+		parsed := make([]chord, len(keys[name]))
+		for j, s := range keys[name] {
+			c, err := parseChord(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			parsed[j] = c
+		}
+		bound[i].Chords = parsed
+	}
+	keymap = bound
+	return nil
+}
+
+// A keyHandler performs an action in response to e if it applies,
+// reporting whether it did.
+type keyHandler func(e key.Event) bool
+
+// keyDispatcher routes key presses through the keymap to the handlers
+// registered for their actions.
+type keyDispatcher struct {
+	handlers map[action][]keyHandler
+}
+
+func newKeyDispatcher() *keyDispatcher {
+	return &keyDispatcher{handlers: map[action][]keyHandler{}}
+}
+
+// Register adds h to the handlers of a. Handlers are tried in the
+// order they were registered until one applies.
+func (d *keyDispatcher) Register(a action, h keyHandler) {
+	d.handlers[a] = append(d.handlers[a], h)
+}
+
+// Dispatch performs the first action bound to e whose handler applies,
+// reporting whether there was one.
+func (d *keyDispatcher) Dispatch(e key.Event) bool {
+	for _, b := range keymap {
+		for _, c := range b.Chords {
+			if !c.matches(e) {
+				continue
+			}
+			for _, h := range d.handlers[b.Action] {
+				if h(e) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// keyHelp is an overlay listing the keyboard shortcuts.
+type keyHelp struct {
+	Visible bool
+	// pressed is the last chord pressed while the list was shown, as
+	// written in the settings file, for rebinding keys on layouts whose
+	// keys are named differently.
+	pressed string
+	scrim   gesture.Click
+	// card is the tag of the handler that keeps clicks on the list
+	// from reaching the scrim behind it.
+	card bool
+	list layout.List
+}
+
+// Press records the chord e presses, if the list is shown.
+func (h *keyHelp) Press(e key.Event) {
+	if h.Visible && e.State == key.Press {
+		h.pressed = chord{Name: e.Name, Modifiers: e.Modifiers}.String()
+	}
+}
+
+// Layout draws the overlay, if visible, over the whole window. Clicking
+// outside the list dismisses it.
+func (h *keyHelp) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	for _, e := range h.scrim.Events(gtx) {
+		if e.Type == gesture.TypeClick {
+			h.Visible = false
+		}
+	}
+	if !h.Visible {
+		return D{}
+	}
+	h.list.Axis = layout.Vertical
+	size := gtx.Constraints.Max
+	paint.FillShape(gtx.Ops, color.NRGBA{A: 0x80}, clip.Rect{Max: size}.Op())
+	stack := op.Save(gtx.Ops)
+	pointer.Rect(image.Rectangle{Max: size}).Add(gtx.Ops)
+	h.scrim.Add(gtx.Ops)
+	stack.Load()
+	layout.Center.Layout(gtx, func(gtx C) D {
+		return layout.Stack{}.Layout(gtx,
+			layout.Expanded(func(gtx C) D {
+				paint.FillShape(gtx.Ops, th.Bg, clip.Rect{Max: gtx.Constraints.Min}.Op())
+				stack := op.Save(gtx.Ops)
+				pointer.Rect(image.Rectangle{Max: gtx.Constraints.Min}).Add(gtx.Ops)
+				pointer.InputOp{Tag: &h.card, Types: pointer.Press | pointer.Release}.Add(gtx.Ops)
+				stack.Load()
+				return D{Size: gtx.Constraints.Min}
+			}),
+			layout.Stacked(func(gtx C) D {
+				return layout.UniformInset(unit.Dp(16)).Layout(gtx, func(gtx C) D {
+					return h.list.Layout(gtx, len(keymap)+2, func(gtx C, index int) D {
+						switch index {
+						case 0:
+							return inset.Layout(gtx, material.H6(th, "Keyboard shortcuts").Layout)
+						case 1:
+							text := "Press a key to see how to write it under keys in the settings file."
+							if h.pressed != "" {
+								text = "Last pressed: " + h.pressed
+							}
+							return inset.Layout(gtx, material.Caption(th, text).Layout)
+						}
+						b := keymap[index-2]
+						chords := make([]string, len(b.Chords))
+						for i, c := range b.Chords {
+							chords[i] = c.String()
+						}
+						return layout.Flex{}.Layout(gtx,
+							layout.Rigid(func(gtx C) D {
+								gtx.Constraints.Min.X = gtx.Px(unit.Dp(160))
+								label := material.Body1(th, strings.Join(chords, ", "))
+								label.Font.Variant = "Mono"
+								return inset.Layout(gtx, label.Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.Body1(th, b.Description).Layout)
+							}),
+						)
+					})
+				})
+			}),
+		)
+	})
+	return D{Size: size}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gioui.org/io/key"
+)
+
+// chordsOf returns the chords bound to a.
+func chordsOf(a action) []chord {
+	for _, b := range keymap {
+		if b.Action == a {
+			return b.Chords
+		}
+	}
+	return nil
+}
+
+func TestRebind(t *testing.T) {
+	defer func(saved []binding) { keymap = saved }(append([]binding(nil), keymap...))
+	if err := rebind(map[string][]string{"copy-result": {"Shortcut+Shift+C", "Alt+C"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []chord{{"C", key.ModShortcut | key.ModShift}, {"C", key.ModAlt}}
+	if got := chordsOf(actionCopyResult); !reflect.DeepEqual(got, want) {
+		t.Errorf("copy-result bound to %v, want %v", got, want)
+	}
+}
+
+func TestRebindInvalidKeepsKeymap(t *testing.T) {
+	defer func(saved []binding) { keymap = saved }(append([]binding(nil), keymap...))
+	for _, keys := range []map[string][]string{
+		{"copy-result": {"Alt+C"}, "run-query": {"Hyper+R"}},
+		{"copy-result": {"Alt+C"}, "no-such-action": {"X"}},
+		{"copy-result": {"Alt+C"}, "run-query": {"Shortcut+"}},
+	} {
+		before := append([]binding(nil), keymap...)
+		// Map order varies, so try each a few times.
+		for i := 0; i < 10; i++ {
+			err := rebind(keys)
+			if err == nil {
+				t.Fatalf("rebind(%v) succeeded", keys)
+			}
+			if !reflect.DeepEqual(keymap, before) {
+				t.Fatalf("rebind(%v) = %v, but changed the keymap", keys, err)
+			}
+			if !strings.Contains(err.Error(), "run-query") && !strings.Contains(err.Error(), "no-such-action") {
+				t.Errorf("rebind(%v) = %v, want it to name the invalid action", keys, err)
+			}
+		}
+	}
+}
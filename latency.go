@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// latencyLimit bounds the number of recent query durations retained.
+const latencyLimit = 40
+
+// latencies records the durations of recent queries, oldest first.
+type latencies []time.Duration
+
+// Add records d, discarding the oldest duration if the limit is reached.
+func (l *latencies) Add(d time.Duration) {
+	*l = append(*l, d)
+	if len(*l) > latencyLimit {
+		*l = (*l)[len(*l)-latencyLimit:]
+	}
+}
+
+func (l latencies) max() time.Duration {
+	var m time.Duration
+	for _, d := range l {
+		if d > m {
+			m = d
+		}
+	}
+	return m
+}
+
+// layoutAge shows how long ago the results on display arrived, counting
+// up every second.
+func layoutAge(gtx C, th *material.Theme, updated time.Time) D {
+	age := gtx.Now.Sub(updated).Truncate(time.Second)
+	if age < 0 {
+		age = 0
+	}
+	op.InvalidateOp{At: updated.Add(age + time.Second)}.Add(gtx.Ops)
+	return material.Caption(th, "updated "+age.String()+" ago").Layout(gtx)
+}
+
+// layoutLatencies draws recent query durations as a sparkline of bars
+// scaled to the slowest of them, labelled with the latest duration.
+func layoutLatencies(gtx C, th *material.Theme, l latencies) D {
+	if len(l) == 0 {
+		return D{}
+	}
+	slowest := l.max()
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			bar := gtx.Px(unit.Dp(3))
+			size := image.Pt(bar*latencyLimit, gtx.Px(unit.Dp(20)))
+			for i, d := range l {
+				height := 1
+				if slowest > 0 {
+					height += int(int64(size.Y-1) * int64(d) / int64(slowest))
+				}
+				x := i * bar
+				rect := image.Rect(x, size.Y-height, x+bar-1, size.Y)
+				paint.FillShape(gtx.Ops, th.ContrastBg, clip.Rect(rect).Op())
+			}
+			return D{Size: size}
+		}),
+		layout.Rigid(func(gtx C) D {
+			last := l[len(l)-1].Round(time.Millisecond)
+			text := fmt.Sprintf(" %v (max %v)", last, slowest.Round(time.Millisecond))
+			return material.Caption(th, text).Layout(gtx)
+		}),
+	)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// errResponseTooLarge is the error reading a response body larger than
+// the limit of its endpoint.
+var errResponseTooLarge = errors.New("response too large")
+
+// limitTransport fails to read the body of any response once it has
+// read max bytes of it, so that a pathological response cannot use up
+// all memory. It wraps gzipTransport, limiting the decompressed body.
+type limitTransport struct {
+	http.RoundTripper
+	max int64
+}
+
+func (t limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, left: t.max, max: t.max}
+	return resp, nil
+}
+
+func (t limitTransport) CloseIdleConnections() {
+	closeIdle(t.RoundTripper)
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	left, max int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// Reading past the limit tells a body of exactly max bytes from
+		// a larger one.
+		var more [1]byte
+		n, err := b.ReadCloser.Read(more[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: more than %d bytes", errResponseTooLarge, b.max)
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
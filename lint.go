@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// A lint is a heuristic check of a query for mistakes that the server
+// does not reject, such as ones that may be costly to evaluate. Each lint
+// is given a node of the query together with the nodes enclosing it,
+// outermost first, and returns a warning about the node, if any.
+type lint struct {
+	id    string
+	check func(n promql.Node, enclosing []promql.Node) string
+}
+
+// lints are all the lints run on each query, unless disabled by id.
+var lints = []lint{
+	{"unbounded-aggregation", lintUnboundedAggregation},
+	{"high-cardinality-grouping", lintHighCardinalityGrouping},
+}
+
+// reducingAggregations are the aggregation operators that, with no by or
+// without clause, reduce every series of their argument to one.
+var reducingAggregations = map[string]bool{
+	"sum": true, "avg": true, "count": true, "min": true, "max": true,
+	"group": true, "stddev": true, "stdvar": true, "quantile": true,
+}
+
+// highCardinalityLabels are labels whose values commonly number in the
+// thousands, so that grouping by them gives about as many series.
+var highCardinalityLabels = map[string]bool{
+	"instance": true, "pod": true, "container_id": true, "id": true,
+	"ip": true, "path": true, "url": true, "uid": true,
+}
+
+// lintIDs lists the ids of the lints, for flag help and errors.
+func lintIDs() string {
+	ids := make([]string, len(lints))
+	for i, l := range lints {
+		ids[i] = l.id
+	}
+	return strings.Join(ids, ", ")
+}
+
+// parseLintIDs parses a comma-separated list of lint ids, failing if any
+// is not that of a lint.
+func parseLintIDs(s string) (map[string]bool, error) {
+	known := map[string]bool{}
+	for _, l := range lints {
+		known[l.id] = true
+	}
+	ids := map[string]bool{}
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if !known[id] {
+			return nil, fmt.Errorf("unknown lint %q; lints are %s", id, lintIDs())
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// lintQuery runs the lints not disabled on a parsed query, returning
+// their warnings, each prefixed by the id of its lint so that it can be
+// disabled. An empty query gets none.
+func lintQuery(expr promql.Expr, disabled map[string]bool) []string {
+	if expr == nil {
+		return nil
+	}
+	var warnings []string
+	var visit func(n promql.Node, enclosing []promql.Node)
+	visit = func(n promql.Node, enclosing []promql.Node) {
+		for _, l := range lints {
+			if disabled[l.id] {
+				continue
+			}
+			if w := l.check(n, enclosing); w != "" {
+				warnings = append(warnings, "lint "+l.id+": "+w)
+			}
+		}
+		enclosing = append(enclosing, n)
+		for _, child := range promql.Children(n) {
+			visit(child, enclosing[:len(enclosing):len(enclosing)])
+		}
+	}
+	visit(expr, nil)
+	return warnings
+}
+
+// lintUnboundedAggregation warns of an aggregation to a single series of
+// every series of a metric, with no label matchers to narrow them, which
+// for a widely exported metric means reading a great many series.
+func lintUnboundedAggregation(n promql.Node, enclosing []promql.Node) string {
+	agg, ok := n.(*promql.AggregateExpr)
+	if !ok || agg.Grouped || !reducingAggregations[agg.Op] {
+		return ""
+	}
+	var names []string
+	seen := map[string]bool{}
+	promql.Inspect(agg.Expr, func(n promql.Node) bool {
+		if vs, ok := n.(*promql.VectorSelector); ok && unboundedSelector(vs) {
+			name := selectorName(vs)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return true
+	})
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%s with no by or without reads every series of %s; label matchers would narrow it", agg.Op, strings.Join(names, ", "))
+}
+
+// unboundedSelector reports whether vs selects every series of a metric,
+// matching on nothing but its name.
+func unboundedSelector(vs *promql.VectorSelector) bool {
+	for _, m := range vs.Matchers {
+		if m.Name != "__name__" {
+			return false
+		}
+	}
+	return true
+}
+
+func selectorName(vs *promql.VectorSelector) string {
+	if vs.Name != "" {
+		return vs.Name
+	}
+	return vs.String()
+}
+
+// lintHighCardinalityGrouping warns of an aggregation by a label such as
+// instance that may have thousands of values, giving a series for each,
+// unless an enclosing aggregation reduces them again.
+func lintHighCardinalityGrouping(n promql.Node, enclosing []promql.Node) string {
+	agg, ok := n.(*promql.AggregateExpr)
+	if !ok || agg.Without {
+		return ""
+	}
+	for _, e := range enclosing {
+		if _, ok := e.(*promql.AggregateExpr); ok {
+			return ""
+		}
+	}
+	for _, label := range agg.Grouping {
+		if highCardinalityLabels[label] {
+			return fmt.Sprintf("%s by (%s) gives a series for each %s, of which there may be thousands", agg.Op, label, label)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+func TestLintQuery(t *testing.T) {
+	for _, tt := range []struct {
+		query    string
+		disabled string
+		want     []string
+	}{
+		{``, "", nil},
+		{`up`, "", nil},
+
+		// unbounded-aggregation
+		{`sum(rate(http_requests_total[5m]))`, "", []string{
+			"lint unbounded-aggregation: sum with no by or without reads every series of http_requests_total; label matchers would narrow it",
+		}},
+		{`count({__name__="up"})`, "", []string{
+			`lint unbounded-aggregation: count with no by or without reads every series of {__name__="up"}; label matchers would narrow it`,
+		}},
+		{`max(b) + min(a / b)`, "", []string{
+			"lint unbounded-aggregation: max with no by or without reads every series of b; label matchers would narrow it",
+			"lint unbounded-aggregation: min with no by or without reads every series of a, b; label matchers would narrow it",
+		}},
+		{`sum(rate(http_requests_total{job="api"}[5m]))`, "", nil},
+		{`sum by (job) (rate(http_requests_total[5m]))`, "", nil},
+		{`sum without (pod) (rate(http_requests_total[5m]))`, "", nil},
+		{`topk(5, http_requests_total)`, "", nil},
+		{`sum(vector(1))`, "", nil},
+		{`sum(rate(http_requests_total[5m]))`, "unbounded-aggregation", nil},
+
+		// high-cardinality-grouping
+		{`sum by (instance) (up{job="api"})`, "", []string{
+			"lint high-cardinality-grouping: sum by (instance) gives a series for each instance, of which there may be thousands",
+		}},
+		{`avg by (job, pod) (up{job="api"})`, "", []string{
+			"lint high-cardinality-grouping: avg by (pod) gives a series for each pod, of which there may be thousands",
+		}},
+		{`sum by (job) (up{job="api"})`, "", nil},
+		{`sum without (instance) (up{job="api"})`, "", nil},
+		// The enclosing count reduces the series again.
+		{`count(sum by (instance) (up{job="api"}))`, "", nil},
+		{`sum by (instance) (up{job="api"})`, "high-cardinality-grouping", nil},
+
+		// A grouped aggregation is not unbounded, whatever it groups by.
+		{`sum by (instance) (up)`, "", []string{
+			"lint high-cardinality-grouping: sum by (instance) gives a series for each instance, of which there may be thousands",
+		}},
+
+		// Both, unless disabled.
+		{`sum(up) / sum by (pod) (up{job="api"})`, "", []string{
+			"lint unbounded-aggregation: sum with no by or without reads every series of up; label matchers would narrow it",
+			"lint high-cardinality-grouping: sum by (pod) gives a series for each pod, of which there may be thousands",
+		}},
+		{`sum(up) / sum by (pod) (up{job="api"})`, "unbounded-aggregation, high-cardinality-grouping", nil},
+	} {
+		disabled, err := parseLintIDs(tt.disabled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expr promql.Expr
+		if tt.query != "" {
+			if expr, err = promql.Parse(tt.query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := lintQuery(expr, disabled); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lintQuery(%s) disabling %q = %q, want %q", tt.query, tt.disabled, got, tt.want)
+		}
+	}
+}
+
+func TestParseLintIDs(t *testing.T) {
+	if _, err := parseLintIDs("unbounded-aggregation, nope"); err == nil {
+		t.Error(`parseLintIDs("unbounded-aggregation, nope") succeeded, want an unknown lint`)
+	}
+	ids, err := parseLintIDs(" high-cardinality-grouping,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"high-cardinality-grouping": true}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("parseLintIDs = %v, want %v", ids, want)
+	}
+}
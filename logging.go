@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// setupLogging directs structured logs at or above level to the file at
+// path, or to stderr if path is empty. The returned writer should be
+// closed when logging is no longer needed.
+func setupLogging(level slog.Level, path string) (io.Closer, error) {
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open log file: %w", err)
+		}
+		out = f
+	}
+	handler := slog.NewTextHandler(out, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(handler))
+	return out, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// fatal logs msg as an error and exits with a nonzero status.
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
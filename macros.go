@@ -0,0 +1,319 @@
+package main
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"gioui.org/widget"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// A macro rewrites the query text around the selection [start, end),
+// returning the new text and the selection to apply afterward.
+type macro func(text string, start, end int) (string, int, int)
+
+// macros maps the keymap actions that trigger a macro to the macro.
+var macros = map[action]macro{
+	actionJobSelector: insertJobSelector,
+	actionWrapRate:    wrapRate,
+	actionWrapSum:     wrapSum,
+	actionToggleMatch: toggleMatcher,
+}
+
+// applyMacro runs m over the editor's text and selection.
+func applyMacro(ed *widget.Editor, m macro) {
+	start, end := ed.Selection()
+	if end < start {
+		start, end = end, start
+	}
+	text, start, end := m(ed.Text(), start, end)
+	ed.SetText(text)
+	ed.SetCaret(start, end)
+}
+
+// insertJobSelector replaces the selection with a job matcher, leaving
+// the caret between its quotes.
+func insertJobSelector(text string, start, end int) (string, int, int) {
+	const prefix, suffix = `{job="`, `"}`
+	caret := start + len(prefix)
+	return text[:start] + prefix + suffix + text[end:], caret, caret
+}
+
+// wrapRate wraps the selection in a five minute rate. With no selection
+// the caret is left where the selector belongs.
+func wrapRate(text string, start, end int) (string, int, int) {
+	const prefix, suffix = "rate(", "[5m])"
+	if start == end {
+		caret := start + len(prefix)
+		return text[:start] + prefix + suffix + text[end:], caret, caret
+	}
+	caret := end + len(prefix) + len(suffix)
+	return text[:start] + prefix + text[start:end] + suffix + text[end:], caret, caret
+}
+
+// wrapSum wraps the selection, or the whole query if nothing is selected,
+// in a sum aggregation, leaving the caret in its grouping clause.
+func wrapSum(text string, start, end int) (string, int, int) {
+	const prefix, suffix = "sum by (", ") ("
+	start, end = selectionOrAll(text, start, end)
+	caret := start + len(prefix)
+	return text[:start] + prefix + suffix + text[start:end] + ")" + text[end:], caret, caret
+}
+
+// insertText returns a macro that replaces the selection with text,
+// leaving the caret after it.
+func insertText(text string) macro {
+	return func(s string, start, end int) (string, int, int) {
+		caret := start + len(text)
+		return s[:start] + text + s[end:], caret, caret
+	}
+}
+
+// selectionOrAll widens an empty selection to the whole text.
+func selectionOrAll(text string, start, end int) (int, int) {
+	if start == end {
+		return 0, len(text)
+	}
+	return start, end
+}
+
+// wrapAbsent wraps the selection, or the whole query if nothing is
+// selected, in absent.
+func wrapAbsent(text string, start, end int) (string, int, int) {
+	start, end = selectionOrAll(text, start, end)
+	wrapped := "absent(" + text[start:end] + ")"
+	caret := start + len(wrapped)
+	return text[:start] + wrapped + text[end:], caret, caret
+}
+
+// compareTo returns a macro that compares the selection, or the whole
+// query if nothing is selected, using cond, such as "> 0.9". The
+// expression is parenthesized if it is itself a binary operation, which
+// might otherwise bind more loosely than the comparison.
+func compareTo(cond string) macro {
+	return func(text string, start, end int) (string, int, int) {
+		start, end = selectionOrAll(text, start, end)
+		expr := strings.TrimSpace(text[start:end])
+		if e, err := promql.Parse(expr); err != nil || isBinary(e) {
+			expr = "(" + expr + ")"
+		}
+		wrapped := expr + " " + strings.TrimSpace(cond)
+		caret := start + len(wrapped)
+		return text[:start] + wrapped + text[end:], caret, caret
+	}
+}
+
+// wrapSubquery returns a macro that evaluates the selection, or the whole
+// query if nothing is selected, as a subquery over rng at resolution
+// step, such as "30m" and "1m", inside max_over_time. The function name
+// is left selected to be replaced with another.
+func wrapSubquery(rng, step string) macro {
+	const fn = "max_over_time"
+	return func(text string, start, end int) (string, int, int) {
+		start, end = selectionOrAll(text, start, end)
+		expr := strings.TrimSpace(text[start:end])
+		if e, err := promql.Parse(expr); err != nil || isBinary(e) {
+			expr = "(" + expr + ")"
+		}
+		wrapped := fn + "(" + expr + "[" + rng + ":" + step + "])"
+		return text[:start] + wrapped + text[end:], start, start + len(fn)
+	}
+}
+
+func isBinary(e promql.Expr) bool {
+	_, ok := e.(*promql.BinaryExpr)
+	return ok
+}
+
+// matcherPattern matches a label matcher, whose name may be quoted,
+// capturing its operator and its quoted value.
+var matcherPattern = regexp.MustCompile(`(?:[a-zA-Z_][a-zA-Z0-9_]*|"(?:[^"\\]|\\.)*")\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`)")
+
+// toggledMatch maps each matcher operator to its exact or regular
+// expression counterpart.
+var toggledMatch = map[string]string{
+	"=":  "=~",
+	"=~": "=",
+	"!=": "!~",
+	"!~": "!=",
+}
+
+// toggleMatcher switches the label matcher around the caret between
+// exact and regular expression matching, keeping it negated if it was.
+// The value is escaped as a regular expression so that it matches the
+// same, and unescaped again if it is nothing but a literal. The caret
+// keeps its place relative to the matcher.
+func toggleMatcher(text string, start, end int) (string, int, int) {
+	for _, m := range matcherPattern.FindAllStringSubmatchIndex(text, -1) {
+		if start < m[0] || start > m[1] {
+			continue
+		}
+		op, quoted := text[m[2]:m[3]], text[m[4]:m[5]]
+		newOp := toggledMatch[op]
+		if value, err := promql.Unquote(quoted); err == nil {
+			if newOp == "=~" || newOp == "!~" {
+				quoted = strconv.Quote(regexp.QuoteMeta(value))
+			} else if literal, ok := regexpLiteral(value); ok {
+				quoted = strconv.Quote(literal)
+			}
+		}
+		replaced := text[:m[2]] + newOp + text[m[3]:m[4]] + quoted + text[m[5]:]
+		opShift, valueEnd := len(newOp)-len(op), len(replaced)-(len(text)-m[5])
+		shift := func(pos int) int {
+			switch {
+			case pos <= m[2]:
+				return pos
+			case pos < m[5]:
+				if pos+opShift > valueEnd {
+					return valueEnd
+				}
+				return pos + opShift
+			}
+			return pos + len(replaced) - len(text)
+		}
+		return replaced, shift(start), shift(end)
+	}
+	return text, start, end
+}
+
+// regexpLiteral returns the string that the regular expression re matches
+// if it matches only that.
+func regexpLiteral(re string) (string, bool) {
+	parsed, err := syntax.Parse(re, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	switch parsed.Op {
+	case syntax.OpEmptyMatch:
+		return "", true
+	case syntax.OpLiteral:
+		if parsed.Flags&syntax.FoldCase == 0 {
+			return string(parsed.Rune), true
+		}
+	}
+	return "", false
+}
+
+// selectors returns the vector selectors of text in the order that
+// promql.Inspect visits them. There are none if text cannot be parsed.
+func selectors(text string) []*promql.VectorSelector {
+	expr, err := promql.Parse(text)
+	if err != nil {
+		return nil
+	}
+	var sels []*promql.VectorSelector
+	promql.Inspect(expr, func(n promql.Node) bool {
+		if vs, ok := n.(*promql.VectorSelector); ok {
+			sels = append(sels, vs)
+		}
+		return true
+	})
+	return sels
+}
+
+// selectorAt returns the index of the last of sels around pos, or else 0.
+func selectorAt(sels []*promql.VectorSelector, pos int) int {
+	i := 0
+	for j, vs := range sels {
+		if vs.Start <= pos && pos <= vs.End {
+			i = j
+		}
+	}
+	return i
+}
+
+// insertMatcher adds the matcher name="value" to the selector vs of text,
+// returning the new text along with where and how much was inserted.
+func insertMatcher(text string, vs *promql.VectorSelector, name, value string) (string, int, int) {
+	matcher := (&promql.Matcher{Name: name, Type: promql.MatchEqual, Value: value}).String()
+	at := selectorEnd(text[:vs.End], vs.Start)
+	switch {
+	case text[at-1] != '}':
+		matcher = "{" + matcher + "}"
+	case strings.HasSuffix(strings.TrimSpace(text[vs.Start:at-1]), "{"):
+		at--
+	default:
+		at--
+		matcher = ", " + matcher
+	}
+	return text[:at] + matcher + text[at:], at, len(matcher)
+}
+
+// selectorEnd returns the end of the name and matchers of the selector
+// at start in text, before any offset or @ modifier.
+func selectorEnd(text string, start int) int {
+	i := start
+	for i < len(text) && (text[i] == '_' || text[i] == ':' || text[i] >= 'a' && text[i] <= 'z' || text[i] >= 'A' && text[i] <= 'Z' || text[i] >= '0' && text[i] <= '9') {
+		i++
+	}
+	if i == len(text) || text[i] != '{' {
+		return i
+	}
+	var quote byte
+	for i++; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '}':
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+// missingRanges returns the selectors in text that are passed to functions
+// needing a range, as in rate(foo), in order. There are none if text
+// cannot be parsed.
+func missingRanges(text string) []*promql.VectorSelector {
+	expr, err := promql.ParseUnchecked(text)
+	if err != nil {
+		return nil
+	}
+	var missing []*promql.VectorSelector
+	promql.Inspect(expr, func(n promql.Node) bool {
+		call, ok := n.(*promql.Call)
+		if !ok || len(call.Func.ArgTypes) == 0 {
+			return true
+		}
+		for i, arg := range call.Args {
+			want := call.Func.ArgTypes[len(call.Func.ArgTypes)-1]
+			if i < len(call.Func.ArgTypes) {
+				want = call.Func.ArgTypes[i]
+			}
+			if vs, ok := arg.(*promql.VectorSelector); ok && want == promql.ValueTypeMatrix {
+				missing = append(missing, vs)
+			}
+		}
+		return true
+	})
+	return missing
+}
+
+// insertRanges returns a macro that gives the range rng, such as "5m", to
+// each selector missing one. The selection keeps its place in the query.
+func insertRanges(rng string) macro {
+	return func(text string, start, end int) (string, int, int) {
+		missing := missingRanges(text)
+		insert := "[" + rng + "]"
+		for i := len(missing) - 1; i >= 0; i-- {
+			vs := missing[i]
+			at := selectorEnd(text[:vs.End], vs.Start)
+			text = text[:at] + insert + text[at:]
+			if start >= at {
+				start += len(insert)
+			}
+			if end >= at {
+				end += len(insert)
+			}
+		}
+		return text, start, end
+	}
+}
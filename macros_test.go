@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestInsertRanges(t *testing.T) {
+	for _, tt := range []struct {
+		text, want string
+	}{
+		{`rate(up)`, `rate(up[5m])`},
+		{`sum(rate(a{job="x"})) / sum(increase(b))`, `sum(rate(a{job="x"}[5m])) / sum(increase(b[5m]))`},
+		{`rate(up[1m])`, `rate(up[1m])`},
+		{`abs(up)`, `abs(up)`},
+		{`rate(up`, `rate(up`},
+	} {
+		got, _, _ := insertRanges("5m")(tt.text, 0, 0)
+		if got != tt.want {
+			t.Errorf("insertRanges(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
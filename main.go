@@ -3,26 +3,37 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"image/color"
+	"io/ioutil"
 	"log"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"gioui.org/app"
+	"gioui.org/io/clipboard"
+	"gioui.org/io/key"
 	"gioui.org/io/system"
 	"gioui.org/layout"
 	"gioui.org/op"
+	"gioui.org/op/paint"
 	"gioui.org/unit"
 	"gioui.org/widget"
 	"gioui.org/widget/material"
 
 	"gioui.org/font/gofont"
-	"github.com/prometheus/client_golang/api"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
@@ -38,66 +49,651 @@ import (
 
 func main() {
 	promURL := flag.String("addr", "", "fully-qualified URL of prometheus instance")
+	configPath := flag.String("config", "", "YAML file listing the endpoints to choose from, instead of -addr")
+	maxResponseBytes := flag.Int64("max-response-bytes", 0, "most bytes of a response read from an endpoint that does not set max_response_bytes, failing larger responses (0 for no limit)")
+	forwardAuth := flag.Bool("forward-auth-on-redirect", false, "send an endpoint's credentials along when it redirects to another host, as if every endpoint set forward_auth_on_redirect")
+	connectTimeout := flag.Duration("connect-timeout", 0, "how long to wait to connect to an endpoint that does not set connect_timeout (0 leaves connecting bounded by the query timeout)")
+	title := flag.String("title", "Binnacle", "window title")
+	tokenFile := flag.String("token-file", "", "file containing the bearer token for -addr, re-read for every query so that it can be rotated (defaults to $PROM_TOKEN)")
+	var oauth2 config.OAuth2
+	flag.StringVar(&oauth2.TokenURL, "oauth2-token-url", "", "token endpoint for authenticating to -addr with OAuth2 client credentials")
+	flag.StringVar(&oauth2.ClientID, "oauth2-client-id", "", "OAuth2 client id")
+	flag.StringVar((*string)(&oauth2.ClientSecret), "oauth2-client-secret", "", "OAuth2 client secret")
+	flag.StringVar(&oauth2.ClientSecretFile, "oauth2-client-secret-file", "", "file containing the OAuth2 client secret, instead of -oauth2-client-secret")
+	oauth2Scopes := flag.String("oauth2-scopes", "", "comma-separated OAuth2 scopes to request")
+	var opts paneOptions
+	flag.BoolVar(&opts.Live, "live", false, "start with live tailing of the query enabled")
+	flag.BoolVar(&opts.Rolling, "rolling", false, "refresh a live subquery at a fixed step, like foo[1h:15s], once per step, fetching only the new steps")
+	flag.DurationVar(&opts.Refresh, "refresh", 15*time.Second, "interval at which live tailing re-runs the query")
+	flag.Float64Var(&opts.RefreshJitter, "refresh-jitter", 0.1, "fraction by which the refresh interval randomly varies, to spread out the load on the server")
+	flag.StringVar(&opts.SeriesOrder, "series-order", orderLabels, "order of the series of range results: labels, fingerprint or server")
+	flag.BoolVar(&opts.CarryForward, "stack-carry-forward", false, "fill in the samples missing from stacked series with their previous values rather than zero")
+	flag.IntVar(&opts.Numbers.Precision, "precision", 0, "significant digits in displayed values (0 for as many as needed)")
+	flag.BoolVar(&opts.Numbers.Thousands, "thousands", false, "separate thousands in displayed values with commas")
+	flag.BoolVar(&opts.Numbers.Scientific, "scientific", false, "display very large and very small values in scientific notation")
+	flag.BoolVar(&opts.AutoFormat, "autoformat", true, "reformat the query as it is edited")
+	flag.BoolVar(&opts.ServerFormat, "server-format", false, "format with the server's format_query endpoint when -autoformat is enabled, falling back to local formatting")
+	flag.BoolVar(&opts.FormatPaste, "format-paste", true, "reformat pasted text when -autoformat is enabled")
+	flag.StringVar(&opts.FormatOn, "format-on", formatOnChange, "when -autoformat reformats the query: change, as it is edited, or blur, when the editor loses focus")
+	flag.IntVar(&opts.Retry.Retries, "retries", 0, "number of times to retry a query that could not reach the server")
+	flag.DurationVar(&opts.Retry.Backoff, "retry-backoff", 500*time.Millisecond, "delay before the first retry, doubling for each one after")
+	flag.DurationVar(&opts.ServerTimeout, "server-timeout", 0, "longest the server is asked to spend evaluating a query (0 for the query's own timeout)")
+	disableLints := flag.String("disable-lints", "", "comma-separated ids of the query lints not to run, of "+lintIDs())
+	flag.IntVar(&opts.CacheSize, "cache-size", 32, "most results kept to answer a query run again soon after (0 to disable)")
+	flag.DurationVar(&opts.CacheTTL, "cache-ttl", 10*time.Second, "how long a result is kept to answer the same query run again")
+	flag.BoolVar(&opts.PauseUnfocused, "pause-unfocused", false, "cancel queries and pause live tailing while the window is not focused")
+	flag.BoolVar(&opts.PollVisible, "poll-visible", false, "pause live tailing while the window is unfocused or minimized, or the results are hidden")
+	flag.DurationVar(&opts.Debounce, "debounce", 300*time.Millisecond, "how long the query must go unedited before it is run (0 to run it with every edit)")
+	flag.DurationVar(&opts.IdleDisconnect, "idle-disconnect", 0, "close connections to the server once no result has arrived for this long (0 to keep them)")
+	flag.IntVar(&opts.MaxSeries, "max-series", 0, "most series to request from the server and display (0 for no limit)")
+	flag.IntVar(&opts.MaxLabelValue, "max-label-value", 0, "characters of each label value displayed before it is cut short (0 for no limit)")
+	flag.DurationVar(&opts.StaleAfter, "stale-after", 5*time.Minute, "highlight instant vector samples older than this at the query's time (0 to disable)")
+	flag.DurationVar(&opts.ExemplarRange, "exemplar-range", time.Hour, "how far back to fetch exemplars when they are enabled")
+	flag.DurationVar(&opts.DefaultRange, "default-range", 5*time.Minute, "range offered to selectors missing one, as in rate(foo)")
+	flag.DurationVar(&opts.SubqueryRange, "subquery-range", 30*time.Minute, "range of the subquery the subquery button evaluates a query over")
+	flag.DurationVar(&opts.GraphRange, "graph-range", time.Hour, "how far back the graph history button charts an instant query, at a step giving about 240 points")
+	flag.DurationVar(&opts.SubqueryStep, "subquery-step", time.Minute, "resolution of the subquery the subquery button evaluates a query at")
+	transform := flag.String("transform", "", "rewrite result samples before displaying them by an expression, like \"value * 100\", or keep only those meeting a condition, like \"value > 0\"")
+	thresholds := flag.String("thresholds", "", "color result values by ascending thresholds, like \"green<0.8, yellow<0.95, red\"")
+	flag.BoolVar(&opts.CurlSecrets, "curl-secrets", false, "include credentials in queries copied as curl commands, rather than redacting them")
+	flag.StringVar(&opts.Wrappers.Counter, "wrap-counters", "", "function a query of just the selector of a counter is wrapped in when submitted, with {selector} in place of it, like \"rate({selector}[5m])\"")
+	flag.StringVar(&opts.Wrappers.Gauge, "wrap-gauges", "", "function a query of just the selector of a gauge is wrapped in when submitted, with {selector} in place of it, like \"avg_over_time({selector}[5m])\"")
+	flag.StringVar(&opts.TraceURL, "trace-url", "", "URL of a trace in your tracing UI, with {trace_id} in place of the id, opened by clicking an exemplar")
+	serve := flag.String("serve", "", "also serve the latest result of each pane as JSON over HTTP at this address, like :8080")
+	record := flag.String("record", "", "append every query response to this file for later replay")
+	replay := flag.String("replay", "", "answer queries from a file written by -record instead of a prometheus instance")
+	dashboardPath := flag.String("dashboard", "", "YAML file listing queries to show as a read-only dashboard, refreshed every -refresh, instead of the editor")
+	kiosk := flag.Bool("kiosk", false, "show the -dashboard for a wall display, filling the window in large type; Esc closes it")
+	kioskQuery := flag.String("kiosk-query", "", "query to show alone as a -kiosk dashboard, instead of -dashboard")
+	printVersion := flag.Bool("version", false, "print version information and exit")
+	diagnostics := flag.Bool("diagnostics", false, "print the effective configuration, with secrets left out, and the outcome of probing each endpoint, for attaching to bug reports, and exit")
+	formatOnly := flag.Bool("fmt", false, "format the query read from stdin, writing it to stdout, and exit")
+	var logLevel slog.Level
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, "minimum level of logged events (debug, info, warn or error)")
+	logFile := flag.String("log-file", "", "write logs to this file instead of stderr")
 	flag.Parse()
-	client, err := api.NewClient(api.Config{
-		Address:      *promURL,
-		RoundTripper: config.NewBearerAuthRoundTripper(config.Secret(os.Getenv("PROM_TOKEN")), api.DefaultRoundTripper),
-	})
+	if *printVersion {
+		fmt.Println(versionString())
+		return
+	}
+	if *formatOnly {
+		if err := formatStream(os.Stdout, os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	logs, err := setupLogging(logLevel, *logFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Refresh <= 0 {
+		fatal("refresh interval must be positive", "refresh", opts.Refresh)
+	}
+	switch opts.SeriesOrder {
+	case orderLabels, orderFingerprint, orderServer:
+	default:
+		fatal("unknown series order", "series-order", opts.SeriesOrder)
+	}
+	switch opts.FormatOn {
+	case formatOnChange, formatOnBlur:
+	default:
+		fatal("unknown time to format", "format-on", opts.FormatOn)
+	}
+	if opts.RefreshJitter < 0 || opts.RefreshJitter >= 1 {
+		fatal("refresh jitter must be at least 0 and less than 1", "refresh-jitter", opts.RefreshJitter)
+	}
+	if opts.Retry.Retries < 0 || opts.Retry.Backoff < 0 {
+		fatal("retries and retry backoff must not be negative", "retries", opts.Retry.Retries, "backoff", opts.Retry.Backoff)
+	}
+	if opts.MaxSeries < 0 {
+		fatal("max series must not be negative", "max-series", opts.MaxSeries)
+	}
+	if opts.CacheSize < 0 || opts.CacheTTL < 0 {
+		fatal("cache size and TTL must not be negative", "cache-size", opts.CacheSize, "cache-ttl", opts.CacheTTL)
+	}
+	disabledLints, err := parseLintIDs(*disableLints)
 	if err != nil {
-		log.Fatal("Could not configure prom client", err)
+		fatal("could not parse disabled lints", "disable-lints", *disableLints, "err", err)
+	}
+	opts.DisabledLints = disabledLints
+	if opts.ServerTimeout < 0 {
+		fatal("server timeout must not be negative", "server-timeout", opts.ServerTimeout)
+	}
+	if opts.Debounce < 0 {
+		fatal("debounce must not be negative", "debounce", opts.Debounce)
+	}
+	if opts.IdleDisconnect < 0 {
+		fatal("idle disconnect must not be negative", "idle-disconnect", opts.IdleDisconnect)
+	}
+	if opts.MaxLabelValue < 0 {
+		fatal("max label value must not be negative", "max-label-value", opts.MaxLabelValue)
+	}
+	if opts.StaleAfter < 0 {
+		fatal("stale-after must not be negative", "stale-after", opts.StaleAfter)
+	}
+	if opts.ExemplarRange <= 0 {
+		fatal("exemplar range must be positive", "range", opts.ExemplarRange)
+	}
+	if opts.DefaultRange <= 0 {
+		fatal("default range must be positive", "range", opts.DefaultRange)
+	}
+	if opts.GraphRange <= 0 {
+		fatal("graph range must be positive", "graph-range", opts.GraphRange)
+	}
+	if opts.SubqueryRange <= 0 || opts.SubqueryStep <= 0 {
+		fatal("subquery range and step must be positive", "range", opts.SubqueryRange, "step", opts.SubqueryStep)
+	}
+	if opts.Thresholds, err = ParseThresholds(*thresholds); err != nil {
+		fatal("invalid thresholds", "err", err)
+	}
+	if opts.Transform, err = ParseTransform(*transform); err != nil {
+		fatal("invalid transform", "err", err)
+	}
+	for _, w := range []string{opts.Wrappers.Counter, opts.Wrappers.Gauge} {
+		if err := checkWrapper(w); err != nil {
+			fatal("invalid wrapper", "err", err)
+		}
+	}
+	if opts.TraceURL != "" {
+		if err := checkTraceURL(opts.TraceURL); err != nil {
+			fatal("invalid trace URL", "err", err)
+		}
+	}
+	var (
+		src       Source
+		endpoints []Endpoint
+		sw        = new(Switch)
+	)
+	// applyDefaults gives the endpoints the settings of the flags they do
+	// not override, when first loaded and when reloaded.
+	applyDefaults := func(endpoints []Endpoint) {
+		defaultConnectTimeouts(endpoints, *connectTimeout)
+		defaultMaxResponseBytes(endpoints, *maxResponseBytes)
+		forwardAuthOnRedirects(endpoints, *forwardAuth)
+	}
+	if *replay != "" {
+		if *diagnostics {
+			fatal("-diagnostics and -replay cannot be used together")
+		}
+		r, err := LoadReplay(*replay)
+		if err != nil {
+			fatal("could not load replay", "path", *replay, "err", err)
+		}
+		slog.Info("replaying recorded responses", "path", *replay)
+		src = r
+	} else {
+		if *configPath != "" {
+			cfg, err := LoadConfig(*configPath)
+			if err != nil {
+				fatal("could not load config", "err", err)
+			}
+			endpoints = cfg.Endpoints
+		} else {
+			ep := Endpoint{
+				Name:             *promURL,
+				Address:          *promURL,
+				HTTPClientConfig: config.DefaultHTTPClientConfig,
+			}
+			switch {
+			case oauth2.TokenURL != "":
+				if *tokenFile != "" {
+					fatal("-token-file and -oauth2-token-url cannot be used together")
+				}
+				if oauth2.ClientSecret != "" && oauth2.ClientSecretFile != "" {
+					fatal("-oauth2-client-secret and -oauth2-client-secret-file cannot be used together")
+				}
+				if *oauth2Scopes != "" {
+					oauth2.Scopes = strings.Split(*oauth2Scopes, ",")
+				}
+				ep.HTTPClientConfig.OAuth2 = &oauth2
+			case *tokenFile != "":
+				if _, err := ioutil.ReadFile(*tokenFile); err != nil {
+					fatal("could not read token file", "err", err)
+				}
+				ep.HTTPClientConfig.BearerTokenFile = *tokenFile
+			case os.Getenv("PROM_TOKEN") != "":
+				ep.HTTPClientConfig.BearerToken = config.Secret(os.Getenv("PROM_TOKEN"))
+			default:
+				// With no credentials, the client config adds no
+				// authentication to requests.
+				slog.Info("no credentials configured, connecting anonymously")
+			}
+			endpoints = []Endpoint{ep}
+		}
+		if *connectTimeout < 0 {
+			fatal("connect timeout must not be negative", "timeout", *connectTimeout)
+		}
+		if *maxResponseBytes < 0 {
+			fatal("max response bytes must not be negative", "max-response-bytes", *maxResponseBytes)
+		}
+		applyDefaults(endpoints)
+		if *diagnostics {
+			fmt.Print(newDiagnostics(endpoints, *configPath, opts))
+			return
+		}
+		client, err := endpoints[0].Connect()
+		if err != nil {
+			fatal("could not configure prom client", "err", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), endpoints[0].QueryTimeout())
+		err = endpoints[0].CheckAuth(ctx)
+		cancel()
+		if err != nil {
+			fatal("could not authenticate", "err", err)
+		}
+		slog.Info("configured prometheus client", "endpoint", endpoints[0].Name, "addr", endpoints[0].Address)
+		go checkPermissions(client, endpoints[0].QueryTimeout())
+		sw.Set(client)
+		src = sw
+	}
+	if *record != "" {
+		r, err := NewRecorder(src, *record)
+		if err != nil {
+			fatal("could not start recording", "path", *record, "err", err)
+		}
+		slog.Info("recording responses", "path", *record)
+		src = r
+	}
+
+	var panels []dashboardPanel
+	if *dashboardPath != "" {
+		if panels, err = LoadDashboard(*dashboardPath); err != nil {
+			fatal("could not load dashboard", "err", err)
+		}
+	}
+	if *kioskQuery != "" {
+		if panels != nil {
+			fatal("-kiosk-query and -dashboard cannot be used together")
+		}
+		panels, *kiosk = []dashboardPanel{{Query: *kioskQuery}}, true
+	}
+	if *kiosk && panels == nil {
+		fatal("-kiosk needs -dashboard or -kiosk-query")
+	}
+
+	var view *liveView
+	if *serve != "" {
+		l, err := net.Listen("tcp", *serve)
+		if err != nil {
+			fatal("could not serve results", "addr", *serve, "err", err)
+		}
+		view = newLiveView(2)
+		slog.Info("serving results", "addr", l.Addr().String())
+		go func() {
+			if err := http.Serve(l, view); err != nil {
+				slog.Error("stopped serving results", "err", err)
+			}
+		}()
 	}
 
 	go func() {
-		w := app.NewWindow(app.Title("Binnacle"))
-		if err := loop(w, client); err != nil {
-			log.Fatal(err)
+		state := LoadWindowState()
+		options := []app.Option{app.Title(*title)}
+		if panels == nil && state.Width > 0 && state.Height > 0 {
+			options = append(options, app.Size(unit.Dp(state.Width), unit.Dp(state.Height)))
+		}
+		w := app.NewWindow(options...)
+		picker := newEndpointPicker(endpoints, sw, applyDefaults)
+		if panels != nil {
+			b := NewBackend(src, opts.Retry)
+			b.ServerTimeout = opts.ServerTimeout
+			if len(endpoints) > 0 {
+				b.SetTimeout(picker.Timeout())
+			}
+			d := newDashboard(b, panels, opts)
+			d.kiosk = *kiosk
+			if err := dashboardLoop(w, d, opts); err != nil {
+				fatal("window closed with error", "err", err)
+			}
+			logs.Close()
+			os.Exit(0)
 		}
+		if *configPath != "" && *replay == "" {
+			picker.WatchConfig(*configPath)
+		}
+		if err := loop(w, src, picker, opts, view, state); err != nil {
+			fatal("window closed with error", "err", err)
+		}
+		logs.Close()
 		os.Exit(0)
 	}()
 	app.Main()
 }
 
 type Backend struct {
-	v1.API
+	Source
 
-	Timeout time.Duration
+	Retry RetryPolicy
+	// ServerTimeout, if positive, is the longest the server is asked to
+	// spend evaluating a query. The server is never asked to spend
+	// longer than the query has left before its own timeout.
+	ServerTimeout time.Duration
+	// Cache, if not nil, answers queries run again soon after with
+	// their earlier results.
+	Cache *queryCache
 	latest.Worker
+	retries *latest.Chan
+
+	mu      sync.Mutex
+	timeout time.Duration
+	// cancel cancels the query in flight, if any.
+	cancel context.CancelFunc
 }
 
-func NewBackend(client api.Client) *Backend {
+func NewBackend(src Source, retry RetryPolicy) *Backend {
 	b := &Backend{
-		API:     v1.NewAPI(client),
-		Timeout: time.Second * 10,
+		Source:  src,
+		Retry:   retry,
+		retries: latest.NewChan(),
+		timeout: defaultTimeout,
 	}
 	b.Worker = latest.NewWorker(func(in interface{}) interface{} {
-		return b.Query(in.(string))
+		return b.Query(in.(queryRequest))
 	})
 	return b
 }
 
-func (b *Backend) Query(text string) queryResult {
-	templ, err := template.New("query").Parse(text)
+// queryRequest is a query to be run by a Backend.
+type queryRequest struct {
+	Text string
+	// Exemplars is how far back from the evaluation time to fetch
+	// exemplars. Zero skips fetching them.
+	Exemplars time.Duration
+	// Stats asks the server for statistics about the query.
+	Stats bool
+	// Limit, if positive, is the most series to ask for and show.
+	Limit int
+	// Timeout, if positive, overrides the Backend's timeout for this
+	// query.
+	Timeout time.Duration
+	// Fresh asks the server again even if the Backend has cached a
+	// result, as for live tailing.
+	Fresh bool
+	// Since, if set, is when the same rolling subquery was last
+	// evaluated, so that only the steps since need be asked for.
+	Since time.Time
+	// Range, if positive, asks for the query evaluated every step over
+	// the range up to now, as a range query, rather than at an instant.
+	// Queries that cannot be, and sources that cannot evaluate range
+	// queries, are evaluated at an instant regardless.
+	Range time.Duration
+}
+
+func (b *Backend) Query(req queryRequest) queryResult {
+	text, err := expand(req.Text)
 	if err != nil {
-		return queryResult{
-			error: fmt.Errorf("query is not a valid go template: %w", err),
+		return queryResult{error: err}
+	}
+	if emptyQuery(text) {
+		// The server would only reject it, as while the query is
+		// being cleared to type another.
+		return queryResult{text: req.Text, at: time.Now(), query: text}
+	}
+	key := req
+	key.Text, key.Fresh = text, false
+	if b.Cache != nil && !req.Fresh {
+		if r, ok := b.Cache.Get(key); ok {
+			slog.Debug("query answered from cache", "query", text, "at", r.at)
+			r.text, r.elapsed = req.Text, 0
+			return r
+		}
+	}
+	timeout := b.Timeout()
+	if req.Timeout > 0 {
+		timeout = req.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	b.mu.Lock()
+	b.cancel = cancel
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.cancel = nil
+		b.mu.Unlock()
+		cancel()
+	}()
+	start := time.Now()
+	// sent is the query sent, narrowed to the steps since req.Since if it
+	// is a rolling subquery.
+	sent, since := text, time.Time{}
+	if sub, ok := rollingSubquery(text); ok && !req.Since.IsZero() {
+		if narrow, ok := rollingQuery(sub, req.Since, start); ok {
+			sent, since = narrow, req.Since
+		}
+	}
+	slog.Debug("issuing query", "query", sent)
+	var (
+		result   model.Value
+		warnings v1.Warnings
+		stats    *QueryStats
+	)
+	opts := queryOptions{Stats: req.Stats, Limit: req.Limit}
+	optSrc, withOpts := b.Source.(OptionSource)
+	rangeSrc, ranged := b.Source.(RangeSource)
+	ranged = ranged && req.Range > 0 && rangeable(text)
+	var answered replicas
+	ctx = withReplicas(ctx, &answered)
+	err = b.Retry.Do(ctx, func(retry int) {
+		slog.Info("retrying query", "query", text, "retry", retry, "retries", b.Retry.Retries)
+		b.retries.Push(retry)
+	}, func() error {
+		var err error
+		opts.Timeout = b.serverTimeout(ctx)
+		if ranged {
+			r := v1.Range{Start: start.Add(-req.Range), End: start, Step: graphStep(req.Range)}
+			result, warnings, err = rangeSrc.QueryRange(ctx, sent, r)
+			if !errors.Is(err, errNoRange) {
+				return err
+			}
+			ranged = false
+		}
+		if withOpts {
+			result, warnings, stats, err = optSrc.QueryWith(ctx, sent, start, opts)
+			if !errors.Is(err, errNoOptions) {
+				return err
+			}
+			withOpts = false
+		}
+		result, warnings, err = b.Source.Query(ctx, sent, start)
+		return err
+	})
+	if req.Stats && err == nil && stats == nil {
+		warnings = append(warnings, "query stats were not reported")
+	}
+	var truncated bool
+	if err == nil {
+		result, truncated = limitSeries(result, req.Limit)
+	}
+	series, samples := resultSize(result)
+	var apiErr *v1.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Type == v1.ErrTimeout:
+		slog.Warn("server timed out evaluating query", "query", text, "timeout", opts.Timeout)
+		err = fmt.Errorf("the server stopped evaluating the query after %v: %w", opts.Timeout, err)
+	case errors.Is(err, context.DeadlineExceeded) || err != nil && ctx.Err() == context.DeadlineExceeded:
+		slog.Warn("query timed out", "query", text, "timeout", timeout, "err", err)
+		err = timeoutError{timeout: timeout, err: err}
+	case errors.Is(err, context.Canceled):
+		slog.Info("query cancelled", "query", text)
+	case err != nil:
+		slog.Warn("query failed", "query", text, "err", err)
+	default:
+		slog.Debug("query succeeded", "query", text, "elapsed", time.Since(start), "warnings", len(warnings))
+	}
+	var exemplars []v1.ExemplarQueryResult
+	if err == nil && req.Exemplars > 0 {
+		var exErr error
+		exemplars, exErr = b.Source.QueryExemplars(ctx, text, start.Add(-req.Exemplars), start)
+		if exErr != nil {
+			slog.Warn("exemplar query failed", "query", text, "err", exErr)
+			warnings = append(warnings, fmt.Sprintf("could not fetch exemplars: %v", exErr))
 		}
 	}
+	r := queryResult{
+		text:      req.Text,
+		at:        start,
+		query:     text,
+		data:      result,
+		warnings:  warnings,
+		exemplars: exemplars,
+		stats:     stats,
+		truncated: truncated,
+		series:    series,
+		samples:   samples,
+		elapsed:   time.Since(start),
+		replica:   answered.String(),
+		since:     since,
+		error:     err,
+	}
+	if b.Cache != nil && err == nil {
+		b.Cache.Put(key, r)
+	}
+	return r
+}
+
+// limitSeries cuts v down to at most limit series, if limit is positive,
+// reporting whether series may have been left out, either here or by a
+// server that applied the limit itself.
+func limitSeries(v model.Value, limit int) (model.Value, bool) {
+	if limit <= 0 {
+		return v, false
+	}
+	switch v := v.(type) {
+	case model.Vector:
+		if len(v) > limit {
+			return v[:limit], true
+		}
+		return v, len(v) == limit
+	case model.Matrix:
+		if len(v) > limit {
+			return v[:limit], true
+		}
+		return v, len(v) == limit
+	}
+	return v, false
+}
+
+// serverTimeout is how long the server is asked to spend evaluating the
+// query run with ctx.
+func (b *Backend) serverTimeout(ctx context.Context) time.Duration {
+	d := b.ServerTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); d <= 0 || left < d {
+			d = left.Truncate(time.Millisecond)
+		}
+	}
+	return d
+}
+
+// Timeout is the time allowed for each query.
+func (b *Backend) Timeout() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.timeout
+}
+
+// SetTimeout bounds the time taken by subsequent queries, including any
+// retries.
+func (b *Backend) SetTimeout(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.timeout = d
+}
+
+// ClearCache drops the cached results, if any, as after switching to
+// another endpoint.
+func (b *Backend) ClearCache() {
+	if b.Cache != nil {
+		b.Cache.Clear()
+	}
+}
+
+// FormatQuery formats text as the server does, within the query timeout.
+func (b *Backend) FormatQuery(text string) (string, error) {
+	src, ok := b.Source.(FormatSource)
+	if !ok {
+		return "", errNoFormat
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+	defer cancel()
+	return src.FormatQuery(ctx, text)
+}
+
+// Names returns the metric names known to the server, or its label
+// names if labels is set, within the query timeout.
+func (b *Backend) Names(labels bool) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+	defer cancel()
+	if labels {
+		names, _, err := b.Source.LabelNames(ctx, nil, time.Time{}, time.Time{})
+		return names, err
+	}
+	values, _, err := b.Source.LabelValues(ctx, model.MetricNameLabel, nil, time.Time{}, time.Time{})
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = string(v)
+	}
+	return names, err
+}
+
+// Curl returns a curl command that sends req as Query would, with
+// credentials included only if secrets is set.
+func (b *Backend) Curl(req queryRequest, secrets bool) (string, error) {
+	text, err := expand(req.Text)
+	if err != nil {
+		return "", err
+	}
+	src, ok := b.Source.(CurlSource)
+	if !ok {
+		return "", errNoCurl
+	}
+	return src.Curl(text, queryOptions{Stats: req.Stats, Limit: req.Limit}, secrets)
+}
+
+// Cancel cancels the query in flight, reporting whether there was one.
+func (b *Backend) Cancel() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel == nil {
+		return false
+	}
+	b.cancel()
+	b.cancel = nil
+	return true
+}
+
+// Retries yields the number of each retry of the current query as it
+// is made.
+func (b *Backend) Retries() <-chan interface{} {
+	return b.retries.Raw()
+}
+
+// expand executes the query text as a go template, yielding the PromQL
+// to send to the server.
+func expand(text string) (string, error) {
+	templ, err := template.New("query").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("query is not a valid go template: %w", err)
+	}
 	var buf bytes.Buffer
 	err = templ.Execute(&buf, nil)
 	if err != nil {
-		return queryResult{
-			error: fmt.Errorf("could not execute query template: %w", err),
-		}
+		return "", fmt.Errorf("could not execute query template: %w", err)
 	}
-	text = buf.String()
-	var ctx context.Context
-	ctx, _ = context.WithTimeout(context.Background(), b.Timeout)
-	result, warnings, err := b.API.Query(ctx, text, time.Now())
-	return queryResult{
-		data:     result,
-		warnings: warnings,
-		error:    err,
+	return buf.String(), nil
+}
+
+// emptyQuery reports whether text has nothing to evaluate, being blank
+// or only comments.
+func emptyQuery(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
 	}
+	return true
 }
 
 type (
@@ -105,76 +701,90 @@ type (
 	D = layout.Dimensions
 )
 
-func format(ed *widget.Editor) {
-	start, end := ed.Selection()
-	forward := true
-	if end < start {
-		forward = false
-		start, end = end, start
-	}
-	text := ed.Text()
-	before := text[:start]
-	selected := text[start:end]
-	after := text[end:]
-
-	depth := 0
-	for _, slice := range []*string{&before, &selected, &after} {
-		var result strings.Builder
-		for i, line := range strings.Split(*slice, "\n") {
-			var leadingCloseParens int
-			newLine := strings.TrimRight(strings.TrimLeft(line, " \t"), "\t\n")
-			strings.TrimLeftFunc(newLine, func(r rune) bool {
-				if r == ')' {
-					leadingCloseParens++
-					return true
-				}
-				return false
-			})
-			prefix := strings.Repeat("  ", depth-leadingCloseParens)
-			depth += strings.Count(line, "(") - strings.Count(line, ")")
-			if i > 0 {
-				result.Write([]byte("\n"))
-				result.Write([]byte(prefix))
-			}
-			result.Write([]byte(newLine))
-		}
-		*slice = result.String()
-	}
+// timeoutError is the error of a query that ran out of time, described by
+// the time it had rather than the error of the client that noticed.
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
 
-	endStart := len(before)
-	endEnd := len(selected) + endStart
-	if !forward {
-		endStart, endEnd = endEnd, endStart
-	}
-	finalText := before + selected + after
-	if finalText != text {
-		ed.SetText(finalText)
-		ed.SetCaret(endStart, endEnd)
-	}
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("query timed out after %v", e.timeout)
+}
+
+func (e timeoutError) Unwrap() error {
+	return e.err
 }
 
 type queryResult struct {
-	data     model.Value
-	warnings []string
+	// text is the query as written, and at the time it was evaluated.
+	text string
+	at   time.Time
+	// query is the PromQL sent, empty if the query was rejected before
+	// being sent.
+	query     string
+	data      model.Value
+	warnings  []string
+	exemplars []v1.ExemplarQueryResult
+	// stats are the server's statistics for the query, if requested
+	// and reported.
+	stats *QueryStats
+	// truncated is set if series may have been left out of data to keep
+	// within the limit of the request.
+	truncated bool
+	// series and samples count what data holds.
+	series, samples int
+	// elapsed is the time spent waiting on the server, even for a query
+	// that failed, zero if the query was rejected before being sent or
+	// answered from the cache.
+	elapsed time.Duration
+	// replica names the servers that answered, if they said.
+	replica string
+	// since, if set, is the Since of the request, and data holds only
+	// the steps of the rolling subquery since then.
+	since time.Time
 	error
 }
 
 type Renderer struct {
 	model.Value
 	*material.Theme
+	Format NumberFormat
 
 	textDirty bool
-	text      []string
+	text      []textRow
 
 	vizInit  bool
 	vizDirty bool
 	vizResult
 	vizWorker latest.Worker
+	legend    *chartLegend
+	cursor    chartCursor
+	logY      bool
+	stacked   bool
+	histogram bool
+	normalize bool
+	// aligned pads the labels of the rows of a vector to a common width,
+	// so that their values line up in a column, and table lays the rows
+	// out in columns of their labels instead.
+	aligned, table bool
+	// CarryForward fills in the samples missing from stacked series
+	// with their previous values.
+	CarryForward bool
+	// MaxLabelValue, if positive, is the most characters of each label
+	// value shown in text rows.
+	MaxLabelValue int
+	// zoomMin and zoomMax are the range of times the chart is zoomed
+	// into, if zoomMax is greater.
+	zoomMin, zoomMax float64
+	resetZoom        widget.Clickable
 }
 
-func NewRenderer(th *material.Theme) *Renderer {
+func NewRenderer(th *material.Theme, f NumberFormat) *Renderer {
 	r := &Renderer{
-		Theme: th,
+		Theme:  th,
+		Format: f,
+		legend: newChartLegend(),
 	}
 	render := func(input interface{}) interface{} {
 		return RenderVizData(input.(vizData))
@@ -188,11 +798,13 @@ type vizResult struct {
 	call        op.CallOp
 	constraints layout.Constraints
 	dims        layout.Dimensions
+	area        chartArea
 }
 
 type vizData struct {
 	model.Value
 	layout.Context
+	Chart chartOptions
 }
 
 func (r *Renderer) SetData(m model.Value) {
@@ -201,19 +813,387 @@ func (r *Renderer) SetData(m model.Value) {
 	r.vizDirty = true
 }
 
-func (r *Renderer) RenderText() []string {
+func (r *Renderer) RenderText() []textRow {
 	if !r.textDirty {
 		return r.text
 	}
 	r.textDirty = false
-	r.text = strings.Split(r.Value.String(), "\n")
-	sort.SliceStable(r.text, func(i, j int) bool {
-		return strings.Compare(r.text[i], r.text[j]) < 0
-	})
+	r.text = formatRows(r.Value, r.Format, r.MaxLabelValue)
+	if _, ok := r.Value.(model.Vector); ok && r.table {
+		r.text = tableRows(r.text, r.MaxLabelValue)
+	} else if ok && r.aligned {
+		alignRows(r.text)
+	}
 	return r.text
 }
 
+// alignRows pads the labels of rows before their " => " to the width of
+// the widest, so that the values after them line up in a column of the
+// monospaced text. Rows without a value are left alone.
+func alignRows(rows []textRow) {
+	width := 0
+	for _, row := range rows {
+		if row.Value != "" {
+			if n := utf8.RuneCountInString(row.Label); n > width {
+				width = n
+			}
+		}
+	}
+	for i, row := range rows {
+		if row.Value == "" {
+			continue
+		}
+		if pad := width - utf8.RuneCountInString(row.Label); pad > 0 {
+			label := strings.TrimSuffix(row.Label, " => ")
+			rows[i].Label = label + strings.Repeat(" ", pad) + row.Label[len(label):]
+		}
+	}
+}
+
+// textRow is a line of text describing a query result. Its value is kept
+// apart from the labels and timestamp around it so that it can be styled
+// distinctly.
+type textRow struct {
+	Label, Value, Time string
+	// Num is the number that Value displays, if Value is not empty.
+	Num float64
+	// At is the timestamp of a sample of an instant vector, which may
+	// be older than the query, and Stale is set if it is too old.
+	At    model.Time
+	Stale bool
+	// Gone is set if the sample is a stale marker, recording that its
+	// series stopped being reported.
+	Gone bool
+	// Header is set for the header of the group of rows whose series
+	// have the label value Group.
+	Header bool
+	Group  string
+	// Metric is the series of the row, if it is part of one.
+	Metric model.Metric
+	// Bool is set if Value is the 0 or 1 of a comparison with the bool
+	// modifier, shown as false or true.
+	Bool bool
+	// FullLabel is Label with none of its label values cut short, if
+	// any are.
+	FullLabel string
+	// Background, if not transparent, is drawn behind the row.
+	Background color.NRGBA
+	// NonFinite is set if Value is NaN or an infinity, as from dividing
+	// by zero, other than a stale marker.
+	NonFinite bool
+}
+
+// String is the full text of the row, with any label values that are
+// cut short for display restored.
+func (r textRow) String() string {
+	label := r.Label
+	if r.FullLabel != "" {
+		label = r.FullLabel
+	}
+	return label + r.Value + r.Time
+}
+
+// staleMarker is the bit pattern of the NaN that Prometheus stores as a
+// sample when its series stops being reported. Servers normally leave
+// these out of query results, but some sources pass them through.
+const staleMarker uint64 = 0x7ff0000000000002
+
+func isStaleMarker(v model.SampleValue) bool {
+	return math.Float64bits(float64(v)) == staleMarker
+}
+
+// sampleRow is a row for a sample with value v at t, formatted with f.
+func sampleRow(label string, v model.SampleValue, t model.Time, f NumberFormat) textRow {
+	row := textRow{
+		Label: label,
+		Value: f.Format(float64(v)),
+		Num:   float64(v),
+		Time:  fmt.Sprintf(" @[%s]", t),
+	}
+	if isStaleMarker(v) {
+		row.Value, row.Gone = "stale", true
+	} else {
+		row.NonFinite = nonFinite(row.Num)
+	}
+	return row
+}
+
+// nonFinite reports whether x is NaN or an infinity.
+func nonFinite(x float64) bool {
+	return math.IsNaN(x) || math.IsInf(x, 0)
+}
+
+// The ways the series of a matrix can be ordered.
+const (
+	// orderLabels sorts series by their labels.
+	orderLabels = "labels"
+	// orderFingerprint sorts series by the fingerprint of their labels,
+	// which keeps them in the same order from one run to the next
+	// without grouping similar series together.
+	orderFingerprint = "fingerprint"
+	// orderServer keeps the order in which the server returned them.
+	orderServer = "server"
+)
+
+// orderSeries returns v with the series of a matrix in the given order.
+// Other values are returned as they are.
+func orderSeries(v model.Value, order string) model.Value {
+	m, ok := v.(model.Matrix)
+	if !ok || order == orderServer {
+		return v
+	}
+	series := make(model.Matrix, len(m))
+	copy(series, m)
+	switch order {
+	case orderFingerprint:
+		sort.SliceStable(series, func(i, j int) bool {
+			return series[i].Metric.Fingerprint() < series[j].Metric.Fingerprint()
+		})
+	default:
+		sort.Sort(series)
+	}
+	return series
+}
+
+// metricLabel is m written as a selector, with label values longer than
+// max characters cut short, if max is positive. cut is set if any are.
+func metricLabel(m model.Metric, max int) (label string, cut bool) {
+	if max <= 0 {
+		return m.String(), false
+	}
+	names := make(model.LabelNames, 0, len(m))
+	for name := range m {
+		if name != model.MetricNameLabel {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := []rune(string(m[name]))
+		if len(value) > max {
+			value, cut = append(value[:max:max], '…'), true
+		}
+		pairs[i] = fmt.Sprintf("%s=%q", name, string(value))
+	}
+	if !cut {
+		return m.String(), false
+	}
+	return fmt.Sprintf("%s{%s}", m[model.MetricNameLabel], strings.Join(pairs, ", ")), true
+}
+
+// seriesRow is a row for the sample s, with its label values cut short
+// to maxValue characters.
+func seriesRow(s *model.Sample, f NumberFormat, maxValue int) textRow {
+	label, cut := metricLabel(s.Metric, maxValue)
+	row := sampleRow(label+" => ", s.Value, s.Timestamp, f)
+	if cut {
+		row.FullLabel = s.Metric.String() + " => "
+	}
+	row.At = s.Timestamp
+	row.Metric = s.Metric
+	return row
+}
+
+// formatRows renders value as lines of text, formatting each sample
+// value with f and cutting label values short to maxValue characters.
+func formatRows(value model.Value, f NumberFormat, maxValue int) []textRow {
+	switch value := value.(type) {
+	case model.Vector:
+		rows := make([]textRow, len(value))
+		for i, s := range value {
+			rows[i] = seriesRow(s, f, maxValue)
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].String() < rows[j].String()
+		})
+		return rows
+	case model.Matrix:
+		// Series are shown in the order given by orderSeries.
+		var rows []textRow
+		for _, ss := range value {
+			header := textRow{Metric: ss.Metric}
+			label, cut := metricLabel(ss.Metric, maxValue)
+			header.Label = label + " =>"
+			if cut {
+				header.FullLabel = ss.Metric.String() + " =>"
+			}
+			rows = append(rows, header)
+			for _, p := range ss.Values {
+				row := sampleRow("", p.Value, p.Timestamp, f)
+				row.Metric = ss.Metric
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	case *model.Scalar:
+		return []textRow{{
+			Label:     "scalar: ",
+			Value:     f.Format(float64(value.Value)),
+			Num:       float64(value.Value),
+			Time:      fmt.Sprintf(" @[%s]", value.Timestamp),
+			NonFinite: nonFinite(float64(value.Value)),
+		}}
+	case nil:
+		return nil
+	default:
+		lines := strings.Split(value.String(), "\n")
+		rows := make([]textRow, len(lines))
+		for i, line := range lines {
+			rows[i] = textRow{Label: line}
+		}
+		return rows
+	}
+}
+
+// labelSetRows lists the label sets of the series of value without their
+// values, sorted and with duplicates left out, cutting label values short
+// to maxValue characters.
+func labelSetRows(value model.Value, maxValue int) []textRow {
+	var metrics []model.Metric
+	switch value := value.(type) {
+	case model.Vector:
+		for _, s := range value {
+			metrics = append(metrics, s.Metric)
+		}
+	case model.Matrix:
+		for _, ss := range value {
+			metrics = append(metrics, ss.Metric)
+		}
+	}
+	seen := map[string]bool{}
+	var rows []textRow
+	for _, m := range metrics {
+		full := m.String()
+		if seen[full] {
+			continue
+		}
+		seen[full] = true
+		row := textRow{Metric: m}
+		var cut bool
+		row.Label, cut = metricLabel(m, maxValue)
+		if cut {
+			row.FullLabel = full
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].String() < rows[j].String()
+	})
+	return rows
+}
+
+// SetLogY chooses whether the chart of a matrix has a logarithmic Y axis.
+func (r *Renderer) SetLogY(logY bool) {
+	if logY != r.logY {
+		r.logY = logY
+		r.vizDirty = true
+	}
+}
+
+// SetFormat chooses how values are written.
+func (r *Renderer) SetFormat(f NumberFormat) {
+	if f != r.Format {
+		r.Format = f
+		r.textDirty = true
+		r.vizDirty = true
+	}
+}
+
+// SetAligned chooses whether the rows of a vector are padded so that
+// their values line up.
+func (r *Renderer) SetAligned(aligned bool) {
+	if aligned != r.aligned {
+		r.aligned = aligned
+		r.textDirty = true
+	}
+}
+
+// SetTable chooses whether the rows of a vector are laid out as a table.
+func (r *Renderer) SetTable(table bool) {
+	if table != r.table {
+		r.table = table
+		r.textDirty = true
+	}
+}
+
+// SetStacked chooses whether the series of a matrix are charted as
+// stacked areas rather than lines.
+func (r *Renderer) SetStacked(stacked bool) {
+	if stacked != r.stacked {
+		r.stacked = stacked
+		r.vizDirty = true
+	}
+}
+
+// SetNormalize chooses whether each series of the chart of a matrix is
+// scaled to span 0 to 1.
+func (r *Renderer) SetNormalize(normalize bool) {
+	if normalize != r.normalize {
+		r.normalize = normalize
+		r.vizDirty = true
+	}
+}
+
+// SetHistogram chooses whether the chart of a classic histogram is a
+// heatmap of its buckets rather than a line per bucket.
+func (r *Renderer) SetHistogram(histogram bool) {
+	if histogram != r.histogram {
+		r.histogram = histogram
+		r.vizDirty = true
+	}
+}
+
+// ChartOptions returns the options with which a matrix is charted.
+func (r *Renderer) ChartOptions() chartOptions {
+	return chartOptions{
+		Hidden:       r.legend.Hidden(),
+		LogY:         r.logY,
+		Stacked:      r.stacked,
+		Histogram:    r.histogram,
+		Normalize:    r.normalize,
+		CarryForward: r.CarryForward,
+		MinX:         r.zoomMin,
+		MaxX:         r.zoomMax,
+	}
+}
+
+// RenderViz charts the result, with a legend of the series of a matrix,
+// which can be zoomed into by dragging across it.
 func (r *Renderer) RenderViz(gtx C) D {
+	matrix, ok := r.Value.(model.Matrix)
+	if !ok || len(matrix) == 0 {
+		return r.renderChart(gtx)
+	}
+	if r.legend.Changed() {
+		r.vizDirty = true
+	}
+	if min, max, ok := r.cursor.Zoom(); ok {
+		r.zoomMin, r.zoomMax = min, max
+		r.vizDirty = true
+	}
+	if r.resetZoom.Clicked() {
+		r.zoomMin, r.zoomMax = 0, 0
+		r.vizDirty = true
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Flexed(1, func(gtx C) D {
+			return r.cursor.Layout(gtx, r.Theme, r.area, matrix, r.legend.hidden, r.Format, r.renderChart)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if r.zoomMax <= r.zoomMin {
+				return D{}
+			}
+			return material.Button(r.Theme, &r.resetZoom, "reset zoom").Layout(gtx)
+		}),
+		layout.Rigid(func(gtx C) D {
+			gtx.Constraints.Max.Y /= 4
+			return r.legend.Layout(gtx, r.Theme, matrix)
+		}),
+	)
+}
+
+func (r *Renderer) renderChart(gtx C) D {
 	select {
 	case result := <-r.vizWorker.Raw():
 		r.vizResult = result.(vizResult)
@@ -232,6 +1212,7 @@ func (r *Renderer) RenderViz(gtx C) D {
 		r.vizWorker.Push(vizData{
 			Value:   r.Value,
 			Context: gtx,
+			Chart:   r.ChartOptions(),
 		})
 	}
 	op.InvalidateOp{}.Add(gtx.Ops)
@@ -240,6 +1221,37 @@ func (r *Renderer) RenderViz(gtx C) D {
 	})
 }
 
+// vectorPlot charts the samples of a non-empty vector as bars, sorted
+// by their labels.
+func vectorPlot(data model.Vector) (*plot.Plot, error) {
+	data = append(model.Vector(nil), data...)
+	sort.SliceStable(data, func(i, j int) bool {
+		return strings.Compare(data[i].Metric.String(), data[j].Metric.String()) < 0
+	})
+	p := plot.New()
+	l := moreland.BlackBody()
+	minData := min([]*model.Sample(data))
+	maxData := max([]*model.Sample(data))
+	l.SetMin(minData)
+	l.SetMax(maxData)
+	values := make([]plotter.Values, len(data))
+	labels := make([]string, len(data))
+	for i := range values {
+		labels[i] = data[i].Metric.String()
+		values[i] = make(plotter.Values, len(data))
+		values[i][i] = float64(data[i].Value)
+		chart, err := plotter.NewBarChart(values[i], 0.5*vg.Centimeter)
+		if err != nil {
+			return nil, err
+		}
+		chart.Color, _ = l.At(values[i][i])
+		chart.Horizontal = true
+		p.Add(chart)
+	}
+	p.NominalY(labels...)
+	return p, nil
+}
+
 func min(in []*model.Sample) float64 {
 	m := in[0].Value
 	for i := range in {
@@ -271,13 +1283,13 @@ func RenderVizData(data vizData) vizResult {
 	case model.Vector:
 		return RenderVector(data.Context, value)
 	case *model.Scalar:
-		log.Println("scalar visualization is not yet supported")
+		slog.Debug("scalar visualization is not yet supported")
 	case model.Matrix:
-		log.Println("matrix visualization is not yet supported")
+		return RenderMatrix(data.Context, value, data.Chart)
 	case *model.String:
-		log.Println("string visualization is not yet supported")
+		slog.Debug("string visualization is not yet supported")
 	default:
-		log.Println("no data to visualize")
+		slog.Debug("no data to visualize")
 	}
 	return vizResult{}
 }
@@ -286,38 +1298,25 @@ func RenderVector(gtx C, data model.Vector) vizResult {
 	if len(data) < 1 {
 		return vizResult{}
 	}
-	sort.SliceStable(data, func(i, j int) bool {
-		return strings.Compare(data[i].Metric.String(), data[j].Metric.String()) < 0
-	})
-	p := plot.New()
-	var result vizResult
-	l := moreland.BlackBody()
-	minData := min([]*model.Sample(data))
-	maxData := max([]*model.Sample(data))
-	l.SetMin(minData)
-	l.SetMax(maxData)
-	values := make([]plotter.Values, len(data))
-	labels := make([]string, len(data))
-	for i := range values {
-		labels[i] = data[i].Metric.String()
-		values[i] = make(plotter.Values, len(data))
-		values[i][i] = float64(data[i].Value)
-		chart, err := plotter.NewBarChart(values[i], 0.5*vg.Centimeter)
-		if err != nil {
-			log.Printf("Failed creating bar chart: %v", err)
-			return vizResult{}
-		}
-		chart.Color, _ = l.At(values[i][i])
-		chart.Horizontal = true
-		p.Add(chart)
+	p, err := vectorPlot(data)
+	if err != nil {
+		slog.Error("failed creating bar chart", "err", err)
+		return vizResult{}
 	}
-	p.NominalY(labels...)
+	return drawPlot(gtx, p)
+}
+
+// drawPlot records the drawing of p filling the constraints of gtx.
+func drawPlot(gtx C, p *plot.Plot) vizResult {
+	var result vizResult
 	oldOps := gtx.Ops
 	gtx.Ops = &result.ops
 
 	macro := op.Record(gtx.Ops)
 	cnv := vggio.New(gtx, vg.Points(float64(gtx.Constraints.Max.X*3/4)), vg.Points(float64(gtx.Constraints.Max.Y*3/4)))
-	p.Draw(draw.New(cnv))
+	dc := draw.New(cnv)
+	p.Draw(dc)
+	result.area = newChartArea(p, dc, cnv.DPI())
 	gtx.Ops = cnv.Paint()
 	call := macro.Stop()
 	result.constraints = gtx.Constraints
@@ -327,113 +1326,430 @@ func RenderVector(gtx C, data model.Vector) vizResult {
 	return result
 }
 
-func loop(w *app.Window, client api.Client) error {
+// jitter returns d lengthened or shortened by a random amount up to the
+// given fraction of it.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
+
+func loop(w *app.Window, src Source, endpoints *endpointPicker, opts paneOptions, view *liveView, state WindowState) error {
 	th := material.NewTheme(gofont.Collection())
-	backEnd := NewBackend(client)
-	renderer := NewRenderer(th)
 	var (
-		ops          op.Ops
-		editor       widget.Editor
-		dataList     layout.List
-		warnings     []string
-		warningsList layout.List
-		errorText    string
-		inset        = layout.UniformInset(unit.Dp(4))
+		ops      op.Ops
+		compare  widget.Bool
+		showDiff widget.Bool
+		diff     paneDiff
+		about    widget.Bool
+		notes    widget.Bool
+		compact  widget.Bool
+		dark     widget.Bool
+		manual   widget.Bool
+		help     keyHelp
+		split    Split
+		style    Style
+
+		// exportSession saves a report of the session, with the outcome
+		// in sessionStatus.
+		exportSession widget.Clickable
+		sessionStatus string
 	)
-	dataList.Axis = layout.Vertical
-	warningsList.Axis = layout.Vertical
+	settings, err := LoadSettings()
+	if err != nil {
+		slog.Warn("using default settings", "err", err)
+	}
+	style.Compact = settings.Compact
+	compact.Value = settings.Compact
+	style.Dark = settings.Dark
+	dark.Value = settings.Dark
+	style.Apply(th)
+	scratch := newScratchpad()
+	panes := [2]*pane{
+		newPane(th, &style, src, opts),
+		newPane(th, &style, src, opts),
+	}
+	recalled := &recallHistory{}
+	for _, p := range panes {
+		p.presets = newPresetPanel(&settings)
+		p.recall.history = recalled
+		p.manual = &manual
+	}
+	for i, p := range panes {
+		path, err := resultCachePath(i)
+		if err != nil {
+			slog.Warn("not caching results", "err", err)
+			break
+		}
+		p.Restore(path)
+	}
+	// The queries left in the editors run as they would once typed.
+	for i, ps := range state.Panes {
+		if i < len(panes) {
+			panes[i].restoreState(ps)
+		}
+	}
+	compare.Value = state.Compare
+	if view != nil {
+		for i, p := range panes {
+			i := i
+			p.onResult = func(result queryResult) { view.Set(i, result) }
+		}
+	}
+	if err := rebind(settings.Keys); err != nil {
+		slog.Error("could not apply key bindings from settings, using the defaults", "err", err)
+	}
+	keys := newKeyDispatcher()
+	editing := func() bool {
+		return panes[0].Editing() || panes[1].Editing() || notes.Value && scratch.editor.Focused()
+	}
+	keys.Register(actionDismiss, func(key.Event) bool {
+		if !help.Visible {
+			return false
+		}
+		help.Visible = false
+		return true
+	})
+	keys.Register(actionShowKeys, func(e key.Event) bool {
+		// Printable keys are text while an editor is focused.
+		if editing() && utf8.RuneCountInString(e.Name) == 1 && e.Modifiers&^key.ModShift == 0 {
+			return false
+		}
+		help.Visible = !help.Visible
+		return true
+	})
+	keys.Register(actionFocusEditor, func(key.Event) bool {
+		// Like the search box of a web page.
+		if editing() {
+			return false
+		}
+		panes[0].editor.Focus()
+		return true
+	})
+	// setDark switches to the dark theme, or back to the light one,
+	// remembering the choice.
+	setDark := func(on bool) {
+		dark.Value, style.Dark, settings.Dark = on, on, on
+		style.Apply(th)
+		if err := settings.Save(); err != nil {
+			slog.Error("could not save settings", "err", err)
+		}
+	}
+	keys.Register(actionToggleTheme, func(key.Event) bool {
+		setDark(!dark.Value)
+		return true
+	})
+	keys.Register(actionCopyResult, func(key.Event) bool {
+		// Text boxes copy their own selection.
+		if editing() || notes.Value {
+			return false
+		}
+		// The second pane only once it has rows selected and the
+		// first does not.
+		p := panes[0]
+		if compare.Value && len(panes[1].selected.rows) > 0 && len(p.selected.rows) == 0 {
+			p = panes[1]
+		}
+		p.CopyResult()
+		return true
+	})
+	// replaceAsked is when the other pane's query was last found in the
+	// way of duplicating, so that repeating the shortcut in time replaces
+	// it.
+	var replaceAsked time.Time
+	keys.Register(actionDuplicate, func(e key.Event) bool {
+		from, to := panes[0], panes[1]
+		if to.Editing() {
+			from, to = to, from
+		}
+		now := time.Now()
+		text := to.editor.Text()
+		if strings.TrimSpace(text) != "" && text != from.editor.Text() && now.Sub(replaceAsked) > noteTime {
+			replaceAsked = now
+			from.Note("the other pane has a query; press "+chord{e.Name, e.Modifiers}.String()+" again to replace it", now)
+			return true
+		}
+		replaceAsked = time.Time{}
+		to.CopyQuery(from)
+		compare.Value = true
+		to.editor.Focus()
+		return true
+	})
+	for _, p := range panes {
+		p.RegisterKeys(keys)
+	}
+	setTimeouts := func() {
+		if len(endpoints.endpoints) > 0 {
+			for _, p := range panes {
+				p.backEnd.SetTimeout(endpoints.Timeout())
+			}
+		}
+	}
+	setTimeouts()
+	// switched reruns the queries after the endpoint in use changes.
+	switched := func() {
+		setTimeouts()
+		for _, p := range panes {
+			p.backEnd.ClearCache()
+			p.complete.Clear()
+		}
+		panes[0].Run()
+		if compare.Value {
+			panes[1].Run()
+		}
+	}
+	keys.Register(actionConnection, func(key.Event) bool {
+		if len(endpoints.endpoints) == 0 {
+			return false
+		}
+		endpoints.Connection.Toggle(endpoints.current)
+		return true
+	})
+	keys.Register(actionReloadConfig, func(key.Event) bool {
+		if endpoints.configPath == "" {
+			return false
+		}
+		if endpoints.Reload() {
+			switched()
+		}
+		return true
+	})
+	refresh := time.NewTimer(jitter(opts.Refresh, opts.RefreshJitter))
+	defer refresh.Stop()
+	// idle fires once no result has arrived for opts.IdleDisconnect, if
+	// set, and never otherwise.
+	idle := time.NewTimer(opts.IdleDisconnect)
+	if opts.IdleDisconnect <= 0 {
+		idle.Stop()
+	}
+	defer idle.Stop()
+	active := func() {
+		if opts.IdleDisconnect > 0 {
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(opts.IdleDisconnect)
+		}
+	}
+	tick := func() {
+		panes[0].Tick()
+		if compare.Value {
+			panes[1].Tick()
+		}
+	}
+	// With opts.PollVisible, live tailing only polls while the window is
+	// focused and the results are on screen, not minimized or hidden by
+	// the notes. A refresh skipped because of that is missed, and made
+	// up as soon as polling resumes.
+	focused, running, missed := true, true, false
+	polling := func() bool {
+		return !opts.PollVisible || focused && running && !notes.Value
+	}
 	for {
 		select {
 		case e := <-w.Events():
 			switch e := e.(type) {
 			case system.DestroyEvent:
+				state.Compare = compare.Value
+				state.Panes = []PaneState{panes[0].state(), panes[1].state()}
+				if err := state.Save(); err != nil {
+					slog.Warn("could not save window state", "err", err)
+				}
 				return e.Err
+			case key.Event:
+				if help.Visible {
+					help.Press(e)
+					w.Invalidate()
+				}
+				if keys.Dispatch(e) {
+					w.Invalidate()
+				}
+			case system.StageEvent:
+				running = e.Stage == system.StageRunning
+			case key.FocusEvent:
+				focused = e.Focus
+				if opts.PauseUnfocused {
+					for _, p := range panes {
+						if e.Focus {
+							p.Resume()
+						} else {
+							p.Pause()
+						}
+					}
+				}
+			case clipboard.Event:
+				for i, p := range panes {
+					// Further queries of pasted Grafana panels go to
+					// the other pane.
+					if more := p.HandlePaste(e.Text); len(more) > 0 {
+						panes[1-i].SetQuery(more[0])
+						compare.Value = true
+					}
+				}
 			case system.FrameEvent:
 				gtx := layout.NewContext(&ops, e)
-				var editorChanged = false
-				for _, e := range editor.Events() {
-					switch e.(type) {
-					case widget.ChangeEvent:
-						editorChanged = true
+				if e.Metric.PxPerDp > 0 {
+					state.Width = float32(e.Size.X) / e.Metric.PxPerDp
+					state.Height = float32(e.Size.Y) / e.Metric.PxPerDp
+				}
+				if compact.Changed() {
+					style.Compact = compact.Value
+					style.Apply(th)
+					settings.Compact = compact.Value
+					if err := settings.Save(); err != nil {
+						slog.Error("could not save settings", "err", err)
+					}
+				}
+				if dark.Changed() {
+					setDark(dark.Value)
+				}
+				paint.Fill(gtx.Ops, th.Bg)
+				inset := style.Inset()
+				if compare.Changed() && compare.Value {
+					panes[1].Run()
+				}
+				if manual.Changed() && !manual.Value {
+					// Run the edits held back.
+					panes[0].Run()
+					if compare.Value {
+						panes[1].Run()
 					}
 				}
-				if editorChanged {
-					format(&editor)
-					backEnd.Push(editor.Text())
+				if endpoints.Switched() {
+					switched()
+				}
+				if exportSession.Clicked() {
+					shown := panes[:1]
+					if compare.Value {
+						shown = panes[:]
+					}
+					now := time.Now()
+					path := sessionPath(now)
+					if err := saveSessionReport(path, shown, now); err != nil {
+						slog.Error("could not export session", "err", err)
+						sessionStatus = err.Error()
+					} else {
+						sessionStatus = "saved " + path
+					}
 				}
 				layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 					layout.Rigid(func(gtx C) D {
-						return inset.Layout(gtx, func(gtx C) D {
-							return widget.Border{
-								Width: unit.Dp(2),
-								Color: th.Fg,
-							}.Layout(gtx, func(gtx C) D {
-								return inset.Layout(gtx, func(gtx C) D {
-									gtx.Constraints.Min.X = gtx.Constraints.Max.X
-									gtx.Constraints.Min.Y = 0
-									ed := material.Editor(th, &editor, "query")
-									ed.Font.Variant = "Mono"
-									return ed.Layout(gtx)
-								})
-							})
-						})
+						return layout.Flex{}.Layout(gtx,
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.CheckBox(th, &compare, "compare side by side").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								if !compare.Value {
+									return D{}
+								}
+								return inset.Layout(gtx, material.CheckBox(th, &showDiff, "differences").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.CheckBox(th, &compact, "compact").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.CheckBox(th, &dark, "dark").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.CheckBox(th, &manual, "run manually").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.CheckBox(th, &about, "about").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.CheckBox(th, &notes, "notes").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return inset.Layout(gtx, material.Button(th, &exportSession, "export session").Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								if sessionStatus == "" {
+									return D{}
+								}
+								return inset.Layout(gtx, material.Caption(th, sessionStatus).Layout)
+							}),
+							layout.Rigid(func(gtx C) D {
+								return endpoints.Layout(gtx, th, inset)
+							}),
+						)
+					}),
+					layout.Rigid(func(gtx C) D {
+						return endpoints.Connection.Layout(gtx, th, inset)
 					}),
 					layout.Rigid(func(gtx C) D {
-						if len(errorText) == 0 {
+						if !about.Value {
 							return D{}
 						}
-						return inset.Layout(gtx, func(gtx C) D {
-							label := material.Body1(th, errorText)
-							label.Font.Variant = "Mono"
-							label.Color = color.NRGBA{R: 0x6e, G: 0x0a, B: 0x1e, A: 255}
-							return label.Layout(gtx)
-						})
+						return inset.Layout(gtx, material.Body2(th, versionString()).Layout)
+					}),
+					layout.Flexed(1, func(gtx C) D {
+						if notes.Value {
+							return scratch.Layout(gtx, th, inset)
+						}
+						if !compare.Value {
+							return panes[0].Layout(gtx)
+						}
+						return split.Layout(gtx, th, panes[0].Layout, panes[1].Layout)
 					}),
 					layout.Rigid(func(gtx C) D {
-						if len(warnings) == 0 {
+						if notes.Value || !compare.Value || !showDiff.Value {
 							return D{}
 						}
-						return inset.Layout(gtx, func(gtx C) D {
-							return warningsList.Layout(gtx, len(warnings), func(gtx C, index int) D {
-								label := material.Body1(th, warnings[index])
-								label.Font.Variant = "Mono"
-								label.Color = color.NRGBA{R: 0xd4, G: 0xaf, B: 0x37, A: 255}
-								return label.Layout(gtx)
-							})
-						})
+						left, right := panes[0], panes[1]
+						return diff.Layout(gtx, th, inset, left.renderer.Value, right.renderer.Value, left.updated, right.updated, opts.Numbers)
 					}),
-					layout.Flexed(1.0, func(gtx C) D {
-						return layout.Flex{}.Layout(gtx,
-							layout.Flexed(.5, func(gtx C) D {
-								return inset.Layout(gtx, func(gtx C) D {
-									data := renderer.RenderText()
-									return dataList.Layout(gtx, len(data), func(gtx C, index int) D {
-										label := material.Body1(th, data[index])
-										label.Font.Variant = "Mono"
-										return label.Layout(gtx)
-									})
-								})
-							}),
-							layout.Flexed(.5, func(gtx C) D {
-								return inset.Layout(gtx, func(gtx C) D {
-									return renderer.RenderViz(gtx)
-								})
-							}),
-						)
+					layout.Rigid(func(gtx C) D {
+						if notes.Value || !compare.Value {
+							return layoutStatusBar(gtx, th, inset, panes[:1])
+						}
+						return layoutStatusBar(gtx, th, inset, panes[:])
 					}),
 				)
+				help.Layout(gtx, th, inset)
 				e.Frame(gtx.Ops)
 			}
-		case data := <-backEnd.Raw():
-			result := data.(queryResult)
-			if result.error != nil {
-				errorText = result.Error()
-				warnings = nil
-			} else {
-				renderer.SetData(result.data)
-				warnings = result.warnings
-				errorText = ""
+			if missed && polling() {
+				slog.Debug("resuming live tailing")
+				missed = false
+				tick()
+			}
+		case <-endpoints.Hangups():
+			if endpoints.Reload() {
+				switched()
+			}
+			w.Invalidate()
+		case <-refresh.C:
+			refresh.Reset(jitter(opts.Refresh, opts.RefreshJitter))
+			if !polling() {
+				missed = true
+				break
+			}
+			tick()
+		case <-idle.C:
+			if c, ok := src.(IdleCloser); ok {
+				slog.Debug("closing idle connections", "idle", opts.IdleDisconnect)
+				c.CloseIdleConnections()
 			}
+		case data := <-panes[0].backEnd.Raw():
+			panes[0].Update(data.(queryResult))
+			active()
+			w.Invalidate()
+		case data := <-panes[1].backEnd.Raw():
+			panes[1].Update(data.(queryResult))
+			active()
+			w.Invalidate()
+		case retry := <-panes[0].backEnd.Retries():
+			panes[0].retry = retry.(int)
+			w.Invalidate()
+		case retry := <-panes[1].backEnd.Retries():
+			panes[1].retry = retry.(int)
+			w.Invalidate()
+		case r := <-panes[0].rules.Results():
+			panes[0].ReceiveRules(r)
+			w.Invalidate()
+		case r := <-panes[1].rules.Results():
+			panes[1].ReceiveRules(r)
 			w.Invalidate()
 		}
 	}
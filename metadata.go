@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/whereswaldon/binnacle/latest"
+)
+
+// MetadataSource is a Source that can describe metrics, as v1.API does.
+type MetadataSource interface {
+	Metadata(ctx context.Context, metric string, limit string) (map[string][]v1.Metadata, error)
+}
+
+// errNoMetadata is returned by Metadata when the Source in use cannot
+// describe metrics.
+var errNoMetadata = errors.New("metadata is not supported by this source")
+
+type metadataResponse struct {
+	metric string
+	text   string
+	err    error
+}
+
+// describeMetadata summarizes the metadata of a metric, of which targets
+// may report more than one version.
+func describeMetadata(metric string, md []v1.Metadata) string {
+	if len(md) == 0 {
+		return metric + ": no metadata"
+	}
+	var parts []string
+	for _, m := range md {
+		part := string(m.Type)
+		if m.Unit != "" {
+			part += " in " + m.Unit
+		}
+		if m.Help != "" {
+			part += ": " + m.Help
+		}
+		parts = append(parts, part)
+	}
+	return metric + " is a " + strings.Join(parts, "; or ")
+}
+
+// metadataView shows the metadata of a metric, fetched in the background.
+type metadataView struct {
+	fetcher latest.Worker
+	// metric is the metric shown, if any, and pending is set until its
+	// metadata arrives.
+	metric  string
+	pending bool
+	text    string
+	close   widget.Clickable
+}
+
+func newMetadataView(b *Backend) *metadataView {
+	v := &metadataView{}
+	v.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		metric := in.(string)
+		src, ok := b.Source.(MetadataSource)
+		if !ok {
+			return metadataResponse{metric: metric, err: errNoMetadata}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		defer cancel()
+		md, err := src.Metadata(ctx, metric, "")
+		if err != nil {
+			return metadataResponse{metric: metric, err: viewError(err)}
+		}
+		return metadataResponse{metric: metric, text: describeMetadata(metric, md[metric])}
+	})
+	return v
+}
+
+// Show fetches and shows the metadata of metric.
+func (v *metadataView) Show(metric string) {
+	v.metric, v.pending, v.text = metric, true, ""
+	v.fetcher.Push(metric)
+}
+
+func (v *metadataView) receive() {
+	select {
+	case r := <-v.fetcher.Raw():
+		resp := r.(metadataResponse)
+		if resp.metric != v.metric {
+			return
+		}
+		v.pending = false
+		if errors.Is(resp.err, errForbidden) {
+			v.text = resp.err.Error()
+		} else if resp.err != nil {
+			v.text = fmt.Sprintf("could not fetch metadata of %s: %v", resp.metric, resp.err)
+		} else {
+			v.text = resp.text
+		}
+	default:
+	}
+}
+
+func (v *metadataView) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	v.receive()
+	if v.close.Clicked() {
+		v.metric = ""
+	}
+	if v.metric == "" {
+		return D{}
+	}
+	text := v.text
+	if v.pending {
+		text = "fetching metadata of " + v.metric + "…"
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Flexed(1, func(gtx C) D {
+			return inset.Layout(gtx, material.Body2(th, text).Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &v.close, "close").Layout)
+		}),
+	)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// notesPath is the location of the scratchpad's notes within the user's
+// configuration directory, beside the settings.
+func notesPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "binnacle", "notes.txt"), nil
+}
+
+// scratchpad is a plain editor for notes taken while investigating,
+// saved as they are typed so that they survive restarts. Nothing in it
+// is queried.
+type scratchpad struct {
+	editor widget.Editor
+	// path is where the notes are saved, or empty if they cannot be.
+	path string
+	err  error
+}
+
+func newScratchpad() *scratchpad {
+	s := &scratchpad{}
+	path, err := notesPath()
+	if err != nil {
+		slog.Warn("not saving notes", "err", err)
+		return s
+	}
+	s.path = path
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.err = fmt.Errorf("could not read notes: %w", err)
+	}
+	s.editor.SetText(string(data))
+	return s
+}
+
+// save writes the notes to disk.
+func (s *scratchpad) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("could not save notes: %w", err)
+	}
+	if err := ioutil.WriteFile(s.path, []byte(s.editor.Text()), 0644); err != nil {
+		return fmt.Errorf("could not save notes: %w", err)
+	}
+	return nil
+}
+
+func (s *scratchpad) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	for _, e := range s.editor.Events() {
+		if _, ok := e.(widget.ChangeEvent); ok && s.path != "" {
+			s.err = s.save()
+		}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			if s.err == nil {
+				return D{}
+			}
+			l := material.Body2(th, s.err.Error())
+			l.Color = errorColor(th)
+			return inset.Layout(gtx, l.Layout)
+		}),
+		layout.Flexed(1, func(gtx C) D {
+			return inset.Layout(gtx, material.Editor(th, &s.editor, "notes, kept between sessions").Layout)
+		}),
+	)
+}
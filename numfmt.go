@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat controls how sample values are rendered.
+type NumberFormat struct {
+	// Precision is the number of significant digits to display. Values
+	// less than one display the shortest representation that round-trips.
+	Precision int
+	// Thousands enables comma separators within the integer part.
+	Thousands bool
+	// Scientific enables exponent notation for very large or very small
+	// magnitudes.
+	Scientific bool
+}
+
+// Format renders v according to the format's settings.
+func (f NumberFormat) Format(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	if v == 0 {
+		// Negative zero, as from -1 * 0, is shown as plain zero.
+		v = 0
+	}
+	precision := f.Precision
+	if precision < 1 {
+		precision = -1
+	}
+	if abs := math.Abs(v); f.Scientific && v != 0 && (abs >= 1e15 || abs < 1e-6) {
+		if precision > 0 {
+			precision--
+		}
+		return strconv.FormatFloat(v, 'e', precision, 64)
+	}
+	if precision > 0 {
+		// Round to the requested significant digits, then print the
+		// result without an exponent.
+		v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'e', precision-1, 64), 64)
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if f.Thousands {
+		s = separateThousands(s)
+	}
+	return s
+}
+
+// separateThousands inserts commas between each group of three digits
+// in the integer part of the decimal number s.
+func separateThousands(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	integer, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integer, fraction = s[:i], s[i:]
+	}
+	var b strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String() + fraction
+}
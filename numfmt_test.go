@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNumberFormat(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		f    NumberFormat
+		v    float64
+		want string
+	}{
+		{"shortest", NumberFormat{}, 0.1, "0.1"},
+		{"shortest integer", NumberFormat{}, 1234567, "1234567"},
+		{"rounds to precision", NumberFormat{Precision: 3}, 3.14159, "3.14"},
+		{"rounds up", NumberFormat{Precision: 3}, 0.9996, "1"},
+		{"rounds integer part", NumberFormat{Precision: 2}, 1251, "1300"},
+		{"rounds half to even", NumberFormat{Precision: 2}, 1250, "1200"},
+		{"precision beyond digits", NumberFormat{Precision: 10}, 1.5, "1.5"},
+		{"rounds small value", NumberFormat{Precision: 2}, 0.000123456, "0.00012"},
+		{"thousands", NumberFormat{Thousands: true}, 1234567.5, "1,234,567.5"},
+		{"thousands negative", NumberFormat{Thousands: true}, -1234567, "-1,234,567"},
+		{"thousands below 1000", NumberFormat{Thousands: true}, 999, "999"},
+		{"thousands negative below 1000", NumberFormat{Thousands: true}, -999.25, "-999.25"},
+		{"thousands fraction", NumberFormat{Thousands: true}, 0.000125, "0.000125"},
+		{"thousands exact group", NumberFormat{Thousands: true}, 100000, "100,000"},
+		{"thousands rounded", NumberFormat{Precision: 3, Thousands: true}, 1234567, "1,230,000"},
+		{"scientific large", NumberFormat{Scientific: true}, 1.5e15, "1.5e+15"},
+		{"scientific just below large", NumberFormat{Scientific: true}, 999999999999999, "999999999999999"},
+		{"scientific small", NumberFormat{Scientific: true}, 1.5e-7, "1.5e-07"},
+		{"scientific just above small", NumberFormat{Scientific: true}, 1e-6, "0.000001"},
+		{"scientific negative", NumberFormat{Scientific: true}, -2e20, "-2e+20"},
+		{"scientific precision", NumberFormat{Precision: 3, Scientific: true}, 1.23456e18, "1.23e+18"},
+		{"scientific zero", NumberFormat{Scientific: true}, 0, "0"},
+		{"scientific off large", NumberFormat{}, 1.5e15, "1500000000000000"},
+		{"scientific off small", NumberFormat{}, 1.5e-7, "0.00000015"},
+		{"scientific not thousands", NumberFormat{Thousands: true, Scientific: true}, 1e18, "1e+18"},
+		{"NaN", NumberFormat{Precision: 3, Thousands: true, Scientific: true}, math.NaN(), "NaN"},
+		{"+Inf", NumberFormat{Precision: 3, Thousands: true, Scientific: true}, math.Inf(1), "+Inf"},
+		{"-Inf", NumberFormat{Precision: 3, Thousands: true, Scientific: true}, math.Inf(-1), "-Inf"},
+		{"negative zero", NumberFormat{}, math.Copysign(0, -1), "0"},
+		{"negative zero formatted", NumberFormat{Precision: 3, Thousands: true, Scientific: true}, math.Copysign(0, -1), "0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.Format(tt.v); got != tt.want {
+				t.Errorf("%+v.Format(%v) = %q, want %q", tt.f, tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeparateThousands(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"0", "0"},
+		{"12", "12"},
+		{"999", "999"},
+		{"1000", "1,000"},
+		{"12345", "12,345"},
+		{"123456", "123,456"},
+		{"1234567", "1,234,567"},
+		{"-1", "-1"},
+		{"-999", "-999"},
+		{"-1000", "-1,000"},
+		{"-1234567.891", "-1,234,567.891"},
+		{"0.5", "0.5"},
+		{"-0.5", "-0.5"},
+		{"1234.5678", "1,234.5678"},
+		{"999.9999", "999.9999"},
+	} {
+		if got := separateThousands(tt.in); got != tt.want {
+			t.Errorf("separateThousands(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
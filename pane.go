@@ -0,0 +1,1824 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"gioui.org/io/clipboard"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// paneOptions configures the behavior of each pane.
+type paneOptions struct {
+	// Live enables live tailing of the query initially.
+	Live bool
+	// Refresh is the interval at which live tailing re-runs the query.
+	Refresh time.Duration
+	// Rolling refreshes a live subquery at a fixed step, like
+	// foo[1h:15s], once per step, fetching only the steps since.
+	Rolling bool
+	// RefreshJitter is the fraction by which each refresh interval is
+	// randomly lengthened or shortened, so that the refreshes of many
+	// users do not fall together.
+	RefreshJitter float64
+	// SeriesOrder is the order in which the series of a matrix are
+	// shown: orderLabels, orderFingerprint or orderServer.
+	SeriesOrder string
+	// CarryForward fills in the samples missing from stacked series
+	// with their previous values, rather than zero.
+	CarryForward bool
+	Numbers      NumberFormat
+	// AutoFormat reformats the query as it is edited, or when the
+	// editor loses focus if FormatOn is formatOnBlur.
+	AutoFormat bool
+	FormatOn   string
+	// FormatPaste reformats text pasted into the editor. It has no
+	// effect unless AutoFormat is set, and the query is reformatted when
+	// the editor loses focus regardless with formatOnBlur.
+	FormatPaste bool
+	// ServerFormat formats with the server's format_query endpoint
+	// where possible, instead of locally.
+	ServerFormat bool
+	Retry        RetryPolicy
+	// ExemplarRange is how far back exemplars are fetched, when enabled.
+	ExemplarRange time.Duration
+	// DefaultRange is the range offered to selectors that need one, as
+	// in rate(foo).
+	DefaultRange time.Duration
+	// SubqueryRange and SubqueryStep are the range and resolution of
+	// the subquery that the subquery button evaluates a query in.
+	SubqueryRange, SubqueryStep time.Duration
+	// GraphRange is how far back the graph history button charts an
+	// instant query.
+	GraphRange time.Duration
+	// CurlSecrets includes credentials in queries copied as curl
+	// commands.
+	CurlSecrets bool
+	// TraceURL, if set, is a template for the URL of a trace in an
+	// external tracing UI.
+	TraceURL string
+	// Thresholds color result values, unless the query sets its own.
+	Thresholds Thresholds
+	// Transform rewrites results before they are displayed, unless the
+	// query sets its own.
+	Transform Transform
+	// Wrappers wrap a submitted query of just a selector in a function
+	// for the type of its metric.
+	Wrappers Wrappers
+	// MaxSeries, if positive, limits the series requested and shown.
+	MaxSeries int
+	// MaxLabelValue, if positive, is the most characters of each label
+	// value shown in result rows, which are copied in full.
+	MaxLabelValue int
+	// StaleAfter, if positive, is the age at the query's time beyond
+	// which the samples of an instant vector are highlighted.
+	StaleAfter time.Duration
+	// PauseUnfocused cancels queries and pauses live tailing while the
+	// window is not focused.
+	PauseUnfocused bool
+	// PollVisible pauses live tailing while the window is not focused
+	// or its results are not on screen.
+	PollVisible bool
+	// Debounce is how long the query must go unedited before it is
+	// run, so that typing it does not run every partial query.
+	Debounce time.Duration
+	// IdleDisconnect, if positive, is how long after the last result
+	// the connections kept open to the server are closed.
+	IdleDisconnect time.Duration
+	// ServerTimeout, if positive, is the longest the server is asked to
+	// spend evaluating a query.
+	ServerTimeout time.Duration
+	// CacheSize and CacheTTL are how many results are cached, and for
+	// how long, to answer queries run again soon after.
+	CacheSize int
+	CacheTTL  time.Duration
+	// DisabledLints are the ids of the lints not run on queries.
+	DisabledLints map[string]bool
+}
+
+// pane is a query editor together with the results of its query. Each
+// pane dispatches its queries through its own Backend.
+type pane struct {
+	th       *material.Theme
+	style    *Style
+	backEnd  *Backend
+	renderer *Renderer
+	opts     paneOptions
+
+	editor  widget.Editor
+	history undoHistory
+	recall  *queryRecall
+	// complete offers names completing the identifier at the caret.
+	complete *queryCompletion
+	// queries are those run in the session, for its report.
+	queries   queryLog
+	find      *queryFind
+	export    *chartExport
+	results   resultExport
+	dataList  layout.List
+	rowHovers []hoverArea
+	rowMenu   rowMenu
+	metadata  *metadataView
+	pinned    *pinnedSeries
+	drill     drillTrail
+	grouping  *resultGrouping
+	warnings  []string
+	// lints are the warnings of the lints about the query being edited,
+	// listed with those of the server.
+	lints        []string
+	warningsList layout.List
+	errorText    string
+	// parenWarning describes unbalanced parentheses in the query, and
+	// rangeWarning selectors missing the range that their function needs,
+	// which addRange inserts.
+	parenWarning string
+	rangeWarning string
+	addRange     widget.Clickable
+	// rangeWindow is instantWindow or one of rangeWindows, over which
+	// the query is evaluated as a range query.
+	rangeWindow  widget.Enum
+	tail         widget.Bool
+	showPlan     widget.Bool
+	showExemplar widget.Bool
+	exemplars    exemplarList
+	showStats    widget.Bool
+	stats        *QueryStats
+	showTimes    widget.Bool
+	// views is the way results are shown, which cycleView changes.
+	views     resultViews
+	cycleView widget.Clickable
+	// heatmap colors the background of each row by where its value
+	// falls within heat, the range of the result's values.
+	heatmap widget.Bool
+	heat    heatScale
+	// summary aggregates the values of a vector displayed, for a footer.
+	summary valueSummary
+	// labelsOnly lists just the label sets of the result's series,
+	// labelSets, leaving out their values. aligned lines up the values
+	// of a vector in a column, and table shows the vector as a table.
+	labelsOnly  widget.Bool
+	labelSets   []textRow
+	aligned     widget.Bool
+	table       widget.Bool
+	logY        widget.Bool
+	stacked     widget.Bool
+	normalize   widget.Bool
+	truncated   bool
+	showBuilder widget.Bool
+	builder     *selectorBuilder
+	showRules   widget.Bool
+	rules       *ruleList
+	// cheap is whether the query reads only recording rules, and
+	// costKnown whether that is known, found once per parse and again
+	// once the rules arrive rather than with every frame.
+	cheap       bool
+	costKnown   bool
+	showSnaps   widget.Bool
+	showSweep   widget.Bool
+	showRelabel widget.Bool
+	relabel     *relabelPanel
+	showPresets widget.Bool
+	presets     *presetPanel
+	sweep       *sweepPanel
+	// histogram charts the result as a heatmap of its buckets, offered
+	// when shownHistogram is set for a classic histogram.
+	histogram      widget.Bool
+	shownHistogram bool
+	// frozen keeps the result on display, setting aside in thawed the
+	// latest of those arriving meanwhile, of which there have been
+	// frozenCount, to be shown once unfrozen.
+	frozen      widget.Bool
+	thawed      *queryResult
+	frozenCount int
+	// onlyChanged hides the series whose values are the same as in
+	// previous, the last result of the query, counting them in
+	// unchangedHidden.
+	onlyChanged     widget.Bool
+	previous        snapshot
+	unchangedHidden int
+	snapshots       *snapshotPanel
+	absent          widget.Clickable
+	subquery        widget.Clickable
+	compareTo       widget.Clickable
+	toAlert         widget.Clickable
+	toCurl          widget.Clickable
+	toTSV           widget.Clickable
+	threshold       widget.Editor
+	// graph replaces an instant vector query, which canGraph is set for,
+	// with its history over opts.GraphRange, and then puts back instant,
+	// the query it replaced, unless graphed has since been edited.
+	graph    widget.Clickable
+	canGraph bool
+	instant  string
+	graphed  string
+	// thresholds color result values, and thresholdErr describes any
+	// problem with those set by the query.
+	thresholds   Thresholds
+	thresholdErr string
+	// transform rewrites results before they are displayed, and
+	// transformErr describes any problem with that set by the query.
+	transform    Transform
+	transformErr string
+	// timeout overrides the time allowed for the query, if not empty.
+	timeout *durationField
+	// shownQuery and shownSeries identify the results displayed, and
+	// shownBool is set if they are the 0s and 1s of a bool comparison.
+	shownQuery, shownSeries string
+	shownBool               bool
+	// targets shows the results of the up query, when shownTargets is
+	// set, and showTargets runs that query.
+	targets      *targetGrid
+	shownTargets bool
+	showTargets  widget.Clickable
+	plan         []string
+	// hints are the values of the query's constant subexpressions.
+	hints    []string
+	planList layout.List
+	recent   latencies
+	series   *cardinality
+	counter  *counterHint
+	wrap     *autoWrap
+	// pasted is set when the next change to the editor is a paste, and
+	// importJSON is the Grafana JSON being pasted, to be replaced with
+	// its query importExpr.
+	pasted                 bool
+	importJSON, importExpr string
+	// primary pastes the primary selection on a middle-click.
+	primary *primaryPaste
+	// retry is the number of the retry in progress, if any.
+	retry int
+	// cachePath is where the last successful result is cached, and
+	// stale is the time of a cached result on display, if any.
+	cachePath string
+	stale     time.Time
+	// evaluated is the time of the query whose results are displayed,
+	// and updated when they arrived.
+	evaluated time.Time
+	updated   time.Time
+	// replica names the server that answered, if it said.
+	replica string
+	// status is what the status bar tells of the last query.
+	status queryStatus
+	// copyPending is set once the result is to be copied.
+	copyPending bool
+	// note is a passing message for the status bar, such as what was
+	// copied, given at notedAt.
+	note    string
+	notedAt time.Time
+	// selected is the rows clicked to copy only those.
+	selected rowSelection
+	// formatter formats queries with the server, if enabled, and
+	// formatting is set while it is busy.
+	formatter  *latest.Worker
+	formatting bool
+	// focused is whether the editor had focus as of the last frame, and
+	// unformatted is set if the query has been edited since, for
+	// formatting when it loses focus.
+	focused, unformatted bool
+	// onResult, if set, is called with each result displayed.
+	onResult func(queryResult)
+	// held is set while the query copied from another pane waits to be
+	// edited before it is run, and copied until the copy reaches the
+	// editor.
+	held, copied bool
+	// runDue is when the query as edited is run, once editing has
+	// paused for opts.Debounce, if runPending is set.
+	runDue     time.Time
+	runPending bool
+	// manual, shared by the panes, holds edits back from running the
+	// query until it is run with the run button or the run shortcut,
+	// whose line break typed into the editor is taken out if runBreak is
+	// set. running is set from a run until its result arrives.
+	manual   *widget.Bool
+	run      widget.Clickable
+	runBreak bool
+	running  bool
+	// paused is set while the window is unfocused, and interrupted if a
+	// query was cancelled by pausing.
+	paused, interrupted bool
+	// cancel cancels the query in flight, and cancelled is set once it
+	// has, until its result arrives.
+	cancel    widget.Clickable
+	cancelled bool
+	// window is the last result of a rolling subquery, extended by each
+	// live refresh.
+	window rollingWindow
+	// parse is that of the query as it is edited, from which the plan,
+	// hints and warnings about it are worked out.
+	parse editParse
+}
+
+func newPane(th *material.Theme, style *Style, src Source, opts paneOptions) *pane {
+	p := &pane{
+		th:       th,
+		style:    style,
+		backEnd:  NewBackend(src, opts.Retry),
+		renderer: NewRenderer(th, opts.Numbers),
+		opts:     opts,
+	}
+	p.backEnd.ServerTimeout = opts.ServerTimeout
+	p.backEnd.Cache = newQueryCache(opts.CacheSize, opts.CacheTTL)
+	p.renderer.CarryForward = opts.CarryForward
+	p.renderer.MaxLabelValue = opts.MaxLabelValue
+	p.thresholds = opts.Thresholds
+	p.transform = opts.Transform
+	p.tail.Value = opts.Live
+	p.dataList.Axis = layout.Vertical
+	p.grouping = newResultGrouping()
+	p.warningsList.Axis = layout.Vertical
+	p.planList.Axis = layout.Vertical
+	p.exemplars.TraceURL = opts.TraceURL
+	p.builder = newSelectorBuilder(p.backEnd)
+	p.series = newCardinality(p.backEnd)
+	p.counter = newCounterHint(p.backEnd)
+	p.wrap = newAutoWrap(p.backEnd, opts.Wrappers)
+	p.rules = newRuleList(p.backEnd)
+	p.snapshots = newSnapshotPanel()
+	p.sweep = newSweepPanel(p.backEnd)
+	p.relabel = newRelabelPanel()
+	p.metadata = newMetadataView(p.backEnd)
+	p.pinned = newPinnedSeries(p.backEnd)
+	p.targets = newTargetGrid()
+	p.find = newQueryFind()
+	p.recall = newQueryRecall()
+	p.complete = newQueryCompletion(p.backEnd)
+	p.manual = new(widget.Bool)
+	p.primary = newPrimaryPaste()
+	p.export = newChartExport()
+	if opts.ServerFormat {
+		formatter := latest.NewWorker(func(in interface{}) interface{} {
+			text := in.(string)
+			formatted, err := p.backEnd.FormatQuery(text)
+			return formatResponse{text: text, formatted: formatted, err: err}
+		})
+		p.formatter = &formatter
+	}
+	p.showTimes.Value = true
+	p.rangeWindow.Value = instantWindow
+	p.threshold.SingleLine = true
+	p.threshold.SetText("> 0.9")
+	p.timeout = newDurationField("timeout")
+	return p
+}
+
+// Run dispatches the pane's current query, along with the pinned series.
+func (p *pane) Run() {
+	p.runPending, p.running = false, true
+	p.backEnd.Push(p.request())
+	p.pinned.Fetch()
+}
+
+// request is the request that Run sends for the pane's current query.
+func (p *pane) request() queryRequest {
+	req := queryRequest{Text: p.editor.Text()}
+	if p.showExemplar.Value {
+		req.Exemplars = p.opts.ExemplarRange
+	}
+	req.Stats = p.showStats.Value
+	req.Timeout = p.timeout.Duration()
+	req.Limit = p.opts.MaxSeries
+	// Live results must be new each time.
+	req.Fresh = p.tail.Value
+	if p.rolling() {
+		req.Since = p.window.at
+	}
+	if p.rangeWindow.Value != instantWindow {
+		req.Range, _ = promql.ParseDuration(p.rangeWindow.Value)
+	}
+	return req
+}
+
+// rolling reports whether live tailing extends the result on display,
+// of the pane's current query, rather than replacing it.
+func (p *pane) rolling() bool {
+	if !p.opts.Rolling || !p.tail.Value {
+		return false
+	}
+	query, err := expand(p.editor.Text())
+	return err == nil && p.window.rolls(query)
+}
+
+// Rerun runs the pane's current query straight away, even if it is held
+// after being copied, asking the server again rather than showing a
+// cached result, as after switching endpoints.
+func (p *pane) Rerun() {
+	p.held = false
+	p.recall.history.Add(p.editor.Text())
+	p.wrap.Submit(p.editor.Text())
+	req := p.request()
+	req.Fresh, req.Since = true, time.Time{}
+	p.running = true
+	p.backEnd.Push(req)
+	p.pinned.Fetch()
+}
+
+// Tick re-runs the query if live tailing is enabled, waiting for the
+// next step of a rolling subquery.
+func (p *pane) Tick() {
+	if p.tail.Value && !p.paused && !p.held && (!p.rolling() || p.window.due(time.Now())) {
+		p.Run()
+	}
+}
+
+// CopyQuery replaces the query with that of from, along with its live
+// tailing and timeout, without running it until it is edited.
+func (p *pane) CopyQuery(from *pane) {
+	p.editor.SetText(from.editor.Text())
+	p.timeout.SetText(from.timeout.Text())
+	p.tail.Value = from.tail.Value
+	p.showStats.Value = from.showStats.Value
+	p.showExemplar.Value = from.showExemplar.Value
+	// Setting empty text is not reported as a change.
+	p.held, p.copied = true, from.editor.Text() != ""
+}
+
+// Pause cancels any query in flight and stops live tailing until Resume.
+func (p *pane) Pause() {
+	p.paused = true
+	if p.backEnd.Cancel() {
+		p.interrupted = true
+	}
+}
+
+// Resume re-runs the query if pausing interrupted it or if live tailing
+// is enabled.
+func (p *pane) Resume() {
+	if p.paused && (p.interrupted || p.tail.Value) {
+		p.Run()
+	}
+	p.paused, p.interrupted = false, false
+}
+
+// ToggleFreeze freezes or unfreezes the result on display. Unfreezing
+// shows the latest result to have arrived while frozen, if any.
+func (p *pane) ToggleFreeze(frozen bool) {
+	p.frozen.Value = frozen
+	if frozen {
+		return
+	}
+	thawed := p.thawed
+	p.thawed, p.frozenCount = nil, 0
+	if thawed != nil {
+		p.Update(*thawed)
+	}
+}
+
+// Editing reports whether any of the pane's editors has focus, and so
+// should receive typed text.
+func (p *pane) Editing() bool {
+	return p.editor.Focused() || p.find.Focused() || p.export.Focused() || p.snapshots.Focused() || p.showSweep.Value && p.sweep.Focused() || p.showRelabel.Value && p.relabel.Focused() || p.showPresets.Value && p.presets.Focused() || p.threshold.Focused() || p.timeout.Focused() || p.grouping.Label.Focused() || p.showBuilder.Value && p.builder.Focused()
+}
+
+// RegisterKeys registers the pane's keyboard actions, which apply while
+// its query editor is focused.
+func (p *pane) RegisterKeys(d *keyDispatcher) {
+	editing := func(f func()) keyHandler {
+		return func(key.Event) bool {
+			if !p.editor.Focused() {
+				return false
+			}
+			f()
+			return true
+		}
+	}
+	for a, m := range macros {
+		m := m
+		d.Register(a, editing(func() { applyMacro(&p.editor, m) }))
+	}
+	d.Register(actionCycleView, editing(func() { p.views.Cycle(p.renderer.Value, p.shownTargets) }))
+	d.Register(actionRerun, editing(p.Rerun))
+	d.Register(actionRun, editing(func() {
+		p.Run()
+		p.runBreak = true
+	}))
+	d.Register(actionFreeze, editing(func() { p.ToggleFreeze(!p.frozen.Value) }))
+	recall := func(dir int) keyHandler {
+		return func(key.Event) bool {
+			return p.editor.Focused() && p.recall.Step(&p.editor, dir)
+		}
+	}
+	d.Register(actionComplete, func(key.Event) bool {
+		return p.editor.Focused() && p.complete.Choose()
+	})
+	d.Register(actionDismiss, func(key.Event) bool { return p.complete.Dismiss() })
+	d.Register(actionRecallPrev, recall(1))
+	d.Register(actionRecallNext, recall(-1))
+	d.Register(actionUndo, editing(func() { p.history.Undo(&p.editor) }))
+	d.Register(actionRedo, editing(func() { p.history.Redo(&p.editor) }))
+	finding := func(f func()) keyHandler {
+		return func(key.Event) bool {
+			if !p.find.Focused() && !(p.find.Visible && p.editor.Focused()) {
+				return false
+			}
+			f()
+			return true
+		}
+	}
+	d.Register(actionFind, func(key.Event) bool {
+		if !p.editor.Focused() && !p.find.Focused() {
+			return false
+		}
+		p.find.Open(&p.editor)
+		return true
+	})
+	d.Register(actionFindNext, finding(func() { p.find.Next(&p.editor, 1) }))
+	d.Register(actionFindPrev, finding(func() { p.find.Next(&p.editor, -1) }))
+	d.Register(actionDismiss, finding(func() { p.find.Close(&p.editor) }))
+}
+
+// HandlePaste notes that text is about to be pasted into the editor, if
+// it is focused. The JSON of a Grafana panel is replaced by the query of
+// its first target, and the queries of any other targets are returned.
+func (p *pane) HandlePaste(text string) []string {
+	if !p.editor.Focused() {
+		return nil
+	}
+	p.pasted = true
+	exprs := grafanaExprs(text)
+	if len(exprs) == 0 {
+		return nil
+	}
+	p.importJSON, p.importExpr = text, exprs[0]
+	return exprs[1:]
+}
+
+// SetQuery replaces the query, which then runs.
+func (p *pane) SetQuery(text string) {
+	p.editor.SetText(text)
+}
+
+// updateThresholds applies the thresholds set by the query, if any, or
+// else the global thresholds.
+func (p *pane) updateThresholds() {
+	p.thresholds, p.thresholdErr = p.opts.Thresholds, ""
+	spec, ok := queryThresholds(p.editor.Text())
+	if !ok {
+		return
+	}
+	t, err := ParseThresholds(spec)
+	if err != nil {
+		p.thresholdErr = err.Error()
+		return
+	}
+	p.thresholds = t
+}
+
+// updateTransform applies the transform set by the query, if any, or else
+// the global transform.
+func (p *pane) updateTransform() {
+	p.transform, p.transformErr = p.opts.Transform, ""
+	spec, ok := queryDirective(p.editor.Text(), transformDirective)
+	if !ok {
+		return
+	}
+	t, err := ParseTransform(spec)
+	if err != nil {
+		p.transformErr = err.Error()
+		return
+	}
+	p.transform = t
+}
+
+// Restore shows the result cached at path by an earlier session, marked
+// as stale, and caches subsequent successful results there. The cached
+// query is put in the editor, which runs it afresh.
+func (p *pane) Restore(path string) {
+	p.cachePath = path
+	cached, value, ok, err := loadResult(path)
+	if err != nil {
+		slog.Warn("could not restore last result", "err", err)
+	}
+	if !ok {
+		return
+	}
+	value = orderSeries(value, p.opts.SeriesOrder)
+	p.editor.SetText(cached.Text)
+	p.updateTransform()
+	value = p.transform.Apply(value)
+	p.shownQuery, p.shownSeries = cached.Query, seriesKey(value)
+	p.shownBool = boolComparison(cached.Query)
+	p.shownTargets = isTargetsQuery(cached.Query)
+	p.targets.SetData(value)
+	p.renderer.SetData(value)
+	p.grouping.SetData(value)
+	p.warnings = cached.Warnings
+	p.stale = cached.Time
+	p.evaluated = cached.Time
+}
+
+type formatResponse struct {
+	text, formatted string
+	err             error
+}
+
+// serverFormattable reports whether the server can format text, which
+// it could not parse as a template, and whose comments it would drop.
+func serverFormattable(text string) bool {
+	return !strings.Contains(text, "{{") && !strings.Contains(text, "#")
+}
+
+// The times at which auto-formatting reformats the query.
+const (
+	// formatOnChange reformats the query with every edit.
+	formatOnChange = "change"
+	// formatOnBlur reformats the query once the editor loses focus,
+	// leaving it as typed until then.
+	formatOnBlur = "blur"
+)
+
+// autoFormat formats the query, with the server if enabled and possible.
+func (p *pane) autoFormat() {
+	if p.formatter != nil && serverFormattable(p.editor.Text()) {
+		p.formatting = true
+		p.formatter.Push(p.editor.Text())
+		return
+	}
+	format(&p.editor)
+	p.history.Record(&p.editor)
+}
+
+// receiveFormat applies the server's formatting of the query, unless it
+// has been edited since, falling back to local formatting if the server
+// could not format it.
+func (p *pane) receiveFormat() {
+	if p.formatter == nil {
+		return
+	}
+	select {
+	case r := <-p.formatter.Raw():
+		resp := r.(formatResponse)
+		p.formatting = false
+		if resp.text != p.editor.Text() {
+			return
+		}
+		if resp.err != nil {
+			slog.Debug("server could not format query", "err", resp.err)
+			format(&p.editor)
+		} else if resp.formatted != resp.text {
+			p.editor.SetText(resp.formatted)
+			n := len(resp.formatted)
+			p.editor.SetCaret(n, n)
+		}
+		p.history.Record(&p.editor)
+	default:
+	}
+}
+
+// Update displays the result of a query.
+func (p *pane) Update(result queryResult) {
+	// Discard any retry notice that raced with the result.
+	select {
+	case <-p.backEnd.Retries():
+	default:
+	}
+	p.retry, p.running = 0, false
+	cancelled := p.cancelled
+	p.cancelled = false
+	if errors.Is(result.error, context.Canceled) {
+		if !cancelled {
+			// Pausing cancels queries too, which are re-run on
+			// resuming.
+			return
+		}
+		result.error = fmt.Errorf("query cancelled after %v", result.elapsed.Round(time.Millisecond))
+	}
+	if result.elapsed > 0 {
+		p.recent.Add(result.elapsed)
+	}
+	p.status = newQueryStatus(result)
+	if p.frozen.Value {
+		p.thawed = &result
+		p.frozenCount++
+		return
+	}
+	if result.error == nil && !p.roll(&result) {
+		return
+	}
+	result.data = orderSeries(result.data, p.opts.SeriesOrder)
+	if p.onResult != nil {
+		p.onResult(result)
+	}
+	if !emptyQuery(result.text) {
+		p.queries.Add(result.text, result.at)
+	}
+	if result.error != nil {
+		p.errorText = result.Error()
+		p.warnings = nil
+	} else {
+		// Keep the scroll position when a query is re-run and
+		// returns the same series, as when live tailing.
+		shown := p.transform.Apply(result.data)
+		p.unchangedHidden = 0
+		if p.onlyChanged.Value {
+			snap, _ := takeSnapshot("", result.query, shown)
+			if p.previous.query == result.query && p.previous.series != nil {
+				shown, p.unchangedHidden = changedSeries(shown, p.previous)
+			}
+			p.previous = snap
+		}
+		series := seriesKey(shown)
+		if result.query != p.shownQuery || series != p.shownSeries {
+			p.dataList.Position = layout.Position{}
+			p.selected.Clear()
+		}
+		p.shownQuery, p.shownSeries = result.query, series
+		p.shownBool = boolComparison(result.query)
+		p.shownTargets = isTargetsQuery(result.query)
+		p.shownHistogram = isHistogram(shown)
+		p.targets.SetData(shown)
+		p.renderer.SetData(shown)
+		p.heat = newHeatScale(shown)
+		p.summary = newValueSummary(shown)
+		p.labelSets = labelSetRows(shown, p.opts.MaxLabelValue)
+		p.grouping.SetData(shown)
+		p.exemplars.Set(result.exemplars, p.opts.Numbers)
+		p.stats = result.stats
+		p.truncated = result.truncated
+		p.warnings = result.warnings
+		p.errorText = ""
+		p.stale = time.Time{}
+		p.evaluated = result.at
+		p.updated = time.Now()
+		p.replica = result.replica
+		if p.cachePath != "" && result.data != nil {
+			if err := saveResult(p.cachePath, result); err != nil {
+				slog.Warn("could not cache result", "err", err)
+			}
+		}
+	}
+}
+
+// analyze updates the features that analyze the query as it is edited,
+// once it has been parsed, all from the one parse of the query as its
+// templates expand. While it cannot be parsed, they analyze the last
+// query that could, lest they flicker with each key typed, and the plan
+// explains that query after the parse error.
+func (p *pane) analyze() {
+	p.parenWarning = checkParens(p.editor.Text())
+	p.rangeWarning = describeMissingRanges(p.parse.Missing())
+	good := p.parse.Good()
+	var expr promql.Expr
+	if good != nil {
+		expr = good.expr
+	}
+	p.plan = explain(expr)
+	if err := p.parse.Err(); err != nil {
+		plan := []string{err.Error()}
+		if len(p.plan) > 0 {
+			plan = append(plan, "the last query that parsed:")
+		}
+		p.plan = append(plan, p.plan...)
+	}
+	p.canGraph = graphable(expr)
+	p.hints = constantHints(good, p.opts.Numbers)
+	p.lints = lintQuery(expr, p.opts.DisabledLints)
+	p.series.Update(expr)
+	p.counter.Update(expr)
+	p.cheap, p.costKnown = p.rules.Recorded(expr)
+}
+
+// ReceiveRules takes in the recording rules fetched, from the Results
+// of rules, and finds again whether the query reads only those.
+func (p *pane) ReceiveRules(r interface{}) {
+	p.rules.Receive(r)
+	var expr promql.Expr
+	if good := p.parse.Good(); good != nil {
+		expr = good.expr
+	}
+	p.cheap, p.costKnown = p.rules.Recorded(expr)
+}
+
+// roll adds the steps of a rolling subquery in result to the window of
+// its earlier steps, and keeps the whole result as the window for the
+// next refresh. It reports false for steps that no longer extend the
+// window, as after it was replaced, which are not to be shown alone.
+func (p *pane) roll(result *queryResult) bool {
+	if !result.since.IsZero() {
+		m, ok := result.data.(model.Matrix)
+		if !ok || !p.window.rolls(result.query) || !p.window.at.Equal(result.since) {
+			p.window = rollingWindow{}
+			return false
+		}
+		from := model.TimeFromUnixNano(result.at.Add(-p.window.rng).UnixNano())
+		result.data = mergeWindow(p.window.data, m, from)
+	}
+	p.window = rollingWindow{}
+	sub, ok := rollingSubquery(result.query)
+	if m, isMatrix := result.data.(model.Matrix); p.opts.Rolling && ok && isMatrix {
+		p.window = rollingWindow{query: result.query, at: result.at, rng: sub.Range, step: sub.Step, data: m}
+	}
+	return true
+}
+
+func (p *pane) Layout(gtx C) D {
+	th := p.th
+	inset := p.style.Inset()
+	if at, text, ok := p.primary.Pasted(); ok {
+		p.editor.SetCaret(at, at)
+		p.editor.Insert(text)
+		p.pasted = true
+	}
+	if wrapped, ok := p.wrap.Wrapped(gtx, p.editor.Text()); ok {
+		p.SetQuery(wrapped)
+	}
+	if original, ok := p.wrap.Undone(p.editor.Text()); ok {
+		p.SetQuery(original)
+	}
+	var editorChanged = false
+	for _, e := range p.editor.Events() {
+		switch e.(type) {
+		case widget.ChangeEvent:
+			editorChanged = true
+		}
+	}
+	if focused := p.editor.Focused(); focused != p.focused {
+		p.focused = focused
+		if !focused {
+			p.recall.history.Add(p.editor.Text())
+			p.wrap.Submit(p.editor.Text())
+		}
+		if !focused && p.unformatted && p.opts.AutoFormat && p.opts.FormatOn == formatOnBlur {
+			p.unformatted = false
+			p.autoFormat()
+		}
+	}
+	p.receiveFormat()
+	if p.formatting {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	if editorChanged && p.importJSON != "" {
+		// The replacement is itself a change, handled like the paste
+		// it stands for.
+		text := p.editor.Text()
+		if i := strings.Index(text, p.importJSON); i >= 0 {
+			p.editor.SetText(text[:i] + p.importExpr + text[i+len(p.importJSON):])
+			n := i + len(p.importExpr)
+			p.editor.SetCaret(n, n)
+			editorChanged = false
+		}
+		p.importJSON, p.importExpr = "", ""
+	}
+	if editorChanged {
+		// Record the state both before and after formatting
+		// so that an unwanted reformat can itself be undone.
+		autoFormat := p.opts.AutoFormat && p.opts.FormatOn != formatOnBlur && (p.opts.FormatPaste || !p.pasted)
+		p.pasted = false
+		if p.history.Record(&p.editor) && autoFormat {
+			p.autoFormat()
+		}
+		if p.copied {
+			p.copied = false
+		} else {
+			p.held = false
+		}
+		if !p.held && !p.manual.Value {
+			p.runDue, p.runPending = gtx.Now.Add(p.opts.Debounce), true
+		}
+		if p.graphed != "" && p.editor.Text() != p.graphed {
+			// The graph has been edited into a query of its own.
+			p.instant, p.graphed = "", ""
+		}
+		p.parse.Edited(p.editor.Text(), gtx.Now)
+		p.recall.Edited(p.editor.Text())
+		p.unformatted = true
+		p.updateThresholds()
+		p.updateTransform()
+		p.drill.Edited(p.editor.Text())
+	}
+	if p.runPending {
+		if gtx.Now.Before(p.runDue) {
+			op.InvalidateOp{At: p.runDue}.Add(gtx.Ops)
+		} else {
+			p.Run()
+		}
+	}
+	if p.parse.Parse(gtx.Now) {
+		p.analyze()
+	} else if due, ok := p.parse.Waiting(); ok {
+		op.InvalidateOp{At: due}.Add(gtx.Ops)
+	}
+	if text, ok := p.drill.Stepped(); ok {
+		p.SetQuery(text)
+	}
+	if p.tail.Changed() && p.tail.Value {
+		p.Run()
+	}
+	if p.showExemplar.Changed() && p.showExemplar.Value {
+		p.Run()
+	}
+	if p.frozen.Changed() {
+		p.ToggleFreeze(p.frozen.Value)
+	}
+	if p.onlyChanged.Changed() && !p.onlyChanged.Value {
+		p.previous, p.unchangedHidden = snapshot{}, 0
+	}
+	if p.showStats.Changed() {
+		p.stats = nil
+		if p.showStats.Value {
+			p.Run()
+		}
+	}
+	p.timeout.Changed()
+	if p.showTargets.Clicked() {
+		p.SetQuery(targetsQuery)
+	}
+	if p.cycleView.Clicked() {
+		p.views.Cycle(p.renderer.Value, p.shownTargets)
+	}
+	view := p.views.Mode(p.renderer.Value, p.shownTargets)
+	textWidth, chartWidth := float32(.5), float32(.5)
+	switch view {
+	case viewText:
+		textWidth, chartWidth = 1, 0
+	case viewChart:
+		textWidth, chartWidth = 0, 1
+	}
+	if sel, ok := p.targets.Clicked(); ok {
+		p.SetQuery(sel)
+	}
+	if p.counter.Rate.Clicked() {
+		p.SetQuery("rate(" + strings.TrimSpace(p.editor.Text()) + "[" + promql.FormatDuration(p.opts.DefaultRange) + "])")
+	}
+	if p.addRange.Clicked() {
+		applyMacro(&p.editor, insertRanges(promql.FormatDuration(p.opts.DefaultRange)))
+	}
+	if p.absent.Clicked() {
+		applyMacro(&p.editor, wrapAbsent)
+	}
+	if p.graph.Clicked() {
+		if p.instant != "" {
+			p.SetQuery(p.instant)
+			p.instant, p.graphed = "", ""
+		} else if parsed, err := parseEdited(p.editor.Text()); err == nil && graphable(parsed.expr) {
+			// canGraph may be that of the last query that parsed, so
+			// the query as it is now is parsed to be sure.
+			text := parsed.text
+			p.instant, p.graphed = text, graphQuery(text, p.opts.GraphRange)
+			p.SetQuery(p.graphed)
+			p.views.ShowChart(model.ValMatrix)
+		}
+	}
+	if p.subquery.Clicked() {
+		applyMacro(&p.editor, wrapSubquery(promql.FormatDuration(p.opts.SubqueryRange), promql.FormatDuration(p.opts.SubqueryStep)))
+	}
+	if p.compareTo.Clicked() {
+		applyMacro(&p.editor, compareTo(p.threshold.Text()))
+	}
+	if p.toAlert.Clicked() {
+		slog.Debug("copying alerting rule")
+		clipboard.WriteOp{Text: alertRule(p.editor.Text())}.Add(gtx.Ops)
+	}
+	if p.toCurl.Clicked() {
+		if cmd, err := p.backEnd.Curl(p.request(), p.opts.CurlSecrets); err != nil {
+			slog.Warn("could not copy query as curl", "err", err)
+		} else {
+			clipboard.WriteOp{Text: cmd}.Add(gtx.Ops)
+		}
+	}
+	if p.toTSV.Clicked() {
+		if text := resultTSV(p.renderer.Value); text == "" {
+			slog.Warn("there is no result to copy for a spreadsheet")
+		} else {
+			clipboard.WriteOp{Text: text}.Add(gtx.Ops)
+		}
+	}
+	p.copyResult(gtx)
+	if p.presets.Saving() {
+		p.presets.Save(p.viewPreset())
+	}
+	if v, ok := p.presets.Applied(); ok {
+		if err := p.applyPreset(v); err != nil {
+			p.presets.status = fmt.Sprintf("could not apply preset: %v", err)
+		}
+	}
+	p.renderer.SetLogY(p.logY.Value)
+	p.renderer.SetStacked(p.stacked.Value)
+	p.renderer.SetHistogram(p.histogram.Value)
+	p.renderer.SetNormalize(p.normalize.Value)
+	p.renderer.SetAligned(p.aligned.Value)
+	p.renderer.SetTable(p.table.Value)
+	p.results.Export(p.renderer.Value, p.errorText == "", gtx.Now)
+	if path, ok := p.export.Saving(); ok {
+		size := p.renderer.dims.Size
+		if size.X == 0 || size.Y == 0 {
+			size = image.Pt(800, 600)
+		}
+		p.export.Saved(path, saveChartPNG(path, p.renderer.Value, p.renderer.ChartOptions(), p.shownQuery, size))
+	}
+	if p.rangeWindow.Changed() {
+		p.Run()
+	}
+	if p.run.Clicked() && !p.running {
+		p.Run()
+	}
+	if p.cancel.Clicked() && p.running && p.backEnd.Cancel() {
+		p.cancelled = true
+	}
+	if p.showRules.Changed() && p.showRules.Value {
+		p.rules.Fetch()
+	}
+	if name, ok := p.rules.Clicked(); ok {
+		p.SetQuery(name)
+	}
+	p.sweep.Sweep(p.editor.Text())
+	if m, ok := p.relabel.Inserted(); ok {
+		applyMacro(&p.editor, m)
+	}
+	if p.snapshots.Taking() {
+		p.snapshots.Take(p.shownQuery, p.renderer.Value)
+	}
+	if item, ok := p.rowMenu.Chosen(); ok {
+		p.chooseRowAction(gtx, item)
+	}
+	if p.showBuilder.Value && p.builder.Inserted() {
+		applyMacro(&p.editor, insertText(p.builder.Selector()))
+		p.editor.Focus()
+	}
+	partial, warnings := splitWarnings(append(p.warnings[:len(p.warnings):len(p.warnings)], p.lints...))
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return p.layoutRangeWindows(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, func(gtx C) D {
+				return widget.Border{
+					Width: unit.Dp(2),
+					Color: th.Fg,
+				}.Layout(gtx, func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						gtx.Constraints.Min.X = gtx.Constraints.Max.X
+						gtx.Constraints.Min.Y = 0
+						ed := material.Editor(th, &p.editor, "query")
+						ed.Font.Variant = "Mono"
+						dims := p.primary.Layout(gtx, &p.editor, ed.Layout)
+						if p.runBreak {
+							p.runBreak = false
+							dropBreak(&p.editor)
+						}
+						if p.recall.Apply(&p.editor) || p.complete.Apply(&p.editor) {
+							op.InvalidateOp{}.Add(gtx.Ops)
+						}
+						p.complete.Update(gtx, &p.editor, p.parse.Good())
+						p.complete.Layout(gtx, th, &p.editor)
+						return dims
+					})
+				})
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			return p.find.Layout(gtx, th, inset, &p.editor)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return layoutFlow(gtx,
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.tail, fmt.Sprintf("live (every %v)", p.opts.Refresh)).Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showPlan, "explain").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showBuilder, "build selector").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showRules, "rules").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showSnaps, "snapshots").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showSweep, "sweep").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showRelabel, "relabel").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showPresets, "presets").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.showTargets, "targets").Layout)
+				},
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return layoutFlow(gtx,
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.absent, "absent").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.subquery, "subquery").Layout)
+				},
+				func(gtx C) D {
+					switch {
+					case p.instant != "":
+						return inset.Layout(gtx, material.Button(th, &p.graph, "back to instant").Layout)
+					case p.canGraph:
+						return inset.Layout(gtx, material.Button(th, &p.graph, "graph history").Layout)
+					}
+					return D{}
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.compareTo, "threshold").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						gtx.Constraints.Max.X = gtx.Px(unit.Dp(80))
+						gtx.Constraints.Min.X = gtx.Constraints.Max.X
+						ed := material.Editor(th, &p.threshold, "> 0.9")
+						ed.Font.Variant = "Mono"
+						return ed.Layout(gtx)
+					})
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.toAlert, "to alert rule").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.toCurl, "copy as curl").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.toTSV, "copy for spreadsheet").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						gtx.Constraints.Max.X = gtx.Px(unit.Dp(100))
+						gtx.Constraints.Min.X = gtx.Constraints.Max.X
+						ed := material.Editor(th, &p.grouping.Label, "group by")
+						ed.Font.Variant = "Mono"
+						return ed.Layout(gtx)
+					})
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						// Hinting at the timeout that applies unless
+						// another is typed.
+						return p.timeout.Layout(gtx, th, unit.Dp(100), "timeout "+p.backEnd.Timeout().String())
+					})
+				},
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return layoutFlow(gtx,
+				func(gtx C) D {
+					label := fmt.Sprintf("exemplars (last %v)", p.opts.ExemplarRange)
+					return inset.Layout(gtx, material.CheckBox(th, &p.showExemplar, label).Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showStats, "server stats").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.showTimes, "timestamps").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.heatmap, "heatmap").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.labelsOnly, "labels only").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.aligned, "align values").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.table, "table").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.cycleView, "view: "+view.String()).Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.onlyChanged, "only changed").Layout)
+				},
+				func(gtx C) D {
+					return inset.Layout(gtx, material.CheckBox(th, &p.frozen, "freeze").Layout)
+				},
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return layoutFlow(gtx,
+				func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						return layoutLatencies(gtx, th, p.recent)
+					})
+				},
+				func(gtx C) D {
+					if p.updated.IsZero() {
+						return D{}
+					}
+					return inset.Layout(gtx, func(gtx C) D {
+						return layoutAge(gtx, th, p.updated)
+					})
+				},
+				func(gtx C) D {
+					if p.replica == "" {
+						return D{}
+					}
+					return inset.Layout(gtx, material.Caption(th, "from "+p.replica).Layout)
+				},
+				func(gtx C) D {
+					return p.series.Layout(gtx, th, inset)
+				},
+				func(gtx C) D {
+					return layoutCost(gtx, th, inset, p.cheap, p.costKnown)
+				},
+				func(gtx C) D {
+					if p.retry == 0 {
+						return D{}
+					}
+					text := fmt.Sprintf("retry %d/%d", p.retry, p.opts.Retry.Retries)
+					return inset.Layout(gtx, material.Caption(th, text).Layout)
+				},
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showStats.Value || p.stats == nil {
+				return D{}
+			}
+			return inset.Layout(gtx, material.Caption(th, p.stats.String()).Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showBuilder.Value {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				return p.builder.Layout(gtx, th, inset)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showRules.Value {
+				return D{}
+			}
+			return p.rules.Layout(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showSnaps.Value {
+				return D{}
+			}
+			return p.snapshots.Layout(gtx, th, inset, p.opts.Numbers)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showSweep.Value {
+				return D{}
+			}
+			return p.sweep.Layout(gtx, th, inset, p.opts.Numbers)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showRelabel.Value {
+				return D{}
+			}
+			return p.relabel.Layout(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.showPresets.Value {
+				return D{}
+			}
+			return p.presets.Layout(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return p.drill.Layout(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return p.metadata.Layout(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return p.pinned.Layout(gtx, th, inset, p.opts.Numbers)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.thresholdErr == "" {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, p.thresholdErr)
+				label.Color = errorColor(th)
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.transformErr == "" {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, p.transformErr)
+				label.Color = errorColor(th)
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if len(p.hints) == 0 {
+				return D{}
+			}
+			label := material.Caption(th, strings.Join(p.hints, "    "))
+			label.Font.Variant = "Mono"
+			return inset.Layout(gtx, label.Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.parenWarning == "" {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, p.parenWarning)
+				label.Font.Variant = "Mono"
+				label.Color = warningColor(th)
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.rangeWarning == "" {
+				return D{}
+			}
+			insert := "insert [" + promql.FormatDuration(p.opts.DefaultRange) + "]"
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						label := material.Body1(th, p.rangeWarning)
+						label.Font.Variant = "Mono"
+						label.Color = warningColor(th)
+						return label.Layout(gtx)
+					})
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.addRange, insert).Layout)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return p.counter.Layout(gtx, th, inset)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return p.wrap.Layout(gtx, th, inset, p.editor.Text())
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.timeout.Err() == "" {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, p.timeout.Err())
+				label.Color = errorColor(th)
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if len(p.errorText) == 0 && emptyQuery(p.editor.Text()) {
+				return inset.Layout(gtx, material.Caption(th, "type a query").Layout)
+			}
+			if len(p.errorText) == 0 {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, p.errorText)
+				label.Font.Variant = "Mono"
+				label.Color = errorColor(th)
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.frozen.Value {
+				return D{}
+			}
+			text := "frozen: new results are not shown until unfrozen"
+			switch p.frozenCount {
+			case 0:
+			case 1:
+				text += " (1 waiting)"
+			default:
+				text += fmt.Sprintf(" (%d arrived, the latest waiting)", p.frozenCount)
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, text)
+				label.Color = palette["blue"]
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.unchangedHidden == 0 {
+				return D{}
+			}
+			text := fmt.Sprintf("%d unchanged hidden", p.unchangedHidden)
+			return inset.Layout(gtx, material.Caption(th, text).Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if p.stale.IsZero() {
+				return D{}
+			}
+			text := "stale from " + p.stale.Format("2006-01-02 15:04:05")
+			return inset.Layout(gtx, material.Caption(th, text).Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			if !p.truncated {
+				return D{}
+			}
+			text := fmt.Sprintf("showing the first %d series; more may match (-max-series)", p.opts.MaxSeries)
+			return inset.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, text)
+				label.Color = warningColor(th)
+				return label.Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if len(partial) == 0 {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				return layoutPartialBanner(gtx, th, inset, partial)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			if len(warnings) == 0 {
+				return D{}
+			}
+			return inset.Layout(gtx, func(gtx C) D {
+				return p.warningsList.Layout(gtx, len(warnings), func(gtx C, index int) D {
+					label := material.Body1(th, warnings[index])
+					label.Font.Variant = "Mono"
+					label.Color = warningColor(th)
+					return label.Layout(gtx)
+				})
+			})
+		}),
+		layout.Flexed(1.0, func(gtx C) D {
+			planWidth := float32(0)
+			if p.showPlan.Value {
+				planWidth = .3
+			}
+			return layout.Flex{}.Layout(gtx,
+				layout.Flexed(planWidth, func(gtx C) D {
+					if !p.showPlan.Value {
+						return D{}
+					}
+					return inset.Layout(gtx, func(gtx C) D {
+						return p.planList.Layout(gtx, len(p.plan), func(gtx C, index int) D {
+							label := material.Body2(th, p.plan[index])
+							label.Font.Variant = "Mono"
+							return label.Layout(gtx)
+						})
+					})
+				}),
+				layout.Flexed(textWidth, func(gtx C) D {
+					if textWidth == 0 {
+						return D{}
+					}
+					exemplarHeight := float32(0)
+					if p.showExemplar.Value {
+						exemplarHeight = .3
+					}
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Flexed(1-exemplarHeight, func(gtx C) D {
+							return inset.Layout(gtx, func(gtx C) D {
+								data := p.shownRows()
+								if len(p.rowHovers) < len(data) {
+									p.rowHovers = make([]hoverArea, len(data))
+								}
+								list := func(gtx C) D {
+									return p.dataList.Layout(gtx, len(data), func(gtx C, index int) D {
+										if data[index].Header {
+											return p.grouping.layoutHeader(gtx, th, data[index])
+										}
+										row := p.sampleTime(data[index])
+										row.Bool = p.shownBool && row.Value != "" && !row.Gone && (row.Num == 0 || row.Num == 1)
+										if p.heatmap.Value && row.Value != "" && !row.Gone {
+											row.Background, _ = p.heat.Color(row.Num)
+										}
+										if pos, ok := p.rowHovers[index].ContextClicked(); ok {
+											p.rowMenu.Open(index, row, pos)
+										}
+										if p.rowHovers[index].Clicked() {
+											p.selected.Toggle(index)
+											// Leave the editor, so that
+											// the shortcut copies rows.
+											key.FocusOp{}.Add(gtx.Ops)
+										}
+										if p.selected.Selected(index) {
+											row.Background = selectionColor(th)
+										}
+										dims := layoutTextRow(gtx, th, row, p.thresholds, &p.rowHovers[index])
+										p.rowMenu.Layout(gtx, th, index)
+										return dims
+									})
+								}
+								if p.labelsOnly.Value {
+									return list(gtx)
+								}
+								return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+									layout.Flexed(1, list),
+									layout.Rigid(func(gtx C) D {
+										return p.summary.Layout(gtx, th, p.opts.Numbers)
+									}),
+								)
+							})
+						}),
+						layout.Flexed(exemplarHeight, func(gtx C) D {
+							if !p.showExemplar.Value {
+								return D{}
+							}
+							return inset.Layout(gtx, func(gtx C) D {
+								return p.exemplars.Layout(gtx, th)
+							})
+						}),
+					)
+				}),
+				layout.Flexed(chartWidth, func(gtx C) D {
+					if chartWidth == 0 {
+						return D{}
+					}
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Rigid(func(gtx C) D {
+							if !charted(p.renderer.Value) {
+								return D{}
+							}
+							return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+								layout.Rigid(func(gtx C) D {
+									if _, ok := p.renderer.Value.(model.Matrix); !ok {
+										return D{}
+									}
+									return layout.Flex{}.Layout(gtx,
+										layout.Rigid(func(gtx C) D {
+											return inset.Layout(gtx, material.CheckBox(th, &p.logY, "log scale").Layout)
+										}),
+										layout.Rigid(func(gtx C) D {
+											return inset.Layout(gtx, material.CheckBox(th, &p.stacked, "stacked").Layout)
+										}),
+										layout.Rigid(func(gtx C) D {
+											return inset.Layout(gtx, material.CheckBox(th, &p.normalize, "normalized").Layout)
+										}),
+										layout.Rigid(func(gtx C) D {
+											if !p.shownHistogram {
+												return D{}
+											}
+											return inset.Layout(gtx, material.CheckBox(th, &p.histogram, "bucket heatmap").Layout)
+										}),
+									)
+								}),
+								layout.Rigid(func(gtx C) D {
+									return p.results.Layout(gtx, th, inset, p.renderer.Value, p.errorText == "")
+								}),
+								layout.Flexed(1, func(gtx C) D {
+									return p.export.Layout(gtx, th, inset)
+								}),
+							)
+						}),
+						layout.Flexed(1, func(gtx C) D {
+							return inset.Layout(gtx, func(gtx C) D {
+								if p.shownTargets {
+									return p.targets.Layout(gtx, th, inset)
+								}
+								return p.renderer.RenderViz(gtx)
+							})
+						}),
+					)
+				}),
+			)
+		}),
+	)
+}
+
+// chooseRowAction carries out the action chosen from the context menu of
+// a result row.
+func (p *pane) chooseRowAction(gtx C, item menuItem) {
+	row := p.rowMenu.row
+	switch item.action {
+	case actionCopyRow:
+		clipboard.WriteOp{Text: row.String()}.Add(gtx.Ops)
+	case actionQuerySeries:
+		p.SetQuery(seriesSelector(row.Metric))
+	case actionQueryRange:
+		p.SetQuery(seriesSelector(row.Metric) + seriesRange)
+	case actionAddMatcher:
+		caret, _ := p.editor.Selection()
+		p.SetQuery(p.drill.Add(p.editor.Text(), caret, item.label, row.Metric[item.label]))
+	case actionMetadata:
+		p.metadata.Show(string(row.Metric[model.MetricNameLabel]))
+	case actionPin:
+		p.pinned.Pin(row.Metric)
+	case actionFilterValue:
+		// The condition is left in the threshold input to be adjusted
+		// and applied again.
+		p.threshold.SetText(item.cond)
+		applyMacro(&p.editor, compareTo(item.cond))
+	}
+}
+
+// describeMissingRanges warns of the selectors missing a range, if any.
+func describeMissingRanges(missing []*promql.VectorSelector) string {
+	switch len(missing) {
+	case 0:
+		return ""
+	case 1:
+		return missing[0].String() + " needs a range"
+	}
+	return fmt.Sprintf("%d selectors need a range, such as %s", len(missing), missing[0])
+}
+
+// boolComparison reports whether query is a comparison with the bool
+// modifier, whose results are all 0 or 1.
+func boolComparison(query string) bool {
+	expr, err := promql.Parse(query)
+	if err != nil {
+		return false
+	}
+	for {
+		paren, ok := expr.(*promql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+	bin, ok := expr.(*promql.BinaryExpr)
+	return ok && bin.ReturnBool && promql.IsComparison(bin.Op)
+}
+
+// sampleTime shows or hides the timestamp of row, marking it stale if it
+// is older than allowed.
+func (p *pane) sampleTime(row textRow) textRow {
+	if !p.showTimes.Value {
+		row.Time = ""
+		return row
+	}
+	if p.opts.StaleAfter > 0 && row.At != 0 && !p.evaluated.IsZero() {
+		row.Stale = p.evaluated.Sub(row.At.Time()) > p.opts.StaleAfter
+	}
+	return row
+}
+
+// layoutTextRow draws a row of results with its value highlighted, in the
+// color given by thresholds if any, or as a badge if it is a stale marker,
+// NaN or an infinity, and its timestamp highlighted if it is stale. A row
+// too long for the width has its label cut short, with the whole row
+// shown when hovered. Any background spans the whole width.
+func layoutTextRow(gtx C, th *material.Theme, row textRow, thresholds Thresholds, hover *hoverArea) D {
+	valueColor := th.ContrastBg
+	if c, ok := thresholds.Color(row.Num); ok && row.Value != "" {
+		valueColor = c
+	}
+
+	timeColor := th.Fg
+	if row.Stale {
+		timeColor = warningColor(th)
+	}
+	label := func(text string, c color.NRGBA, maxLines int) layout.Widget {
+		return func(gtx C) D {
+			if text == "" {
+				return D{}
+			}
+			label := material.Body1(th, text)
+			label.Font.Variant = "Mono"
+			label.Color = c
+			label.MaxLines = maxLines
+			return label.Layout(gtx)
+		}
+	}
+	value := label(row.Value, valueColor, 0)
+	switch {
+	case row.Gone:
+		value = func(gtx C) D {
+			return layoutBadge(gtx, th, row.Value, th.Fg)
+		}
+	case row.NonFinite:
+		// Muted, so as not to be read as a number of the result.
+		value = func(gtx C) D {
+			return layoutBadge(gtx, th, row.Value, palette["gray"])
+		}
+	case row.Bool && row.Num == 1:
+		value = func(gtx C) D {
+			return layoutBadge(gtx, th, "true", palette["green"])
+		}
+	case row.Bool:
+		value = func(gtx C) D {
+			return layoutBadge(gtx, th, "false", palette["red"])
+		}
+	}
+	background := func(w layout.Widget) layout.Widget {
+		if row.Background.A == 0 {
+			return w
+		}
+		return func(gtx C) D {
+			macro := op.Record(gtx.Ops)
+			dims := w(gtx)
+			call := macro.Stop()
+			paint.FillShape(gtx.Ops, row.Background, clip.Rect{Max: image.Pt(gtx.Constraints.Max.X, dims.Size.Y)}.Op())
+			call.Add(gtx.Ops)
+			return dims
+		}
+	}
+	// Measure the row unconstrained to learn whether it fits.
+	macro := op.Record(gtx.Ops)
+	wide := gtx
+	wide.Constraints.Max.X = 1 << 24
+	dims := layout.Flex{}.Layout(wide,
+		layout.Rigid(label(row.Label, th.Fg, 0)),
+		layout.Rigid(value),
+		layout.Rigid(label(row.Time, timeColor, 0)),
+	)
+	call := macro.Stop()
+	if dims.Size.X <= gtx.Constraints.Max.X {
+		tip := ""
+		if row.FullLabel != "" {
+			tip = row.String()
+		}
+		return hover.Layout(gtx, th, tip, background(func(gtx C) D {
+			call.Add(gtx.Ops)
+			return dims
+		}))
+	}
+	return hover.Layout(gtx, th, row.String(), background(func(gtx C) D {
+		return layout.Flex{}.Layout(gtx,
+			layout.Flexed(1, label(row.Label, th.Fg, 1)),
+			layout.Rigid(value),
+			layout.Rigid(label(row.Time, timeColor, 0)),
+		)
+	}))
+}
+
+// layoutRangeWindows lays out the choice of evaluating the query at an
+// instant or over one of rangeWindows.
+func (p *pane) layoutRangeWindows(gtx C, th *material.Theme, inset layout.Inset) D {
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.RadioButton(th, &p.rangeWindow, instantWindow, instantWindow).Layout)
+		}),
+	}
+	for _, w := range rangeWindows {
+		w := w
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.RadioButton(th, &p.rangeWindow, w, "last "+w).Layout)
+		}))
+	}
+	if p.manual.Value {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			b := material.Button(th, &p.run, "run")
+			if p.running {
+				b.Background = palette["gray"]
+			}
+			return inset.Layout(gtx, b.Layout)
+		}))
+	}
+	if p.running {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &p.cancel, "cancel").Layout)
+		}))
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
+
+// dropBreak takes out the line break just before the caret of ed, which
+// the editor types for Enter whatever the modifiers, as for a shortcut.
+func dropBreak(ed *widget.Editor) {
+	text := ed.Text()
+	caret, _ := ed.Selection()
+	if caret > 0 && text[caret-1] == '\n' {
+		ed.SetText(text[:caret-1] + text[caret:])
+		ed.SetCaret(caret-1, caret-1)
+	}
+}
+
+// layoutBadge draws text in the background color on bg, to stand out
+// from the rows around it.
+func layoutBadge(gtx C, th *material.Theme, text string, bg color.NRGBA) D {
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx C) D {
+			paint.FillShape(gtx.Ops, bg, clip.Rect{Max: gtx.Constraints.Min}.Op())
+			return D{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx C) D {
+			return layout.Inset{Left: unit.Dp(4), Right: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+				label := material.Body1(th, text)
+				label.Font.Variant = "Mono"
+				label.Color = th.Bg
+				return label.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// seriesKey identifies the set of series in v.
+func seriesKey(v model.Value) string {
+	var metrics []string
+	switch v := v.(type) {
+	case model.Vector:
+		for _, s := range v {
+			metrics = append(metrics, s.Metric.String())
+		}
+	case model.Matrix:
+		for _, s := range v {
+			metrics = append(metrics, s.Metric.String())
+		}
+	case nil:
+		return ""
+	default:
+		return v.Type().String()
+	}
+	sort.Strings(metrics)
+	return strings.Join(metrics, "\n")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// paneDiff compares the results of the two panes side by side, matching
+// series by fingerprint, and lists those that differ: series whose
+// values differ with the delta, and series found in only one pane marked
+// with its side.
+type paneDiff struct {
+	// compared is set once results have been compared, and left and
+	// right are when those results arrived, so that they are compared
+	// again only when either changes.
+	compared    bool
+	left, right time.Time
+	diffs       []seriesDiff
+	same        int
+	onlyLeft    int
+	onlyRight   int
+}
+
+// update compares a and b, the results that arrived at left and right,
+// if they are not those compared already.
+func (d *paneDiff) update(a, b model.Value, left, right time.Time) {
+	if d.compared && left.Equal(d.left) && right.Equal(d.right) {
+		return
+	}
+	d.compared, d.left, d.right = true, left, right
+	sa, _ := takeSnapshot("left", "", a)
+	sb, _ := takeSnapshot("right", "", b)
+	d.diffs, d.same = diffSnapshots(sa, sb)
+	d.onlyLeft, d.onlyRight = 0, 0
+	for _, diff := range d.diffs {
+		switch diff.kind {
+		case seriesDisappeared:
+			d.onlyLeft++
+		case seriesAppeared:
+			d.onlyRight++
+		}
+	}
+}
+
+// describe is d written for the comparison of the left pane to the right.
+func (d seriesDiff) describe(f NumberFormat) string {
+	switch d.kind {
+	case seriesAppeared:
+		return fmt.Sprintf("right only: %s => %s", d.metric, f.Format(d.to))
+	case seriesDisappeared:
+		return fmt.Sprintf("left only:  %s => %s", d.metric, f.Format(d.from))
+	}
+	delta := f.Format(d.to - d.from)
+	if d.to >= d.from {
+		delta = "+" + delta
+	}
+	return fmt.Sprintf("differ:     %s => %s | %s (%s)", d.metric, f.Format(d.from), f.Format(d.to), delta)
+}
+
+// Layout lists the series that differ between the results a and b of the
+// left and right panes, which arrived at left and right.
+func (d *paneDiff) Layout(gtx C, th *material.Theme, inset layout.Inset, a, b model.Value, left, right time.Time, f NumberFormat) D {
+	d.update(a, b, left, right)
+	changed := len(d.diffs) - d.onlyLeft - d.onlyRight
+	summary := fmt.Sprintf("%d differ, %d only left, %d only right, %d the same", changed, d.onlyLeft, d.onlyRight, d.same)
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Caption(th, summary).Layout)
+		}),
+	}
+	for i, diff := range d.diffs {
+		if i == maxDiffRows {
+			more := fmt.Sprintf("and %d more", len(d.diffs)-maxDiffRows)
+			children = append(children, layout.Rigid(func(gtx C) D {
+				return inset.Layout(gtx, material.Caption(th, more).Layout)
+			}))
+			break
+		}
+		diff := diff
+		children = append(children, layout.Rigid(func(gtx C) D {
+			label := material.Body2(th, diff.describe(f))
+			label.Font.Variant = "Mono"
+			label.MaxLines = 1
+			switch diff.kind {
+			case seriesChanged:
+				label.Color = palette["orange"]
+			case seriesDisappeared:
+				label.Color = palette["blue"]
+			case seriesAppeared:
+				label.Color = palette["green"]
+			}
+			return inset.Layout(gtx, label.Layout)
+		}))
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
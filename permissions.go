@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// errForbidden replaces the error of a view whose endpoint the server
+// refused to answer with the credentials in use, as a token allowed to
+// query but not to read rules or metadata may be.
+var errForbidden = errors.New("insufficient permissions for this view")
+
+// forbidden reports whether err is the server refusing a request with
+// 403 Forbidden.
+func forbidden(err error) bool {
+	var apiErr *v1.Error
+	return errors.As(err, &apiErr) && apiErr.Type == v1.ErrClient &&
+		apiErr.Msg == fmt.Sprintf("client error: %d", http.StatusForbidden)
+}
+
+// viewError is the error to show in a view for err.
+func viewError(err error) error {
+	if forbidden(err) {
+		return errForbidden
+	}
+	return err
+}
+
+// checkPermissions probes the endpoints behind the views other than
+// queries, logging those that src is not permitted to read, so that a
+// restricted token is noticed at startup rather than view by view.
+func checkPermissions(src Source, timeout time.Duration) {
+	probes := []struct {
+		view  string
+		probe func(ctx context.Context) error
+	}{
+		{"rules", func(ctx context.Context) error {
+			s, ok := src.(RuleSource)
+			if !ok {
+				return nil
+			}
+			_, err := s.Rules(ctx)
+			return err
+		}},
+		{"metadata", func(ctx context.Context) error {
+			s, ok := src.(MetadataSource)
+			if !ok {
+				return nil
+			}
+			_, err := s.Metadata(ctx, "", "1")
+			return err
+		}},
+	}
+	for _, p := range probes {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := p.probe(ctx)
+		cancel()
+		if forbidden(err) {
+			slog.Warn("insufficient permissions, view will be unavailable", "view", p.view)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/latest"
+)
+
+// pinnedResponse is the value of each pinned selector, or why it could not
+// be fetched.
+type pinnedResponse struct {
+	key    string
+	values map[string]model.Vector
+	errs   map[string]error
+}
+
+// pinnedSeries keeps series on display while the query changes. Each is
+// pinned by its full selector, which is queried again whenever the
+// pane's query runs.
+type pinnedSeries struct {
+	fetcher   latest.Worker
+	selectors []string
+	unpin     []widget.Clickable
+	// key identifies the selectors most recently fetched, which are
+	// pending until their values arrive.
+	key     string
+	pending bool
+	values  map[string]model.Vector
+	errs    map[string]error
+}
+
+func newPinnedSeries(b *Backend) *pinnedSeries {
+	p := &pinnedSeries{}
+	p.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		selectors := in.([]string)
+		resp := pinnedResponse{
+			key:    strings.Join(selectors, "\n"),
+			values: map[string]model.Vector{},
+			errs:   map[string]error{},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		defer cancel()
+		now := time.Now()
+		for _, sel := range selectors {
+			v, _, err := b.Source.Query(ctx, sel, now)
+			if err != nil {
+				resp.errs[sel] = err
+				continue
+			}
+			vec, ok := v.(model.Vector)
+			if !ok {
+				resp.errs[sel] = fmt.Errorf("unexpected %s result", v.Type())
+				continue
+			}
+			resp.values[sel] = vec
+		}
+		return resp
+	})
+	return p
+}
+
+// Pin keeps the series metric on display, if it is not already.
+func (p *pinnedSeries) Pin(metric model.Metric) {
+	sel := seriesSelector(metric)
+	for _, s := range p.selectors {
+		if s == sel {
+			return
+		}
+	}
+	p.selectors = append(p.selectors, sel)
+	p.unpin = append(p.unpin, widget.Clickable{})
+	p.Fetch()
+}
+
+// Fetch queries the pinned series again.
+func (p *pinnedSeries) Fetch() {
+	p.key = strings.Join(p.selectors, "\n")
+	p.pending = len(p.selectors) > 0
+	if p.pending {
+		p.fetcher.Push(append([]string(nil), p.selectors...))
+	}
+}
+
+func (p *pinnedSeries) receive() {
+	select {
+	case r := <-p.fetcher.Raw():
+		resp := r.(pinnedResponse)
+		// Values of series since unpinned are simply not shown.
+		p.values, p.errs = resp.values, resp.errs
+		if resp.key == p.key {
+			p.pending = false
+		}
+	default:
+	}
+}
+
+// describe is the value of the series pinned by sel.
+func (p *pinnedSeries) describe(sel string, f NumberFormat) string {
+	if err, ok := p.errs[sel]; ok {
+		return "error: " + err.Error()
+	}
+	vec, ok := p.values[sel]
+	switch {
+	case !ok:
+		return "…"
+	case len(vec) == 0:
+		return "no data"
+	}
+	values := make([]string, len(vec))
+	for i, s := range vec {
+		values[i] = f.Format(float64(s.Value))
+	}
+	return strings.Join(values, ", ")
+}
+
+// Layout lists the pinned series with their latest values, each with a
+// button to unpin it.
+func (p *pinnedSeries) Layout(gtx C, th *material.Theme, inset layout.Inset, f NumberFormat) D {
+	p.receive()
+	for i := range p.unpin {
+		if p.unpin[i].Clicked() {
+			p.selectors = append(p.selectors[:i], p.selectors[i+1:]...)
+			p.unpin = append(p.unpin[:i], p.unpin[i+1:]...)
+			break
+		}
+	}
+	if len(p.selectors) == 0 {
+		return D{}
+	}
+	if p.pending {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Caption(th, "pinned").Layout)
+		}),
+	}
+	for i, sel := range p.selectors {
+		i, sel := i, sel
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, func(gtx C) D {
+					label := material.Body2(th, sel+" => "+p.describe(sel, f))
+					label.Font.Variant = "Mono"
+					label.MaxLines = 1
+					return inset.Layout(gtx, label.Layout)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &p.unpin[i], "unpin").Layout)
+				}),
+			)
+		}))
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// A ViewPreset is a named bundle of the options of how a pane shows its
+// results, so that a whole way of viewing them, such as one for latencies
+// and another for errors, can be switched to at once.
+type ViewPreset struct {
+	View        string `yaml:"view,omitempty"`
+	SeriesOrder string `yaml:"series_order,omitempty"`
+	Thresholds  string `yaml:"thresholds,omitempty"`
+	Precision   int    `yaml:"precision,omitempty"`
+	Thousands   bool   `yaml:"thousands,omitempty"`
+	Scientific  bool   `yaml:"scientific,omitempty"`
+	Timestamps  bool   `yaml:"timestamps,omitempty"`
+	Heatmap     bool   `yaml:"heatmap,omitempty"`
+	LabelsOnly  bool   `yaml:"labels_only,omitempty"`
+	Aligned     bool   `yaml:"aligned,omitempty"`
+	Table       bool   `yaml:"table,omitempty"`
+	OnlyChanged bool   `yaml:"only_changed,omitempty"`
+	LogY        bool   `yaml:"log_y,omitempty"`
+	Stacked     bool   `yaml:"stacked,omitempty"`
+	Normalize   bool   `yaml:"normalize,omitempty"`
+}
+
+// presetPanel saves the view options of a pane as presets in the settings,
+// shared by both panes, and applies them again from a menu of their names.
+type presetPanel struct {
+	settings *Settings
+	name     widget.Editor
+	save     widget.Clickable
+	// apply and remove are the buttons of each preset, by name.
+	apply, remove map[string]*widget.Clickable
+	status        string
+}
+
+func newPresetPanel(settings *Settings) *presetPanel {
+	s := &presetPanel{
+		settings: settings,
+		apply:    map[string]*widget.Clickable{},
+		remove:   map[string]*widget.Clickable{},
+	}
+	s.name.SingleLine = true
+	s.name.Submit = true
+	return s
+}
+
+// Focused reports whether the name of a preset is being edited.
+func (s *presetPanel) Focused() bool {
+	return s.name.Focused()
+}
+
+// Saving reports whether the view should be saved as a preset, as when
+// the button is clicked or Enter is pressed in the name.
+func (s *presetPanel) Saving() bool {
+	submitted := false
+	for _, ev := range s.name.Events() {
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			submitted = true
+		}
+	}
+	return s.save.Clicked() || submitted
+}
+
+// Save saves v as the preset of the name typed, replacing any preset of
+// that name.
+func (s *presetPanel) Save(v ViewPreset) {
+	name := strings.TrimSpace(s.name.Text())
+	if name == "" {
+		s.status = "a preset needs a name"
+		return
+	}
+	if s.settings.Presets == nil {
+		s.settings.Presets = map[string]ViewPreset{}
+	}
+	s.settings.Presets[name] = v
+	s.name.SetText("")
+	s.store("saved " + name)
+}
+
+// Applied returns the preset whose button has been clicked, if any, and
+// removes those whose remove buttons have been.
+func (s *presetPanel) Applied() (ViewPreset, bool) {
+	for _, name := range s.names() {
+		if b := s.remove[name]; b != nil && b.Clicked() {
+			delete(s.settings.Presets, name)
+			s.store("removed " + name)
+		}
+	}
+	for _, name := range s.names() {
+		if b := s.apply[name]; b != nil && b.Clicked() {
+			s.status = "applied " + name
+			return s.settings.Presets[name], true
+		}
+	}
+	return ViewPreset{}, false
+}
+
+// store saves the settings holding the presets, with status describing
+// what changed unless that failed.
+func (s *presetPanel) store(status string) {
+	if err := s.settings.Save(); err != nil {
+		s.status = err.Error()
+		return
+	}
+	s.status = status
+}
+
+func (s *presetPanel) names() []string {
+	names := make([]string, 0, len(s.settings.Presets))
+	for name := range s.settings.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Layout shows the form for saving the view as a preset and the presets
+// saved, each with buttons applying and removing it.
+func (s *presetPanel) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Max.X = gtx.Px(unit.Dp(160))
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return material.Editor(th, &s.name, "preset name").Layout(gtx)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &s.save, "save view").Layout)
+		}),
+	}
+	for _, name := range s.names() {
+		apply, remove := s.apply[name], s.remove[name]
+		if apply == nil {
+			apply, remove = new(widget.Clickable), new(widget.Clickable)
+			s.apply[name], s.remove[name] = apply, remove
+		}
+		name := name
+		children = append(children,
+			layout.Rigid(func(gtx C) D {
+				return inset.Layout(gtx, material.Button(th, apply, name).Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				b := material.Button(th, remove, "×")
+				b.Background = palette["gray"]
+				return inset.Layout(gtx, b.Layout)
+			}),
+		)
+	}
+	children = append(children, layout.Flexed(1, func(gtx C) D {
+		return inset.Layout(gtx, material.Caption(th, s.status).Layout)
+	}))
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
+
+// viewPreset captures the pane's view options as a preset.
+func (p *pane) viewPreset() ViewPreset {
+	return ViewPreset{
+		View:        p.views.Mode(p.renderer.Value, p.shownTargets).String(),
+		SeriesOrder: p.opts.SeriesOrder,
+		Thresholds:  p.opts.Thresholds.String(),
+		Precision:   p.opts.Numbers.Precision,
+		Thousands:   p.opts.Numbers.Thousands,
+		Scientific:  p.opts.Numbers.Scientific,
+		Timestamps:  p.showTimes.Value,
+		Heatmap:     p.heatmap.Value,
+		LabelsOnly:  p.labelsOnly.Value,
+		Aligned:     p.aligned.Value,
+		Table:       p.table.Value,
+		OnlyChanged: p.onlyChanged.Value,
+		LogY:        p.logY.Value,
+		Stacked:     p.stacked.Value,
+		Normalize:   p.normalize.Value,
+	}
+}
+
+// applyPreset sets the pane's view options to those of v, re-showing the
+// result on display accordingly. A preset edited by hand to be invalid is
+// not applied at all.
+func (p *pane) applyPreset(v ViewPreset) error {
+	mode, ok := parseViewMode(v.View)
+	if !ok && v.View != "" {
+		return fmt.Errorf("unknown view %q", v.View)
+	}
+	order := v.SeriesOrder
+	switch order {
+	case "":
+		order = orderLabels
+	case orderLabels, orderFingerprint, orderServer:
+	default:
+		return fmt.Errorf("unknown series order %q", order)
+	}
+	thresholds, err := ParseThresholds(v.Thresholds)
+	if err != nil {
+		return fmt.Errorf("invalid thresholds: %w", err)
+	}
+	if v.View != "" {
+		p.views.ChooseAll(mode)
+	}
+	p.opts.SeriesOrder = order
+	p.opts.Thresholds = thresholds
+	p.updateThresholds()
+	p.opts.Numbers = NumberFormat{Precision: v.Precision, Thousands: v.Thousands, Scientific: v.Scientific}
+	p.renderer.SetFormat(p.opts.Numbers)
+	p.showTimes.Value = v.Timestamps
+	p.heatmap.Value = v.Heatmap
+	p.labelsOnly.Value = v.LabelsOnly
+	p.aligned.Value = v.Aligned
+	p.table.Value = v.Table
+	p.onlyChanged.Value = v.OnlyChanged
+	p.logY.Value = v.LogY
+	p.stacked.Value = v.Stacked
+	p.normalize.Value = v.Normalize
+	shown := orderSeries(p.renderer.Value, order)
+	p.renderer.SetData(shown)
+	p.grouping.SetData(shown)
+	return nil
+}
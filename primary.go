@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"unicode/utf8"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/op"
+	"gioui.org/widget"
+	"github.com/whereswaldon/binnacle/latest"
+)
+
+// errNoPrimary is returned by readPrimary on platforms without a primary
+// selection.
+var errNoPrimary = errors.New("there is no primary selection on this platform")
+
+// readPrimary returns the text of the primary selection, the text last
+// selected in any window, which Linux desktops paste on a middle-click.
+// Gio does not read it, so it is read with wl-paste under Wayland and
+// with xclip or xsel under X11.
+func readPrimary() (string, error) {
+	switch runtime.GOOS {
+	case "darwin", "windows", "android", "ios", "js":
+		return "", errNoPrimary
+	}
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-paste", "--primary", "--no-newline"})
+	}
+	cmds = append(cmds,
+		[]string{"xclip", "-out", "-selection", "primary"},
+		[]string{"xsel", "--primary", "--output"},
+	)
+	err := errNoPrimary
+	for _, cmd := range cmds {
+		out, cmdErr := exec.Command(cmd[0], cmd[1:]...).Output()
+		if cmdErr == nil {
+			return string(out), nil
+		}
+		err = fmt.Errorf("could not read the primary selection with %s: %w", cmd[0], cmdErr)
+	}
+	return "", err
+}
+
+type primaryResponse struct {
+	at   int
+	text string
+	err  error
+}
+
+// primaryPaste pastes the primary selection into an editor where it is
+// middle-clicked. The selection is read in the background, and pending is
+// set until it has been.
+type primaryPaste struct {
+	reader  latest.Worker
+	pending bool
+}
+
+func newPrimaryPaste() *primaryPaste {
+	return &primaryPaste{reader: latest.NewWorker(func(in interface{}) interface{} {
+		text, err := readPrimary()
+		return primaryResponse{at: in.(int), text: text, err: err}
+	})}
+}
+
+// Pasted returns the primary selection read since a middle-click, and the
+// offset in the editor's text at which it was clicked. Failures to read
+// it are only logged, as most platforms have no primary selection.
+func (m *primaryPaste) Pasted() (at int, text string, ok bool) {
+	select {
+	case r := <-m.reader.Raw():
+		m.pending = false
+		resp := r.(primaryResponse)
+		if resp.err != nil {
+			slog.Debug("not pasting the primary selection", "err", resp.err)
+			return 0, "", false
+		}
+		return resp.at, resp.text, resp.text != ""
+	default:
+		return 0, "", false
+	}
+}
+
+// Layout lays out the editor ed with w, passing pointer events through to
+// it, and reads the primary selection when it is middle-clicked.
+func (m *primaryPaste) Layout(gtx C, ed *widget.Editor, w func(gtx C) D) D {
+	for _, e := range gtx.Events(m) {
+		if e, ok := e.(pointer.Event); ok && e.Type == pointer.Press && e.Buttons.Contain(pointer.ButtonMiddle) {
+			m.pending = true
+			m.reader.Push(caretAt(ed, e.Position))
+		}
+	}
+	if m.pending {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	dims := w(gtx)
+	stack := op.Save(gtx.Ops)
+	pointer.PassOp{Pass: true}.Add(gtx.Ops)
+	pointer.Rect(image.Rectangle{Max: dims.Size}).Add(gtx.Ops)
+	pointer.InputOp{Tag: m, Types: pointer.Press}.Add(gtx.Ops)
+	stack.Load()
+	return dims
+}
+
+// caretAt finds the offset in the text of ed nearest pos, relative to the
+// editor, by moving the caret through the text, as the editor does not
+// say where its lines are laid out, and then putting it back. It is on the first line whose baseline
+// is below pos, or else the last line, nearest pos across.
+func caretAt(ed *widget.Editor, pos f32.Point) int {
+	start, end := ed.Selection()
+	defer ed.SetCaret(start, end)
+	text := ed.Text()
+	var offsets []int
+	var coords []f32.Point
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && !utf8.RuneStart(text[i]) {
+			continue
+		}
+		ed.SetCaret(i, i)
+		offsets = append(offsets, i)
+		coords = append(coords, ed.CaretCoords())
+	}
+	line := float32(math.Inf(-1))
+	for _, c := range coords {
+		if c.Y > line {
+			line = c.Y
+		}
+	}
+	for _, c := range coords {
+		if c.Y >= pos.Y && c.Y < line {
+			line = c.Y
+		}
+	}
+	best, bestX := 0, float32(math.Inf(1))
+	for i, c := range coords {
+		if dx := float32(math.Abs(float64(c.X - pos.X))); c.Y == line && dx < bestX {
+			best, bestX = offsets[i], dx
+		}
+	}
+	return best
+}
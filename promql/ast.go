@@ -0,0 +1,409 @@
+/*
+Package promql parses the Prometheus query language into a syntax tree
+suitable for inspecting and rewriting queries locally, without a round
+trip to the server.
+
+It stands in for github.com/prometheus/prometheus/promql/parser, whose
+module brings newer client_golang, common and oauth2 releases and a
+golang.org/x/exp past the split of x/exp/shiny, which the Gio release
+binnacle builds on still imports. To keep its grammar in step with
+upstream, the conformance module alongside runs both parsers over the
+queries in testdata and fails where they disagree.
+*/
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueType is the type that an expression evaluates to.
+type ValueType string
+
+const (
+	ValueTypeNone   ValueType = "none"
+	ValueTypeVector ValueType = "instant vector"
+	ValueTypeMatrix ValueType = "range vector"
+	ValueTypeScalar ValueType = "scalar"
+	ValueTypeString ValueType = "string"
+)
+
+// PosRange is the half-open range of byte offsets within the query text
+// that a node was parsed from.
+type PosRange struct {
+	Start, End int
+}
+
+// PositionRange returns the range itself, allowing every node to satisfy
+// Node by embedding a PosRange.
+func (p PosRange) PositionRange() PosRange {
+	return p
+}
+
+// Node is an element of the syntax tree.
+type Node interface {
+	// String returns the canonical PromQL text of the node.
+	String() string
+	PositionRange() PosRange
+}
+
+// Expr is a node that can be evaluated.
+type Expr interface {
+	Node
+	Type() ValueType
+}
+
+// NumberLiteral is a scalar constant like 3.14 or Inf.
+type NumberLiteral struct {
+	Val float64
+	PosRange
+}
+
+// StringLiteral is a quoted string constant.
+type StringLiteral struct {
+	Val string
+	PosRange
+}
+
+// MatchType is the comparison performed by a label matcher.
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher constrains the value of a single label in a selector.
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	PosRange
+}
+
+// AtModifier pins the evaluation time of a selector or subquery, either
+// to a Timestamp or to the start or end of the query's range.
+type AtModifier struct {
+	Timestamp float64
+	// Preprocessor is "start" or "end" for @ start() or @ end(), in which
+	// case Timestamp is unused.
+	Preprocessor string
+	PosRange
+}
+
+// VectorSelector selects series by metric name and label matchers.
+type VectorSelector struct {
+	Name     string
+	Matchers []*Matcher
+	Offset   time.Duration
+	At       *AtModifier
+	PosRange
+}
+
+// MatrixSelector selects a range of samples for each series matched by
+// a vector selector.
+type MatrixSelector struct {
+	VectorSelector *VectorSelector
+	Range          time.Duration
+	PosRange
+}
+
+// SubqueryExpr evaluates an instant expression over a range.
+type SubqueryExpr struct {
+	Expr   Expr
+	Range  time.Duration
+	Step   time.Duration
+	Offset time.Duration
+	At     *AtModifier
+	PosRange
+}
+
+// Call is a function invocation.
+type Call struct {
+	Func *Function
+	Args []Expr
+	PosRange
+}
+
+// AggregateExpr applies an aggregation operator such as sum or topk.
+type AggregateExpr struct {
+	Op       string
+	Expr     Expr
+	Param    Expr
+	Grouping []string
+	// Without reports whether Grouping lists the labels to drop rather
+	// than the labels to keep.
+	Without bool
+	// Grouped reports whether a by or without clause was present, even
+	// if it was empty.
+	Grouped bool
+	PosRange
+}
+
+// VectorMatching describes how the series on either side of a binary
+// operation are paired.
+type VectorMatching struct {
+	// On reports whether Labels lists the labels to match on rather than
+	// the labels to ignore.
+	On     bool
+	Labels []string
+	// Card is "group_left", "group_right" or empty for one-to-one
+	// matching.
+	Card    string
+	Include []string
+}
+
+// BinaryExpr applies an arithmetic, comparison or set operator.
+type BinaryExpr struct {
+	Op         string
+	LHS, RHS   Expr
+	ReturnBool bool
+	Matching   *VectorMatching
+	PosRange
+}
+
+// ParenExpr is an expression wrapped in parentheses.
+type ParenExpr struct {
+	Expr Expr
+	PosRange
+}
+
+// UnaryExpr negates or affirms its operand.
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+	PosRange
+}
+
+func (*NumberLiteral) Type() ValueType  { return ValueTypeScalar }
+func (*StringLiteral) Type() ValueType  { return ValueTypeString }
+func (*VectorSelector) Type() ValueType { return ValueTypeVector }
+func (*MatrixSelector) Type() ValueType { return ValueTypeMatrix }
+func (*SubqueryExpr) Type() ValueType   { return ValueTypeMatrix }
+func (*AggregateExpr) Type() ValueType  { return ValueTypeVector }
+func (e *Call) Type() ValueType         { return e.Func.ReturnType }
+func (e *ParenExpr) Type() ValueType    { return e.Expr.Type() }
+func (e *UnaryExpr) Type() ValueType    { return e.Expr.Type() }
+
+func (e *BinaryExpr) Type() ValueType {
+	if e.LHS.Type() == ValueTypeScalar && e.RHS.Type() == ValueTypeScalar {
+		return ValueTypeScalar
+	}
+	return ValueTypeVector
+}
+
+func (e *NumberLiteral) String() string {
+	return strconv.FormatFloat(e.Val, 'f', -1, 64)
+}
+
+func (e *StringLiteral) String() string {
+	return strconv.Quote(e.Val)
+}
+
+func (m *Matcher) String() string {
+	name := m.Name
+	if !IsLabelName(name) {
+		name = strconv.Quote(name)
+	}
+	return name + string(m.Type) + strconv.Quote(m.Value)
+}
+
+// IsMetricName reports whether name can be written as a metric name
+// without quotes, and IsLabelName likewise as a label name. Other names,
+// such as UTF-8 ones, must be quoted inside the braces of a selector.
+func IsMetricName(name string) bool {
+	return isName(name, true)
+}
+
+func IsLabelName(name string) bool {
+	return isName(name, false)
+}
+
+func isName(name string, colons bool) bool {
+	if name == "" || isDigit(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentChar(name[i]) || name[i] == ':' && !colons {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *AtModifier) String() string {
+	if a.Preprocessor != "" {
+		return "@ " + a.Preprocessor + "()"
+	}
+	return "@ " + strconv.FormatFloat(a.Timestamp, 'f', -1, 64)
+}
+
+func (e *VectorSelector) String() string {
+	var b strings.Builder
+	var matchers []string
+	if IsMetricName(e.Name) {
+		b.WriteString(e.Name)
+	} else if e.Name != "" {
+		matchers = append(matchers, strconv.Quote(e.Name))
+	}
+	for _, m := range e.Matchers {
+		matchers = append(matchers, m.String())
+	}
+	if len(matchers) > 0 || e.Name == "" {
+		b.WriteString("{" + strings.Join(matchers, ", ") + "}")
+	}
+	writeModifiers(&b, e.Offset, e.At)
+	return b.String()
+}
+
+func (e *MatrixSelector) String() string {
+	// The range belongs between the selector and its modifiers.
+	vs := *e.VectorSelector
+	vs.Offset, vs.At = 0, nil
+	var b strings.Builder
+	b.WriteString(vs.String() + "[" + FormatDuration(e.Range) + "]")
+	writeModifiers(&b, e.VectorSelector.Offset, e.VectorSelector.At)
+	return b.String()
+}
+
+func (e *SubqueryExpr) String() string {
+	var b strings.Builder
+	b.WriteString(e.Expr.String() + "[" + FormatDuration(e.Range) + ":")
+	if e.Step != 0 {
+		b.WriteString(FormatDuration(e.Step))
+	}
+	b.WriteString("]")
+	writeModifiers(&b, e.Offset, e.At)
+	return b.String()
+}
+
+func writeModifiers(b *strings.Builder, offset time.Duration, at *AtModifier) {
+	if at != nil {
+		b.WriteString(" " + at.String())
+	}
+	if offset > 0 {
+		b.WriteString(" offset " + FormatDuration(offset))
+	} else if offset < 0 {
+		b.WriteString(" offset -" + FormatDuration(-offset))
+	}
+}
+
+func (e *Call) String() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return e.Func.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (e *AggregateExpr) String() string {
+	var b strings.Builder
+	b.WriteString(e.Op)
+	if e.Grouped {
+		if e.Without {
+			b.WriteString(" without")
+		} else {
+			b.WriteString(" by")
+		}
+		b.WriteString(" (" + strings.Join(e.Grouping, ", ") + ") ")
+	}
+	b.WriteString("(")
+	if e.Param != nil {
+		b.WriteString(e.Param.String() + ", ")
+	}
+	b.WriteString(e.Expr.String() + ")")
+	return b.String()
+}
+
+func (m *VectorMatching) String() string {
+	var b strings.Builder
+	if m.On {
+		b.WriteString("on")
+	} else {
+		b.WriteString("ignoring")
+	}
+	b.WriteString(" (" + strings.Join(m.Labels, ", ") + ")")
+	if m.Card != "" {
+		b.WriteString(" " + m.Card)
+		if len(m.Include) > 0 {
+			b.WriteString(" (" + strings.Join(m.Include, ", ") + ")")
+		}
+	}
+	return b.String()
+}
+
+func (e *BinaryExpr) String() string {
+	op := e.Op
+	if e.ReturnBool {
+		op += " bool"
+	}
+	if e.Matching != nil {
+		op += " " + e.Matching.String()
+	}
+	return e.LHS.String() + " " + op + " " + e.RHS.String()
+}
+
+func (e *ParenExpr) String() string {
+	return "(" + e.Expr.String() + ")"
+}
+
+func (e *UnaryExpr) String() string {
+	return e.Op + e.Expr.String()
+}
+
+// Children returns the direct descendants of n in evaluation order.
+func Children(n Node) []Node {
+	var children []Node
+	switch n := n.(type) {
+	case *VectorSelector:
+		for _, m := range n.Matchers {
+			children = append(children, m)
+		}
+	case *MatrixSelector:
+		children = append(children, n.VectorSelector)
+	case *SubqueryExpr:
+		children = append(children, n.Expr)
+	case *Call:
+		for _, arg := range n.Args {
+			children = append(children, arg)
+		}
+	case *AggregateExpr:
+		if n.Param != nil {
+			children = append(children, n.Param)
+		}
+		children = append(children, n.Expr)
+	case *BinaryExpr:
+		children = append(children, n.LHS, n.RHS)
+	case *ParenExpr:
+		children = append(children, n.Expr)
+	case *UnaryExpr:
+		children = append(children, n.Expr)
+	}
+	return children
+}
+
+// Inspect traverses the tree rooted at n in depth-first order, calling
+// f for each node. If f returns false, the children of that node are
+// skipped.
+func Inspect(n Node, f func(Node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, child := range Children(n) {
+		Inspect(child, f)
+	}
+}
+
+// ParseError reports a syntax error at a byte offset within the query.
+type ParseError struct {
+	Pos int
+	Err string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error at char %d: %s", e.Pos+1, e.Err)
+}
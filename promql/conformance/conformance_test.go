@@ -0,0 +1,85 @@
+// Package conformance checks package promql against the upstream
+// Prometheus parser. It is a module of its own so that the upstream
+// parser's dependencies stay out of binnacle's build; run its tests from
+// this directory with go test.
+package conformance
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// readCorpus returns the queries in the named file of promql's testdata,
+// one per line, skipping blank lines and comments.
+func readCorpus(t *testing.T, name string) []string {
+	t.Helper()
+	f, err := os.Open(filepath.Join("..", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var queries []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
+			queries = append(queries, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return queries
+}
+
+// upstream returns the canonical text of query as printed by the
+// upstream parser.
+func upstream(query string) (string, error) {
+	e, err := parser.ParseExpr(query)
+	if err != nil {
+		return "", err
+	}
+	return e.String(), nil
+}
+
+func TestValidQueriesMatchUpstream(t *testing.T) {
+	for _, q := range readCorpus(t, "valid.txt") {
+		want, err := upstream(q)
+		if err != nil {
+			t.Errorf("upstream rejects %s: %v", q, err)
+			continue
+		}
+		e, err := promql.Parse(q)
+		if err != nil {
+			t.Errorf("promql.Parse(%s): %v", q, err)
+			continue
+		}
+		// The two print some queries differently, so compare what
+		// upstream makes of our canonical text.
+		got, err := upstream(e.String())
+		if err != nil {
+			t.Errorf("upstream rejects %s, printed from %s: %v", e.String(), q, err)
+		} else if got != want {
+			t.Errorf("%s printed as %s, which upstream reads as %s, want %s", q, e.String(), got, want)
+		}
+		if _, err := promql.Parse(want); err != nil {
+			t.Errorf("promql.Parse(%s), printed by upstream from %s: %v", want, q, err)
+		}
+	}
+}
+
+func TestInvalidQueriesMatchUpstream(t *testing.T) {
+	for _, q := range readCorpus(t, "invalid.txt") {
+		if _, err := upstream(q); err == nil {
+			t.Errorf("upstream accepts %s", q)
+		}
+		if e, err := promql.Parse(q); err == nil {
+			t.Errorf("promql.Parse(%s) = %s, want an error", q, e)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package promql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// durationUnits lists the units of the Prometheus duration syntax from
+// largest to smallest. A year is always 365 days and a week 7 days.
+var durationUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// ParseDuration parses a Prometheus duration such as "5m" or "1h30m".
+// Unlike time.ParseDuration it accepts days, weeks and years, rejects
+// fractional and negative values, and requires the units to appear from
+// largest to smallest with none repeated.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+	if s == "0" {
+		return 0, nil
+	}
+	var total time.Duration
+	next := 0 // index of the largest unit still allowed
+	for rest := s; rest != ""; {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration %q: expected a number", s)
+		}
+		digits := rest[:i]
+		rest = rest[i:]
+		unit := -1
+		for j := next; j < len(durationUnits); j++ {
+			name := durationUnits[j].name
+			if strings.HasPrefix(rest, name) && !(name == "m" && strings.HasPrefix(rest, "ms")) {
+				unit = j
+				break
+			}
+		}
+		if unit < 0 {
+			return 0, fmt.Errorf("invalid duration %q: expected a unit after %s", s, digits)
+		}
+		rest = rest[len(durationUnits[unit].name):]
+		next = unit + 1
+		var n time.Duration
+		for _, d := range digits {
+			n = n*10 + time.Duration(d-'0')
+			if n > math.MaxInt64/durationUnits[unit].size {
+				return 0, fmt.Errorf("invalid duration %q: out of range", s)
+			}
+		}
+		n *= durationUnits[unit].size
+		if total > math.MaxInt64-n {
+			return 0, fmt.Errorf("invalid duration %q: out of range", s)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// FormatDuration renders d in the Prometheus duration syntax, using the
+// largest units that represent it exactly. Precision below a millisecond
+// is discarded.
+func FormatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, unit := range durationUnits {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.name)
+			d -= n * unit.size
+		}
+	}
+	return b.String()
+}
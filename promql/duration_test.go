@@ -0,0 +1,64 @@
+package promql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, tt := range []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"5m", 5 * time.Minute, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"250ms", 250 * time.Millisecond, true},
+		{"1m30s500ms", 90*time.Second + 500*time.Millisecond, true},
+		{"2d", 2 * day, true},
+		{"1w", 7 * day, true},
+		{"1y", 365 * day, true},
+		{"1y2w3d", 365*day + 17*day, true},
+		{"", 0, false},
+		{"h", 0, false},
+		{"1.5h", 0, false},
+		{"-5m", 0, false},
+		{"5", 0, false},
+		{"30m1h", 0, false},
+		{"1h1h", 0, false},
+		{"5x", 0, false},
+		{"999999999999y", 0, false},
+	} {
+		got, err := ParseDuration(tt.in)
+		if tt.ok && err != nil {
+			t.Errorf("ParseDuration(%q): %v", tt.in, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("ParseDuration(%q) = %v, want an error", tt.in, got)
+		} else if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, tt := range []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{time.Microsecond, "0s"},
+		{90 * time.Minute, "1h30m"},
+		{8 * 24 * time.Hour, "1w1d"},
+		{1500 * time.Millisecond, "1s500ms"},
+	} {
+		got := FormatDuration(tt.in)
+		if got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+		if d, err := ParseDuration(got); err != nil || d != tt.in.Truncate(time.Millisecond) {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", got, d, err, tt.in.Truncate(time.Millisecond))
+		}
+	}
+}
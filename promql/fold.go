@@ -0,0 +1,77 @@
+package promql
+
+import "math"
+
+// Fold evaluates e if it is built only from number literals, using
+// arithmetic and bool comparisons, reporting whether it was.
+func Fold(e Expr) (float64, bool) {
+	switch e := e.(type) {
+	case *NumberLiteral:
+		return e.Val, true
+	case *ParenExpr:
+		return Fold(e.Expr)
+	case *UnaryExpr:
+		v, ok := Fold(e.Expr)
+		if !ok {
+			return 0, false
+		}
+		if e.Op == "-" {
+			v = -v
+		}
+		return v, true
+	case *BinaryExpr:
+		if IsComparison(e.Op) && !e.ReturnBool {
+			return 0, false
+		}
+		lhs, ok := Fold(e.LHS)
+		if !ok {
+			return 0, false
+		}
+		rhs, ok := Fold(e.RHS)
+		if !ok {
+			return 0, false
+		}
+		return foldBinary(e.Op, lhs, rhs)
+	}
+	return 0, false
+}
+
+// foldBinary applies a binary operator to two scalars as Prometheus
+// does.
+func foldBinary(op string, lhs, rhs float64) (float64, bool) {
+	boolean := func(b bool) (float64, bool) {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	switch op {
+	case "+":
+		return lhs + rhs, true
+	case "-":
+		return lhs - rhs, true
+	case "*":
+		return lhs * rhs, true
+	case "/":
+		return lhs / rhs, true
+	case "%":
+		return math.Mod(lhs, rhs), true
+	case "^":
+		return math.Pow(lhs, rhs), true
+	case "atan2":
+		return math.Atan2(lhs, rhs), true
+	case "==":
+		return boolean(lhs == rhs)
+	case "!=":
+		return boolean(lhs != rhs)
+	case "<":
+		return boolean(lhs < rhs)
+	case "<=":
+		return boolean(lhs <= rhs)
+	case ">":
+		return boolean(lhs > rhs)
+	case ">=":
+		return boolean(lhs >= rhs)
+	}
+	return 0, false
+}
@@ -0,0 +1,116 @@
+package promql
+
+// Function describes the signature of a PromQL function.
+type Function struct {
+	Name     string
+	ArgTypes []ValueType
+	// Variadic is the number of trailing arguments that may be omitted,
+	// or -1 if the last argument may be repeated any number of times.
+	Variadic   int
+	ReturnType ValueType
+}
+
+func fn(name string, ret ValueType, variadic int, args ...ValueType) *Function {
+	return &Function{Name: name, ArgTypes: args, Variadic: variadic, ReturnType: ret}
+}
+
+const (
+	vector = ValueTypeVector
+	matrix = ValueTypeMatrix
+	scalar = ValueTypeScalar
+	str    = ValueTypeString
+)
+
+// Functions maps each function name known to the parser to its signature.
+var Functions = map[string]*Function{}
+
+func init() {
+	for _, f := range []*Function{
+		fn("abs", vector, 0, vector),
+		fn("absent", vector, 0, vector),
+		fn("absent_over_time", vector, 0, matrix),
+		fn("acos", vector, 0, vector),
+		fn("acosh", vector, 0, vector),
+		fn("asin", vector, 0, vector),
+		fn("asinh", vector, 0, vector),
+		fn("atan", vector, 0, vector),
+		fn("atanh", vector, 0, vector),
+		fn("avg_over_time", vector, 0, matrix),
+		fn("ceil", vector, 0, vector),
+		fn("changes", vector, 0, matrix),
+		fn("clamp", vector, 0, vector, scalar, scalar),
+		fn("clamp_max", vector, 0, vector, scalar),
+		fn("clamp_min", vector, 0, vector, scalar),
+		fn("cos", vector, 0, vector),
+		fn("cosh", vector, 0, vector),
+		fn("count_over_time", vector, 0, matrix),
+		fn("day_of_month", vector, 1, vector),
+		fn("day_of_week", vector, 1, vector),
+		fn("day_of_year", vector, 1, vector),
+		fn("days_in_month", vector, 1, vector),
+		fn("deg", vector, 0, vector),
+		fn("delta", vector, 0, matrix),
+		fn("deriv", vector, 0, matrix),
+		fn("exp", vector, 0, vector),
+		fn("floor", vector, 0, vector),
+		fn("histogram_quantile", vector, 0, scalar, vector),
+		fn("holt_winters", vector, 0, matrix, scalar, scalar),
+		fn("hour", vector, 1, vector),
+		fn("idelta", vector, 0, matrix),
+		fn("increase", vector, 0, matrix),
+		fn("irate", vector, 0, matrix),
+		fn("label_join", vector, -1, vector, str, str, str),
+		fn("label_replace", vector, 0, vector, str, str, str, str),
+		fn("last_over_time", vector, 0, matrix),
+		fn("ln", vector, 0, vector),
+		fn("log10", vector, 0, vector),
+		fn("log2", vector, 0, vector),
+		fn("max_over_time", vector, 0, matrix),
+		fn("min_over_time", vector, 0, matrix),
+		fn("minute", vector, 1, vector),
+		fn("month", vector, 1, vector),
+		fn("pi", scalar, 0),
+		fn("predict_linear", vector, 0, matrix, scalar),
+		fn("present_over_time", vector, 0, matrix),
+		fn("quantile_over_time", vector, 0, scalar, matrix),
+		fn("rad", vector, 0, vector),
+		fn("rate", vector, 0, matrix),
+		fn("resets", vector, 0, matrix),
+		fn("round", vector, 1, vector, scalar),
+		fn("scalar", scalar, 0, vector),
+		fn("sgn", vector, 0, vector),
+		fn("sin", vector, 0, vector),
+		fn("sinh", vector, 0, vector),
+		fn("sort", vector, 0, vector),
+		fn("sort_desc", vector, 0, vector),
+		fn("sqrt", vector, 0, vector),
+		fn("stddev_over_time", vector, 0, matrix),
+		fn("stdvar_over_time", vector, 0, matrix),
+		fn("sum_over_time", vector, 0, matrix),
+		fn("tan", vector, 0, vector),
+		fn("tanh", vector, 0, vector),
+		fn("time", scalar, 0),
+		fn("timestamp", vector, 0, vector),
+		fn("vector", vector, 0, scalar),
+		fn("year", vector, 1, vector),
+	} {
+		Functions[f.Name] = f
+	}
+}
+
+// Aggregators lists the aggregation operators, mapped to the type of the
+// parameter each requires before its vector argument, if any.
+var Aggregators = map[string]ValueType{
+	"avg":          ValueTypeNone,
+	"bottomk":      ValueTypeScalar,
+	"count":        ValueTypeNone,
+	"count_values": ValueTypeString,
+	"group":        ValueTypeNone,
+	"max":          ValueTypeNone,
+	"min":          ValueTypeNone,
+	"quantile":     ValueTypeScalar,
+	"stddev":       ValueTypeNone,
+	"stdvar":       ValueTypeNone,
+	"sum":          ValueTypeNone,
+	"topk":         ValueTypeScalar,
+}
@@ -0,0 +1,215 @@
+package promql
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenNumber
+	tokenDuration
+	tokenString
+	// tokenPunct covers operators and delimiters. Word operators such as
+	// "and" and keywords such as "by" are identifiers.
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	// text is the token exactly as it appears in the query.
+	text string
+}
+
+// punctuation lists the symbolic tokens, longest first so that the
+// lexer prefers "=~" over "=".
+var punctuation = []string{
+	"==", "!=", ">=", "<=", "=~", "!~",
+	"+", "-", "*", "/", "%", "^", ">", "<", "=",
+	"(", ")", "{", "}", "[", "]", ",", ":", "@",
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == ':' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lex splits query into tokens, always ending with a tokenEOF.
+func lex(query string) ([]token, error) {
+	var tokens []token
+	// Within brackets a colon separates a subquery's range and step
+	// rather than starting an identifier.
+	brackets := 0
+	for pos := 0; ; {
+		for pos < len(query) && strings.IndexByte(" \t\r\n", query[pos]) >= 0 {
+			pos++
+		}
+		if pos < len(query) && query[pos] == '#' {
+			for pos < len(query) && query[pos] != '\n' {
+				pos++
+			}
+			continue
+		}
+		if pos == len(query) {
+			return append(tokens, token{kind: tokenEOF, pos: pos}), nil
+		}
+		start := pos
+		kind := tokenPunct
+		switch c := query[pos]; {
+		case isIdentStart(c) && !(c == ':' && brackets > 0):
+			for pos < len(query) && isIdentChar(query[pos]) {
+				pos++
+			}
+			kind = tokenIdentifier
+			if word := strings.ToLower(query[start:pos]); word == "inf" || word == "nan" {
+				kind = tokenNumber
+			}
+		case isDigit(c) || c == '.' && pos+1 < len(query) && isDigit(query[pos+1]):
+			var err error
+			pos, kind, err = lexNumber(query, pos)
+			if err != nil {
+				return tokens, err
+			}
+		case c == '"' || c == '\'' || c == '`':
+			end, err := lexString(query, pos)
+			if err != nil {
+				return tokens, err
+			}
+			pos, kind = end, tokenString
+		default:
+			for _, p := range punctuation {
+				if strings.HasPrefix(query[pos:], p) {
+					pos += len(p)
+					break
+				}
+			}
+			if pos == start {
+				r, _ := utf8.DecodeRuneInString(query[pos:])
+				return tokens, &ParseError{Pos: pos, Err: "unexpected character " + strconv.QuoteRune(r)}
+			}
+			switch c {
+			case '[':
+				brackets++
+			case ']':
+				brackets--
+			}
+		}
+		tokens = append(tokens, token{kind: kind, pos: start, text: query[start:pos]})
+	}
+}
+
+// lexNumber scans the number or duration beginning at pos and returns
+// the offset just past it.
+func lexNumber(query string, pos int) (int, tokenKind, error) {
+	start := pos
+	digits := func() {
+		for pos < len(query) && isDigit(query[pos]) {
+			pos++
+		}
+	}
+	if strings.HasPrefix(query[pos:], "0x") || strings.HasPrefix(query[pos:], "0X") {
+		pos += 2
+		for pos < len(query) && strings.IndexByte("0123456789abcdefABCDEF", query[pos]) >= 0 {
+			pos++
+		}
+	} else {
+		digits()
+		integer := pos
+		if pos < len(query) && query[pos] == '.' {
+			pos++
+			digits()
+		}
+		if pos < len(query) && (query[pos] == 'e' || query[pos] == 'E') {
+			exp := pos + 1
+			if exp < len(query) && (query[exp] == '+' || query[exp] == '-') {
+				exp++
+			}
+			if exp < len(query) && isDigit(query[exp]) {
+				pos = exp
+				digits()
+			}
+		}
+		if pos == integer && pos < len(query) && strings.IndexByte("ywdhms", query[pos]) >= 0 {
+			for pos < len(query) && (isDigit(query[pos]) || strings.IndexByte("ywdhms", query[pos]) >= 0) {
+				pos++
+			}
+			if pos < len(query) && isIdentChar(query[pos]) && query[pos] != ':' {
+				return pos, tokenDuration, &ParseError{Pos: start, Err: "bad number or duration syntax"}
+			}
+			if _, err := ParseDuration(query[start:pos]); err != nil {
+				return pos, tokenDuration, &ParseError{Pos: start, Err: err.Error()}
+			}
+			return pos, tokenDuration, nil
+		}
+	}
+	if pos < len(query) && isIdentChar(query[pos]) && query[pos] != ':' {
+		return pos, tokenNumber, &ParseError{Pos: start, Err: "bad number or duration syntax"}
+	}
+	return pos, tokenNumber, nil
+}
+
+// lexString scans the quoted string beginning at pos and returns the
+// offset just past its closing quote.
+func lexString(query string, pos int) (int, error) {
+	quote := query[pos]
+	for i := pos + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case '\n':
+			if quote != '`' {
+				return i, &ParseError{Pos: pos, Err: "unterminated quoted string"}
+			}
+		case quote:
+			return i + 1, nil
+		}
+	}
+	return len(query), &ParseError{Pos: pos, Err: "unterminated quoted string"}
+}
+
+// Unquote returns the value of a quoted string, interpreting escape
+// sequences the way Go does for all three quote styles.
+func Unquote(s string) (string, error) {
+	if s[0] != '\'' {
+		return strconv.Unquote(s)
+	}
+	// Rewrite the single-quoted string into an equivalent double-quoted
+	// one so that strconv handles the escapes.
+	var b strings.Builder
+	b.WriteByte('"')
+	body := s[1 : len(s)-1]
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; c {
+		case '\\':
+			if i+1 < len(body) && body[i+1] == '\'' {
+				b.WriteByte('\'')
+			} else {
+				b.WriteByte(c)
+				if i+1 < len(body) {
+					b.WriteByte(body[i+1])
+				}
+			}
+			i++
+		case '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return strconv.Unquote(b.String())
+}
@@ -0,0 +1,590 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// binaryPrecedence maps each binary operator to its binding strength.
+// Higher values bind more tightly.
+var binaryPrecedence = map[string]int{
+	"or":     1,
+	"and":    2,
+	"unless": 2,
+	"==":     3,
+	"!=":     3,
+	"<":      3,
+	"<=":     3,
+	">":      3,
+	">=":     3,
+	"+":      4,
+	"-":      4,
+	"*":      5,
+	"/":      5,
+	"%":      5,
+	"atan2":  5,
+	"^":      6,
+}
+
+// IsComparison reports whether op is a comparison operator, and so may
+// take the bool modifier.
+func IsComparison(op string) bool {
+	return binaryPrecedence[op] == 3
+}
+
+// IsSetOperator reports whether op operates on sets of series rather
+// than on sample values.
+func IsSetOperator(op string) bool {
+	return op == "and" || op == "or" || op == "unless"
+}
+
+type parser struct {
+	tokens []token
+	next   int
+	// end is the offset just past the most recently consumed token.
+	end int
+	// unchecked skips checking the types of function arguments.
+	unchecked bool
+}
+
+// Parse parses query into an expression tree. Errors are always of type
+// *ParseError.
+func Parse(query string) (Expr, error) {
+	return parse(query, false)
+}
+
+// ParseUnchecked parses query like Parse, but allows function arguments
+// of the wrong type, so that mistakes like the missing range of
+// rate(foo) can be pointed out.
+func ParseUnchecked(query string) (Expr, error) {
+	return parse(query, true)
+}
+
+func parse(query string, unchecked bool) (expr Expr, err error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, unchecked: unchecked}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*ParseError)
+			if !ok {
+				panic(r)
+			}
+			expr, err = nil, perr
+		}
+	}()
+	if p.peek().kind == tokenEOF {
+		p.errorf(0, "no expression found in input")
+	}
+	expr = p.parseExpr(1)
+	if t := p.peek(); t.kind != tokenEOF {
+		p.unexpected(t, "")
+	}
+	return expr, nil
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) {
+	panic(&ParseError{Pos: pos, Err: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) unexpected(t token, context string) {
+	desc := strconv.Quote(t.text)
+	if t.kind == tokenEOF {
+		desc = "end of input"
+	}
+	if context != "" {
+		context = " " + context
+	}
+	p.errorf(t.pos, "unexpected %s%s", desc, context)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) peekN(n int) token {
+	if i := p.next + n; i < len(p.tokens) {
+		return p.tokens[i]
+	}
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *parser) consume() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+		p.end = t.pos + len(t.text)
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuation or keyword text.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenPunct || t.kind == tokenIdentifier) && t.text == text
+}
+
+func (p *parser) expect(text, context string) token {
+	if !p.is(text) {
+		p.unexpected(p.peek(), context)
+	}
+	return p.consume()
+}
+
+func (p *parser) binaryOp() (string, int) {
+	t := p.peek()
+	if t.kind != tokenPunct && t.kind != tokenIdentifier {
+		return "", 0
+	}
+	prec, ok := binaryPrecedence[t.text]
+	if !ok {
+		return "", 0
+	}
+	return t.text, prec
+}
+
+// parseExpr parses a sequence of binary operations whose operators bind
+// at least as tightly as minPrec.
+func (p *parser) parseExpr(minPrec int) Expr {
+	lhs := p.parseUnary()
+	for {
+		op, prec := p.binaryOp()
+		if prec == 0 || prec < minPrec {
+			return lhs
+		}
+		opToken := p.consume()
+		bin := &BinaryExpr{Op: op, LHS: lhs}
+		if p.is("bool") {
+			if !IsComparison(op) {
+				p.errorf(p.peek().pos, "bool modifier can only be used on comparison operators")
+			}
+			p.consume()
+			bin.ReturnBool = true
+		}
+		if p.is("on") || p.is("ignoring") {
+			bin.Matching = &VectorMatching{On: p.consume().text == "on"}
+			bin.Matching.Labels = p.parseLabels()
+			if p.is("group_left") || p.is("group_right") {
+				if IsSetOperator(op) {
+					p.errorf(p.peek().pos, "no grouping allowed for %q operation", op)
+				}
+				bin.Matching.Card = p.consume().text
+				if p.is("(") {
+					bin.Matching.Include = p.parseLabels()
+				}
+			}
+		}
+		next := prec + 1
+		if op == "^" {
+			// Exponentiation is right associative.
+			next = prec
+		}
+		bin.RHS = p.parseExpr(next)
+		bin.PosRange = PosRange{lhs.PositionRange().Start, p.end}
+		for _, operand := range []Expr{lhs, bin.RHS} {
+			if t := operand.Type(); t != ValueTypeScalar && t != ValueTypeVector {
+				p.errorf(operand.PositionRange().Start, "binary expression must contain only scalar and instant vector types, got %s", t)
+			}
+		}
+		if IsSetOperator(op) && (lhs.Type() == ValueTypeScalar || bin.RHS.Type() == ValueTypeScalar) {
+			p.errorf(opToken.pos, "set operator %q not allowed in binary scalar expression", op)
+		}
+		if IsComparison(op) && !bin.ReturnBool && lhs.Type() == ValueTypeScalar && bin.RHS.Type() == ValueTypeScalar {
+			p.errorf(opToken.pos, "comparisons between scalars must use bool modifier")
+		}
+		lhs = bin
+	}
+}
+
+func (p *parser) parseUnary() Expr {
+	if !p.is("+") && !p.is("-") {
+		return p.parsePostfix(p.parsePrimary())
+	}
+	t := p.consume()
+	operand := p.parseExpr(binaryPrecedence["^"])
+	switch operand.Type() {
+	case ValueTypeScalar, ValueTypeVector:
+	default:
+		p.errorf(t.pos, "unary expression only allowed on expressions of type scalar or instant vector, got %q", operand.Type())
+	}
+	if n, ok := operand.(*NumberLiteral); ok {
+		if t.text == "-" {
+			n.Val = -n.Val
+		}
+		n.Start = t.pos
+		return n
+	}
+	return &UnaryExpr{Op: t.text, Expr: operand, PosRange: PosRange{t.pos, p.end}}
+}
+
+func (p *parser) parsePrimary() Expr {
+	t := p.peek()
+	switch t.kind {
+	case tokenNumber:
+		p.consume()
+		return &NumberLiteral{Val: parseNumber(t.text), PosRange: PosRange{t.pos, p.end}}
+	case tokenString:
+		p.consume()
+		val, err := Unquote(t.text)
+		if err != nil {
+			p.errorf(t.pos, "invalid string %s: %v", t.text, err)
+		}
+		return &StringLiteral{Val: val, PosRange: PosRange{t.pos, p.end}}
+	case tokenIdentifier:
+		next := p.peekN(1)
+		if _, ok := Aggregators[t.text]; ok && (next.text == "(" || next.text == "by" || next.text == "without") {
+			return p.parseAggregate()
+		}
+		if next.text == "(" {
+			return p.parseCall()
+		}
+		p.consume()
+		vs := &VectorSelector{Name: t.text}
+		if p.is("{") {
+			var name token
+			name, vs.Matchers = p.parseMatchers()
+			if name.kind == tokenString {
+				p.errorf(name.pos, "metric name must not be set twice: %s or %s", t.text, name.text)
+			}
+		}
+		vs.PosRange = PosRange{t.pos, p.end}
+		return vs
+	case tokenPunct:
+		switch t.text {
+		case "(":
+			p.consume()
+			inner := p.parseExpr(1)
+			p.expect(")", "in parenthesized expression")
+			return &ParenExpr{Expr: inner, PosRange: PosRange{t.pos, p.end}}
+		case "{":
+			name, matchers := p.parseMatchers()
+			vs := &VectorSelector{Matchers: matchers}
+			vs.PosRange = PosRange{t.pos, p.end}
+			if name.kind == tokenString {
+				vs.Name = p.unquote(name)
+			} else {
+				p.checkSelector(vs)
+			}
+			return vs
+		}
+	}
+	p.unexpected(t, "")
+	return nil
+}
+
+func parseNumber(text string) float64 {
+	if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return float64(i)
+	}
+	f, _ := strconv.ParseFloat(text, 64)
+	return f
+}
+
+// checkSelector enforces that a selector without a metric name cannot
+// match every series.
+func (p *parser) checkSelector(vs *VectorSelector) {
+	for _, m := range vs.Matchers {
+		var matchesEmpty bool
+		switch m.Type {
+		case MatchEqual:
+			matchesEmpty = m.Value == ""
+		case MatchNotEqual:
+			matchesEmpty = m.Value != ""
+		case MatchRegexp, MatchNotRegexp:
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				p.errorf(m.Start, "invalid regular expression %q: %v", m.Value, err)
+			}
+			matchesEmpty = re.MatchString("") == (m.Type == MatchRegexp)
+		}
+		if !matchesEmpty {
+			return
+		}
+	}
+	p.errorf(vs.Start, "vector selector must contain at least one non-empty matcher")
+}
+
+// parseMatchers parses the braces of a selector, returning its matchers
+// and the quoted metric name among them, if any, as in {"my.metric"}.
+func (p *parser) parseMatchers() (token, []*Matcher) {
+	p.expect("{", "")
+	var (
+		metric   token
+		matchers []*Matcher
+	)
+	for !p.is("}") {
+		name := p.peek()
+		if name.kind != tokenIdentifier && name.kind != tokenString {
+			p.unexpected(name, "in label matching, expected label")
+		}
+		p.consume()
+		if name.kind == tokenString && (p.is(",") || p.is("}")) {
+			if metric.kind == tokenString {
+				p.errorf(name.pos, "metric name must not be set twice: %s or %s", metric.text, name.text)
+			}
+			metric = name
+			if !p.is(",") {
+				break
+			}
+			p.consume()
+			continue
+		}
+		label := name.text
+		if name.kind == tokenString {
+			label = p.unquote(name)
+		}
+		op := p.peek()
+		switch MatchType(op.text) {
+		case MatchEqual, MatchNotEqual, MatchRegexp, MatchNotRegexp:
+		default:
+			p.unexpected(op, "in label matching, expected one of \"=\", \"!=\", \"=~\" or \"!~\"")
+		}
+		p.consume()
+		value := p.peek()
+		if value.kind != tokenString {
+			p.unexpected(value, "in label matching, expected string")
+		}
+		p.consume()
+		val := p.unquote(value)
+		m := &Matcher{Name: label, Type: MatchType(op.text), Value: val, PosRange: PosRange{name.pos, p.end}}
+		if m.Type == MatchRegexp || m.Type == MatchNotRegexp {
+			if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+				p.errorf(value.pos, "invalid regular expression %q: %v", m.Value, err)
+			}
+		}
+		matchers = append(matchers, m)
+		if !p.is(",") {
+			break
+		}
+		p.consume()
+	}
+	p.expect("}", "in label matching, expected \",\" or \"}\"")
+	return metric, matchers
+}
+
+// unquote returns the contents of the string token t.
+func (p *parser) unquote(t token) string {
+	s, err := Unquote(t.text)
+	if err != nil {
+		p.errorf(t.pos, "invalid string %s: %v", t.text, err)
+	}
+	return s
+}
+
+// parseLabels parses a parenthesized, comma separated list of label names.
+func (p *parser) parseLabels() []string {
+	p.expect("(", "in grouping, expected \"(\"")
+	labels := []string{}
+	for !p.is(")") {
+		t := p.peek()
+		if t.kind != tokenIdentifier {
+			p.unexpected(t, "in grouping, expected label")
+		}
+		labels = append(labels, p.consume().text)
+		if !p.is(",") {
+			break
+		}
+		p.consume()
+	}
+	p.expect(")", "in grouping, expected \",\" or \")\"")
+	return labels
+}
+
+func (p *parser) parseGrouping(agg *AggregateExpr) {
+	if agg.Grouped {
+		p.errorf(p.peek().pos, "aggregation may only have one grouping clause")
+	}
+	agg.Grouped = true
+	agg.Without = p.consume().text == "without"
+	agg.Grouping = p.parseLabels()
+}
+
+func (p *parser) parseAggregate() Expr {
+	t := p.consume()
+	agg := &AggregateExpr{Op: t.text}
+	if p.is("by") || p.is("without") {
+		p.parseGrouping(agg)
+	}
+	p.expect("(", "in aggregation, expected \"(\"")
+	if Aggregators[agg.Op] != ValueTypeNone {
+		agg.Param = p.parseExpr(1)
+		if got, want := agg.Param.Type(), Aggregators[agg.Op]; got != want {
+			p.errorf(agg.Param.PositionRange().Start, "expected type %s in aggregation parameter, got %s", want, got)
+		}
+		p.expect(",", "in aggregation, expected \",\"")
+	}
+	agg.Expr = p.parseExpr(1)
+	if got := agg.Expr.Type(); got != ValueTypeVector {
+		p.errorf(agg.Expr.PositionRange().Start, "expected type %s in aggregation expression, got %s", ValueTypeVector, got)
+	}
+	p.expect(")", "in aggregation, expected \")\"")
+	if p.is("by") || p.is("without") {
+		p.parseGrouping(agg)
+	}
+	agg.PosRange = PosRange{t.pos, p.end}
+	return agg
+}
+
+func (p *parser) parseCall() Expr {
+	t := p.consume()
+	f, ok := Functions[t.text]
+	if !ok {
+		p.errorf(t.pos, "unknown function with name %q", t.text)
+	}
+	call := &Call{Func: f}
+	p.expect("(", "")
+	for !p.is(")") {
+		call.Args = append(call.Args, p.parseExpr(1))
+		if !p.is(",") {
+			break
+		}
+		p.consume()
+	}
+	p.expect(")", "in call to function "+strconv.Quote(f.Name)+", expected \",\" or \")\"")
+	call.PosRange = PosRange{t.pos, p.end}
+	n, min := len(call.Args), len(f.ArgTypes)
+	switch {
+	case f.Variadic < 0:
+		if n < min-1 {
+			p.errorf(t.pos, "expected at least %d argument(s) in call to %q, got %d", min-1, f.Name, n)
+		}
+	case f.Variadic > 0:
+		if n > min || n < min-f.Variadic {
+			p.errorf(t.pos, "expected %d to %d argument(s) in call to %q, got %d", min-f.Variadic, min, f.Name, n)
+		}
+	default:
+		if n != min {
+			p.errorf(t.pos, "expected %d argument(s) in call to %q, got %d", min, f.Name, n)
+		}
+	}
+	if !p.unchecked {
+		p.checkArgs(call)
+	}
+	return call
+}
+
+// checkArgs checks the types of the arguments of call.
+func (p *parser) checkArgs(call *Call) {
+	for i, arg := range call.Args {
+		want := call.Func.ArgTypes[len(call.Func.ArgTypes)-1]
+		if i < len(call.Func.ArgTypes) {
+			want = call.Func.ArgTypes[i]
+		}
+		if got := arg.Type(); got != want {
+			p.errorf(arg.PositionRange().Start, "expected type %s in call to function %q, got %s", want, call.Func.Name, got)
+		}
+	}
+}
+
+// parsePostfix applies any range, subquery, offset and @ modifiers that
+// follow expr.
+func (p *parser) parsePostfix(expr Expr) Expr {
+	for {
+		switch {
+		case p.is("["):
+			expr = p.parseRange(expr)
+		case p.is("offset"):
+			p.consume()
+			sign := time.Duration(1)
+			if p.is("-") {
+				p.consume()
+				sign = -1
+			}
+			offset := sign * p.parseDuration("in offset, expected duration")
+			p.setModifier(expr, func(o *time.Duration, _ **AtModifier) { *o = offset })
+		case p.is("@"):
+			t := p.consume()
+			at := &AtModifier{}
+			if p.is("start") || p.is("end") {
+				at.Preprocessor = p.consume().text
+				p.expect("(", "in @ modifier")
+				p.expect(")", "in @ modifier")
+			} else {
+				ts := p.peek()
+				if ts.kind != tokenNumber {
+					p.unexpected(ts, "in @ modifier, expected timestamp, start() or end()")
+				}
+				p.consume()
+				at.Timestamp = parseNumber(ts.text)
+			}
+			at.PosRange = PosRange{t.pos, p.end}
+			p.setModifier(expr, func(_ *time.Duration, a **AtModifier) { *a = at })
+		default:
+			return expr
+		}
+	}
+}
+
+// parseDuration parses a duration, which may also be written as a
+// number of seconds.
+func (p *parser) parseDuration(context string) time.Duration {
+	t := p.peek()
+	switch t.kind {
+	case tokenDuration:
+		p.consume()
+		d, _ := ParseDuration(t.text)
+		return d
+	case tokenNumber:
+		p.consume()
+		secs := parseNumber(t.text)
+		if math.IsNaN(secs) || math.IsInf(secs, 0) || secs*float64(time.Second) > math.MaxInt64 {
+			p.errorf(t.pos, "invalid duration %s", t.text)
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	p.unexpected(t, context)
+	return 0
+}
+
+func (p *parser) parseRange(expr Expr) Expr {
+	open := p.consume()
+	start := expr.PositionRange().Start
+	rng := p.parseDuration("in range, expected duration")
+	if p.is("]") {
+		p.consume()
+		vs, ok := expr.(*VectorSelector)
+		if !ok {
+			p.errorf(open.pos, "ranges only allowed for vector selectors")
+		}
+		if vs.Offset != 0 || vs.At != nil {
+			p.errorf(open.pos, "no offset or @ modifiers allowed before range")
+		}
+		return &MatrixSelector{VectorSelector: vs, Range: rng, PosRange: PosRange{start, p.end}}
+	}
+	p.expect(":", "in subquery, expected \":\" or \"]\"")
+	sq := &SubqueryExpr{Expr: expr, Range: rng}
+	if !p.is("]") {
+		sq.Step = p.parseDuration("in subquery, expected duration")
+	}
+	p.expect("]", "in subquery, expected \"]\"")
+	if t := expr.Type(); t != ValueTypeVector {
+		p.errorf(open.pos, "subquery is only allowed on instant vector, got %s", t)
+	}
+	sq.PosRange = PosRange{start, p.end}
+	return sq
+}
+
+// setModifier applies an offset or @ modifier to expr via set, extending
+// the node's position to cover the modifier.
+func (p *parser) setModifier(expr Expr, set func(*time.Duration, **AtModifier)) {
+	switch e := expr.(type) {
+	case *VectorSelector:
+		set(&e.Offset, &e.At)
+		e.End = p.end
+	case *MatrixSelector:
+		set(&e.VectorSelector.Offset, &e.VectorSelector.At)
+		e.End = p.end
+	case *SubqueryExpr:
+		set(&e.Offset, &e.At)
+		e.End = p.end
+	default:
+		p.errorf(expr.PositionRange().Start, "offset and @ modifiers must follow a selector or subquery, not %s",
+			strings.TrimPrefix(fmt.Sprintf("%T", expr), "*promql."))
+	}
+}
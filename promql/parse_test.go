@@ -0,0 +1,171 @@
+package promql
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{`up`, `up`},
+		{`up{job="api"}`, `up{job="api"}`},
+		{`sum by (job) (rate(http_requests_total{job=~"api|web",code!="200"}[5m] offset 1h))`,
+			`sum by (job) (rate(http_requests_total{job=~"api|web", code!="200"}[5m] offset 1h))`},
+		{`a / on(job) group_left(env) b`, `a / on (job) group_left (env) b`},
+		{`(1+2)*3`, `(1 + 2) * 3`},
+		{`sum(up) without (a)`, `sum without (a) (up)`},
+		{`up offset -5m`, `up offset -5m`},
+		{`up == bool 1`, `up == bool 1`},
+		{`-up`, `-up`},
+		{`rate(up[1h30m])`, `rate(up[1h30m])`},
+		{`max_over_time(rate(up[5m])[1h:1m])`, `max_over_time(rate(up[5m])[1h:1m])`},
+		{`topk(3, up)`, `topk(3, up)`},
+		{`label_replace(up, "a", "$1", "b", "(.*)")`, `label_replace(up, "a", "$1", "b", "(.*)")`},
+		{`up and ignoring (instance) down`, `up and ignoring (instance) down`},
+	} {
+		e, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+			continue
+		}
+		// The canonical text must itself parse back to the same text.
+		e, err = Parse(tt.want)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.want, err)
+		} else if got := e.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, not stable", tt.want, got)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		pos int
+		err string // substring of the message
+	}{
+		{``, 0, "no expression found in input"},
+		{`up{`, 3, "unexpected end of input in label matching, expected label"},
+		{`up{job=}`, 7, ""},
+		{`up{job="x}`, 7, "unterminated quoted string"},
+		{`up[x]`, 3, `unexpected "x" in range, expected duration`},
+		{`up +`, 4, ""},
+		{`1 +* 2`, 3, ""},
+		{`foo bar`, 4, ""},
+		{`sum(`, 4, ""},
+		{`sum by (job`, 11, ""},
+		{`rate(up[5m]`, 11, ""},
+		{`rate()`, 0, "expected 1 argument(s)"},
+		{`unknown_fn(up)`, 0, `unknown function with name "unknown_fn"`},
+		{`rate(up[5m]) @ start()`, -1, ""},
+	} {
+		_, err := Parse(tt.in)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q) error = %v, want a *ParseError", tt.in, err)
+			continue
+		}
+		if tt.pos >= 0 && perr.Pos != tt.pos {
+			t.Errorf("Parse(%q) error at %d, want %d: %v", tt.in, perr.Pos, tt.pos, err)
+		}
+		if !strings.Contains(perr.Err, tt.err) {
+			t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.in, perr.Err, tt.err)
+		}
+	}
+}
+
+func TestParseQuotedNames(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+		name     string
+		labels   []string
+	}{
+		{`{"foo.bar"}`, `{"foo.bar"}`, "foo.bar", nil},
+		{`{"ü", job="x"}`, `{"ü", job="x"}`, "ü", []string{"job"}},
+		{`{"a\"b"="c\"d"}`, `{"a\"b"="c\"d"}`, "", []string{`a"b`}},
+		{`foo{"a.b"="1"}`, `foo{"a.b"="1"}`, "foo", []string{"a.b"}},
+		{`{"foo"}`, `foo`, "foo", nil},
+		{`{"job"="x"}`, `{job="x"}`, "", []string{"job"}},
+		{`sum by (job) ({"c.d"})`, `sum by (job) ({"c.d"})`, "c.d", nil},
+	} {
+		e, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		var sel *VectorSelector
+		Inspect(e, func(n Node) bool {
+			if s, ok := n.(*VectorSelector); ok {
+				sel = s
+			}
+			return true
+		})
+		if sel == nil {
+			t.Errorf("Parse(%q) has no selector", tt.in)
+			continue
+		}
+		if sel.Name != tt.name {
+			t.Errorf("Parse(%q) selects metric %q, want %q", tt.in, sel.Name, tt.name)
+		}
+		var labels []string
+		for _, m := range sel.Matchers {
+			if m.Name != "__name__" {
+				labels = append(labels, m.Name)
+			}
+		}
+		if strings.Join(labels, ",") != strings.Join(tt.labels, ",") {
+			t.Errorf("Parse(%q) matches labels %q, want %q", tt.in, labels, tt.labels)
+		}
+	}
+}
+
+// readCorpus returns the queries in the named testdata file, one per
+// line, skipping blank lines and comments. The conformance module checks
+// the upstream parser against the same files.
+func readCorpus(t *testing.T, name string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "#") {
+			queries = append(queries, line)
+		}
+	}
+	return queries
+}
+
+func TestParseCorpus(t *testing.T) {
+	for _, q := range readCorpus(t, "valid.txt") {
+		e, err := Parse(q)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", q, err)
+			continue
+		}
+		again, err := Parse(e.String())
+		if err != nil {
+			t.Errorf("Parse(%s), printed from %s: %v", e.String(), q, err)
+		} else if again.String() != e.String() {
+			t.Errorf("Parse(%s).String() = %s, not stable", e.String(), again.String())
+		}
+	}
+	for _, q := range readCorpus(t, "invalid.txt") {
+		if e, err := Parse(q); err == nil {
+			t.Errorf("Parse(%s) = %s, want an error", q, e)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// replicaHeaders are the response headers that may name the server, such
+// as one replica of an HA pair, that answered a request, in the order
+// they are preferred. Servers and proxies set none of them by default.
+var replicaHeaders = []string{"X-Prometheus-Replica", "X-Replica", "X-Served-By", "X-Backend-Server"}
+
+type replicasKey struct{}
+
+// replicas collects the names of the servers that answered the requests
+// made with a context, as a query to a Federation makes several at once.
+type replicas struct {
+	mu    sync.Mutex
+	names []string
+}
+
+// withReplicas returns a context whose requests record in r the servers
+// that answered them.
+func withReplicas(ctx context.Context, r *replicas) context.Context {
+	return context.WithValue(ctx, replicasKey{}, r)
+}
+
+func (r *replicas) add(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, n := range r.names {
+		if n == name {
+			return
+		}
+	}
+	r.names = append(r.names, name)
+}
+
+// String lists the servers that answered, empty if none said who they
+// were.
+func (r *replicas) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.names, ", ")
+}
+
+// replicaTransport records the server that answered each request, if a
+// response header names it, in the replicas of the request's context.
+type replicaTransport struct {
+	http.RoundTripper
+}
+
+func (t replicaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if r, ok := req.Context().Value(replicasKey{}).(*replicas); ok {
+		for _, h := range replicaHeaders {
+			if name := resp.Header.Get(h); name != "" {
+				r.add(name)
+				break
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (t replicaTransport) CloseIdleConnections() {
+	closeIdle(t.RoundTripper)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// queryCache keeps the latest results of the queries run most recently,
+// so that running one again soon after, as when switching between views,
+// is answered without asking the server. Results are keyed by the request
+// that fetched them and are kept only until they are ttl old, as a result
+// evaluated a moment ago stands in for one evaluated now.
+type queryCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[queryRequest]*list.Element
+	// order holds the cached results, most recently used first.
+	order *list.List
+}
+
+type cacheEntry struct {
+	req    queryRequest
+	result queryResult
+}
+
+// newQueryCache caches up to size results for ttl each, or returns nil
+// if either is not positive.
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &queryCache{
+		size:    size,
+		ttl:     ttl,
+		entries: map[queryRequest]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Get returns the result cached for req, if there is one and it is not
+// too old.
+func (c *queryCache) Get(req queryRequest) (queryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[req]
+	if !ok {
+		return queryResult{}, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if time.Since(entry.result.at) > c.ttl {
+		c.order.Remove(e)
+		delete(c.entries, req)
+		return queryResult{}, false
+	}
+	c.order.MoveToFront(e)
+	return entry.result, true
+}
+
+// Put caches result for req, evicting the least recently used result if
+// the cache is full.
+func (c *queryCache) Put(req queryRequest, result queryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[req]; ok {
+		e.Value.(*cacheEntry).result = result
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[req] = c.order.PushFront(&cacheEntry{req: req, result: result})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).req)
+	}
+}
+
+// Clear drops every cached result, as when they came from an endpoint no
+// longer in use.
+func (c *queryCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[queryRequest]*list.Element{}
+	c.order.Init()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+
+	"gioui.org/widget"
+)
+
+// recallLimit bounds the number of queries kept for recall.
+const recallLimit = 100
+
+// recallHistory is the distinct queries submitted in the window, oldest
+// first, shared by its panes for as long as it is open. A query is
+// submitted when it is run again with the rerun shortcut or the editor
+// loses focus, rather than with every edit run as it is typed.
+type recallHistory struct {
+	queries []string
+}
+
+// Add records text as the latest query submitted, moving it there if it
+// was submitted before. Blank queries are left out.
+func (h *recallHistory) Add(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	for i, q := range h.queries {
+		if q == text {
+			h.queries = append(h.queries[:i], h.queries[i+1:]...)
+			break
+		}
+	}
+	h.queries = append(h.queries, text)
+	if len(h.queries) > recallLimit {
+		h.queries = h.queries[len(h.queries)-recallLimit:]
+	}
+}
+
+// queryRecall steps a pane's query back and forth through the history
+// with the arrow keys. Stepping forward past the latest query returns to
+// the draft, the query as it was before stepping back began, without
+// wrapping around.
+type queryRecall struct {
+	history *recallHistory
+	// back is how many queries back from the latest the one in the
+	// editor is, or -1 for the draft.
+	back  int
+	draft string
+	// recalled is the text last put in the editor, to tell it apart
+	// from edits, which leave the history and keep the edit as draft.
+	recalled string
+	// step is the step to take once the editor has handled the key
+	// that asked for it, which would otherwise move the caret within
+	// the recalled query.
+	step int
+}
+
+func newQueryRecall() *queryRecall {
+	return &queryRecall{history: &recallHistory{}, back: -1}
+}
+
+// Step asks to step dir queries back, if positive, or forward, if the
+// caret is on the first or last line of ed respectively, reporting whether
+// there is a query to step to.
+func (r *queryRecall) Step(ed *widget.Editor, dir int) bool {
+	line, _ := ed.CaretPos()
+	switch {
+	case dir > 0 && (line != 0 || r.back+1 >= len(r.history.queries)):
+		return false
+	case dir < 0 && (line != ed.NumLines()-1 || r.back < 0):
+		return false
+	}
+	r.step = dir
+	return true
+}
+
+// Apply takes the step asked for, if any, putting the query stepped to in
+// ed with the caret at its end, and reports whether it did.
+func (r *queryRecall) Apply(ed *widget.Editor) bool {
+	if r.step == 0 {
+		return false
+	}
+	if r.back < 0 {
+		r.draft = ed.Text()
+	}
+	r.back += r.step
+	r.step = 0
+	if r.back >= len(r.history.queries) {
+		r.back = len(r.history.queries) - 1
+	}
+	text := r.draft
+	if r.back >= 0 {
+		text = r.history.queries[len(r.history.queries)-1-r.back]
+	}
+	r.recalled = text
+	ed.SetText(text)
+	ed.SetCaret(len(text), len(text))
+	return true
+}
+
+// Edited notes that the query is now text, leaving the history unless
+// text is the query recalled.
+func (r *queryRecall) Edited(text string) {
+	if text != r.recalled {
+		r.back, r.recalled = -1, ""
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/common/config"
+)
+
+// redirectTransport sends requests that follow a redirect to another
+// origin than the endpoint's through anonymous, so that the endpoint's
+// credentials are not leaked to wherever it redirects. The client config
+// adds credentials to every request it sends, redirected or not, so the
+// stripping the http package does for its own headers is not enough.
+type redirectTransport struct {
+	authed, anonymous http.RoundTripper
+	origin            *url.URL
+}
+
+// newRedirectTransport wraps rt, which authenticates to ep, unless ep
+// forwards its credentials on redirects.
+func newRedirectTransport(rt http.RoundTripper, ep *Endpoint, opts ...config.HTTPClientOption) (http.RoundTripper, error) {
+	if ep.ForwardAuthOnRedirect {
+		return rt, nil
+	}
+	origin, err := url.Parse(ep.Address)
+	if err != nil {
+		return nil, err
+	}
+	cfg := ep.HTTPClientConfig
+	cfg.BasicAuth, cfg.Authorization, cfg.OAuth2 = nil, nil, nil
+	cfg.BearerToken, cfg.BearerTokenFile = "", ""
+	// A client certificate identifies the client as much as a token, and
+	// the server name is that of the endpoint.
+	cfg.TLSConfig.CertFile, cfg.TLSConfig.KeyFile, cfg.TLSConfig.ServerName = "", "", ""
+	anonymous, err := config.NewRoundTripperFromConfig(cfg, "binnacle", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return redirectTransport{authed: rt, anonymous: anonymous, origin: origin}, nil
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Response == nil || t.sameOrigin(req.URL) {
+		return t.authed.RoundTrip(req)
+	}
+	slog.Info("not forwarding credentials on redirect", "from", t.origin.Host, "to", req.URL.Host)
+	req = req.Clone(req.Context())
+	req.Header.Del("Authorization")
+	return t.anonymous.RoundTrip(req)
+}
+
+func (t redirectTransport) sameOrigin(u *url.URL) bool {
+	return strings.EqualFold(u.Scheme, t.origin.Scheme) && strings.EqualFold(u.Host, t.origin.Host)
+}
+
+func (t redirectTransport) CloseIdleConnections() {
+	closeIdle(t.authed)
+	closeIdle(t.anonymous)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// The relabeling functions that the relabel panel builds calls of.
+const (
+	labelReplace = "label_replace"
+	labelJoin    = "label_join"
+)
+
+// groupRefs finds the references to capture groups in a replacement, as
+// $1 or ${1}.
+var groupRefs = regexp.MustCompile(`\$(\d+)|\$\{(\d+)\}`)
+
+// relabelPanel is a form building a call of label_replace or label_join
+// from named fields, which wraps the selection, or the whole query.
+type relabelPanel struct {
+	fn          widget.Enum
+	dst         widget.Editor
+	replacement widget.Editor
+	regex       widget.Editor
+	separator   widget.Editor
+	// src is the source label of label_replace, or the source labels of
+	// label_join, separated by commas.
+	src    widget.Editor
+	insert widget.Clickable
+	status string
+}
+
+func newRelabelPanel() *relabelPanel {
+	r := &relabelPanel{}
+	r.fn.Value = labelReplace
+	for _, ed := range []*widget.Editor{&r.dst, &r.replacement, &r.regex, &r.separator, &r.src} {
+		ed.SingleLine = true
+	}
+	r.replacement.SetText("$1")
+	r.regex.SetText("(.*)")
+	r.separator.SetText(",")
+	return r
+}
+
+// Focused reports whether one of the panel's fields has focus.
+func (r *relabelPanel) Focused() bool {
+	return r.dst.Focused() || r.replacement.Focused() || r.regex.Focused() || r.separator.Focused() || r.src.Focused()
+}
+
+// Inserted returns the macro wrapping the query in the call built, if
+// insert has been clicked and the fields are valid. Otherwise the status
+// says what is wrong with them.
+func (r *relabelPanel) Inserted() (macro, bool) {
+	if !r.insert.Clicked() {
+		return nil, false
+	}
+	args, err := r.args()
+	if err != nil {
+		r.status = err.Error()
+		return nil, false
+	}
+	r.status = ""
+	fn := r.fn.Value
+	return func(text string, start, end int) (string, int, int) {
+		start, end = selectionOrAll(text, start, end)
+		call := fn + "(" + strings.TrimSpace(text[start:end]) + ", " + args + ")"
+		return text[:start] + call + text[end:], start, start + len(call)
+	}, true
+}
+
+// args are the arguments of the call after the vector, each quoted, or
+// the reason the fields do not make a valid call.
+func (r *relabelPanel) args() (string, error) {
+	dst := strings.TrimSpace(r.dst.Text())
+	if dst == "" {
+		return "", fmt.Errorf("the destination label is missing")
+	}
+	quote := func(s string) string { return (&promql.StringLiteral{Val: s}).String() }
+	if r.fn.Value == labelJoin {
+		var srcs []string
+		for _, s := range strings.Split(r.src.Text(), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				srcs = append(srcs, quote(s))
+			}
+		}
+		if len(srcs) == 0 {
+			return "", fmt.Errorf("label_join needs at least one source label")
+		}
+		return strings.Join(append([]string{quote(dst), quote(r.separator.Text())}, srcs...), ", "), nil
+	}
+	// The server anchors the regex at both ends.
+	re, err := regexp.Compile("^(?:" + r.regex.Text() + ")$")
+	if err != nil {
+		return "", fmt.Errorf("bad regex: %w", err)
+	}
+	for _, m := range groupRefs.FindAllStringSubmatch(r.replacement.Text(), -1) {
+		ref := m[1] + m[2]
+		if n, _ := strconv.Atoi(ref); n > re.NumSubexp() {
+			return "", fmt.Errorf("the replacement refers to group $%s, but the regex has %d", ref, re.NumSubexp())
+		}
+	}
+	args := []string{quote(dst), quote(r.replacement.Text()), quote(strings.TrimSpace(r.src.Text())), quote(r.regex.Text())}
+	return strings.Join(args, ", "), nil
+}
+
+func (r *relabelPanel) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	join := r.fn.Value == labelJoin
+	field := func(ed *widget.Editor, hint string, width unit.Value) layout.FlexChild {
+		return layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, func(gtx C) D {
+				gtx.Constraints.Max.X = gtx.Px(width)
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				e := material.Editor(th, ed, hint)
+				e.Font.Variant = "Mono"
+				return e.Layout(gtx)
+			})
+		})
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(material.RadioButton(th, &r.fn, labelReplace, labelReplace).Layout),
+		layout.Rigid(material.RadioButton(th, &r.fn, labelJoin, labelJoin).Layout),
+		field(&r.dst, "destination label", unit.Dp(120)),
+	}
+	if join {
+		children = append(children,
+			field(&r.separator, "separator", unit.Dp(60)),
+			field(&r.src, "source labels, a, b", unit.Dp(160)),
+		)
+	} else {
+		children = append(children,
+			field(&r.replacement, "replacement", unit.Dp(100)),
+			field(&r.src, "source label", unit.Dp(100)),
+			field(&r.regex, "regex", unit.Dp(140)),
+		)
+	}
+	children = append(children,
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &r.insert, "wrap query").Layout)
+		}),
+		layout.Flexed(1, func(gtx C) D {
+			label := material.Caption(th, r.status)
+			label.Color = palette["red"]
+			return inset.Layout(gtx, label.Layout)
+		}),
+	)
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// resultPath is where a result exported at t in the format ext is saved.
+// Gio has no file dialog, so it goes in the working directory.
+func resultPath(t time.Time, ext string) string {
+	return "binnacle-result-" + t.Format("20060102-150405") + "." + ext
+}
+
+// resultCSV writes the instant vector v as comma-separated values, with a
+// column for each label of any series, named as the label is, then one
+// for the value.
+func resultCSV(v model.Value) ([]byte, error) {
+	vec, ok := v.(model.Vector)
+	if !ok || len(vec) == 0 {
+		return nil, errors.New("there is no instant vector to export as CSV")
+	}
+	metrics := make([]model.Metric, len(vec))
+	for i, s := range vec {
+		metrics[i] = s.Metric
+	}
+	names := columnLabels(metrics)
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	header := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		header = append(header, string(name))
+	}
+	w.Write(append(header, "value"))
+	for _, s := range vec {
+		row := make([]string, 0, len(names)+1)
+		for _, name := range names {
+			row = append(row, string(s.Metric[name]))
+		}
+		w.Write(append(row, strconv.FormatFloat(float64(s.Value), 'g', -1, 64)))
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// resultJSON writes v as the data of a response from the query API, its
+// type along with the result as Prometheus encodes it.
+func resultJSON(v model.Value) ([]byte, error) {
+	if !exportable(v) {
+		return nil, errors.New("there is no result to export as JSON")
+	}
+	return json.MarshalIndent(struct {
+		Type   model.ValueType `json:"resultType"`
+		Result model.Value     `json:"result"`
+	}{v.Type(), v}, "", "  ")
+}
+
+// exportable reports whether v is a result with something in it.
+func exportable(v model.Value) bool {
+	switch v := v.(type) {
+	case model.Vector:
+		return len(v) > 0
+	case model.Matrix:
+		return len(v) > 0
+	case *model.Scalar, *model.String:
+		return true
+	}
+	return false
+}
+
+// exportFormats reports whether v can be exported as CSV and as JSON,
+// neither unless enabled is set.
+func exportFormats(v model.Value, enabled bool) (asCSV, asJSON bool) {
+	_, vector := v.(model.Vector)
+	asJSON = enabled && exportable(v)
+	return asJSON && vector, asJSON
+}
+
+// resultExport saves the result on display to a file, as CSV if it is an
+// instant vector or else as JSON.
+type resultExport struct {
+	csv, json widget.Clickable
+	status    string
+}
+
+// Export saves v if one of the buttons was clicked while it could be,
+// reporting the path saved at or why it could not be saved.
+func (e *resultExport) Export(v model.Value, enabled bool, now time.Time) {
+	clickedCSV, clickedJSON := e.csv.Clicked(), e.json.Clicked()
+	canCSV, canJSON := exportFormats(v, enabled)
+	save := func(ext string, encode func(model.Value) ([]byte, error)) {
+		data, err := encode(v)
+		if err == nil {
+			path := resultPath(now, ext)
+			if err = ioutil.WriteFile(path, data, 0644); err == nil {
+				e.status = "saved " + path
+				return
+			}
+		}
+		e.status = fmt.Sprintf("could not export result: %v", err)
+	}
+	switch {
+	case clickedCSV && canCSV:
+		save("csv", resultCSV)
+	case clickedJSON && canJSON:
+		save("json", resultJSON)
+	}
+}
+
+// Layout shows the buttons exporting v, greyed out unless enabled is set
+// and v can be exported so.
+func (e *resultExport) Layout(gtx C, th *material.Theme, inset layout.Inset, v model.Value, enabled bool) D {
+	button := func(b *widget.Clickable, label string, ok bool) layout.FlexChild {
+		return layout.Rigid(func(gtx C) D {
+			style := material.Button(th, b, label)
+			if !ok {
+				style.Background = palette["gray"]
+			}
+			return inset.Layout(gtx, style.Layout)
+		})
+	}
+	canCSV, canJSON := exportFormats(v, enabled)
+	children := []layout.FlexChild{
+		button(&e.csv, "save CSV", canCSV),
+		button(&e.json, "save JSON", canJSON),
+	}
+	if e.status != "" {
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Caption(th, e.status).Layout)
+		}))
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
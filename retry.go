@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// RetryPolicy controls how queries that fail to reach the server are
+// retried.
+type RetryPolicy struct {
+	// Retries is the number of times a query is retried after its first
+	// attempt fails. Zero disables retrying.
+	Retries int
+	// Backoff is the delay before the first retry. It doubles with each
+	// subsequent retry.
+	Backoff time.Duration
+}
+
+// Do calls try until it succeeds, fails with an error other than a
+// connection error, or the retries are exhausted. Retries never extend
+// past the deadline of ctx: if the next backoff would end after it, the
+// last error is returned immediately. onRetry, if not nil, is called
+// with the number of each retry before waiting for its backoff.
+func (p RetryPolicy) Do(ctx context.Context, onRetry func(retry int), try func() error) error {
+	backoff := p.Backoff
+	for retry := 1; ; retry++ {
+		err := try()
+		if err == nil || retry > p.Retries || !isConnectionError(ctx, err) {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(retry)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isConnectionError reports whether err came from failing to talk to the
+// server rather than from the server rejecting the query.
+func isConnectionError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails the first failures round trips as though the
+// server could not be reached, and answers the rest with status.
+type flakyTransport struct {
+	failures int
+	status   int
+	attempts int
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.attempts++
+	if f.attempts <= f.failures {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return &http.Response{
+		StatusCode: f.status,
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+// get returns a try function for RetryPolicy.Do that queries through
+// the transport.
+func (f *flakyTransport) get(ctx context.Context) func() error {
+	client := &http.Client{Transport: f}
+	return func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://prometheus/api/v1/query", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("server returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		retries      int
+		failures     int
+		status       int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"succeeds at once", 3, 0, http.StatusOK, false, 1},
+		{"succeeds on a retry", 3, 2, http.StatusOK, false, 3},
+		{"retries exhausted", 2, 5, http.StatusOK, true, 3},
+		{"retrying disabled", 0, 1, http.StatusOK, true, 1},
+		{"query rejected", 3, 0, http.StatusBadRequest, true, 1},
+		{"rejected after a retry", 3, 1, http.StatusBadRequest, true, 2},
+	} {
+		f := &flakyTransport{failures: tt.failures, status: tt.status}
+		var retries []int
+		p := RetryPolicy{Retries: tt.retries, Backoff: time.Millisecond}
+		err := p.Do(context.Background(), func(retry int) { retries = append(retries, retry) }, f.get(context.Background()))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Do() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if f.attempts != tt.wantAttempts {
+			t.Errorf("%s: %d attempts, want %d", tt.name, f.attempts, tt.wantAttempts)
+		}
+		if len(retries) != tt.wantAttempts-1 {
+			t.Errorf("%s: onRetry called with %v, want %d retries", tt.name, retries, tt.wantAttempts-1)
+		}
+		for i, r := range retries {
+			if r != i+1 {
+				t.Errorf("%s: onRetry called with %v, want 1, 2, ...", tt.name, retries)
+				break
+			}
+		}
+	}
+}
+
+func TestRetryPolicyDoStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &flakyTransport{failures: 10, status: http.StatusOK}
+	p := RetryPolicy{Retries: 5, Backoff: time.Hour}
+	done := make(chan error)
+	go func() {
+		done <- p.Do(ctx, func(int) { cancel() }, f.get(ctx))
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Do() succeeded after cancellation")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Do() kept waiting to retry after cancellation")
+	}
+	if f.attempts != 1 {
+		t.Errorf("%d attempts, want 1", f.attempts)
+	}
+}
+
+func TestRetryPolicyDoRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	f := &flakyTransport{failures: 10, status: http.StatusOK}
+	p := RetryPolicy{Retries: 5, Backoff: time.Hour}
+	if err := p.Do(ctx, nil, f.get(ctx)); err == nil {
+		t.Error("Do() succeeded, want the connection error")
+	}
+	if f.attempts != 1 {
+		t.Errorf("%d attempts, want 1 as the backoff ends after the deadline", f.attempts)
+	}
+}
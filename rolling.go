@@ -0,0 +1,96 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// rollingSubquery returns query as a subquery at a fixed step, like
+// rate(foo[5m])[1h:15s], whose points fall on multiples of the step and so
+// stay the same from one evaluation to the next. A live chart of such a
+// query can be refreshed with just the steps since it was last evaluated.
+func rollingSubquery(query string) (*promql.SubqueryExpr, bool) {
+	e, err := promql.Parse(query)
+	if err != nil {
+		return nil, false
+	}
+	sub, ok := e.(*promql.SubqueryExpr)
+	if !ok || sub.Step <= 0 || sub.Offset != 0 || sub.At != nil {
+		return nil, false
+	}
+	return sub, true
+}
+
+// rollingQuery is the subquery sub narrowed to the steps from since to
+// now, with one step more in case the server leaves out the first, or
+// false if that would be no narrower.
+func rollingQuery(sub *promql.SubqueryExpr, since, now time.Time) (string, bool) {
+	steps := (now.Sub(since) + sub.Step - 1) / sub.Step
+	rng := (steps + 1) * sub.Step
+	if rng >= sub.Range {
+		return "", false
+	}
+	narrow := *sub
+	narrow.Range = rng
+	return narrow.String(), true
+}
+
+// rollingWindow is the last result of a rolling subquery in a pane, to
+// which the points of each refresh are added.
+type rollingWindow struct {
+	query string
+	at    time.Time
+	rng   time.Duration
+	step  time.Duration
+	data  model.Matrix
+}
+
+// rolls reports whether the window holds a result of query to extend.
+func (w *rollingWindow) rolls(query string) bool {
+	return w.data != nil && w.query == query
+}
+
+// due reports whether a step has begun since the window was evaluated,
+// so that a refresh would add a point.
+func (w *rollingWindow) due(now time.Time) bool {
+	return now.Truncate(w.step).After(w.at.Truncate(w.step))
+}
+
+// mergeWindow adds to each series of old the points of the same series in
+// recent after its last, and the series new in recent, then drops the
+// points before from and the series left with none. Neither matrix is
+// modified.
+func mergeWindow(old, recent model.Matrix, from model.Time) model.Matrix {
+	index := map[model.Fingerprint]int{}
+	merged := make(model.Matrix, 0, len(old)+len(recent))
+	for _, s := range old {
+		index[s.Metric.Fingerprint()] = len(merged)
+		merged = append(merged, &model.SampleStream{Metric: s.Metric, Values: s.Values[:len(s.Values):len(s.Values)]})
+	}
+	for _, s := range recent {
+		i, ok := index[s.Metric.Fingerprint()]
+		if !ok {
+			merged = append(merged, &model.SampleStream{Metric: s.Metric, Values: s.Values})
+			continue
+		}
+		m := merged[i]
+		for _, p := range s.Values {
+			if n := len(m.Values); n == 0 || p.Timestamp > m.Values[n-1].Timestamp {
+				m.Values = append(m.Values, p)
+			}
+		}
+	}
+	kept := merged[:0]
+	for _, s := range merged {
+		first := 0
+		for first < len(s.Values) && s.Values[first].Timestamp < from {
+			first++
+		}
+		if s.Values = s.Values[first:]; len(s.Values) > 0 {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
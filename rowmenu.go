@@ -0,0 +1,170 @@
+package main
+
+import (
+	"image"
+	"math"
+	"sort"
+	"strconv"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// The actions of the context menu of a result row.
+const (
+	actionCopyRow = iota
+	actionQuerySeries
+	actionQueryRange
+	actionAddMatcher
+	actionMetadata
+	actionPin
+	actionFilterValue
+)
+
+// maxMenuLabels is the most labels of a series offered to add to the
+// query.
+const maxMenuLabels = 8
+
+// seriesRange is the range of the query for a single series.
+const seriesRange = "[1h]"
+
+// seriesSelector is the selector matching exactly the labels of m, with
+// names that are not classic identifiers quoted.
+func seriesSelector(m model.Metric) string {
+	vs := promql.VectorSelector{Name: string(m[model.MetricNameLabel])}
+	var names model.LabelNames
+	for name := range m {
+		if name != model.MetricNameLabel {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(names)
+	for _, name := range names {
+		vs.Matchers = append(vs.Matchers, &promql.Matcher{Name: string(name), Type: promql.MatchEqual, Value: string(m[name])})
+	}
+	return vs.String()
+}
+
+type menuItem struct {
+	text   string
+	action int
+	// label is the label added by actionAddMatcher, and cond the
+	// comparison added by actionFilterValue.
+	label model.LabelName
+	cond  string
+}
+
+// rowMenu is the context menu of a result row, opened by right-clicking
+// it and closed by choosing an item or clicking anywhere else.
+type rowMenu struct {
+	// index is the row the menu is open on, if open, and pos where it
+	// was clicked within the row.
+	open  bool
+	index int
+	row   textRow
+	pos   f32.Point
+	items []menuItem
+	click []widget.Clickable
+}
+
+// Open opens the menu on the row at index, at pos within it.
+func (m *rowMenu) Open(index int, row textRow, pos f32.Point) {
+	m.open, m.index, m.row, m.pos = true, index, row, pos
+	m.items = []menuItem{{text: "copy row", action: actionCopyRow}}
+	if row.Metric != nil {
+		m.items = append(m.items,
+			menuItem{text: "query this series", action: actionQuerySeries},
+			menuItem{text: "query this series" + seriesRange, action: actionQueryRange},
+			menuItem{text: "pin this series", action: actionPin},
+		)
+		var names model.LabelNames
+		for name := range row.Metric {
+			if name != model.MetricNameLabel {
+				names = append(names, name)
+			}
+		}
+		sort.Sort(names)
+		for i, name := range names {
+			if i == maxMenuLabels {
+				break
+			}
+			matcher := model.LabelSet{name: row.Metric[name]}.String()
+			m.items = append(m.items, menuItem{text: "add " + matcher[1:len(matcher)-1] + " to the query", action: actionAddMatcher, label: name})
+		}
+		// Only samples of instant vectors have a time of their own, and
+		// only instant vectors can be filtered by comparison.
+		if row.At != 0 && row.Value != "" && !row.Gone && !math.IsNaN(row.Num) {
+			cond := "> " + strconv.FormatFloat(row.Num, 'g', -1, 64)
+			m.items = append(m.items, menuItem{text: "only show values " + cond, action: actionFilterValue, cond: cond})
+		}
+		if _, ok := row.Metric[model.MetricNameLabel]; ok {
+			m.items = append(m.items, menuItem{text: "show metadata", action: actionMetadata})
+		}
+	}
+	m.click = make([]widget.Clickable, len(m.items))
+}
+
+// Chosen returns the item chosen, if any, closing the menu.
+func (m *rowMenu) Chosen() (menuItem, bool) {
+	for i := range m.click {
+		if m.click[i].Clicked() && m.open {
+			m.open = false
+			return m.items[i], true
+		}
+	}
+	return menuItem{}, false
+}
+
+// Layout draws the menu over everything else, if it is open on the row
+// at index, which has just been laid out.
+func (m *rowMenu) Layout(gtx C, th *material.Theme, index int) {
+	for _, e := range gtx.Events(m) {
+		if e, ok := e.(pointer.Event); ok && e.Type == pointer.Press {
+			m.open = false
+		}
+	}
+	if !m.open || index != m.index {
+		return
+	}
+	macro := op.Record(gtx.Ops)
+	// Clicks anywhere outside the menu close it.
+	stack := op.Save(gtx.Ops)
+	pointer.Rect(image.Rect(-1<<20, -1<<20, 1<<20, 1<<20)).Add(gtx.Ops)
+	pointer.InputOp{Tag: m, Types: pointer.Press}.Add(gtx.Ops)
+	stack.Load()
+	op.Offset(m.pos).Add(gtx.Ops)
+	gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Px(unit.Dp(400)), gtx.Px(unit.Dp(600)))}
+	layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx C) D {
+			paint.FillShape(gtx.Ops, th.Bg, clip.Rect{Max: gtx.Constraints.Min}.Op())
+			return D{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx C) D {
+			return widget.Border{Width: unit.Dp(1), Color: th.Fg}.Layout(gtx, func(gtx C) D {
+				children := make([]layout.FlexChild, len(m.items))
+				for i := range m.items {
+					i := i
+					children[i] = layout.Rigid(func(gtx C) D {
+						return material.Clickable(gtx, &m.click[i], func(gtx C) D {
+							gtx.Constraints.Min.X = gtx.Constraints.Max.X
+							label := material.Body2(th, m.items[i].text)
+							label.Font.Variant = "Mono"
+							return layout.UniformInset(unit.Dp(4)).Layout(gtx, label.Layout)
+						})
+					})
+				}
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+			})
+		}),
+	)
+	op.Defer(gtx.Ops, macro.Stop())
+}
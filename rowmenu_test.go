@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+func TestSeriesSelectorQuotesNames(t *testing.T) {
+	for _, tt := range []struct {
+		metric model.Metric
+		want   string
+	}{
+		{model.Metric{"__name__": "up", "job": "api"}, `up{job="api"}`},
+		{model.Metric{"__name__": "my.metric", "job": "api"}, `{"my.metric", job="api"}`},
+		{model.Metric{"__name__": "up", "k8s.pod": "web-1", "zone": `"eu"`}, `up{"k8s.pod"="web-1", zone="\"eu\""}`},
+		{model.Metric{"ü": "ö"}, `{"ü"="ö"}`},
+	} {
+		got := seriesSelector(tt.metric)
+		if got != tt.want {
+			t.Errorf("seriesSelector(%v) = %s, want %s", tt.metric, got, tt.want)
+		}
+		// The selector must parse back to itself.
+		e, err := promql.Parse(got)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", got, err)
+		} else if e.String() != got {
+			t.Errorf("Parse(%s).String() = %s", got, e.String())
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"gioui.org/layout"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// RuleSource is a Source that can list the server's rules, as v1.API
+// does.
+type RuleSource interface {
+	Rules(ctx context.Context) (v1.RulesResult, error)
+}
+
+// errNoRules is returned by Rules when the Source in use cannot list
+// rules.
+var errNoRules = errors.New("rules are not supported by this source")
+
+// recordingRules returns the sorted names of the recording rules among
+// all the groups of rules.
+func recordingRules(rules v1.RulesResult) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, g := range rules.Groups {
+		for _, r := range g.Rules {
+			if r, ok := r.(v1.RecordingRule); ok && !seen[r.Name] {
+				seen[r.Name] = true
+				names = append(names, r.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// recorded reports whether every series selected by a parsed query is
+// the result of a recording rule, and so cheap to query. ok is false if
+// the query is empty or selects nothing.
+func recorded(expr promql.Expr, rules map[string]bool) (cheap, ok bool) {
+	if expr == nil {
+		return false, false
+	}
+	cheap = true
+	promql.Inspect(expr, func(n promql.Node) bool {
+		if vs, isSelector := n.(*promql.VectorSelector); isSelector {
+			ok = true
+			cheap = cheap && rules[vs.Name]
+		}
+		return true
+	})
+	return cheap && ok, ok
+}
+
+type rulesResponse struct {
+	names []string
+	err   error
+}
+
+// ruleList lists the server's recording rules, fetched in the background
+// when first shown, so that one can be queried with a click.
+type ruleList struct {
+	fetcher latest.Worker
+	// fetched is set once the rules have been requested, and pending
+	// until they arrive.
+	fetched, pending bool
+	names            []string
+	known            map[string]bool
+	err              string
+	clicks           []widget.Clickable
+	list             layout.List
+}
+
+func newRuleList(b *Backend) *ruleList {
+	l := &ruleList{}
+	l.list.Axis = layout.Horizontal
+	l.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		src, ok := b.Source.(RuleSource)
+		if !ok {
+			return rulesResponse{err: errNoRules}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		defer cancel()
+		rules, err := src.Rules(ctx)
+		return rulesResponse{names: recordingRules(rules), err: viewError(err)}
+	})
+	return l
+}
+
+// Fetch requests the rules, unless they have been already.
+func (l *ruleList) Fetch() {
+	if l.fetched {
+		return
+	}
+	l.fetched, l.pending = true, true
+	l.fetcher.Push(struct{}{})
+}
+
+// Results is the channel the rules arrive on once fetched, each to be
+// passed to Receive.
+func (l *ruleList) Results() <-chan interface{} {
+	return l.fetcher.Raw()
+}
+
+// Receive takes in the rules received from Results.
+func (l *ruleList) Receive(r interface{}) {
+	resp := r.(rulesResponse)
+	l.pending = false
+	if resp.err != nil {
+		l.err = resp.err.Error()
+		return
+	}
+	l.err = ""
+	l.names = resp.names
+	l.known = map[string]bool{}
+	for _, name := range l.names {
+		l.known[name] = true
+	}
+	l.clicks = make([]widget.Clickable, len(l.names))
+}
+
+// Recorded reports whether a parsed query reads only recording rules, as
+// recorded does, with ok false until the rules are known.
+func (l *ruleList) Recorded(expr promql.Expr) (cheap, ok bool) {
+	if l.known == nil {
+		return false, false
+	}
+	return recorded(expr, l.known)
+}
+
+// Clicked returns the name of the rule clicked, if any.
+func (l *ruleList) Clicked() (string, bool) {
+	for i := range l.clicks {
+		if l.clicks[i].Clicked() {
+			return l.names[i], true
+		}
+	}
+	return "", false
+}
+
+// Layout shows the names of the rules, each of which can be clicked.
+func (l *ruleList) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	if l.pending {
+		return inset.Layout(gtx, material.Caption(th, "fetching rules…").Layout)
+	}
+	if l.err != "" {
+		return inset.Layout(gtx, material.Caption(th, l.err).Layout)
+	}
+	if len(l.names) == 0 {
+		return inset.Layout(gtx, material.Caption(th, "no recording rules").Layout)
+	}
+	return l.list.Layout(gtx, len(l.names), func(gtx C, index int) D {
+		return inset.Layout(gtx, func(gtx C) D {
+			label := material.Body2(th, l.names[index])
+			label.Font.Variant = "Mono"
+			label.Color = th.ContrastBg
+			return material.Clickable(gtx, &l.clicks[index], label.Layout)
+		})
+	})
+}
+
+// layoutCost shows whether the query reads only recording rules, as
+// found by Recorded, if that is known. It is laid out whether or not the
+// list is.
+func layoutCost(gtx C, th *material.Theme, inset layout.Inset, cheap, ok bool) D {
+	if !ok {
+		return D{}
+	}
+	label := "raw computation"
+	if cheap {
+		label = "recording rule"
+	}
+	return inset.Layout(gtx, material.Caption(th, label).Layout)
+}
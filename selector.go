@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// matchOps are the matcher operators in the order that a matcher's
+// operator button cycles through them.
+var matchOps = []string{"=", "!=", "=~", "!~"}
+
+// matcherToken returns the operator op followed by the PromQL string
+// that makes a matcher compare the label value raw literally. Regular
+// expression operators need its metacharacters escaped; all need its
+// quotes and backslashes escaped within the string.
+func matcherToken(op, raw string) string {
+	if op == "=~" || op == "!~" {
+		raw = regexp.QuoteMeta(raw)
+	}
+	return op + strconv.Quote(raw)
+}
+
+// matcherRow is a single label matcher of a selectorBuilder.
+type matcherRow struct {
+	name, value widget.Editor
+	op          int
+	opButton    widget.Clickable
+	remove      widget.Clickable
+	// suggested is the label value last inserted from a suggestion. While
+	// the value editor still holds it, it is compared literally whatever
+	// the operator; anything else typed there is taken as written, as a
+	// regular expression for =~ and !~.
+	suggested string
+}
+
+func newMatcherRow() *matcherRow {
+	r := &matcherRow{}
+	r.name.SingleLine = true
+	r.value.SingleLine = true
+	return r
+}
+
+// labelRequest asks for the values of the named label, or for the label
+// names if Name is empty.
+type labelRequest struct {
+	Name string
+}
+
+type labelResponse struct {
+	labelRequest
+	Values []string
+	Err    error
+}
+
+// selectorBuilder is a form for assembling a series selector from label
+// matchers, suggesting the label names and values known to the server.
+type selectorBuilder struct {
+	rows    []*matcherRow
+	add     widget.Clickable
+	insert  widget.Clickable
+	rowList layout.List
+
+	fetcher latest.Worker
+	// requested is the most recent request sent to fetcher, which is
+	// pending until its response arrives.
+	requested labelRequest
+	pending   bool
+	names     []string
+	values    map[string][]string
+	err       string
+
+	// target is the most recently focused editor, which suggestions
+	// complete, and targetRow is its row.
+	target      *widget.Editor
+	targetRow   *matcherRow
+	suggestions []string
+	clicks      []widget.Clickable
+	suggestList layout.List
+}
+
+func newSelectorBuilder(b *Backend) *selectorBuilder {
+	s := &selectorBuilder{
+		rows:   []*matcherRow{newMatcherRow()},
+		values: map[string][]string{},
+	}
+	s.rowList.Axis = layout.Vertical
+	s.suggestList.Axis = layout.Horizontal
+	s.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		req := in.(labelRequest)
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		defer cancel()
+		resp := labelResponse{labelRequest: req}
+		if req.Name == "" {
+			resp.Values, _, resp.Err = b.Source.LabelNames(ctx, nil, time.Time{}, time.Time{})
+		} else {
+			values, _, err := b.Source.LabelValues(ctx, req.Name, nil, time.Time{}, time.Time{})
+			for _, v := range values {
+				resp.Values = append(resp.Values, string(v))
+			}
+			resp.Err = err
+		}
+		return resp
+	})
+	return s
+}
+
+// fetch requests the values of the named label, or the label names if
+// name is empty, unless they are already known.
+func (s *selectorBuilder) fetch(name string) {
+	if name == "" && s.names != nil {
+		return
+	}
+	if _, ok := s.values[name]; ok && name != "" {
+		return
+	}
+	req := labelRequest{Name: name}
+	if s.pending && s.requested == req {
+		return
+	}
+	s.requested = req
+	s.pending = true
+	s.fetcher.Push(req)
+}
+
+func (s *selectorBuilder) receive() {
+	select {
+	case r := <-s.fetcher.Raw():
+		resp := r.(labelResponse)
+		if resp.labelRequest == s.requested {
+			s.pending = false
+		}
+		// Failed lookups are remembered as empty so that they are
+		// not retried on every frame.
+		s.err = ""
+		if resp.Err != nil {
+			s.err = resp.Err.Error()
+			resp.Values = []string{}
+		}
+		if resp.Name == "" {
+			s.names = resp.Values
+		} else {
+			s.values[resp.Name] = resp.Values
+		}
+	default:
+	}
+}
+
+// Selector assembles the selector described by the form. Matchers
+// without a label name are ignored.
+func (s *selectorBuilder) Selector() string {
+	var matchers []string
+	for _, r := range s.rows {
+		name := strings.TrimSpace(r.name.Text())
+		if name == "" {
+			continue
+		}
+		if !promql.IsLabelName(name) {
+			name = strconv.Quote(name)
+		}
+		op, value := matchOps[r.op], r.value.Text()
+		if value == r.suggested {
+			matchers = append(matchers, name+matcherToken(op, value))
+		} else {
+			matchers = append(matchers, name+op+strconv.Quote(value))
+		}
+	}
+	return "{" + strings.Join(matchers, ", ") + "}"
+}
+
+// Focused reports whether one of the form's editors has focus.
+func (s *selectorBuilder) Focused() bool {
+	for _, r := range s.rows {
+		if r.name.Focused() || r.value.Focused() {
+			return true
+		}
+	}
+	return false
+}
+
+// Inserted reports whether the user asked to insert the selector.
+func (s *selectorBuilder) Inserted() bool {
+	return s.insert.Clicked()
+}
+
+func (s *selectorBuilder) update() {
+	s.receive()
+	if s.add.Clicked() {
+		s.rows = append(s.rows, newMatcherRow())
+	}
+	for i := 0; i < len(s.rows); i++ {
+		r := s.rows[i]
+		if r.opButton.Clicked() {
+			r.op = (r.op + 1) % len(matchOps)
+		}
+		if r.remove.Clicked() && len(s.rows) > 1 {
+			if s.targetRow == r {
+				s.target, s.targetRow = nil, nil
+			}
+			s.rows = append(s.rows[:i], s.rows[i+1:]...)
+			i--
+			continue
+		}
+		if r.name.Focused() {
+			s.target, s.targetRow = &r.name, r
+		} else if r.value.Focused() {
+			s.target, s.targetRow = &r.value, r
+		}
+	}
+	for i := range s.suggestions {
+		if i < len(s.clicks) && s.clicks[i].Clicked() && s.target != nil {
+			text := s.suggestions[i]
+			if s.target == &s.targetRow.value {
+				s.targetRow.suggested = text
+			}
+			s.target.SetText(text)
+			n := len(text)
+			s.target.SetCaret(n, n)
+			s.target.Focus()
+		}
+	}
+
+	// Suggest names or values beginning with what has been typed.
+	var candidates []string
+	s.fetch("")
+	switch {
+	case s.target == nil:
+	case s.target == &s.targetRow.name:
+		candidates = s.names
+	default:
+		name := strings.TrimSpace(s.targetRow.name.Text())
+		if name != "" {
+			s.fetch(name)
+			candidates = s.values[name]
+		}
+	}
+	s.suggestions = s.suggestions[:0]
+	if s.target != nil && s.target == &s.targetRow.value && strings.TrimSpace(s.targetRow.name.Text()) == model.MetricNameLabel && s.target.Text() != "" {
+		// Metric names are long enough that their exact prefix is
+		// easily forgotten, so they are matched fuzzily.
+		typed := s.target.Text()
+		for _, c := range fuzzyRank(typed, candidates) {
+			if c != typed {
+				s.suggestions = append(s.suggestions, c)
+			}
+		}
+	} else if s.target != nil {
+		prefix := s.target.Text()
+		for _, c := range candidates {
+			if strings.HasPrefix(c, prefix) && c != prefix {
+				s.suggestions = append(s.suggestions, c)
+			}
+		}
+	}
+	if len(s.clicks) < len(s.suggestions) {
+		s.clicks = make([]widget.Clickable, len(s.suggestions))
+	}
+}
+
+func (s *selectorBuilder) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	s.update()
+	if s.pending {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	}
+	field := func(ed *widget.Editor, hint string) layout.Widget {
+		return func(gtx C) D {
+			return widget.Border{Width: unit.Dp(1), Color: th.Fg}.Layout(gtx, func(gtx C) D {
+				return inset.Layout(gtx, func(gtx C) D {
+					gtx.Constraints.Min.X = gtx.Constraints.Max.X
+					e := material.Editor(th, ed, hint)
+					e.Font.Variant = "Mono"
+					return e.Layout(gtx)
+				})
+			})
+		}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx C) D {
+			return s.rowList.Layout(gtx, len(s.rows), func(gtx C, index int) D {
+				r := s.rows[index]
+				return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(.5, func(gtx C) D {
+						return inset.Layout(gtx, field(&r.name, "label"))
+					}),
+					layout.Rigid(func(gtx C) D {
+						return inset.Layout(gtx, material.Button(th, &r.opButton, matchOps[r.op]).Layout)
+					}),
+					layout.Flexed(.5, func(gtx C) D {
+						return inset.Layout(gtx, field(&r.value, "value"))
+					}),
+					layout.Rigid(func(gtx C) D {
+						return inset.Layout(gtx, material.Button(th, &r.remove, "remove").Layout)
+					}),
+				)
+			})
+		}),
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &s.add, "add matcher").Layout)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &s.insert, "insert "+s.Selector()).Layout)
+				}),
+				layout.Rigid(func(gtx C) D {
+					if s.err == "" {
+						return D{}
+					}
+					return inset.Layout(gtx, material.Caption(th, s.err).Layout)
+				}),
+			)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return s.suggestList.Layout(gtx, len(s.suggestions), func(gtx C, index int) D {
+				return inset.Layout(gtx, func(gtx C) D {
+					label := material.Body2(th, s.suggestions[index])
+					label.Font.Variant = "Mono"
+					label.Color = th.ContrastBg
+					return material.Clickable(gtx, &s.clicks[index], label.Layout)
+				})
+			})
+		}),
+	)
+}
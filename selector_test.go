@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestMatcherToken(t *testing.T) {
+	for _, tt := range []struct {
+		op, raw, want string
+	}{
+		{"=", "api", `="api"`},
+		{"!=", "", `!=""`},
+		{"=", `say "hi"`, `="say \"hi\""`},
+		{"=", `C:\temp`, `="C:\\temp"`},
+		{"=~", `C:\temp`, `=~"C:\\\\temp"`},
+		{"=~", "a.b", `=~"a\\.b"`},
+		{"!~", "/api/(v1|v2)/*", `!~"/api/\\(v1\\|v2\\)/\\*"`},
+		{"=~", "[0-9]+?^$", `=~"\\[0-9\\]\\+\\?\\^\\$"`},
+		{"=~", `"{x}"`, `=~"\"\\{x\\}\""`},
+		{"=", "ü\n", `="ü\n"`},
+	} {
+		if got := matcherToken(tt.op, tt.raw); got != tt.want {
+			t.Errorf("matcherToken(%q, %q) = %s, want %s", tt.op, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorKeepsSuggestionRaw(t *testing.T) {
+	s := &selectorBuilder{rows: []*matcherRow{newMatcherRow(), newMatcherRow()}}
+	s.rows[0].name.SetText("job")
+	s.rows[0].value.SetText("a.b")
+	s.rows[0].suggested = "a.b"
+	s.rows[1].name.SetText("my.label")
+	s.rows[1].value.SetText("x|y")
+
+	for _, tt := range []struct {
+		op   int
+		want string
+	}{
+		{0, `{job="a.b", "my.label"="x|y"}`},
+		{1, `{job!="a.b", "my.label"!="x|y"}`},
+		// The suggestion is escaped for the regular expression
+		// operators, but what was typed is taken as a regular
+		// expression.
+		{2, `{job=~"a\\.b", "my.label"=~"x|y"}`},
+		{3, `{job!~"a\\.b", "my.label"!~"x|y"}`},
+		// Cycling back to = must not leave the suggestion escaped.
+		{0, `{job="a.b", "my.label"="x|y"}`},
+	} {
+		for _, r := range s.rows {
+			r.op = tt.op
+		}
+		if got := s.Selector(); got != tt.want {
+			t.Errorf("Selector() with %s = %s, want %s", matchOps[tt.op], got, tt.want)
+		}
+	}
+
+	// Editing the suggestion makes it typed text.
+	s.rows[0].value.SetText("a.b.*")
+	s.rows[0].op = 2
+	if got, want := s.Selector(), `{job=~"a.b.*", "my.label"="x|y"}`; got != want {
+		t.Errorf("Selector() after editing = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// sharedPane is the latest result of a pane as served to others.
+type sharedPane struct {
+	cachedResult
+	Error string `json:"error,omitempty"`
+}
+
+// liveView serves the latest result of each pane as JSON, so that it can
+// be watched from elsewhere.
+type liveView struct {
+	mu    sync.Mutex
+	panes []*sharedPane
+}
+
+func newLiveView(panes int) *liveView {
+	return &liveView{panes: make([]*sharedPane, panes)}
+}
+
+// Set publishes the result shown by the pane with the given index.
+func (v *liveView) Set(index int, result queryResult) {
+	shared := &sharedPane{}
+	if result.error != nil || result.data == nil {
+		shared.Text, shared.Query, shared.Time = result.text, result.query, result.at
+		if result.error != nil {
+			shared.Error = result.Error()
+		}
+	} else {
+		cached, err := newCachedResult(result)
+		if err != nil {
+			slog.Warn("could not share result", "err", err)
+			return
+		}
+		shared.cachedResult = cached
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.panes[index] = shared
+}
+
+func (v *liveView) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v.mu.Lock()
+	data, err := json.Marshal(struct {
+		Panes []*sharedPane `json:"panes"`
+	}{v.panes})
+	v.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// maxSessionQueries bounds the queries each pane remembers for the
+	// session report.
+	maxSessionQueries = 200
+	// maxReportRows is the most series of a result written to a session
+	// report.
+	maxReportRows = 500
+)
+
+type sessionQuery struct {
+	text string
+	at   time.Time
+}
+
+// queryLog lists the queries whose results a pane has shown, oldest
+// first, leaving out a query run again straight after itself.
+type queryLog struct {
+	queries []sessionQuery
+}
+
+func (l *queryLog) Add(text string, at time.Time) {
+	if n := len(l.queries); n > 0 && l.queries[n-1].text == text {
+		l.queries[n-1].at = at
+		return
+	}
+	l.queries = append(l.queries, sessionQuery{text: text, at: at})
+	if len(l.queries) > maxSessionQueries {
+		l.queries = l.queries[len(l.queries)-maxSessionQueries:]
+	}
+}
+
+// sessionPath is where a session exported at t is saved.
+func sessionPath(t time.Time) string {
+	return "binnacle-session-" + t.Format("20060102-150405") + ".md"
+}
+
+// saveSessionReport writes a Markdown report of the panes' query history,
+// results and pinned series at path.
+func saveSessionReport(path string, panes []*pane, now time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# binnacle session\n\nExported %s.\n", now.Format(time.RFC3339))
+	for i, p := range panes {
+		title := ""
+		if len(panes) > 1 {
+			title = fmt.Sprintf(" %d", i+1)
+		}
+		p.report(&b, title)
+	}
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+	return nil
+}
+
+// mdCell escapes s for a cell of a Markdown table.
+func mdCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// mdInline is s as inline code in a cell of a Markdown table.
+func mdInline(s string) string {
+	s = mdCell(s)
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+// mdCode is s as a fenced Markdown code block.
+func mdCode(s, lang string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(s, "\n") + "\n" + fence + "\n"
+}
+
+// report writes the pane's section of a session report to b.
+func (p *pane) report(b *strings.Builder, title string) {
+	f := p.opts.Numbers
+	fmt.Fprintf(b, "\n## Pane%s\n\n### Query\n\n%s", title, mdCode(p.editor.Text(), "promql"))
+	b.WriteString("\n### Result\n\n")
+	if !p.evaluated.IsZero() {
+		fmt.Fprintf(b, "Evaluated at %s.\n\n", p.evaluated.Format(time.RFC3339))
+	}
+	switch v := p.renderer.Value.(type) {
+	case nil:
+		b.WriteString("No result.\n")
+	case model.Vector:
+		b.WriteString("| Series | Value | Timestamp |\n| --- | ---: | --- |\n")
+		for i, s := range v {
+			if i == maxReportRows {
+				fmt.Fprintf(b, "\nAnd %d more series.\n", len(v)-maxReportRows)
+				break
+			}
+			fmt.Fprintf(b, "| %s | %s | %s |\n", mdInline(s.Metric.String()), f.Format(float64(s.Value)), s.Timestamp.Time().UTC().Format(time.RFC3339))
+		}
+	case model.Matrix:
+		b.WriteString("| Series | Samples | Latest value | Latest timestamp |\n| --- | ---: | ---: | --- |\n")
+		for i, ss := range v {
+			if i == maxReportRows {
+				fmt.Fprintf(b, "\nAnd %d more series.\n", len(v)-maxReportRows)
+				break
+			}
+			if len(ss.Values) == 0 {
+				fmt.Fprintf(b, "| %s | 0 | | |\n", mdInline(ss.Metric.String()))
+				continue
+			}
+			last := ss.Values[len(ss.Values)-1]
+			fmt.Fprintf(b, "| %s | %d | %s | %s |\n", mdInline(ss.Metric.String()), len(ss.Values), f.Format(float64(last.Value)), last.Timestamp.Time().UTC().Format(time.RFC3339))
+		}
+	case *model.Scalar:
+		fmt.Fprintf(b, "| Value | Timestamp |\n| ---: | --- |\n| %s | %s |\n", f.Format(float64(v.Value)), v.Timestamp.Time().UTC().Format(time.RFC3339))
+	default:
+		b.WriteString(mdCode(v.String(), ""))
+	}
+	if p.errorText != "" {
+		fmt.Fprintf(b, "\nThe last query failed:\n\n%s", mdCode(p.errorText, ""))
+	}
+	if len(p.pinned.selectors) > 0 {
+		b.WriteString("\n### Pinned series\n\n| Series | Value |\n| --- | ---: |\n")
+		for _, sel := range p.pinned.selectors {
+			fmt.Fprintf(b, "| %s | %s |\n", mdInline(sel), mdCell(p.pinned.describe(sel, f)))
+		}
+	}
+	if len(p.queries.queries) > 0 {
+		b.WriteString("\n### Query history\n\n| Time | Query |\n| --- | --- |\n")
+		for _, q := range p.queries.queries {
+			at := ""
+			if !q.at.IsZero() {
+				at = q.at.Format("15:04:05")
+			}
+			fmt.Fprintf(b, "| %s | %s |\n", at, mdInline(q.text))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Settings are the preferences chosen in the UI that persist between
+// sessions.
+type Settings struct {
+	Compact bool `yaml:"compact"`
+	// Dark chooses the dark theme.
+	Dark bool `yaml:"dark,omitempty"`
+	// Keys rebinds keyboard shortcuts, mapping action names to chords
+	// such as "Ctrl+Shift+Z".
+	Keys map[string][]string `yaml:"keys,omitempty"`
+	// Presets are the view presets saved, by name.
+	Presets map[string]ViewPreset `yaml:"presets,omitempty"`
+}
+
+// settingsPath is the location of the settings file within the user's
+// configuration directory.
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "binnacle", "settings.yaml"), nil
+}
+
+// LoadSettings reads the saved settings. If none have been saved, the
+// zero Settings are returned.
+func LoadSettings() (Settings, error) {
+	var s Settings
+	path, err := settingsPath()
+	if err != nil {
+		return s, fmt.Errorf("could not locate settings: %w", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return s, fmt.Errorf("could not read settings: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("could not parse settings %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the settings so that later sessions load them.
+func (s Settings) Save() error {
+	path, err := settingsPath()
+	if err != nil {
+		return fmt.Errorf("could not locate settings: %w", err)
+	}
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("could not encode settings: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not save settings: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("could not save settings: %w", err)
+	}
+	return nil
+}
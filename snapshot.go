@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// snapshot is a named copy of a result, keyed by the fingerprint of each
+// series. A range result is recorded by the last value of each series.
+type snapshot struct {
+	name   string
+	query  string
+	series map[model.Fingerprint]snapshotSample
+}
+
+type snapshotSample struct {
+	metric model.Metric
+	value  float64
+}
+
+// takeSnapshot records the series of v, reporting false if v has none.
+func takeSnapshot(name, query string, v model.Value) (snapshot, bool) {
+	s := snapshot{name: name, query: query, series: map[model.Fingerprint]snapshotSample{}}
+	add := func(m model.Metric, v model.SampleValue) {
+		s.series[m.Fingerprint()] = snapshotSample{metric: m, value: float64(v)}
+	}
+	switch v := v.(type) {
+	case model.Vector:
+		for _, sample := range v {
+			add(sample.Metric, sample.Value)
+		}
+	case model.Matrix:
+		for _, ss := range v {
+			if len(ss.Values) > 0 {
+				add(ss.Metric, ss.Values[len(ss.Values)-1].Value)
+			}
+		}
+	case *model.Scalar:
+		add(model.Metric{}, v.Value)
+	}
+	return s, len(s.series) > 0
+}
+
+// The ways a series can differ between two snapshots.
+const (
+	seriesChanged = iota
+	seriesAppeared
+	seriesDisappeared
+)
+
+// seriesDiff is a series that differs between two snapshots. Its values
+// in each are from and to, of which only one is set unless it changed.
+type seriesDiff struct {
+	metric   model.Metric
+	kind     int
+	from, to float64
+}
+
+// diffSnapshots returns the series that differ from a to b, sorted by
+// their labels, and the number of those that do not.
+func diffSnapshots(a, b snapshot) (diffs []seriesDiff, unchanged int) {
+	for fp, sa := range a.series {
+		sb, ok := b.series[fp]
+		switch {
+		case !ok:
+			diffs = append(diffs, seriesDiff{metric: sa.metric, kind: seriesDisappeared, from: sa.value})
+		case sa.value == sb.value || math.IsNaN(sa.value) && math.IsNaN(sb.value):
+			unchanged++
+		default:
+			diffs = append(diffs, seriesDiff{metric: sa.metric, kind: seriesChanged, from: sa.value, to: sb.value})
+		}
+	}
+	for fp, sb := range b.series {
+		if _, ok := a.series[fp]; !ok {
+			diffs = append(diffs, seriesDiff{metric: sb.metric, kind: seriesAppeared, to: sb.value})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].metric.Before(diffs[j].metric)
+	})
+	return diffs, unchanged
+}
+
+// String describes d with its values formatted by f, marking appeared
+// series with +, disappeared ones with - and changed ones with ~.
+func (d seriesDiff) String(f NumberFormat) string {
+	switch d.kind {
+	case seriesAppeared:
+		return fmt.Sprintf("+ %s => %s", d.metric, f.Format(d.to))
+	case seriesDisappeared:
+		return fmt.Sprintf("- %s => %s", d.metric, f.Format(d.from))
+	}
+	delta := f.Format(d.to - d.from)
+	if d.to >= d.from {
+		delta = "+" + delta
+	}
+	return fmt.Sprintf("~ %s => %s → %s (%s)", d.metric, f.Format(d.from), f.Format(d.to), delta)
+}
+
+// maxDiffRows is the most differing series listed at once.
+const maxDiffRows = 20
+
+// snapshotPanel takes named snapshots of a pane's result and compares any
+// two of them. Snapshots are kept in memory for the session.
+type snapshotPanel struct {
+	name      widget.Editor
+	take      widget.Clickable
+	snapshots []snapshot
+	// a and b choose the snapshots to compare by name.
+	a, b   widget.Enum
+	status string
+}
+
+func newSnapshotPanel() *snapshotPanel {
+	s := &snapshotPanel{}
+	s.name.SingleLine = true
+	s.name.Submit = true
+	return s
+}
+
+// Focused reports whether the name of a snapshot is being edited.
+func (s *snapshotPanel) Focused() bool {
+	return s.name.Focused()
+}
+
+// Taking reports whether a snapshot should be taken, as when the button is
+// clicked or Enter is pressed in the name.
+func (s *snapshotPanel) Taking() bool {
+	submitted := false
+	for _, ev := range s.name.Events() {
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			submitted = true
+		}
+	}
+	return s.take.Clicked() || submitted
+}
+
+// Take records a snapshot of the result v of query, under the name typed
+// or else a numbered one, replacing any snapshot of the same name. The
+// new snapshot is compared with the one before it.
+func (s *snapshotPanel) Take(query string, v model.Value) {
+	name := strings.TrimSpace(s.name.Text())
+	if name == "" {
+		name = fmt.Sprintf("snapshot %d", len(s.snapshots)+1)
+	}
+	snap, ok := takeSnapshot(name, query, v)
+	if !ok {
+		s.status = "there is no result to snapshot"
+		return
+	}
+	s.status = ""
+	s.name.SetText("")
+	for i := range s.snapshots {
+		if s.snapshots[i].name == name {
+			s.snapshots = append(s.snapshots[:i], s.snapshots[i+1:]...)
+			break
+		}
+	}
+	s.snapshots = append(s.snapshots, snap)
+	if n := len(s.snapshots); n > 1 {
+		s.a.Value = s.snapshots[n-2].name
+	}
+	s.b.Value = name
+}
+
+func (s *snapshotPanel) find(name string) (snapshot, bool) {
+	for _, snap := range s.snapshots {
+		if snap.name == name {
+			return snap, true
+		}
+	}
+	return snapshot{}, false
+}
+
+// Layout shows the form for taking snapshots, a choice of the two to
+// compare and the series that differ between them.
+func (s *snapshotPanel) Layout(gtx C, th *material.Theme, inset layout.Inset, f NumberFormat) D {
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						gtx.Constraints.Max.X = gtx.Px(unit.Dp(160))
+						gtx.Constraints.Min.X = gtx.Constraints.Max.X
+						return material.Editor(th, &s.name, "snapshot name").Layout(gtx)
+					})
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &s.take, "snapshot").Layout)
+				}),
+				layout.Flexed(1, func(gtx C) D {
+					return inset.Layout(gtx, material.Caption(th, s.status).Layout)
+				}),
+			)
+		}),
+	}
+	if len(s.snapshots) > 1 {
+		children = append(children,
+			layout.Rigid(func(gtx C) D { return s.layoutChoice(gtx, th, inset, &s.a, "A") }),
+			layout.Rigid(func(gtx C) D { return s.layoutChoice(gtx, th, inset, &s.b, "B") }),
+		)
+	}
+	a, okA := s.find(s.a.Value)
+	b, okB := s.find(s.b.Value)
+	if okA && okB && a.name != b.name {
+		diffs, unchanged := diffSnapshots(a, b)
+		summary := fmt.Sprintf("%d differ, %d unchanged", len(diffs), unchanged)
+		if a.query != b.query {
+			summary += " (the snapshots are of different queries)"
+		}
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Caption(th, summary).Layout)
+		}))
+		for i, d := range diffs {
+			if i == maxDiffRows {
+				more := fmt.Sprintf("and %d more", len(diffs)-maxDiffRows)
+				children = append(children, layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Caption(th, more).Layout)
+				}))
+				break
+			}
+			d := d
+			children = append(children, layout.Rigid(func(gtx C) D {
+				label := material.Body2(th, d.String(f))
+				label.Font.Variant = "Mono"
+				label.MaxLines = 1
+				switch d.kind {
+				case seriesAppeared:
+					label.Color = palette["green"]
+				case seriesDisappeared:
+					label.Color = palette["red"]
+				}
+				return inset.Layout(gtx, label.Layout)
+			}))
+		}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
+
+func (s *snapshotPanel) layoutChoice(gtx C, th *material.Theme, inset layout.Inset, choice *widget.Enum, label string) D {
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Body2(th, label+":").Layout)
+		}),
+	}
+	for _, snap := range s.snapshots {
+		name := snap.name
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.RadioButton(th, choice, name, name).Layout)
+		}))
+	}
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx, children...)
+}
+
+// changedSeries returns the series of v whose values differ from those in
+// prev, or that are not in it, and the number of the rest left out.
+func changedSeries(v model.Value, prev snapshot) (model.Value, int) {
+	unchanged := func(m model.Metric, v model.SampleValue) bool {
+		s, ok := prev.series[m.Fingerprint()]
+		return ok && (s.value == float64(v) || math.IsNaN(s.value) && math.IsNaN(float64(v)))
+	}
+	hidden := 0
+	switch v := v.(type) {
+	case model.Vector:
+		changed := model.Vector{}
+		for _, s := range v {
+			if unchanged(s.Metric, s.Value) {
+				hidden++
+			} else {
+				changed = append(changed, s)
+			}
+		}
+		return changed, hidden
+	case model.Matrix:
+		changed := model.Matrix{}
+		for _, ss := range v {
+			if len(ss.Values) > 0 && unchanged(ss.Metric, ss.Values[len(ss.Values)-1].Value) {
+				hidden++
+			} else {
+				changed = append(changed, ss)
+			}
+		}
+		return changed, hidden
+	}
+	return v, 0
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// Source is the subset of the Prometheus API that Binnacle queries. It
+// is satisfied by v1.API as well as by recordings of earlier sessions.
+type Source interface {
+	Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error)
+	QueryExemplars(ctx context.Context, query string, startTime time.Time, endTime time.Time) ([]v1.ExemplarQueryResult, error)
+	LabelNames(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]string, v1.Warnings, error)
+	LabelValues(ctx context.Context, label string, matches []string, startTime time.Time, endTime time.Time) (model.LabelValues, v1.Warnings, error)
+	Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error)
+}
+
+// recordedResponse is a single line of a recording file. Range and Step
+// are in seconds, and set only for range queries, whose Time is the end
+// of the range.
+type recordedResponse struct {
+	Query    string          `json:"query"`
+	Time     time.Time       `json:"time"`
+	Range    float64         `json:"range,omitempty"`
+	Step     float64         `json:"step,omitempty"`
+	Type     model.ValueType `json:"resultType,omitempty"`
+	Result   json.RawMessage `json:"result"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// Recorder is a Source that appends every successful response from
+// another Source to a file so that it can be replayed later. Responses
+// that cannot be recorded are logged, and still returned.
+type Recorder struct {
+	Source
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder wraps src, appending its responses to the file at path.
+func NewRecorder(src Source, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open recording: %w", err)
+	}
+	return &Recorder{Source: src, file: f}, nil
+}
+
+func (r *Recorder) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	value, warnings, err := r.Source.Query(ctx, query, ts)
+	if err == nil {
+		r.record(recordedResponse{Query: query, Time: ts}, value, warnings)
+	}
+	return value, warnings, err
+}
+
+// QueryWith records the response like Query, if the wrapped Source can
+// pass query options.
+func (r *Recorder) QueryWith(ctx context.Context, query string, ts time.Time, opts queryOptions) (model.Value, v1.Warnings, *QueryStats, error) {
+	src, ok := r.Source.(OptionSource)
+	if !ok {
+		return nil, nil, nil, errNoOptions
+	}
+	value, warnings, stats, err := src.QueryWith(ctx, query, ts, opts)
+	if err == nil {
+		r.record(recordedResponse{Query: query, Time: ts}, value, warnings)
+	}
+	return value, warnings, stats, err
+}
+
+// FormatQuery forwards to the wrapped Source, if it can format queries.
+func (r *Recorder) FormatQuery(ctx context.Context, query string) (string, error) {
+	src, ok := r.Source.(FormatSource)
+	if !ok {
+		return "", errNoFormat
+	}
+	return src.FormatQuery(ctx, query)
+}
+
+// Curl forwards to the wrapped Source, if it can be queried with curl.
+func (r *Recorder) Curl(query string, opts queryOptions, secrets bool) (string, error) {
+	src, ok := r.Source.(CurlSource)
+	if !ok {
+		return "", errNoCurl
+	}
+	return src.Curl(query, opts, secrets)
+}
+
+// Metadata forwards to the wrapped Source, if it can describe metrics.
+func (r *Recorder) Metadata(ctx context.Context, metric string, limit string) (map[string][]v1.Metadata, error) {
+	src, ok := r.Source.(MetadataSource)
+	if !ok {
+		return nil, errNoMetadata
+	}
+	return src.Metadata(ctx, metric, limit)
+}
+
+// QueryRange records the response like Query, if the wrapped Source can
+// evaluate range queries.
+func (r *Recorder) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	src, ok := r.Source.(RangeSource)
+	if !ok {
+		return nil, nil, errNoRange
+	}
+	value, warnings, err := src.QueryRange(ctx, query, rng)
+	if err == nil {
+		r.record(recordedResponse{
+			Query: query,
+			Time:  rng.End,
+			Range: rng.End.Sub(rng.Start).Seconds(),
+			Step:  rng.Step.Seconds(),
+		}, value, warnings)
+	}
+	return value, warnings, err
+}
+
+// Rules forwards to the wrapped Source, if it can list rules.
+func (r *Recorder) Rules(ctx context.Context) (v1.RulesResult, error) {
+	src, ok := r.Source.(RuleSource)
+	if !ok {
+		return v1.RulesResult{}, errNoRules
+	}
+	return src.Rules(ctx)
+}
+
+// record appends resp, with the response value and warnings, to the
+// recording. The query has been answered whether or not it can be
+// recorded, so failing to is only logged.
+func (r *Recorder) record(resp recordedResponse, value model.Value, warnings v1.Warnings) {
+	if err := r.write(resp, value, warnings); err != nil {
+		slog.Warn("could not record response", "query", resp.Query, "err", err)
+	}
+}
+
+func (r *Recorder) write(resp recordedResponse, value model.Value, warnings v1.Warnings) error {
+	result, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("could not encode result for recording: %w", err)
+	}
+	resp.Type, resp.Result, resp.Warnings = value.Type(), result, warnings
+	line, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("could not encode recording: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write recording: %w", err)
+	}
+	return nil
+}
+
+// Replay is a Source that answers queries from a recording. Each query
+// is answered with the most recent response recorded for identical
+// query text and, for a range query, the same length of range and step;
+// the evaluation time is ignored.
+type Replay struct {
+	responses map[replayKey]recordedResponse
+}
+
+// replayKey identifies the responses that a recorded one answers for, by
+// the query and, for range queries, the length in seconds of the range
+// and the step.
+type replayKey struct {
+	query     string
+	rng, step float64
+}
+
+// LoadReplay reads the recording at path.
+func LoadReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open recording: %w", err)
+	}
+	defer f.Close()
+	r := &Replay{responses: make(map[replayKey]recordedResponse)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var resp recordedResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid recording: %w", path, line, err)
+		}
+		r.responses[replayKey{resp.Query, resp.Range, resp.Step}] = resp
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read recording: %w", err)
+	}
+	return r, nil
+}
+
+func (r *Replay) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	resp, ok := r.responses[replayKey{query: query}]
+	if !ok {
+		return nil, nil, fmt.Errorf("query not present in recording")
+	}
+	return replayed(resp)
+}
+
+// QueryRange answers a range query recorded over as long a range with
+// the same step. Recordings made before range queries were recorded
+// have none, so one missing fails with errNoRange, for the query to be
+// made with instant queries instead.
+func (r *Replay) QueryRange(ctx context.Context, query string, rng v1.Range) (model.Value, v1.Warnings, error) {
+	resp, ok := r.responses[replayKey{query, rng.End.Sub(rng.Start).Seconds(), rng.Step.Seconds()}]
+	if !ok {
+		return nil, nil, fmt.Errorf("range query not present in recording: %w", errNoRange)
+	}
+	return replayed(resp)
+}
+
+// replayed decodes the recorded response resp.
+func replayed(resp recordedResponse) (model.Value, v1.Warnings, error) {
+	value, err := decodeValue(resp.Type, resp.Result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid recorded result: %w", err)
+	}
+	return value, resp.Warnings, nil
+}
+
+// decodeValue decodes a query result of type t from JSON.
+func decodeValue(t model.ValueType, result json.RawMessage) (model.Value, error) {
+	var value model.Value
+	switch t {
+	case model.ValVector:
+		value = &model.Vector{}
+	case model.ValMatrix:
+		value = &model.Matrix{}
+	case model.ValScalar:
+		value = &model.Scalar{}
+	case model.ValString:
+		value = &model.String{}
+	default:
+		return nil, fmt.Errorf("unsupported result type %q", t)
+	}
+	if err := json.Unmarshal(result, value); err != nil {
+		return nil, err
+	}
+	// Vectors and matrices are returned by value, like the real API.
+	switch v := value.(type) {
+	case *model.Vector:
+		value = *v
+	case *model.Matrix:
+		value = *v
+	}
+	return value, nil
+}
+
+// QueryExemplars always fails, since recordings do not include exemplars.
+func (r *Replay) QueryExemplars(ctx context.Context, query string, startTime time.Time, endTime time.Time) ([]v1.ExemplarQueryResult, error) {
+	return nil, fmt.Errorf("exemplars are not recorded")
+}
+
+// LabelNames returns the names of the labels of every recorded series.
+func (r *Replay) LabelNames(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]string, v1.Warnings, error) {
+	seen := map[string]bool{}
+	var names []string
+	r.eachMetric(func(m model.Metric) {
+		for name := range m {
+			if !seen[string(name)] {
+				seen[string(name)] = true
+				names = append(names, string(name))
+			}
+		}
+	})
+	sort.Strings(names)
+	return names, nil, nil
+}
+
+// LabelValues returns the values of the named label across every
+// recorded series.
+func (r *Replay) LabelValues(ctx context.Context, label string, matches []string, startTime time.Time, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	seen := map[model.LabelValue]bool{}
+	var values model.LabelValues
+	r.eachMetric(func(m model.Metric) {
+		if v, ok := m[model.LabelName(label)]; ok && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	})
+	sort.Sort(values)
+	return values, nil, nil
+}
+
+// Series always fails, since recordings cannot be searched by selector.
+func (r *Replay) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	return nil, nil, fmt.Errorf("series are not recorded")
+}
+
+// eachMetric calls f with the metric of every series in the recording.
+func (r *Replay) eachMetric(f func(model.Metric)) {
+	for _, resp := range r.responses {
+		switch resp.Type {
+		case model.ValVector:
+			var v model.Vector
+			if json.Unmarshal(resp.Result, &v) == nil {
+				for _, s := range v {
+					f(s.Metric)
+				}
+			}
+		case model.ValMatrix:
+			var m model.Matrix
+			if json.Unmarshal(resp.Result, &m) == nil {
+				for _, s := range m {
+					f(s.Metric)
+				}
+			}
+		}
+	}
+}
+
+// Switch is a Source that forwards queries to another Source, which can
+// be replaced at any time.
+type Switch struct {
+	mu  sync.Mutex
+	src Source
+}
+
+// Set directs subsequent queries to src.
+func (s *Switch) Set(src Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src = src
+}
+
+func (s *Switch) current() Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src
+}
+
+func (s *Switch) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	return s.current().Query(ctx, query, ts)
+}
+
+// QueryWith forwards to the current Source if it can pass query
+// options, and otherwise fails with errNoOptions.
+func (s *Switch) QueryWith(ctx context.Context, query string, ts time.Time, opts queryOptions) (model.Value, v1.Warnings, *QueryStats, error) {
+	src, ok := s.current().(OptionSource)
+	if !ok {
+		return nil, nil, nil, errNoOptions
+	}
+	return src.QueryWith(ctx, query, ts, opts)
+}
+
+// FormatQuery forwards to the current Source if it can format queries,
+// and otherwise fails with errNoFormat.
+func (s *Switch) FormatQuery(ctx context.Context, query string) (string, error) {
+	src, ok := s.current().(FormatSource)
+	if !ok {
+		return "", errNoFormat
+	}
+	return src.FormatQuery(ctx, query)
+}
+
+// QueryRange forwards to the current Source if it can evaluate range
+// queries, and otherwise fails with errNoRange.
+func (s *Switch) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	src, ok := s.current().(RangeSource)
+	if !ok {
+		return nil, nil, errNoRange
+	}
+	return src.QueryRange(ctx, query, r)
+}
+
+// Curl forwards to the current Source if it can be queried with curl,
+// and otherwise fails with errNoCurl.
+func (s *Switch) Curl(query string, opts queryOptions, secrets bool) (string, error) {
+	src, ok := s.current().(CurlSource)
+	if !ok {
+		return "", errNoCurl
+	}
+	return src.Curl(query, opts, secrets)
+}
+
+// Metadata forwards to the current Source if it can describe metrics,
+// and otherwise fails with errNoMetadata.
+func (s *Switch) Metadata(ctx context.Context, metric string, limit string) (map[string][]v1.Metadata, error) {
+	src, ok := s.current().(MetadataSource)
+	if !ok {
+		return nil, errNoMetadata
+	}
+	return src.Metadata(ctx, metric, limit)
+}
+
+// Rules forwards to the current Source if it can list rules, and
+// otherwise fails with errNoRules.
+func (s *Switch) Rules(ctx context.Context) (v1.RulesResult, error) {
+	src, ok := s.current().(RuleSource)
+	if !ok {
+		return v1.RulesResult{}, errNoRules
+	}
+	return src.Rules(ctx)
+}
+
+func (s *Switch) QueryExemplars(ctx context.Context, query string, startTime time.Time, endTime time.Time) ([]v1.ExemplarQueryResult, error) {
+	return s.current().QueryExemplars(ctx, query, startTime, endTime)
+}
+
+func (s *Switch) LabelNames(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]string, v1.Warnings, error) {
+	return s.current().LabelNames(ctx, matches, startTime, endTime)
+}
+
+func (s *Switch) LabelValues(ctx context.Context, label string, matches []string, startTime time.Time, endTime time.Time) (model.LabelValues, v1.Warnings, error) {
+	return s.current().LabelValues(ctx, label, matches, startTime, endTime)
+}
+
+func (s *Switch) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, v1.Warnings, error) {
+	return s.current().Series(ctx, matches, startTime, endTime)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// fixedSource answers every instant query with instant, and every range
+// query with the query text as the value of a series of points a step
+// apart.
+type fixedSource struct {
+	Source
+	instant model.Value
+}
+
+func (s fixedSource) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	return s.instant, nil, nil
+}
+
+func (s fixedSource) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	var values []model.SamplePair
+	for t := r.Start; !t.After(r.End); t = t.Add(r.Step) {
+		values = append(values, model.SamplePair{Timestamp: model.TimeFromUnixNano(t.UnixNano()), Value: 1})
+	}
+	return model.Matrix{{Metric: model.Metric{"query": model.LabelValue(query)}, Values: values}}, nil, nil
+}
+
+func TestReplayRangeQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	rec, err := NewRecorder(fixedSource{instant: &model.Scalar{Value: 7}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	end := time.Unix(1600000000, 0)
+	if _, _, err := rec.Query(ctx, "up", end); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []v1.Range{
+		{Start: end.Add(-time.Hour), End: end, Step: time.Minute},
+		{Start: end.Add(-time.Hour), End: end, Step: 15 * time.Second},
+		{Start: end.Add(-15 * time.Minute), End: end, Step: time.Minute},
+	} {
+		if _, _, err := rec.QueryRange(ctx, "up", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec.file.Close()
+
+	replay, err := LoadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := replay.Query(ctx, "up", end.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if s, ok := v.(*model.Scalar); !ok || s.Value != 7 {
+		t.Errorf("Query = %v, want the recorded instant answer", v)
+	}
+	later := end.Add(24 * time.Hour)
+	for _, tt := range []struct {
+		rng, step time.Duration
+		points    int
+	}{
+		{time.Hour, time.Minute, 61},
+		{time.Hour, 15 * time.Second, 241},
+		{15 * time.Minute, time.Minute, 16},
+	} {
+		v, _, err := replay.QueryRange(ctx, "up", v1.Range{Start: later.Add(-tt.rng), End: later, Step: tt.step})
+		if err != nil {
+			t.Errorf("QueryRange over %v at %v: %v", tt.rng, tt.step, err)
+			continue
+		}
+		if m, ok := v.(model.Matrix); !ok || len(m) != 1 || len(m[0].Values) != tt.points {
+			t.Errorf("QueryRange over %v at %v = %v, want the %d points recorded", tt.rng, tt.step, v, tt.points)
+		}
+	}
+	_, _, err = replay.QueryRange(ctx, "up", v1.Range{Start: later.Add(-6 * time.Hour), End: later, Step: time.Minute})
+	if !errors.Is(err, errNoRange) {
+		t.Errorf("QueryRange not recorded = %v, want errNoRange", err)
+	}
+	if _, _, err := replay.Query(ctx, "down", later); err == nil {
+		t.Error("Query not recorded succeeded")
+	}
+}
+
+func TestRecorderAnswersWhenRecordingFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	rec, err := NewRecorder(fixedSource{instant: &model.Scalar{Value: 7}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes to the closed file fail.
+	rec.file.Close()
+	v, _, err := rec.Query(context.Background(), "up", time.Unix(1600000000, 0))
+	if err != nil {
+		t.Errorf("Query = %v, want the answer despite the recording failing", err)
+	}
+	if s, ok := v.(*model.Scalar); !ok || s.Value != 7 {
+		t.Errorf("Query = %v, want the answer", v)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	"gioui.org/gesture"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// Split lays out two widgets side by side, separated by a bar that can
+// be dragged to resize them.
+type Split struct {
+	// Ratio is the fraction of the width given to the left widget. Zero
+	// is treated as an even split.
+	Ratio float32
+
+	drag  gesture.Drag
+	dragX float32
+}
+
+func (s *Split) Layout(gtx C, th *material.Theme, left, right func(C) D) D {
+	bar := gtx.Px(unit.Dp(6))
+	if s.Ratio == 0 {
+		s.Ratio = .5
+	}
+	for _, e := range s.drag.Events(gtx.Metric, gtx, gesture.Horizontal) {
+		switch e.Type {
+		case pointer.Press:
+			s.dragX = e.Position.X
+		case pointer.Drag:
+			s.Ratio += (e.Position.X - s.dragX) / float32(gtx.Constraints.Max.X)
+			s.dragX = e.Position.X
+		}
+	}
+	if s.Ratio < .1 {
+		s.Ratio = .1
+	} else if s.Ratio > .9 {
+		s.Ratio = .9
+	}
+
+	leftWidth := int(s.Ratio * float32(gtx.Constraints.Max.X-bar))
+	rightWidth := gtx.Constraints.Max.X - bar - leftWidth
+	height := gtx.Constraints.Max.Y
+
+	{
+		stack := op.Save(gtx.Ops)
+		gtx := gtx
+		gtx.Constraints = layout.Exact(image.Pt(leftWidth, height))
+		left(gtx)
+		stack.Load()
+	}
+	{
+		stack := op.Save(gtx.Ops)
+		op.Offset(f32.Pt(float32(leftWidth), 0)).Add(gtx.Ops)
+		area := image.Rect(0, 0, bar, height)
+		paint.FillShape(gtx.Ops, th.ContrastBg, clip.Rect(area).Op())
+		pointer.Rect(area).Add(gtx.Ops)
+		pointer.CursorNameOp{Name: pointer.CursorColResize}.Add(gtx.Ops)
+		s.drag.Add(gtx.Ops)
+		stack.Load()
+	}
+	{
+		stack := op.Save(gtx.Ops)
+		op.Offset(f32.Pt(float32(leftWidth+bar), 0)).Add(gtx.Ops)
+		gtx := gtx
+		gtx.Constraints = layout.Exact(image.Pt(rightWidth, height))
+		right(gtx)
+		stack.Load()
+	}
+	return D{Size: gtx.Constraints.Max}
+}
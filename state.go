@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WindowState is what was being worked on in the window when it was last
+// closed, so that it comes back as it was when binnacle is next started.
+// Unlike Settings it is saved only on a clean exit.
+type WindowState struct {
+	// Width and Height are the size of the window, in dp.
+	Width   float32     `yaml:"width,omitempty"`
+	Height  float32     `yaml:"height,omitempty"`
+	Compare bool        `yaml:"compare,omitempty"`
+	Panes   []PaneState `yaml:"panes,omitempty"`
+}
+
+// PaneState is the query of a pane, along with the range it is evaluated
+// over and the way its results are shown.
+type PaneState struct {
+	Query string `yaml:"query"`
+	Range string `yaml:"range,omitempty"`
+	View  string `yaml:"view,omitempty"`
+}
+
+// statePath is the location of the window state within the user's
+// configuration directory.
+func statePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "binnacle", "state.yaml"), nil
+}
+
+// LoadWindowState reads the state the window was left in. A state that is
+// missing or unreadable is no different from a first start, so the zero
+// WindowState is returned for it.
+func LoadWindowState() WindowState {
+	var s WindowState
+	path, err := statePath()
+	if err != nil {
+		return s
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return WindowState{}
+	}
+	return s
+}
+
+// Save writes the state for the next session to load. It is written to a
+// temporary file that then replaces the last, so that a crash while saving
+// leaves the last state as it was.
+func (s WindowState) Save() error {
+	path, err := statePath()
+	if err != nil {
+		return fmt.Errorf("could not locate window state: %w", err)
+	}
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("could not encode window state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not save window state: %w", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "state-*.yaml")
+	if err != nil {
+		return fmt.Errorf("could not save window state: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not save window state: %w", err)
+	}
+	return nil
+}
+
+// state captures the pane's query, range and view.
+func (p *pane) state() PaneState {
+	return PaneState{
+		Query: p.editor.Text(),
+		Range: p.rangeWindow.Value,
+		View:  p.views.Mode(p.renderer.Value, p.shownTargets).String(),
+	}
+}
+
+// restoreState puts the query of s back in the pane, to be run as an edit
+// is, and its range and view, any of which not understood being left as
+// they are.
+func (p *pane) restoreState(s PaneState) {
+	if s.Query != "" {
+		p.editor.SetText(s.Query)
+		p.updateTransform()
+	}
+	if s.Range == instantWindow {
+		p.rangeWindow.Value = s.Range
+	}
+	for _, w := range rangeWindows {
+		if s.Range == w {
+			p.rangeWindow.Value = s.Range
+		}
+	}
+	if mode, ok := parseViewMode(s.View); ok {
+		p.views.ChooseAll(mode)
+	}
+}
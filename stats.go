@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// QueryStats are the statistics that Prometheus reports for a query
+// evaluated with stats=all. Times are in seconds.
+type QueryStats struct {
+	Timings struct {
+		EvalTotalTime        float64 `json:"evalTotalTime"`
+		ResultSortTime       float64 `json:"resultSortTime"`
+		QueryPreparationTime float64 `json:"queryPreparationTime"`
+		InnerEvalTime        float64 `json:"innerEvalTime"`
+		ExecQueueTime        float64 `json:"execQueueTime"`
+		ExecTotalTime        float64 `json:"execTotalTime"`
+	} `json:"timings"`
+	Samples *struct {
+		TotalQueryableSamples int64 `json:"totalQueryableSamples"`
+		PeakSamples           int64 `json:"peakSamples"`
+	} `json:"samples"`
+}
+
+func (s *QueryStats) String() string {
+	seconds := func(f float64) time.Duration {
+		return time.Duration(f * float64(time.Second)).Round(time.Microsecond)
+	}
+	parts := []string{
+		"queue " + seconds(s.Timings.ExecQueueTime).String(),
+		"prepare " + seconds(s.Timings.QueryPreparationTime).String(),
+		"eval " + seconds(s.Timings.EvalTotalTime).String(),
+	}
+	if s.Samples != nil {
+		parts = append(parts, fmt.Sprintf("%d samples (peak %d)", s.Samples.TotalQueryableSamples, s.Samples.PeakSamples))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// queryOptions are the parameters of an instant query that v1.API
+// cannot pass.
+type queryOptions struct {
+	// Stats asks for the query's statistics.
+	Stats bool
+	// Limit, if positive, asks the server to return at most this many
+	// series.
+	Limit int
+	// Timeout, if positive, asks the server to stop evaluating the query
+	// after this long.
+	Timeout time.Duration
+}
+
+// OptionSource is a Source that can pass queryOptions to the server.
+type OptionSource interface {
+	// QueryWith is like Query, also returning the query's statistics,
+	// which are nil unless requested and reported by the server.
+	QueryWith(ctx context.Context, query string, ts time.Time, opts queryOptions) (model.Value, v1.Warnings, *QueryStats, error)
+}
+
+// errNoOptions is returned by QueryWith when the Source in use cannot
+// pass queryOptions.
+var errNoOptions = errors.New("query options are not supported by this source")
+
+// apiSource is the Source for a Prometheus server, querying it directly
+// when queryOptions are given since v1.API cannot pass them.
+type apiSource struct {
+	v1.API
+	client api.Client
+	// params are passed with every query, and partial is set if the
+	// server's warnings mean that it returned only part of the data.
+	params  url.Values
+	partial bool
+	// endpoint is the configuration the client was built from, and
+	// transport the client's round tripper.
+	endpoint  Endpoint
+	transport http.RoundTripper
+}
+
+// queryForm returns the parameters of an instant query, which is
+// evaluated at ts unless it is zero.
+func (s *apiSource) queryForm(query string, ts time.Time, opts queryOptions) url.Values {
+	form := url.Values{}
+	for k, v := range s.params {
+		form[k] = v
+	}
+	form.Set("query", query)
+	if opts.Stats {
+		form.Set("stats", "all")
+	}
+	if opts.Limit > 0 {
+		form.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Timeout > 0 {
+		form.Set("timeout", strconv.FormatFloat(opts.Timeout.Seconds(), 'f', -1, 64))
+	}
+	if !ts.IsZero() {
+		form.Set("time", formatTime(ts))
+	}
+	return form
+}
+
+// formatTime formats t as the API's parameters take times, in seconds
+// since the epoch.
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.Unix())+float64(t.Nanosecond())/1e9, 'f', -1, 64)
+}
+
+func (s *apiSource) QueryWith(ctx context.Context, query string, ts time.Time, opts queryOptions) (model.Value, v1.Warnings, *QueryStats, error) {
+	return s.post(ctx, "/api/v1/query", s.queryForm(query, ts, opts))
+}
+
+// post sends a query with the parameters in form to the endpoint at path
+// and decodes its result.
+func (s *apiSource) post(ctx context.Context, path string, form url.Values) (model.Value, v1.Warnings, *QueryStats, error) {
+	u := s.client.URL(path, nil)
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not build query: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, body, err := s.client.Do(ctx, req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var r struct {
+		Status    string       `json:"status"`
+		ErrorType v1.ErrorType `json:"errorType"`
+		Error     string       `json:"error"`
+		Warnings  []string     `json:"warnings"`
+		Data      struct {
+			Type   model.ValueType `json:"resultType"`
+			Result json.RawMessage `json:"result"`
+			Stats  *QueryStats     `json:"stats"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return nil, nil, nil, fmt.Errorf("server returned %s", resp.Status)
+		}
+		return nil, nil, nil, fmt.Errorf("could not decode response: %w", err)
+	}
+	if s.partial {
+		for i, w := range r.Warnings {
+			r.Warnings[i] = partialResponsePrefix + w
+		}
+	}
+	if r.Status != "success" {
+		return nil, r.Warnings, nil, &v1.Error{Type: r.ErrorType, Msg: r.Error}
+	}
+	value, err := decodeValue(r.Data.Type, r.Data.Result)
+	if err != nil {
+		return nil, r.Warnings, nil, err
+	}
+	return value, r.Warnings, r.Data.Stats, nil
+}
+
+// FormatSource is a Source that can format queries as the server does.
+type FormatSource interface {
+	FormatQuery(ctx context.Context, query string) (string, error)
+}
+
+// errNoFormat is returned by FormatQuery when the Source in use cannot
+// format queries.
+var errNoFormat = errors.New("query formatting is not supported by this source")
+
+// FormatQuery formats the query with the server's format_query endpoint,
+// which only newer versions of Prometheus have.
+func (s *apiSource) FormatQuery(ctx context.Context, query string) (string, error) {
+	form := url.Values{}
+	form.Set("query", query)
+	u := s.client.URL("/api/v1/format_query", nil)
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("could not build query: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, body, err := s.client.Do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	var r struct {
+		Status    string       `json:"status"`
+		ErrorType v1.ErrorType `json:"errorType"`
+		Error     string       `json:"error"`
+		Data      string       `json:"data"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return "", fmt.Errorf("server returned %s", resp.Status)
+		}
+		return "", fmt.Errorf("could not decode response: %w", err)
+	}
+	if r.Status != "success" {
+		return "", &v1.Error{Type: r.ErrorType, Msg: r.Error}
+	}
+	return r.Data, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// resultSize counts the series in v and the samples among them, a scalar
+// or string being a single sample of no series.
+func resultSize(v model.Value) (series, samples int) {
+	switch v := v.(type) {
+	case model.Vector:
+		return len(v), len(v)
+	case model.Matrix:
+		for _, s := range v {
+			samples += len(s.Values)
+		}
+		return len(v), samples
+	case *model.Scalar, *model.String:
+		return 0, 1
+	}
+	return 0, 0
+}
+
+// queryStatus is what the status bar tells of a pane's last query.
+type queryStatus struct {
+	// done is set once a query has been answered or has failed.
+	done            bool
+	failed          bool
+	elapsed         time.Duration
+	at              time.Time
+	series, samples int
+}
+
+func newQueryStatus(r queryResult) queryStatus {
+	return queryStatus{
+		done:    !emptyQuery(r.text) || r.error != nil,
+		failed:  r.error != nil,
+		elapsed: r.elapsed,
+		at:      r.at,
+		series:  r.series,
+		samples: r.samples,
+	}
+}
+
+// String describes the query, or that one is running, in place of the
+// last one, if running is set.
+func (s queryStatus) String(running bool) string {
+	switch {
+	case running:
+		return "running…"
+	case !s.done:
+		return ""
+	case s.failed && s.elapsed == 0:
+		return "failed before being sent"
+	case s.failed:
+		return fmt.Sprintf("failed after %v", s.elapsed.Round(time.Millisecond))
+	}
+	took := "from cache"
+	if s.elapsed > 0 {
+		took = "in " + s.elapsed.Round(time.Millisecond).String()
+	}
+	return fmt.Sprintf("%d series, %d samples %s, evaluated at %s", s.series, s.samples, took, s.at.Format("15:04:05"))
+}
+
+// noteTime is how long the status bar shows a pane's note.
+const noteTime = 2 * time.Second
+
+// Note shows text in the status bar for noteTime from now.
+func (p *pane) Note(text string, now time.Time) {
+	p.note, p.notedAt = text, now
+}
+
+// layoutStatusBar shows the status of the last query of each of panes,
+// side by side, after the pane's note if it was given just now.
+func layoutStatusBar(gtx C, th *material.Theme, inset layout.Inset, panes []*pane) D {
+	children := make([]layout.FlexChild, len(panes))
+	for i, p := range panes {
+		text := p.status.String(p.running)
+		if until := p.notedAt.Add(noteTime); p.note != "" && gtx.Now.Before(until) {
+			if text != "" {
+				text = p.note + "; " + text
+			} else {
+				text = p.note
+			}
+			op.InvalidateOp{At: until}.Add(gtx.Ops)
+		}
+		children[i] = layout.Flexed(1, func(gtx C) D {
+			label := material.Caption(th, text)
+			label.Font.Variant = "Mono"
+			label.MaxLines = 1
+			return inset.Layout(gtx, label.Layout)
+		})
+	}
+	return layout.Flex{}.Layout(gtx, children...)
+}
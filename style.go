@@ -0,0 +1,87 @@
+package main
+
+import (
+	"image/color"
+
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// Text sizes of the normal and compact styles.
+var (
+	normalTextSize  = unit.Sp(16)
+	compactTextSize = unit.Sp(12)
+)
+
+// The palettes of the light and dark themes, the light one being Gio's
+// own.
+var (
+	lightPalette = material.Palette{
+		Fg:         color.NRGBA{A: 255},
+		Bg:         color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 255},
+		ContrastBg: color.NRGBA{R: 0x3f, G: 0x51, B: 0xb5, A: 255},
+		ContrastFg: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 255},
+	}
+	darkPalette = material.Palette{
+		Fg:         color.NRGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 255},
+		Bg:         color.NRGBA{R: 0x1e, G: 0x1e, B: 0x1e, A: 255},
+		ContrastBg: color.NRGBA{R: 0x8c, G: 0x9e, B: 0xff, A: 255},
+		ContrastFg: color.NRGBA{R: 0x12, G: 0x12, B: 0x12, A: 255},
+	}
+)
+
+// Style holds the layout settings shared by the whole window.
+type Style struct {
+	// Compact tightens spacing and shrinks text so that more results
+	// fit on a small screen.
+	Compact bool
+	// Dark shows light text on a dark background.
+	Dark bool
+}
+
+// Inset is the padding placed around each widget.
+func (s *Style) Inset() layout.Inset {
+	if s.Compact {
+		return layout.UniformInset(unit.Dp(1))
+	}
+	return layout.UniformInset(unit.Dp(4))
+}
+
+// Apply sets the text size and palette of th to match the style.
+func (s *Style) Apply(th *material.Theme) {
+	if s.Compact {
+		th.TextSize = compactTextSize
+	} else {
+		th.TextSize = normalTextSize
+	}
+	if s.Dark {
+		th.Palette = darkPalette
+	} else {
+		th.Palette = lightPalette
+	}
+}
+
+// isDark reports whether th has a dark background.
+func isDark(th *material.Theme) bool {
+	bg := th.Bg
+	return int(bg.R)*299+int(bg.G)*587+int(bg.B)*114 < 128*1000
+}
+
+// errorColor is the color of error messages, dark red on a light
+// background and light red on a dark one.
+func errorColor(th *material.Theme) color.NRGBA {
+	if isDark(th) {
+		return color.NRGBA{R: 0xef, G: 0x9a, B: 0x9a, A: 255}
+	}
+	return color.NRGBA{R: 0x6e, G: 0x0a, B: 0x1e, A: 255}
+}
+
+// warningColor is the color of warnings, and of anything that may be out
+// of date, gold on a light background and a paler yellow on a dark one.
+func warningColor(th *material.Theme) color.NRGBA {
+	if isDark(th) {
+		return color.NRGBA{R: 0xff, G: 0xd5, B: 0x4f, A: 255}
+	}
+	return color.NRGBA{R: 0xd4, G: 0xaf, B: 0x37, A: 255}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+)
+
+// valueSummary aggregates the values of an instant vector as displayed,
+// saving a query for simple statistics of them.
+type valueSummary struct {
+	count         int
+	sum, min, max float64
+	// skipped counts the values left out for not being finite, or for
+	// being stale markers.
+	skipped int
+}
+
+// newValueSummary summarizes the values of v, if it is a vector.
+func newValueSummary(v model.Value) valueSummary {
+	var s valueSummary
+	vec, ok := v.(model.Vector)
+	if !ok {
+		return s
+	}
+	for _, sample := range vec {
+		x := float64(sample.Value)
+		if nonFinite(x) || isStaleMarker(sample.Value) {
+			s.skipped++
+			continue
+		}
+		if s.count == 0 || x < s.min {
+			s.min = x
+		}
+		if s.count == 0 || x > s.max {
+			s.max = x
+		}
+		s.sum += x
+		s.count++
+	}
+	return s
+}
+
+// String describes the summary with its values formatted by f.
+func (s valueSummary) String(f NumberFormat) string {
+	text := fmt.Sprintf("count %d, sum %s, min %s, max %s, mean %s",
+		s.count, f.Format(s.sum), f.Format(s.min), f.Format(s.max), f.Format(s.sum/float64(s.count)))
+	if s.skipped > 0 {
+		text += fmt.Sprintf(" (%d not finite, left out)", s.skipped)
+	}
+	return text
+}
+
+// Layout shows the summary as a footer, or nothing if there are no values
+// to summarize.
+func (s valueSummary) Layout(gtx C, th *material.Theme, f NumberFormat) D {
+	if s.count == 0 {
+		return D{}
+	}
+	label := material.Caption(th, s.String(f))
+	label.Font.Variant = "Mono"
+	label.MaxLines = 1
+	return label.Layout(gtx)
+}
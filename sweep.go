@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/latest"
+)
+
+// maxSweepPoints is the most instants a query is swept over, and
+// maxSweepRows the most series tabulated.
+const (
+	maxSweepPoints = 100
+	maxSweepRows   = 50
+)
+
+// RangeSource is a Source that can evaluate a query every step over a
+// range at once, as v1.API does.
+type RangeSource interface {
+	QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error)
+}
+
+// errNoRange is returned by QueryRange when the Source in use cannot
+// evaluate range queries.
+var errNoRange = errors.New("range queries are not supported by this source")
+
+// QueryRange passes any extra parameters of the endpoint, which v1.API
+// cannot.
+func (s *apiSource) QueryRange(ctx context.Context, query string, r v1.Range) (model.Value, v1.Warnings, error) {
+	form := s.queryForm(query, time.Time{}, queryOptions{})
+	form.Set("start", formatTime(r.Start))
+	form.Set("end", formatTime(r.End))
+	form.Set("step", strconv.FormatFloat(r.Step.Seconds(), 'f', -1, 64))
+	value, warnings, _, err := s.post(ctx, "/api/v1/query_range", form)
+	return value, warnings, err
+}
+
+type sweepRequest struct {
+	query string
+	times []time.Time
+	step  time.Duration
+}
+
+// sweepResponse is the result of a query at each instant of a sweep, or
+// why it could not be had. ranged is set if it took one range query
+// rather than a query at each instant.
+type sweepResponse struct {
+	query   string
+	times   []time.Time
+	vectors []model.Vector
+	ranged  bool
+	err     error
+}
+
+// sweepRange evaluates query at each of times, step apart, with a single
+// range query, failing with errNoRange if src cannot.
+func sweepRange(ctx context.Context, src Source, query string, times []time.Time, step time.Duration) ([]model.Vector, error) {
+	rs, ok := src.(RangeSource)
+	if !ok {
+		return nil, errNoRange
+	}
+	start := times[0]
+	v, _, err := rs.QueryRange(ctx, query, v1.Range{Start: start, End: times[len(times)-1], Step: step})
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("a sweep needs an instant vector, not a %s", v.Type())
+	}
+	vectors := make([]model.Vector, len(times))
+	for _, s := range m {
+		for _, p := range s.Values {
+			// The server's evaluation times are those asked for, give or
+			// take the rounding to milliseconds.
+			i := int(math.Round(float64(p.Timestamp.Time().Sub(start)) / float64(step)))
+			if i >= 0 && i < len(times) {
+				vectors[i] = append(vectors[i], &model.Sample{Metric: s.Metric, Value: p.Value, Timestamp: p.Timestamp})
+			}
+		}
+	}
+	return vectors, nil
+}
+
+// sweepTimes are the instants every step over the span up to end, oldest
+// first.
+func sweepTimes(end time.Time, step, span time.Duration) []time.Time {
+	n := int(span / step)
+	times := make([]time.Time, 0, n+1)
+	for i := n; i >= 0; i-- {
+		times = append(times, end.Add(-time.Duration(i)*step))
+	}
+	return times
+}
+
+// sweepRows tabulates the vectors, one row for each series and one column
+// for each instant, with a header row of the times. Series missing at an
+// instant are shown as "-" there.
+func sweepRows(times []time.Time, vectors []model.Vector, f NumberFormat) []string {
+	values := map[string][]string{}
+	var series []string
+	for i, vec := range vectors {
+		for _, s := range vec {
+			key := s.Metric.String()
+			row, ok := values[key]
+			if !ok {
+				row = make([]string, len(times))
+				for j := range row {
+					row[j] = "-"
+				}
+				values[key] = row
+				series = append(series, key)
+			}
+			row[i] = f.Format(float64(s.Value))
+		}
+	}
+	sort.Strings(series)
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "series")
+	for _, t := range times {
+		fmt.Fprint(w, "\t", t.Format("Jan 2 15:04"))
+	}
+	fmt.Fprintln(w)
+	for _, key := range series {
+		fmt.Fprintln(w, key+"\t"+strings.Join(values[key], "\t"))
+	}
+	w.Flush()
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// sweepPanel runs the pane's query as an instant query at each of a
+// series of instants that the user controls, every step over a span, and
+// tabulates the results side by side.
+type sweepPanel struct {
+	fetcher latest.Worker
+	step    *durationField
+	span    *durationField
+	run     widget.Clickable
+	status  string
+	// pending is set until the sweep last run arrives.
+	pending bool
+	resp    sweepResponse
+}
+
+func newSweepPanel(b *Backend) *sweepPanel {
+	s := &sweepPanel{
+		step: newDurationField("step"),
+		span: newDurationField("span"),
+	}
+	s.step.SetText("1h")
+	s.span.SetText("1d")
+	s.step.parse()
+	s.span.parse()
+	s.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		req := in.(sweepRequest)
+		resp := sweepResponse{query: req.query, times: req.times}
+		text, err := expand(req.query)
+		if err != nil {
+			resp.err = err
+			return resp
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+		vectors, err := sweepRange(ctx, b.Source, text, req.times, req.step)
+		cancel()
+		if !errors.Is(err, errNoRange) {
+			resp.vectors, resp.ranged, resp.err = vectors, true, err
+			return resp
+		}
+		for _, t := range req.times {
+			ctx, cancel := context.WithTimeout(context.Background(), b.Timeout())
+			v, _, err := b.Source.Query(ctx, text, t)
+			cancel()
+			if err != nil {
+				resp.err = fmt.Errorf("could not query at %s: %w", t.Format(time.RFC3339), err)
+				return resp
+			}
+			vec, ok := v.(model.Vector)
+			if !ok {
+				resp.err = fmt.Errorf("a sweep needs an instant vector, not a %s", v.Type())
+				return resp
+			}
+			resp.vectors = append(resp.vectors, vec)
+		}
+		return resp
+	})
+	return s
+}
+
+// Focused reports whether one of the panel's fields has focus.
+func (s *sweepPanel) Focused() bool {
+	return s.step.Focused() || s.span.Focused()
+}
+
+// Sweep starts a sweep of query if the sweep button has been clicked.
+func (s *sweepPanel) Sweep(query string) {
+	if !s.run.Clicked() {
+		return
+	}
+	step, span := s.step.Duration(), s.span.Duration()
+	switch {
+	case s.step.Err() != "":
+		s.status = s.step.Err()
+	case s.span.Err() != "":
+		s.status = s.span.Err()
+	case step <= 0 || span <= 0:
+		s.status = "the step and span must be positive"
+	case span/step >= maxSweepPoints:
+		s.status = fmt.Sprintf("a sweep can have at most %d points", maxSweepPoints)
+	default:
+		s.status, s.pending = "", true
+		s.fetcher.Push(sweepRequest{query: query, times: sweepTimes(time.Now(), step, span), step: step})
+	}
+}
+
+func (s *sweepPanel) receive() {
+	select {
+	case r := <-s.fetcher.Raw():
+		s.resp, s.pending = r.(sweepResponse), false
+	default:
+	}
+}
+
+func (s *sweepPanel) Layout(gtx C, th *material.Theme, inset layout.Inset, f NumberFormat) D {
+	s.receive()
+	s.step.Changed()
+	s.span.Changed()
+	status := s.status
+	switch {
+	case s.pending:
+		op.InvalidateOp{}.Add(gtx.Ops)
+		status = "sweeping…"
+	case status == "" && s.resp.err != nil:
+		status = s.resp.err.Error()
+	case status == "" && s.resp.query != "":
+		status = fmt.Sprintf("%s at %d instants", s.resp.query, len(s.resp.times))
+		if s.resp.ranged {
+			status += ", in one range query"
+		}
+	}
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Body2(th, "every").Layout)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						return s.step.Layout(gtx, th, unit.Dp(60), "step")
+					})
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Body2(th, "over the last").Layout)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, func(gtx C) D {
+						return s.span.Layout(gtx, th, unit.Dp(60), "span")
+					})
+				}),
+				layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Button(th, &s.run, "sweep").Layout)
+				}),
+				layout.Flexed(1, func(gtx C) D {
+					return inset.Layout(gtx, material.Caption(th, status).Layout)
+				}),
+			)
+		}),
+	}
+	if s.resp.err == nil && len(s.resp.vectors) > 0 {
+		rows := sweepRows(s.resp.times, s.resp.vectors, f)
+		for i, row := range rows {
+			if i == maxSweepRows+1 {
+				more := fmt.Sprintf("and %d more", len(rows)-i)
+				children = append(children, layout.Rigid(func(gtx C) D {
+					return inset.Layout(gtx, material.Caption(th, more).Layout)
+				}))
+				break
+			}
+			row := row
+			children = append(children, layout.Rigid(func(gtx C) D {
+				label := material.Body2(th, row)
+				label.Font.Variant = "Mono"
+				label.MaxLines = 1
+				return inset.Layout(gtx, label.Layout)
+			}))
+		}
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
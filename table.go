@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+)
+
+// tableCellWidth is the most characters of a label value shown in a cell
+// of a table, unless label values are cut shorter than that anyway.
+const tableCellWidth = 40
+
+// tableRows lays out the rows of a vector as a table: a header row, then
+// the cells of each row's labels, in a column for each label of any of
+// the series with the metric name first, and its value right-aligned in
+// a column of its own. Rows without a series are left out.
+func tableRows(rows []textRow, maxValue int) []textRow {
+	width := tableCellWidth
+	if maxValue > 0 && maxValue < width {
+		width = maxValue
+	}
+	var series []textRow
+	var metrics []model.Metric
+	for _, row := range rows {
+		if row.Metric != nil && row.Value != "" {
+			series = append(series, row)
+			metrics = append(metrics, row.Metric)
+		}
+	}
+	if len(series) == 0 {
+		return rows
+	}
+	names := columnLabels(metrics)
+	cells := make([][]string, len(series))
+	widths := make([]int, len(names))
+	for i, name := range names {
+		widths[i] = utf8.RuneCountInString(string(name))
+	}
+	valueWidth := len("value")
+	for i, row := range series {
+		// The full labels are shown on hovering over a row only if
+		// any of its cells are cut short.
+		series[i].FullLabel = ""
+		cells[i] = make([]string, len(names))
+		for j, name := range names {
+			value := []rune(string(row.Metric[name]))
+			if len(value) > width {
+				value = append(value[:width:width], '…')
+				series[i].FullLabel = row.Metric.String() + " => "
+			}
+			cells[i][j] = string(value)
+			if n := len(value); n > widths[j] {
+				widths[j] = n
+			}
+		}
+		if n := utf8.RuneCountInString(row.Value); n > valueWidth {
+			valueWidth = n
+		}
+	}
+	line := func(cells []string, value string) string {
+		var b strings.Builder
+		for j, cell := range cells {
+			b.WriteString(cell)
+			b.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)+2))
+		}
+		// Values are right-aligned, the padding going in the label.
+		b.WriteString(strings.Repeat(" ", valueWidth-utf8.RuneCountInString(value)))
+		return b.String()
+	}
+	header := make([]string, len(names))
+	for j, name := range names {
+		header[j] = string(name)
+	}
+	table := []textRow{{Label: line(header, "value") + "value"}}
+	for i, row := range series {
+		row.Label = line(cells[i], row.Value)
+		table = append(table, row)
+	}
+	return table
+}
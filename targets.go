@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/prometheus/common/model"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// targetsQuery is the query whose results the target grid shows.
+const targetsQuery = "up"
+
+// isTargetsQuery reports whether query selects the up series, whose
+// results are shown as a grid of targets.
+func isTargetsQuery(query string) bool {
+	expr, err := promql.Parse(query)
+	if err != nil {
+		return false
+	}
+	vs, ok := expr.(*promql.VectorSelector)
+	return ok && vs.Name == targetsQuery
+}
+
+// target is a cell of the target grid.
+type target struct {
+	job, instance model.LabelValue
+	up            bool
+}
+
+// targetGrid shows whether each scrape target is up, grouping the targets
+// by job. Clicking one queries just that target.
+type targetGrid struct {
+	jobs    []string
+	targets map[string][]target
+	clicks  map[target]*widget.Clickable
+	list    layout.List
+}
+
+func newTargetGrid() *targetGrid {
+	g := &targetGrid{clicks: map[target]*widget.Clickable{}}
+	g.list.Axis = layout.Vertical
+	return g
+}
+
+// SetData shows the targets of the up series in v.
+func (g *targetGrid) SetData(v model.Value) {
+	g.jobs, g.targets = nil, map[string][]target{}
+	vec, _ := v.(model.Vector)
+	for _, s := range vec {
+		t := target{job: s.Metric["job"], instance: s.Metric["instance"], up: s.Value == 1}
+		job := string(t.job)
+		if _, ok := g.targets[job]; !ok {
+			g.jobs = append(g.jobs, job)
+		}
+		g.targets[job] = append(g.targets[job], t)
+	}
+	sort.Strings(g.jobs)
+	clicks := map[target]*widget.Clickable{}
+	for _, ts := range g.targets {
+		sort.Slice(ts, func(i, j int) bool { return ts[i].instance < ts[j].instance })
+		for _, t := range ts {
+			if click, ok := g.clicks[t]; ok {
+				clicks[t] = click
+			}
+		}
+	}
+	g.clicks = clicks
+}
+
+// Clicked returns the selector of the target clicked, if any.
+func (g *targetGrid) Clicked() (string, bool) {
+	for t, click := range g.clicks {
+		if click.Clicked() {
+			return seriesSelector(model.Metric{
+				model.MetricNameLabel: targetsQuery,
+				"job":                 t.job,
+				"instance":            t.instance,
+			}), true
+		}
+	}
+	return "", false
+}
+
+func (g *targetGrid) Layout(gtx C, th *material.Theme, inset layout.Inset) D {
+	if len(g.jobs) == 0 {
+		return D{}
+	}
+	return g.list.Layout(gtx, len(g.jobs), func(gtx C, index int) D {
+		job := g.jobs[index]
+		targets := g.targets[job]
+		up := 0
+		for _, t := range targets {
+			if t.up {
+				up++
+			}
+		}
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				name := job
+				if name == "" {
+					name = "(no job)"
+				}
+				text := fmt.Sprintf("%s: %d of %d up", name, up, len(targets))
+				return inset.Layout(gtx, material.Body2(th, text).Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return layoutWrap(gtx, gtx.Px(unit.Dp(4)), len(targets), func(gtx C, i int) D {
+					t := targets[i]
+					click, ok := g.clicks[t]
+					if !ok {
+						click = new(widget.Clickable)
+						g.clicks[t] = click
+					}
+					bg := palette["red"]
+					if t.up {
+						bg = palette["green"]
+					}
+					return material.Clickable(gtx, click, func(gtx C) D {
+						return layoutBadge(gtx, th, string(t.instance), bg)
+					})
+				})
+			}),
+		)
+	})
+}
+
+// layoutWrap lays out n widgets in rows, starting a new row whenever the
+// next would not fit, with space between them.
+func layoutWrap(gtx C, space, n int, w func(gtx C, i int) D) D {
+	var x, y, rowHeight, width int
+	cgtx := gtx
+	cgtx.Constraints.Min = image.Point{}
+	for i := 0; i < n; i++ {
+		macro := op.Record(gtx.Ops)
+		dims := w(cgtx, i)
+		call := macro.Stop()
+		if x > 0 && x+dims.Size.X > gtx.Constraints.Max.X {
+			x, y, rowHeight = 0, y+rowHeight+space, 0
+		}
+		stack := op.Save(gtx.Ops)
+		op.Offset(layout.FPt(image.Pt(x, y))).Add(gtx.Ops)
+		call.Add(gtx.Ops)
+		stack.Load()
+		x += dims.Size.X + space
+		if x-space > width {
+			width = x - space
+		}
+		if dims.Size.Y > rowHeight {
+			rowHeight = dims.Size.Y
+		}
+	}
+	return D{Size: image.Pt(width, y+rowHeight)}
+}
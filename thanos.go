@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// The kinds of server that an endpoint can be.
+const (
+	backendPrometheus = "prometheus"
+	// backendThanos is a Thanos querier, which takes ThanosOptions.
+	backendThanos = "thanos"
+)
+
+// ThanosOptions are the query parameters of a Thanos querier beyond
+// those of Prometheus. Unset options are left to the querier's defaults.
+type ThanosOptions struct {
+	// Dedup merges series that differ only in their replica labels.
+	Dedup *bool `yaml:"dedup,omitempty"`
+	// PartialResponse returns what data there is, with a warning, when
+	// some stores fail, rather than failing the query.
+	PartialResponse *bool `yaml:"partial_response,omitempty"`
+	// MaxSourceResolution is the coarsest downsampled data to use, as a
+	// duration such as 5m, or auto.
+	MaxSourceResolution string `yaml:"max_source_resolution,omitempty"`
+}
+
+func (o ThanosOptions) validate() error {
+	if o.MaxSourceResolution != "" && o.MaxSourceResolution != "auto" {
+		if _, err := model.ParseDuration(o.MaxSourceResolution); err != nil {
+			return fmt.Errorf("bad max_source_resolution: %w", err)
+		}
+	}
+	return nil
+}
+
+// params returns the options as query parameters.
+func (o ThanosOptions) params() url.Values {
+	params := url.Values{}
+	if o.Dedup != nil {
+		params.Set("dedup", strconv.FormatBool(*o.Dedup))
+	}
+	if o.PartialResponse != nil {
+		params.Set("partial_response", strconv.FormatBool(*o.PartialResponse))
+	}
+	if o.MaxSourceResolution != "" {
+		params.Set("max_source_resolution", o.MaxSourceResolution)
+	}
+	return params
+}
+
+// partialResponsePrefix marks the warnings that a Thanos querier gives
+// when some of its stores did not answer, so that the data is partial.
+const partialResponsePrefix = "partial response: "
+
+// Query passes any extra parameters of the endpoint, and marks partial
+// responses, which v1.API cannot.
+func (s *apiSource) Query(ctx context.Context, query string, ts time.Time) (model.Value, v1.Warnings, error) {
+	if len(s.params) == 0 && !s.partial {
+		return s.API.Query(ctx, query, ts)
+	}
+	value, warnings, _, err := s.QueryWith(ctx, query, ts, queryOptions{})
+	return value, warnings, err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// palette names the colors that thresholds can use.
+var palette = map[string]color.NRGBA{
+	"green":  {R: 0x2e, G: 0x7d, B: 0x32, A: 255},
+	"yellow": {R: 0xd4, G: 0xaf, B: 0x37, A: 255},
+	"orange": {R: 0xe6, G: 0x7e, B: 0x22, A: 255},
+	"red":    {R: 0xc6, G: 0x28, B: 0x28, A: 255},
+	"blue":   {R: 0x15, G: 0x65, B: 0xc0, A: 255},
+	"gray":   {R: 0x75, G: 0x75, B: 0x75, A: 255},
+}
+
+type threshold struct {
+	limit float64
+	color color.NRGBA
+}
+
+// Thresholds color values by the first threshold whose limit they are
+// below. Values above every limit get the color of the final threshold.
+// The zero Thresholds colors nothing.
+type Thresholds []threshold
+
+// ParseThresholds parses a comma-separated list of colors with limits,
+// ascending, such as "green<0.8, yellow<0.95, red". The final color may
+// omit its limit to apply to all greater values.
+func ParseThresholds(spec string) (Thresholds, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var t Thresholds
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		name, limit := strings.TrimSpace(part), math.Inf(1)
+		if j := strings.Index(name, "<"); j >= 0 {
+			var err error
+			limit, err = strconv.ParseFloat(strings.TrimSpace(name[j+1:]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad threshold %q: %w", part, err)
+			}
+			name = strings.TrimSpace(name[:j])
+		} else if i != len(parts)-1 {
+			return nil, fmt.Errorf("threshold %q needs a limit, as only the last may omit it", part)
+		}
+		c, ok := palette[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown threshold color %q", name)
+		}
+		if len(t) > 0 && limit <= t[len(t)-1].limit {
+			return nil, fmt.Errorf("threshold limits must ascend")
+		}
+		t = append(t, threshold{limit: limit, color: c})
+	}
+	return t, nil
+}
+
+// String writes t as the spec ParseThresholds parses.
+func (t Thresholds) String() string {
+	parts := make([]string, len(t))
+	for i, th := range t {
+		name := ""
+		for n, c := range palette {
+			if c == th.color {
+				name = n
+			}
+		}
+		parts[i] = name
+		if !math.IsInf(th.limit, 1) {
+			parts[i] += "<" + strconv.FormatFloat(th.limit, 'g', -1, 64)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Color returns the color for v, if any.
+func (t Thresholds) Color(v float64) (color.NRGBA, bool) {
+	if len(t) == 0 || math.IsNaN(v) {
+		return color.NRGBA{}, false
+	}
+	for _, th := range t {
+		if v < th.limit {
+			return th.color, true
+		}
+	}
+	return t[len(t)-1].color, true
+}
+
+// thresholdDirective introduces a comment in a query that sets its
+// thresholds, overriding the global ones.
+const thresholdDirective = "thresholds:"
+
+// queryThresholds returns the threshold spec given by a comment in the
+// query text, such as
+//
+//	# thresholds: green<0.8, yellow<0.95, red
+func queryThresholds(text string) (string, bool) {
+	return queryDirective(text, thresholdDirective)
+}
+
+// queryDirective returns the rest of the first comment in the query text
+// that starts with directive.
+func queryDirective(text, directive string) (string, bool) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		comment := strings.TrimSpace(line[1:])
+		if strings.HasPrefix(comment, directive) {
+			return comment[len(directive):], true
+		}
+	}
+	return "", false
+}
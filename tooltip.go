@@ -0,0 +1,101 @@
+package main
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// hoverArea tracks the pointer over a widget so that a tooltip can be
+// shown next to it. It also notices right clicks, for a context menu,
+// and left clicks.
+type hoverArea struct {
+	hovered bool
+	pos     f32.Point
+	// menuAt is where the widget was last right-clicked, if menu is set.
+	menu    bool
+	menuAt  f32.Point
+	clicked bool
+}
+
+// Clicked reports whether the widget was left-clicked since the last
+// call.
+func (h *hoverArea) Clicked() bool {
+	clicked := h.clicked
+	h.clicked = false
+	return clicked
+}
+
+// ContextClicked reports where the widget was right-clicked, if it was
+// since the last call.
+func (h *hoverArea) ContextClicked() (f32.Point, bool) {
+	clicked := h.menu
+	h.menu = false
+	return h.menuAt, clicked
+}
+
+// Layout draws w and, while the pointer is over it, a tooltip with the
+// text tip beside the pointer. An empty tip shows nothing.
+func (h *hoverArea) Layout(gtx C, th *material.Theme, tip string, w layout.Widget) D {
+	for _, e := range gtx.Events(h) {
+		e, ok := e.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch e.Type {
+		case pointer.Enter, pointer.Move:
+			h.hovered, h.pos = true, e.Position
+		case pointer.Leave, pointer.Cancel:
+			h.hovered = false
+		case pointer.Press:
+			switch {
+			case e.Buttons.Contain(pointer.ButtonRight):
+				h.menu, h.menuAt = true, e.Position
+			case e.Buttons.Contain(pointer.ButtonLeft):
+				h.clicked = true
+			}
+		}
+	}
+	dims := w(gtx)
+	stack := op.Save(gtx.Ops)
+	pointer.Rect(image.Rectangle{Max: dims.Size}).Add(gtx.Ops)
+	pointer.InputOp{Tag: h, Types: pointer.Enter | pointer.Leave | pointer.Move | pointer.Press}.Add(gtx.Ops)
+	stack.Load()
+	if h.hovered && tip != "" {
+		macro := op.Record(gtx.Ops)
+		offset := gtx.Px(unit.Dp(16))
+		op.Offset(h.pos.Add(f32.Pt(float32(offset), float32(offset)))).Add(gtx.Ops)
+		gtx := gtx
+		gtx.Constraints = layout.Constraints{Max: image.Pt(gtx.Px(unit.Dp(600)), gtx.Px(unit.Dp(400)))}
+		layoutTooltip(gtx, th, tip)
+		op.Defer(gtx.Ops, macro.Stop())
+	}
+	return dims
+}
+
+// layoutTooltip draws text in a bordered box.
+func layoutTooltip(gtx C, th *material.Theme, text string) D {
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx C) D {
+			paint.FillShape(gtx.Ops, th.Bg, clip.Rect{Max: gtx.Constraints.Min}.Op())
+			return D{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx C) D {
+			return widget.Border{Width: unit.Dp(1), Color: th.Fg}.Layout(gtx, func(gtx C) D {
+				return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx C) D {
+					label := material.Body2(th, text)
+					label.Font.Variant = "Mono"
+					return label.Layout(gtx)
+				})
+			})
+		}),
+	)
+}
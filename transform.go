@@ -0,0 +1,438 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/prometheus/common/model"
+)
+
+// sampleEnv is what a transform is evaluated against: one sample and the
+// labels of its series.
+type sampleEnv struct {
+	metric model.Metric
+	value  float64
+	time   model.Time
+}
+
+// operand is a compiled subexpression of a transform, of which exactly
+// one function is set, according to its type.
+type operand struct {
+	num  func(*sampleEnv) float64
+	str  func(*sampleEnv) string
+	cond func(*sampleEnv) bool
+}
+
+func (o operand) kind() string {
+	switch {
+	case o.num != nil:
+		return "number"
+	case o.str != nil:
+		return "string"
+	}
+	return "condition"
+}
+
+// Transform rewrites the samples of a result before it is displayed. It
+// is an expression over a sample, in which value is its value, time its
+// timestamp in seconds and any other name the value of one of its
+// labels. A numeric expression, such as
+//
+//	value * 100
+//
+// replaces the value of each sample, while a condition, such as
+//
+//	code =~ "5.." && value > 0
+//
+// keeps only the samples for which it holds. The zero Transform leaves
+// results as they are.
+type Transform struct {
+	spec string
+	expr operand
+}
+
+// ParseTransform parses the expression of a transform.
+func ParseTransform(spec string) (Transform, error) {
+	if strings.TrimSpace(spec) == "" {
+		return Transform{}, nil
+	}
+	p, err := newTransformParser(spec)
+	if err != nil {
+		return Transform{}, err
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return Transform{}, fmt.Errorf("bad transform %q: %w", spec, err)
+	}
+	if tok := p.peek(); tok != "" {
+		return Transform{}, fmt.Errorf("bad transform %q: unexpected %q", spec, tok)
+	}
+	if expr.str != nil {
+		return Transform{}, fmt.Errorf("bad transform %q: it must give a number or a condition, not a string", spec)
+	}
+	return Transform{spec: spec, expr: expr}, nil
+}
+
+func (t Transform) String() string {
+	return t.spec
+}
+
+// Apply returns v with the transform applied to each of its samples,
+// dropping the series left with none. v itself is left unchanged.
+func (t Transform) Apply(v model.Value) model.Value {
+	if t.spec == "" {
+		return v
+	}
+	switch v := v.(type) {
+	case model.Vector:
+		var out model.Vector
+		for _, s := range v {
+			if value, ok := t.sample(s.Metric, s.Value, s.Timestamp); ok {
+				out = append(out, &model.Sample{Metric: s.Metric, Value: value, Timestamp: s.Timestamp})
+			}
+		}
+		return out
+	case model.Matrix:
+		var out model.Matrix
+		for _, ss := range v {
+			var values []model.SamplePair
+			for _, p := range ss.Values {
+				if value, ok := t.sample(ss.Metric, p.Value, p.Timestamp); ok {
+					values = append(values, model.SamplePair{Timestamp: p.Timestamp, Value: value})
+				}
+			}
+			if len(values) > 0 {
+				out = append(out, &model.SampleStream{Metric: ss.Metric, Values: values})
+			}
+		}
+		return out
+	case *model.Scalar:
+		value, ok := t.sample(nil, v.Value, v.Timestamp)
+		if !ok {
+			return nil
+		}
+		return &model.Scalar{Value: value, Timestamp: v.Timestamp}
+	}
+	return v
+}
+
+// sample transforms a sample, reporting whether it is kept.
+func (t Transform) sample(m model.Metric, v model.SampleValue, ts model.Time) (model.SampleValue, bool) {
+	env := &sampleEnv{metric: m, value: float64(v), time: ts}
+	if t.expr.cond != nil {
+		return v, t.expr.cond(env)
+	}
+	return model.SampleValue(t.expr.num(env)), true
+}
+
+// transformDirective introduces a comment in a query that sets its
+// transform, overriding the global one.
+const transformDirective = "transform:"
+
+// transformFuncs are the functions of a number that a transform can call.
+var transformFuncs = map[string]func(float64) float64{
+	"abs":   math.Abs,
+	"ceil":  math.Ceil,
+	"floor": math.Floor,
+	"round": math.Round,
+	"sqrt":  math.Sqrt,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log2":  math.Log2,
+	"log10": math.Log10,
+}
+
+// transformParser parses a transform by recursive descent, compiling it as
+// it goes.
+type transformParser struct {
+	tokens []string
+	pos    int
+}
+
+// transformOps are the operators of more than one character.
+var transformOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~"}
+
+func newTransformParser(spec string) (*transformParser, error) {
+	var (
+		s   scanner.Scanner
+		err error
+	)
+	s.Init(strings.NewReader(spec))
+	s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanStrings | scanner.ScanRawStrings
+	s.Error = func(_ *scanner.Scanner, msg string) {
+		err = fmt.Errorf("bad transform %q: %s", spec, msg)
+	}
+	p := &transformParser{}
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		text := s.TokenText()
+		for _, op := range transformOps {
+			if rune(op[0]) == tok && s.Peek() == rune(op[1]) {
+				s.Next()
+				text = op
+				break
+			}
+		}
+		p.tokens = append(p.tokens, text)
+	}
+	return p, err
+}
+
+func (p *transformParser) peek() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *transformParser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *transformParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+func (p *transformParser) parseOr() (operand, error) {
+	x, err := p.parseAnd()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var y operand
+		if y, err = p.parseAnd(); err == nil {
+			x, err = logical("||", x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *transformParser) parseAnd() (operand, error) {
+	x, err := p.parseComparison()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var y operand
+		if y, err = p.parseComparison(); err == nil {
+			x, err = logical("&&", x, y)
+		}
+	}
+	return x, err
+}
+
+func logical(op string, x, y operand) (operand, error) {
+	if x.cond == nil || y.cond == nil {
+		return operand{}, fmt.Errorf("%s needs conditions, not a %s and a %s", op, x.kind(), y.kind())
+	}
+	if op == "&&" {
+		return operand{cond: func(e *sampleEnv) bool { return x.cond(e) && y.cond(e) }}, nil
+	}
+	return operand{cond: func(e *sampleEnv) bool { return x.cond(e) || y.cond(e) }}, nil
+}
+
+func (p *transformParser) parseComparison() (operand, error) {
+	x, err := p.parseSum()
+	if err != nil {
+		return x, err
+	}
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", ">", "<=", ">=":
+		p.next()
+		y, err := p.parseSum()
+		if err != nil {
+			return y, err
+		}
+		return compare(op, x, y)
+	case "=~", "!~":
+		p.next()
+		tok := p.next()
+		pattern, err := strconv.Unquote(tok)
+		if err != nil {
+			return operand{}, fmt.Errorf("%s needs a quoted pattern, got %q", op, tok)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return operand{}, err
+		}
+		if x.str == nil {
+			return operand{}, fmt.Errorf("%s needs a string, not a %s", op, x.kind())
+		}
+		match := op == "=~"
+		return operand{cond: func(e *sampleEnv) bool { return re.MatchString(x.str(e)) == match }}, nil
+	}
+	return x, nil
+}
+
+func compare(op string, x, y operand) (operand, error) {
+	if x.num != nil && y.num != nil {
+		var c func(a, b float64) bool
+		switch op {
+		case "==":
+			c = func(a, b float64) bool { return a == b }
+		case "!=":
+			c = func(a, b float64) bool { return a != b }
+		case "<":
+			c = func(a, b float64) bool { return a < b }
+		case ">":
+			c = func(a, b float64) bool { return a > b }
+		case "<=":
+			c = func(a, b float64) bool { return a <= b }
+		case ">=":
+			c = func(a, b float64) bool { return a >= b }
+		}
+		return operand{cond: func(e *sampleEnv) bool { return c(x.num(e), y.num(e)) }}, nil
+	}
+	if x.str != nil && y.str != nil && (op == "==" || op == "!=") {
+		equal := op == "=="
+		return operand{cond: func(e *sampleEnv) bool { return (x.str(e) == y.str(e)) == equal }}, nil
+	}
+	return operand{}, fmt.Errorf("cannot compare a %s and a %s with %s", x.kind(), y.kind(), op)
+}
+
+func (p *transformParser) parseSum() (operand, error) {
+	x, err := p.parseProduct()
+	for err == nil && (p.peek() == "+" || p.peek() == "-") {
+		op := p.next()
+		var y operand
+		if y, err = p.parseProduct(); err == nil {
+			x, err = arithmetic(op, x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *transformParser) parseProduct() (operand, error) {
+	x, err := p.parseUnary()
+	for err == nil && (p.peek() == "*" || p.peek() == "/" || p.peek() == "%") {
+		op := p.next()
+		var y operand
+		if y, err = p.parseUnary(); err == nil {
+			x, err = arithmetic(op, x, y)
+		}
+	}
+	return x, err
+}
+
+func arithmetic(op string, x, y operand) (operand, error) {
+	if x.num == nil || y.num == nil {
+		return operand{}, fmt.Errorf("%s needs numbers, not a %s and a %s", op, x.kind(), y.kind())
+	}
+	var f func(*sampleEnv) float64
+	switch op {
+	case "+":
+		f = func(e *sampleEnv) float64 { return x.num(e) + y.num(e) }
+	case "-":
+		f = func(e *sampleEnv) float64 { return x.num(e) - y.num(e) }
+	case "*":
+		f = func(e *sampleEnv) float64 { return x.num(e) * y.num(e) }
+	case "/":
+		f = func(e *sampleEnv) float64 { return x.num(e) / y.num(e) }
+	case "%":
+		f = func(e *sampleEnv) float64 { return math.Mod(x.num(e), y.num(e)) }
+	}
+	return operand{num: f}, nil
+}
+
+func (p *transformParser) parseUnary() (operand, error) {
+	switch p.peek() {
+	case "-":
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return x, err
+		}
+		if x.num == nil {
+			return operand{}, fmt.Errorf("- needs a number, not a %s", x.kind())
+		}
+		return operand{num: func(e *sampleEnv) float64 { return -x.num(e) }}, nil
+	case "!":
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return x, err
+		}
+		if x.cond == nil {
+			return operand{}, fmt.Errorf("! needs a condition, not a %s", x.kind())
+		}
+		return operand{cond: func(e *sampleEnv) bool { return !x.cond(e) }}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *transformParser) parsePrimary() (operand, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return operand{}, fmt.Errorf("unexpected end")
+	case tok == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return x, err
+		}
+		return x, p.expect(")")
+	case tok[0] == '"' || tok[0] == '`':
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return operand{}, fmt.Errorf("bad string %s", tok)
+		}
+		return operand{str: func(*sampleEnv) string { return s }}, nil
+	case tok[0] >= '0' && tok[0] <= '9' || tok[0] == '.':
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return operand{}, fmt.Errorf("bad number %s", tok)
+		}
+		return operand{num: func(*sampleEnv) float64 { return n }}, nil
+	case !model.LabelName(tok).IsValid():
+		return operand{}, fmt.Errorf("unexpected %q", tok)
+	case p.peek() == "(":
+		return p.parseCall(tok)
+	case tok == "value":
+		return operand{num: func(e *sampleEnv) float64 { return e.value }}, nil
+	case tok == "time":
+		return operand{num: func(e *sampleEnv) float64 { return float64(e.time) / 1000 }}, nil
+	}
+	name := model.LabelName(tok)
+	return operand{str: func(e *sampleEnv) string { return string(e.metric[name]) }}, nil
+}
+
+// parseCall parses the arguments of a call of the named function. Besides
+// those of transformFuncs, num converts a string to a number, or NaN if it
+// is not one.
+func (p *transformParser) parseCall(name string) (operand, error) {
+	p.next()
+	x, err := p.parseOr()
+	if err != nil {
+		return x, err
+	}
+	if err := p.expect(")"); err != nil {
+		return operand{}, err
+	}
+	if name == "num" {
+		if x.str == nil {
+			return operand{}, fmt.Errorf("num needs a string, not a %s", x.kind())
+		}
+		return operand{num: func(e *sampleEnv) float64 {
+			n, err := strconv.ParseFloat(x.str(e), 64)
+			if err != nil {
+				return math.NaN()
+			}
+			return n
+		}}, nil
+	}
+	f, ok := transformFuncs[name]
+	if !ok {
+		return operand{}, fmt.Errorf("unknown function %q", name)
+	}
+	if x.num == nil {
+		return operand{}, fmt.Errorf("%s needs a number, not a %s", name, x.kind())
+	}
+	return operand{num: func(e *sampleEnv) float64 { return f(x.num(e)) }}, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestTransformApply(t *testing.T) {
+	api := model.Metric{"__name__": "http_requests", "job": "api", "code": "500"}
+	web := model.Metric{"__name__": "http_requests", "job": "web", "code": "200"}
+	// bare has none of the labels that the transforms name.
+	bare := model.Metric{"__name__": "up"}
+	vector := model.Vector{
+		{Metric: api, Value: 2, Timestamp: 1000},
+		{Metric: web, Value: 0.5, Timestamp: 1000},
+		{Metric: bare, Value: 1, Timestamp: 1000},
+	}
+	matrix := model.Matrix{
+		{Metric: api, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 3}}},
+		{Metric: web, Values: []model.SamplePair{{Timestamp: 1000, Value: 0}, {Timestamp: 2000, Value: 0}}},
+	}
+	for _, tt := range []struct {
+		name, spec string
+		in         model.Value
+		want       model.Value
+	}{
+		{"none", "", vector, vector},
+		{"scale", "value * 100", vector, model.Vector{
+			{Metric: api, Value: 200, Timestamp: 1000},
+			{Metric: web, Value: 50, Timestamp: 1000},
+			{Metric: bare, Value: 100, Timestamp: 1000},
+		}},
+		{"precedence", "-value + 2 * 3", vector, model.Vector{
+			{Metric: api, Value: 4, Timestamp: 1000},
+			{Metric: web, Value: 5.5, Timestamp: 1000},
+			{Metric: bare, Value: 5, Timestamp: 1000},
+		}},
+		{"time", "time", vector, model.Vector{
+			{Metric: api, Value: 1, Timestamp: 1000},
+			{Metric: web, Value: 1, Timestamp: 1000},
+			{Metric: bare, Value: 1, Timestamp: 1000},
+		}},
+		{"function", "round(value)", vector, model.Vector{
+			{Metric: api, Value: 2, Timestamp: 1000},
+			{Metric: web, Value: 1, Timestamp: 1000},
+			{Metric: bare, Value: 1, Timestamp: 1000},
+		}},
+		{"filter by label", `code =~ "5.."`, vector, model.Vector{
+			{Metric: api, Value: 2, Timestamp: 1000},
+		}},
+		{"filter by value", "value >= 1 && !(job == \"api\")", vector, model.Vector{
+			{Metric: bare, Value: 1, Timestamp: 1000},
+		}},
+		{"missing label is empty", `job == ""`, vector, model.Vector{
+			{Metric: bare, Value: 1, Timestamp: 1000},
+		}},
+		{"missing label negated", `job != ""`, vector, model.Vector{
+			{Metric: api, Value: 2, Timestamp: 1000},
+			{Metric: web, Value: 0.5, Timestamp: 1000},
+		}},
+		{"number of label", `num(code) / 100`, vector, model.Vector{
+			{Metric: api, Value: 5, Timestamp: 1000},
+			{Metric: web, Value: 2, Timestamp: 1000},
+			{Metric: bare, Value: model.SampleValue(math.NaN()), Timestamp: 1000},
+		}},
+		{"filter drops all", "value > 10", vector, model.Vector(nil)},
+		{"empty vector", "value * 2", model.Vector{}, model.Vector(nil)},
+		{"nil vector", `job == "api"`, model.Vector(nil), model.Vector(nil)},
+		{"matrix", "value + 1", matrix, model.Matrix{
+			{Metric: api, Values: []model.SamplePair{{Timestamp: 1000, Value: 2}, {Timestamp: 2000, Value: 4}}},
+			{Metric: web, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 1}}},
+		}},
+		{"matrix drops emptied series", "value > 2", matrix, model.Matrix{
+			{Metric: api, Values: []model.SamplePair{{Timestamp: 2000, Value: 3}}},
+		}},
+		{"empty matrix", "value > 2", model.Matrix{}, model.Matrix(nil)},
+		{"scalar", "value * 2", &model.Scalar{Value: 3, Timestamp: 1000}, &model.Scalar{Value: 6, Timestamp: 1000}},
+		{"scalar kept", "value > 2", &model.Scalar{Value: 3, Timestamp: 1000}, &model.Scalar{Value: 3, Timestamp: 1000}},
+		{"scalar has no labels", `job == "api"`, &model.Scalar{Value: 3, Timestamp: 1000}, nil},
+		{"string left alone", "value * 2", &model.String{Value: "x", Timestamp: 1000}, &model.String{Value: "x", Timestamp: 1000}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := ParseTransform(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tr.Apply(tt.in)
+			if valueString(got) != valueString(tt.want) {
+				t.Errorf("%q applied to\n%s\n= %s\nwant %s", tt.spec, valueString(tt.in), valueString(got), valueString(tt.want))
+			}
+		})
+	}
+}
+
+// valueString renders v, or nil, for comparison.
+func valueString(v model.Value) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return v.Type().String() + ": " + v.String()
+}
+
+func TestParseTransformErrors(t *testing.T) {
+	for _, tt := range []struct {
+		spec, want string
+	}{
+		{`job`, "not a string"},
+		{`value +`, "unexpected end"},
+		{`(value`, `expected ")"`},
+		{`value value`, `unexpected "value"`},
+		{`job * 2`, "* needs numbers, not a string and a number"},
+		{`value && job == "api"`, "&& needs conditions"},
+		{`value =~ "a"`, "=~ needs a string, not a number"},
+		{`job =~ a`, "needs a quoted pattern"},
+		{`job =~ "("`, "missing closing )"},
+		{`job < "a"`, "cannot compare a string and a string with <"},
+		{`-job`, "- needs a number, not a string"},
+		{`!value`, "! needs a condition, not a number"},
+		{`frob(value)`, `unknown function "frob"`},
+		{`abs(job)`, "abs needs a number, not a string"},
+		{`num(value)`, "num needs a string, not a number"},
+	} {
+		_, err := ParseTransform(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseTransform(%q) = %v, want an error containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// resultTSV writes v as tab-separated values for pasting into a
+// spreadsheet: a column for each label of any series, with the metric
+// name first, then the time and value of each sample. Series without a
+// label leave its cell empty, so the columns line up.
+func resultTSV(v model.Value) string {
+	type sample struct {
+		metric model.Metric
+		model.SamplePair
+	}
+	var samples []sample
+	switch v := v.(type) {
+	case model.Vector:
+		for _, s := range v {
+			samples = append(samples, sample{s.Metric, model.SamplePair{Timestamp: s.Timestamp, Value: s.Value}})
+		}
+	case model.Matrix:
+		for _, ss := range v {
+			for _, p := range ss.Values {
+				samples = append(samples, sample{ss.Metric, p})
+			}
+		}
+	case *model.Scalar:
+		samples = append(samples, sample{model.Metric{}, model.SamplePair{Timestamp: v.Timestamp, Value: v.Value}})
+	}
+	if len(samples) == 0 {
+		return ""
+	}
+	metrics := make([]model.Metric, len(samples))
+	for i, s := range samples {
+		metrics[i] = s.metric
+	}
+	names := columnLabels(metrics)
+	var b strings.Builder
+	row := func(cells []string) {
+		for i, c := range cells {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			b.WriteString(tsvCell(c))
+		}
+		b.WriteByte('\n')
+	}
+	header := make([]string, 0, len(names)+2)
+	for _, name := range names {
+		header = append(header, string(name))
+	}
+	row(append(header, "time", "value"))
+	for _, s := range samples {
+		cells := make([]string, 0, len(names)+2)
+		for _, name := range names {
+			cells = append(cells, string(s.metric[name]))
+		}
+		cells = append(cells,
+			s.Timestamp.Time().UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(float64(s.Value), 'g', -1, 64),
+		)
+		row(cells)
+	}
+	return b.String()
+}
+
+// columnLabels are the names of the labels of any of metrics, each
+// making a column of a table of them, with the metric name first, like
+// in a selector, and the rest in order.
+func columnLabels(metrics []model.Metric) model.LabelNames {
+	seen := map[model.LabelName]bool{}
+	var names model.LabelNames
+	for _, m := range metrics {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == model.MetricNameLabel) != (names[j] == model.MetricNameLabel) {
+			return names[i] == model.MetricNameLabel
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// tsvCell replaces the tabs and line breaks in a cell, which would
+// otherwise split it.
+func tsvCell(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
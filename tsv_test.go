@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestResultTSVAlignsHeterogeneousLabels(t *testing.T) {
+	at := model.TimeFromUnix(1600000000)
+	v := model.Vector{
+		{Metric: model.Metric{"__name__": "up", "job": "api", "instance": "a:9090"}, Value: 1, Timestamp: at},
+		{Metric: model.Metric{"job": "web", "zone": "eu"}, Value: 0, Timestamp: at},
+		{Metric: model.Metric{"__name__": "up", "tab": "x\ty"}, Value: 0.5, Timestamp: at},
+		{Metric: model.Metric{}, Value: 2, Timestamp: at},
+	}
+	want := []string{
+		"__name__\tinstance\tjob\ttab\tzone\ttime\tvalue",
+		"up\ta:9090\tapi\t\t\t2020-09-13T12:26:40Z\t1",
+		"\t\tweb\t\teu\t2020-09-13T12:26:40Z\t0",
+		"up\t\t\tx y\t\t2020-09-13T12:26:40Z\t0.5",
+		"\t\t\t\t\t2020-09-13T12:26:40Z\t2",
+	}
+	got := strings.Split(strings.TrimSuffix(resultTSV(v), "\n"), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d = %q, want %q", i, got[i], want[i])
+		}
+		if n, m := strings.Count(got[i], "\t"), strings.Count(want[0], "\t"); n != m {
+			t.Errorf("row %d has %d tabs, want %d like the header", i, n, m)
+		}
+	}
+}
+
+func TestResultTSVMatrix(t *testing.T) {
+	v := model.Matrix{
+		{Metric: model.Metric{"job": "api"}, Values: []model.SamplePair{{Timestamp: 0, Value: 1}, {Timestamp: 1000, Value: 2}}},
+		{Metric: model.Metric{"env": "prod"}, Values: []model.SamplePair{{Timestamp: 0, Value: 3}}},
+	}
+	want := "env\tjob\ttime\tvalue\n" +
+		"\tapi\t1970-01-01T00:00:00Z\t1\n" +
+		"\tapi\t1970-01-01T00:00:01Z\t2\n" +
+		"prod\t\t1970-01-01T00:00:00Z\t3\n"
+	if got := resultTSV(v); got != want {
+		t.Errorf("resultTSV() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestResultTSVEmpty(t *testing.T) {
+	for _, v := range []model.Value{nil, model.Vector{}, model.Matrix{}, &model.String{Value: "x"}} {
+		if got := resultTSV(v); got != "" {
+			t.Errorf("resultTSV(%v) = %q, want empty", v, got)
+		}
+	}
+}
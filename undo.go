@@ -0,0 +1,66 @@
+package main
+
+import (
+	"gioui.org/widget"
+)
+
+// undoLimit bounds the number of states kept for undo.
+const undoLimit = 100
+
+type editorState struct {
+	text       string
+	start, end int
+}
+
+// undoHistory tracks the states of an editor so that edits, including
+// those made by formatting and macros, can be undone and redone.
+type undoHistory struct {
+	undo, redo []editorState
+	current    editorState
+}
+
+// Record notes the editor's current state after a change, making the
+// previous state available to Undo. It reports whether the text actually
+// changed, which is not the case after Undo and Redo restore a state.
+func (h *undoHistory) Record(ed *widget.Editor) bool {
+	start, end := ed.Selection()
+	state := editorState{text: ed.Text(), start: start, end: end}
+	if state.text == h.current.text {
+		h.current = state
+		return false
+	}
+	h.undo = append(h.undo, h.current)
+	if len(h.undo) > undoLimit {
+		h.undo = h.undo[len(h.undo)-undoLimit:]
+	}
+	h.redo = h.redo[:0]
+	h.current = state
+	return true
+}
+
+// Undo restores the state before the most recent change.
+func (h *undoHistory) Undo(ed *widget.Editor) {
+	if len(h.undo) == 0 {
+		return
+	}
+	h.redo = append(h.redo, h.current)
+	h.current = h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	h.restore(ed)
+}
+
+// Redo reapplies the most recently undone change.
+func (h *undoHistory) Redo(ed *widget.Editor) {
+	if len(h.redo) == 0 {
+		return
+	}
+	h.undo = append(h.undo, h.current)
+	h.current = h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	h.restore(ed)
+}
+
+func (h *undoHistory) restore(ed *widget.Editor) {
+	ed.SetText(h.current.text)
+	ed.SetCaret(h.current.start, h.current.end)
+}
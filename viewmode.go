@@ -0,0 +1,108 @@
+package main
+
+import "github.com/prometheus/common/model"
+
+// A viewMode is the way a pane shows its result.
+type viewMode int
+
+const (
+	// viewBoth shows the result as text beside its chart.
+	viewBoth viewMode = iota
+	// viewText shows only the text, across the whole pane.
+	viewText
+	// viewChart shows only the chart, or the grid of targets.
+	viewChart
+)
+
+func (m viewMode) String() string {
+	switch m {
+	case viewText:
+		return "text"
+	case viewChart:
+		return "chart"
+	}
+	return "text and chart"
+}
+
+// viewModes are the modes that apply to showing v, in the order they are
+// cycled through. A result with nothing to chart can only be text.
+func viewModes(v model.Value, targets bool) []viewMode {
+	if targets || charted(v) {
+		return []viewMode{viewBoth, viewText, viewChart}
+	}
+	return []viewMode{viewText}
+}
+
+// resultViews remembers the view mode chosen for each type of result.
+type resultViews struct {
+	chosen map[model.ValueType]viewMode
+}
+
+func valueType(v model.Value) model.ValueType {
+	if v == nil {
+		return model.ValNone
+	}
+	return v.Type()
+}
+
+// Mode is the view mode of v: the one last chosen for its type if it
+// applies, or else the first that does.
+func (r *resultViews) Mode(v model.Value, targets bool) viewMode {
+	modes := viewModes(v, targets)
+	if m, ok := r.chosen[valueType(v)]; ok {
+		for _, mode := range modes {
+			if mode == m {
+				return m
+			}
+		}
+	}
+	return modes[0]
+}
+
+// ShowChart chooses to show the chart of results of type t, beside their
+// text, unless a mode showing it is chosen already.
+func (r *resultViews) ShowChart(t model.ValueType) {
+	if m, ok := r.chosen[t]; ok && m != viewText {
+		return
+	}
+	if r.chosen == nil {
+		r.chosen = map[model.ValueType]viewMode{}
+	}
+	r.chosen[t] = viewBoth
+}
+
+// Cycle chooses the next view mode that applies to v, remembering it
+// for later results of the same type.
+func (r *resultViews) Cycle(v model.Value, targets bool) {
+	modes := viewModes(v, targets)
+	current := r.Mode(v, targets)
+	next := modes[0]
+	for i, mode := range modes {
+		if mode == current {
+			next = modes[(i+1)%len(modes)]
+		}
+	}
+	if r.chosen == nil {
+		r.chosen = map[model.ValueType]viewMode{}
+	}
+	r.chosen[valueType(v)] = next
+}
+
+// parseViewMode parses a view mode as written by its String method.
+func parseViewMode(s string) (viewMode, bool) {
+	for _, m := range []viewMode{viewBoth, viewText, viewChart} {
+		if m.String() == s {
+			return m, true
+		}
+	}
+	return viewBoth, false
+}
+
+// ChooseAll chooses m for results of every type, each of which is shown
+// by its first mode instead if m does not apply to it.
+func (r *resultViews) ChooseAll(m viewMode) {
+	r.chosen = map[model.ValueType]viewMode{}
+	for _, t := range []model.ValueType{model.ValNone, model.ValScalar, model.ValVector, model.ValMatrix, model.ValString} {
+		r.chosen[t] = m
+	}
+}
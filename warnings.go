@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget/material"
+)
+
+// partialHints are phrases, in lower case, of the warnings that servers
+// give when they return only part of the data asked for.
+var partialHints = []string{
+	strings.TrimSpace(partialResponsePrefix),
+	"partial data",
+	"partial result",
+	"incomplete",
+	"may be missing",
+	"might be missing",
+	"receive series from",
+}
+
+// isPartial reports whether the warning w means that a result may be
+// missing data.
+func isPartial(w string) bool {
+	w = strings.ToLower(w)
+	for _, hint := range partialHints {
+		if strings.Contains(w, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWarnings separates the warnings of partial data from the others.
+func splitWarnings(warnings []string) (partial, other []string) {
+	for _, w := range warnings {
+		if isPartial(w) {
+			partial = append(partial, w)
+		} else {
+			other = append(other, w)
+		}
+	}
+	return partial, other
+}
+
+// layoutPartialBanner draws a banner warning that the result may be
+// incomplete, above the warnings that say why.
+func layoutPartialBanner(gtx C, th *material.Theme, inset layout.Inset, warnings []string) D {
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx C) D {
+			paint.FillShape(gtx.Ops, palette["orange"], clip.Rect{Max: gtx.Constraints.Min}.Op())
+			return D{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx C) D {
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			children := []layout.FlexChild{
+				layout.Rigid(func(gtx C) D {
+					label := material.H6(th, "Results may be incomplete")
+					label.Color = th.Bg
+					return inset.Layout(gtx, label.Layout)
+				}),
+			}
+			for _, w := range warnings {
+				w := w
+				children = append(children, layout.Rigid(func(gtx C) D {
+					label := material.Body2(th, w)
+					label.Font.Variant = "Mono"
+					label.Color = th.Bg
+					label.MaxLines = 2
+					return inset.Layout(gtx, label.Layout)
+				}))
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		}),
+	)
+}
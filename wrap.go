@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/whereswaldon/binnacle/latest"
+	"github.com/whereswaldon/binnacle/promql"
+)
+
+// wrapPlaceholder stands for the selector in the template of a wrapper.
+const wrapPlaceholder = "{selector}"
+
+// noWrapDirective introduces a comment in a query that keeps its selector
+// from being wrapped.
+const noWrapDirective = "nowrap"
+
+// Wrappers are the templates of the functions that a query of just the
+// selector of a counter, or of a gauge, is wrapped in when submitted, such
+// as "rate({selector}[5m])". Each is empty to leave such queries be.
+type Wrappers struct {
+	Counter, Gauge string
+}
+
+// checkWrapper reports whether tmpl is a usable wrapper template.
+func checkWrapper(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	if !strings.Contains(tmpl, wrapPlaceholder) {
+		return fmt.Errorf("wrapper %q does not contain %s", tmpl, wrapPlaceholder)
+	}
+	e, err := promql.Parse(strings.ReplaceAll(tmpl, wrapPlaceholder, "x"))
+	if err != nil {
+		return fmt.Errorf("wrapper %q does not make a valid query: %w", tmpl, err)
+	}
+	if e.Type() != promql.ValueTypeVector {
+		return fmt.Errorf("wrapper %q gives a %s, not an instant vector", tmpl, e.Type())
+	}
+	return nil
+}
+
+// template is the wrapper for metrics of type t, if any.
+func (w Wrappers) template(t v1.MetricType) string {
+	switch t {
+	case v1.MetricTypeCounter:
+		return w.Counter
+	case v1.MetricTypeGauge:
+		return w.Gauge
+	}
+	return ""
+}
+
+// bareSelector returns the selector that the query text consists of, if
+// it is nothing else but comments, none of them opting out of wrapping.
+func bareSelector(text string) (*promql.VectorSelector, bool) {
+	if _, ok := queryDirective(text, noWrapDirective); ok {
+		return nil, false
+	}
+	e, err := promql.Parse(text)
+	if err != nil {
+		return nil, false
+	}
+	vs, ok := e.(*promql.VectorSelector)
+	return vs, ok && vs.Name != ""
+}
+
+// wrapQuery replaces the selector vs of the query text with tmpl around
+// it, leaving the rest of text, such as comments, as it is.
+func wrapQuery(text string, vs *promql.VectorSelector, tmpl string) string {
+	r := vs.PositionRange()
+	return text[:r.Start] + strings.ReplaceAll(tmpl, wrapPlaceholder, text[r.Start:r.End]) + text[r.End:]
+}
+
+type wrapRequest struct {
+	text, metric string
+}
+
+type wrapResponse struct {
+	text       string
+	metricType v1.MetricType
+}
+
+// autoWrap wraps a query of just a selector in the function configured for
+// the type of its metric, when it is submitted, and offers to undo that.
+// The type is looked up in the metadata in the background.
+type autoWrap struct {
+	wrappers Wrappers
+	fetcher  latest.Worker
+	pending  bool
+	// original and wrapped are the query before and after it was last
+	// wrapped, and kind the type of its metric, for the hint shown while
+	// the query is as wrapped.
+	original, wrapped, kind string
+	// Undo puts back the original query, which is then added to kept,
+	// the queries never to be wrapped again.
+	Undo widget.Clickable
+	kept map[string]bool
+}
+
+func newAutoWrap(b *Backend, w Wrappers) *autoWrap {
+	a := &autoWrap{wrappers: w, kept: map[string]bool{}}
+	a.fetcher = latest.NewWorker(func(in interface{}) interface{} {
+		req := in.(wrapRequest)
+		resp := wrapResponse{text: req.text}
+		if src, ok := b.Source.(MetadataSource); ok {
+			resp.metricType, _ = metricType(src, b, req.metric)
+		}
+		return resp
+	})
+	return a
+}
+
+// Submit looks up the type of the metric selected, if the query text is
+// nothing but a selector, for Wrapped to wrap it.
+func (a *autoWrap) Submit(text string) {
+	if a.wrappers == (Wrappers{}) || a.kept[text] {
+		return
+	}
+	vs, ok := bareSelector(text)
+	if !ok {
+		return
+	}
+	a.pending = true
+	a.fetcher.Push(wrapRequest{text: text, metric: vs.Name})
+}
+
+// Wrapped returns the query text wrapped, once the type of its metric has
+// arrived, if the query is still text and there is a wrapper for the type.
+func (a *autoWrap) Wrapped(gtx C, text string) (string, bool) {
+	select {
+	case r := <-a.fetcher.Raw():
+		a.pending = false
+		resp := r.(wrapResponse)
+		tmpl := a.wrappers.template(resp.metricType)
+		vs, ok := bareSelector(text)
+		if resp.text != text || tmpl == "" || !ok {
+			return "", false
+		}
+		a.original, a.wrapped, a.kind = text, wrapQuery(text, vs, tmpl), string(resp.metricType)
+		return a.wrapped, true
+	default:
+		if a.pending {
+			op.InvalidateOp{}.Add(gtx.Ops)
+		}
+		return "", false
+	}
+}
+
+// Undone returns the query as it was before being wrapped, if Undo has
+// been clicked while the query text is as wrapped.
+func (a *autoWrap) Undone(text string) (string, bool) {
+	if !a.Undo.Clicked() || a.wrapped == "" || text != a.wrapped {
+		return "", false
+	}
+	a.kept[a.original] = true
+	original := a.original
+	a.original, a.wrapped = "", ""
+	return original, true
+}
+
+// Layout shows what the query was wrapped in while it still is.
+func (a *autoWrap) Layout(gtx C, th *material.Theme, inset layout.Inset, text string) D {
+	if a.wrapped == "" || text != a.wrapped {
+		return D{}
+	}
+	msg := fmt.Sprintf("the selector is of a %s, so it was wrapped as --wrap-%ss sets; undo puts it back, as a \"# %s\" comment in a query keeps it as it is", a.kind, a.kind, noWrapDirective)
+	return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+		layout.Flexed(1, func(gtx C) D {
+			return inset.Layout(gtx, material.Body2(th, msg).Layout)
+		}),
+		layout.Rigid(func(gtx C) D {
+			return inset.Layout(gtx, material.Button(th, &a.Undo, "undo").Layout)
+		}),
+	)
+}